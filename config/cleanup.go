@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StagingCleanup defines which staging images `gipgee staging cleanup` deletes. An image
+// is deleted if any of the configured policies matches.
+type StagingCleanup struct {
+	// MaxAge deletes staging images older than this, e.g. 14d or 72h
+	MaxAge *string `yaml:"maxAge,omitempty"`
+	// KeepLast deletes all but the newest n staging images of each image
+	KeepLast *int `yaml:"keepLast,omitempty"`
+	// DeleteMerged deletes staging images of commits that have been merged into the default branch
+	DeleteMerged bool `yaml:"deleteMerged,omitempty"`
+}
+
+// ParseAge parses a duration, additionally supporting days (e.g. 14d) which
+// time.ParseDuration doesn't support.
+func ParseAge(age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		count, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("'%s' is not a valid age (expected e.g. 14d or 72h)", age)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(age)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("'%s' is not a valid age (expected e.g. 14d or 72h)", age)
+	}
+	return duration, nil
+}
+
+func validateStagingCleanup(cleanup *StagingCleanup) error {
+	if cleanup.MaxAge == nil && cleanup.KeepLast == nil && !cleanup.DeleteMerged {
+		return fmt.Errorf("staging cleanup defines no policy (maxAge, keepLast or deleteMerged)")
+	}
+	if cleanup.MaxAge != nil {
+		if _, err := ParseAge(*cleanup.MaxAge); err != nil {
+			return fmt.Errorf("staging cleanup maxAge: %w", err)
+		}
+	}
+	if cleanup.KeepLast != nil && *cleanup.KeepLast < 1 {
+		return fmt.Errorf("staging cleanup keepLast must be at least 1, is %d", *cleanup.KeepLast)
+	}
+	return nil
+}
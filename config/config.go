@@ -3,14 +3,17 @@ package config
 import (
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/devfbe/gipgee/docker"
 	"github.com/devfbe/gipgee/git"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
 	yaml "gopkg.in/yaml.v3"
 )
 
@@ -21,6 +24,340 @@ type Credentials struct {
 	AuthFile        *string `yaml:"authFile"`
 }
 
+// SigningKey references a cosign key pair. Like the registry credentials, the key material
+// itself is never part of the configuration, only the names of the env vars containing it.
+type SigningKey struct {
+	PrivateKeyVarName *string `yaml:"privateKeyVarName"`
+	PasswordVarName   *string `yaml:"passwordVarName"`
+	PublicKeyVarName  *string `yaml:"publicKeyVarName"`
+}
+
+type Signing struct {
+	// Id of the signing key (see signingKeys) to sign the images with
+	Key *string `yaml:"key"`
+	// If true, the staging image digest is signed after the build and the signature is
+	// verified before the image gets released.
+	VerifyStagingImage bool `yaml:"verifyStagingImage"`
+	// Upload the signatures to the sigstore transparency log. Disabled by default because
+	// most private registries / images should not end up in a public log.
+	TransparencyLog bool `yaml:"transparencyLog"`
+}
+
+const (
+	SbomFormatCycloneDX = "cyclonedx"
+	SbomFormatSPDX      = "spdx"
+)
+
+type Sbom struct {
+	// Set to false to disable the SBOM generation for an image if it's enabled in the defaults
+	Enabled *bool `yaml:"enabled"`
+	// cyclonedx (default) or spdx
+	Format *string `yaml:"format"`
+}
+
+func (sbom *Sbom) IsEnabled() bool {
+	return sbom != nil && (sbom.Enabled == nil || *sbom.Enabled)
+}
+
+const (
+	ScanToolTrivy = "trivy"
+	ScanToolGrype = "grype"
+)
+
+type IgnoredVulnerability struct {
+	Id string `yaml:"id"`
+	// The ignore entry is not applied anymore after this date (YYYY-MM-DD)
+	Expires *string `yaml:"expires"`
+	Reason  *string `yaml:"reason"`
+}
+
+type VulnerabilityScan struct {
+	// Set to false to disable the scan for an image if it's enabled in the defaults
+	Enabled *bool `yaml:"enabled"`
+	// trivy (default) or grype
+	Tool *string `yaml:"tool"`
+	// Findings with this or a higher severity block the release (default: HIGH)
+	Severity *string `yaml:"severity"`
+	// Only block the release for findings that have a fix available
+	FixableOnly bool                   `yaml:"fixableOnly"`
+	Ignore      []IgnoredVulnerability `yaml:"ignore"`
+}
+
+func (scan *VulnerabilityScan) IsEnabled() bool {
+	return scan != nil && (scan.Enabled == nil || *scan.Enabled)
+}
+
+// Severities contains the supported vulnerability severities, ordered from lowest to highest.
+var Severities = []string{"UNKNOWN", "NEGLIGIBLE", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func (config *Config) validateVulnerabilityScan(imageId string, scan *VulnerabilityScan) error {
+	if scan.Tool == nil {
+		scan.Tool = &[]string{ScanToolTrivy}[0]
+	} else if *scan.Tool != ScanToolTrivy && *scan.Tool != ScanToolGrype {
+		return fmt.Errorf("vulnerability scan tool '%s' of image '%s' is not supported (supported tools: %s, %s)", *scan.Tool, imageId, ScanToolTrivy, ScanToolGrype)
+	}
+	if scan.Severity == nil {
+		scan.Severity = &[]string{"HIGH"}[0]
+	}
+	validSeverity := false
+	for _, severity := range Severities {
+		if strings.EqualFold(severity, *scan.Severity) {
+			scan.Severity = &[]string{severity}[0]
+			validSeverity = true
+		}
+	}
+	if !validSeverity {
+		return fmt.Errorf("vulnerability scan severity '%s' of image '%s' is not valid (valid severities: %s)", *scan.Severity, imageId, strings.Join(Severities, ", "))
+	}
+	for idx, ignored := range scan.Ignore {
+		if ignored.Id == "" {
+			return fmt.Errorf("ignored vulnerability %d of image '%s' has no id", idx, imageId)
+		}
+		if ignored.Expires != nil {
+			if _, err := time.Parse("2006-01-02", *ignored.Expires); err != nil {
+				return fmt.Errorf("ignored vulnerability '%s' of image '%s' has an invalid expiry date '%s' (expected format: YYYY-MM-DD)", ignored.Id, imageId, *ignored.Expires)
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	DefaultServiceAlias         = "staging-image"
+	DefaultServiceProbeTimeout  = "60s"
+	DefaultServiceProbeInterval = "2s"
+)
+
+// ServiceTest starts the staging image as gitlab service and probes it from a gipgee job.
+type ServiceTest struct {
+	Alias      *string                `yaml:"alias,omitempty"`
+	Entrypoint []string               `yaml:"entrypoint,omitempty"`
+	Command    []string               `yaml:"command,omitempty"`
+	Variables  map[string]interface{} `yaml:"variables,omitempty"`
+	Probes     []*ServiceProbe        `yaml:"probes"`
+}
+
+type ServiceProbe struct {
+	Name *string    `yaml:"name,omitempty"`
+	Tcp  *TcpProbe  `yaml:"tcp,omitempty"`
+	Http *HttpProbe `yaml:"http,omitempty"`
+	// Timeout is the overall time the probe waits for the service, e.g. 60s
+	Timeout *string `yaml:"timeout,omitempty"`
+	// Interval is the time between two attempts, e.g. 2s
+	Interval *string `yaml:"interval,omitempty"`
+	// Retries limits the number of attempts after the first one, unlimited (until the timeout) if not set
+	Retries *int `yaml:"retries,omitempty"`
+}
+
+type TcpProbe struct {
+	Host *string `yaml:"host,omitempty"` // defaults to the service alias
+	Port int     `yaml:"port"`
+}
+
+type HttpProbe struct {
+	Scheme         *string           `yaml:"scheme,omitempty"` // http (default) or https
+	Host           *string           `yaml:"host,omitempty"`   // defaults to the service alias
+	Port           int               `yaml:"port"`
+	Path           *string           `yaml:"path,omitempty"`
+	Method         *string           `yaml:"method,omitempty"`
+	Headers        map[string]string `yaml:"headers,omitempty"`
+	ExpectedStatus []int             `yaml:"expectedStatus,omitempty"` // defaults to [200]
+	ExpectedBody   *string           `yaml:"expectedBody,omitempty"`   // regular expression
+}
+
+func validateServiceTest(imageId string, serviceTest *ServiceTest) error {
+	if serviceTest.Alias == nil {
+		serviceTest.Alias = &[]string{DefaultServiceAlias}[0]
+	}
+	if len(serviceTest.Probes) == 0 {
+		return fmt.Errorf("service test of image '%s' has no probes", imageId)
+	}
+	for idx, probe := range serviceTest.Probes {
+		if probe.Name == nil {
+			probe.Name = &[]string{fmt.Sprintf("probe %d", idx)}[0]
+		}
+		if (probe.Tcp == nil) == (probe.Http == nil) {
+			return fmt.Errorf("service probe '%s' of image '%s' must define exactly one of tcp or http", *probe.Name, imageId)
+		}
+		if probe.Timeout == nil {
+			probe.Timeout = &[]string{DefaultServiceProbeTimeout}[0]
+		}
+		if probe.Interval == nil {
+			probe.Interval = &[]string{DefaultServiceProbeInterval}[0]
+		}
+		for _, duration := range []string{*probe.Timeout, *probe.Interval} {
+			if _, err := time.ParseDuration(duration); err != nil {
+				return fmt.Errorf("service probe '%s' of image '%s' has an invalid duration '%s': %w", *probe.Name, imageId, duration, err)
+			}
+		}
+		if probe.Retries != nil && *probe.Retries < 0 {
+			return fmt.Errorf("service probe '%s' of image '%s' must not have negative retries", *probe.Name, imageId)
+		}
+		if probe.Tcp != nil {
+			if probe.Tcp.Host == nil {
+				probe.Tcp.Host = serviceTest.Alias
+			}
+			if probe.Tcp.Port <= 0 || probe.Tcp.Port > 65535 {
+				return fmt.Errorf("tcp probe '%s' of image '%s' has an invalid port %d", *probe.Name, imageId, probe.Tcp.Port)
+			}
+		}
+		if probe.Http != nil {
+			if probe.Http.Host == nil {
+				probe.Http.Host = serviceTest.Alias
+			}
+			if probe.Http.Scheme == nil {
+				probe.Http.Scheme = &[]string{"http"}[0]
+			} else if *probe.Http.Scheme != "http" && *probe.Http.Scheme != "https" {
+				return fmt.Errorf("http probe '%s' of image '%s' has an invalid scheme '%s' (valid: http, https)", *probe.Name, imageId, *probe.Http.Scheme)
+			}
+			if probe.Http.Port <= 0 || probe.Http.Port > 65535 {
+				return fmt.Errorf("http probe '%s' of image '%s' has an invalid port %d", *probe.Name, imageId, probe.Http.Port)
+			}
+			if probe.Http.Path == nil {
+				probe.Http.Path = &[]string{"/"}[0]
+			}
+			if probe.Http.Method == nil {
+				probe.Http.Method = &[]string{"GET"}[0]
+			}
+			if len(probe.Http.ExpectedStatus) == 0 {
+				probe.Http.ExpectedStatus = []int{200}
+			}
+			if probe.Http.ExpectedBody != nil {
+				if _, err := regexp.Compile(*probe.Http.ExpectedBody); err != nil {
+					return fmt.Errorf("http probe '%s' of image '%s' has an invalid expectedBody regular expression: %w", *probe.Name, imageId, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// TestExecution controls how gipgee executes a test command inside the test job.
+type TestExecution struct {
+	// CommandTimeout terminates the test (including all child processes) after this duration, e.g. 10m
+	CommandTimeout *string `yaml:"commandTimeout,omitempty"`
+	// Retries is the number of times a failed test is executed again
+	Retries   int            `yaml:"retries,omitempty"`
+	ExitCodes *TestExitCodes `yaml:"exitCodes,omitempty"`
+}
+
+// TestExitCodes maps the exit codes of the test command to a test result. All exit codes
+// which are neither pass nor skip exit codes fail the test.
+type TestExitCodes struct {
+	Pass []int `yaml:"pass,omitempty"`
+	Skip []int `yaml:"skip,omitempty"`
+}
+
+func validateTestExecution(description string, execution *TestExecution) error {
+	if execution.CommandTimeout != nil {
+		if duration, err := time.ParseDuration(*execution.CommandTimeout); err != nil || duration <= 0 {
+			return fmt.Errorf("%s has an invalid command timeout '%s' (expected a positive duration like 10m)", description, *execution.CommandTimeout)
+		}
+	}
+	if execution.Retries < 0 {
+		return fmt.Errorf("%s must not have negative retries", description)
+	}
+	if execution.ExitCodes == nil {
+		execution.ExitCodes = &TestExitCodes{}
+	}
+	if len(execution.ExitCodes.Pass) == 0 {
+		execution.ExitCodes.Pass = []int{0}
+	}
+	for _, pass := range execution.ExitCodes.Pass {
+		for _, skip := range execution.ExitCodes.Skip {
+			if pass == skip {
+				return fmt.Errorf("%s maps exit code %d to pass and skip", description, pass)
+			}
+		}
+	}
+	return nil
+}
+
+// TestSuite is a named staging image test, each suite becomes a separate job.
+type TestSuite struct {
+	TestExecution `yaml:",inline"`
+	Command       []string               `yaml:"command"`
+	Variables     map[string]interface{} `yaml:"variables,omitempty"`
+	Tags          []string               `yaml:"tags,omitempty"`
+	Timeout       *string                `yaml:"timeout,omitempty"`
+	// If an image is given, the suite runs in this image and the staging image is started as service
+	Image        *string             `yaml:"image,omitempty"`
+	ServiceAlias *string             `yaml:"serviceAlias,omitempty"`
+	Artifacts    *TestSuiteArtifacts `yaml:"artifacts,omitempty"`
+	// Required suites must pass before the image is released (default: true)
+	Required *bool `yaml:"required,omitempty"`
+}
+
+type TestSuiteArtifacts struct {
+	Paths    []string     `yaml:"paths,omitempty"`
+	When     *string      `yaml:"when,omitempty"`
+	ExpireIn *string      `yaml:"expireIn,omitempty"`
+	ExposeAs *string      `yaml:"exposeAs,omitempty"`
+	Reports  *TestReports `yaml:"reports,omitempty"`
+}
+
+// TestReports are published as gitlab reports, e.g. junit reports show up in the test tab
+// of the pipeline and in the merge request widget.
+type TestReports struct {
+	Junit             []string `yaml:"junit,omitempty"`
+	Codequality       []string `yaml:"codequality,omitempty"`
+	ContainerScanning []string `yaml:"containerScanning,omitempty"`
+	Cyclonedx         []string `yaml:"cyclonedx,omitempty"`
+	Dotenv            *string  `yaml:"dotenv,omitempty"`
+}
+
+func validateTestArtifacts(description string, artifacts *TestSuiteArtifacts) error {
+	if artifacts.When != nil {
+		switch *artifacts.When {
+		case "on_success", "on_failure", "always":
+		default:
+			return fmt.Errorf("%s has invalid artifacts when '%s' (valid: on_success, on_failure, always)", description, *artifacts.When)
+		}
+	}
+	if artifacts.ExposeAs != nil && len(artifacts.Paths) == 0 {
+		return fmt.Errorf("%s exposes artifacts as '%s' but defines no artifact paths", description, *artifacts.ExposeAs)
+	}
+	return nil
+}
+
+func (suite *TestSuite) IsRequired() bool {
+	return suite.Required == nil || *suite.Required
+}
+
+func validateTestSuites(imageId string, suites map[string]*TestSuite) error {
+	// The suite name is rendered into the job names and the --suite argument of the test jobs,
+	// so it is restricted to the same characters as the image id.
+	validSuiteNameRegex := regexp.MustCompile(`^[0-9a-zA-Z-_.]+$`)
+	for name, suite := range suites {
+		if !validSuiteNameRegex.MatchString(name) {
+			return fmt.Errorf("test suite name '%s' of image '%s' doesn't match the regex '^[0-9a-zA-Z-_.]+$' (at least one valid char, valid chars: characters, digits, dash, dot, underscore)", name, imageId)
+		}
+		if suite == nil || len(suite.Command) == 0 {
+			return fmt.Errorf("test suite '%s' of image '%s' has no command", name, imageId)
+		}
+		if suite.Image != nil {
+			if _, err := pm.ContainerImageCoordinatesFromString(*suite.Image); err != nil {
+				return fmt.Errorf("test suite '%s' of image '%s' has an invalid image: %w", name, imageId, err)
+			}
+			if suite.ServiceAlias == nil {
+				suite.ServiceAlias = &[]string{DefaultServiceAlias}[0]
+			}
+		}
+		if suite.Image == nil && suite.ServiceAlias != nil {
+			return fmt.Errorf("test suite '%s' of image '%s' defines a service alias but no image, the staging image is only started as service if the suite runs in another image", name, imageId)
+		}
+		if err := validateTestExecution(fmt.Sprintf("test suite '%s' of image '%s'", name, imageId), &suite.TestExecution); err != nil {
+			return err
+		}
+		if suite.Artifacts != nil {
+			if err := validateTestArtifacts(fmt.Sprintf("test suite '%s' of image '%s'", name, imageId), suite.Artifacts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 type Quirks struct {
 	// see https://github.com/GoogleContainerTools/kaniko/issues/1297
 	KanikoMoveVarQuirk bool `yaml:"kanikoMoveVarQuirk"`
@@ -30,8 +367,54 @@ type Config struct {
 	Version             int                     `yaml:"version"`
 	Defaults            Defaults                `yaml:"defaults"`
 	RegistryCredentials map[string]*Credentials `yaml:"registryCredentials"`
+	SigningKeys         map[string]*SigningKey  `yaml:"signingKeys"`
 	Images              map[string]*Image       `yaml:"images"`
 	Quirks              Quirks                  `yaml:"quirks"`
+	StagingCleanup      *StagingCleanup         `yaml:"stagingCleanup,omitempty"`
+	Hooks               *Hooks                  `yaml:"hooks,omitempty"`
+	Sharding            *Sharding               `yaml:"sharding,omitempty"`
+	// SemverReleaseTags are the release tags of the git tag of a tag pipeline (including latest), see SemverReleaseTagsVarName
+	SemverReleaseTags []string `yaml:"-"`
+	// resolves the variables of credentials and signing keys, see SetVariableLookup
+	variableLookup func(name string) (string, bool)
+}
+
+// SetVariableLookup replaces the lookup of the environment variables the credentials and signing keys
+// refer to. This allows generating pipelines that resolve them at runtime, e.g. from github actions secrets.
+func (cfg *Config) SetVariableLookup(lookup func(name string) (string, bool)) {
+	cfg.variableLookup = lookup
+}
+
+func (cfg *Config) lookupVariable(name string) (string, bool) {
+	if cfg.variableLookup != nil {
+		return cfg.variableLookup(name)
+	}
+	return os.LookupEnv(name)
+}
+
+// VariableNames returns the sorted names of the environment variables the credentials and signing keys refer to.
+func (cfg *Config) VariableNames() []string {
+	names := make(map[string]bool)
+	for _, credential := range cfg.RegistryCredentials {
+		for _, name := range []*string{credential.UsernameVarName, credential.PasswordVarName} {
+			if name != nil {
+				names[*name] = true
+			}
+		}
+	}
+	for _, signingKey := range cfg.SigningKeys {
+		for _, name := range []*string{signingKey.PrivateKeyVarName, signingKey.PasswordVarName, signingKey.PublicKeyVarName} {
+			if name != nil {
+				names[*name] = true
+			}
+		}
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+	return sortedNames
 }
 
 type BuildArg struct {
@@ -40,16 +423,22 @@ type BuildArg struct {
 }
 
 type Defaults struct {
-	DefaultStagingRegistry            *string        `yaml:"defaultStagingRegistry,omitempty"`
-	DefaultReleaseRegistry            *string        `yaml:"defaultReleaseRegistry,omitempty"`
-	DefaultContainerFile              *string        `yaml:"defaultContainerFile,omitempty"`
-	DefaultStagingRegistryCredentials *string        `yaml:"defaultStagingRegistryCredentials,omitempty"`
-	DefaultReleaseRegistryCredentials *string        `yaml:"defaultReleaseRegistryCredentials"`
-	DefaultUpdateCheckCommand         *[]string      `yaml:"defaultUpdateCheckCommand,omitempty"`
-	DefaultTestCommand                *[]string      `yaml:"defaultTestCommand,omitempty"`
-	DefaultAssetsToWatch              *[]string      `yaml:"defaultAssetsToWatch,omitempty"`
-	DefaultBaseImage                  *ImageLocation `yaml:"defaultBaseImage,omitempty"`
-	DefaultBuildArgs                  *[]BuildArg    `yaml:"defaultBuildArgs,omitempty"`
+	DefaultStagingRegistry            *string            `yaml:"defaultStagingRegistry,omitempty"`
+	DefaultReleaseRegistry            *string            `yaml:"defaultReleaseRegistry,omitempty"`
+	DefaultContainerFile              *string            `yaml:"defaultContainerFile,omitempty"`
+	DefaultStagingRegistryCredentials *string            `yaml:"defaultStagingRegistryCredentials,omitempty"`
+	DefaultStagingRepositoryPrefix    *string            `yaml:"defaultStagingRepositoryPrefix,omitempty"`
+	DefaultReleaseRegistryCredentials *string            `yaml:"defaultReleaseRegistryCredentials"`
+	DefaultUpdateCheckCommand         *[]string          `yaml:"defaultUpdateCheckCommand,omitempty"`
+	DefaultTestCommand                *[]string          `yaml:"defaultTestCommand,omitempty"`
+	DefaultStructureTests             *string            `yaml:"defaultStructureTests,omitempty"`
+	DefaultAssetsToWatch              *[]string          `yaml:"defaultAssetsToWatch,omitempty"`
+	DefaultBaseImage                  *ImageLocation     `yaml:"defaultBaseImage,omitempty"`
+	DefaultBuildArgs                  *[]BuildArg        `yaml:"defaultBuildArgs,omitempty"`
+	DefaultSigning                    *Signing           `yaml:"defaultSigning,omitempty"`
+	DefaultSbom                       *Sbom              `yaml:"defaultSbom,omitempty"`
+	DefaultVulnerabilityScan          *VulnerabilityScan `yaml:"defaultVulnerabilityScan,omitempty"`
+	DefaultVulnerabilityUpdateCheck   *VulnerabilityScan `yaml:"defaultVulnerabilityUpdateCheck,omitempty"`
 }
 
 type ImageLocation struct {
@@ -57,6 +446,34 @@ type ImageLocation struct {
 	Repository  *string `yaml:"repository"`
 	Tag         *string `yaml:"tag"`
 	Credentials *string `yaml:"credentials"`
+	// Only allowed for base images
+	Verify *SignatureVerification `yaml:"verify,omitempty"`
+	// Only allowed for release locations
+	TagStrategy   *string `yaml:"tagStrategy,omitempty"`
+	ReleaseLatest bool    `yaml:"releaseLatest,omitempty"`
+	// ReleaseTags are the tags the image is released with, derived from the tag strategy
+	ReleaseTags []string `yaml:"-"`
+	// Only allowed for release locations
+	Retention *Retention `yaml:"retention,omitempty"`
+}
+
+// CertificateIdentity describes a trusted keyless (fulcio certificate based) signer.
+type CertificateIdentity struct {
+	Identity       *string `yaml:"identity"`
+	IdentityRegexp *string `yaml:"identityRegexp"`
+	Issuer         *string `yaml:"issuer"`
+	IssuerRegexp   *string `yaml:"issuerRegexp"`
+}
+
+// SignatureVerification lists the trusted signers of an image. The image is trusted if
+// at least one of the public keys or certificate identities has signed it.
+type SignatureVerification struct {
+	// Ids of signing keys (see signingKeys) with a public key
+	PublicKeys            []string              `yaml:"publicKeys"`
+	CertificateIdentities []CertificateIdentity `yaml:"certificateIdentities"`
+	// Require the key based signatures to be in the transparency log. Keyless
+	// signatures are always checked against the transparency log.
+	TransparencyLog bool `yaml:"transparencyLog"`
 }
 
 type UsernamePassword struct {
@@ -70,11 +487,11 @@ func (cfg *Config) GetUserNamePassword(credentialId string) (UsernamePassword, e
 		return UsernamePassword{}, fmt.Errorf("could not find registry credentials with id '%s'", credentialId)
 	}
 	if credential.PasswordVarName != nil && credential.UsernameVarName != nil {
-		userValue, userValueExists := os.LookupEnv(*credential.UsernameVarName)
+		userValue, userValueExists := cfg.lookupVariable(*credential.UsernameVarName)
 		if !userValueExists {
 			return UsernamePassword{}, fmt.Errorf("environment variable '%s' (for username of credential '%s') is not set", *credential.UsernameVarName, credentialId)
 		}
-		passwordValue, passwordValueExists := os.LookupEnv(*credential.PasswordVarName)
+		passwordValue, passwordValueExists := cfg.lookupVariable(*credential.PasswordVarName)
 		if !passwordValueExists {
 			return UsernamePassword{}, fmt.Errorf("environment variable '%s' (for password of credential '%s') is not set", *credential.PasswordVarName, credentialId)
 		}
@@ -84,9 +501,119 @@ func (cfg *Config) GetUserNamePassword(credentialId string) (UsernamePassword, e
 }
 
 func (loc *ImageLocation) String() string {
+	if loc.Tag == nil {
+		// only possible for release locations with the semver tag strategy
+		return fmt.Sprintf("%s/%s", *loc.Registry, *loc.Repository)
+	}
 	return fmt.Sprintf("%s/%s:%s", *loc.Registry, *loc.Repository, *loc.Tag)
 }
 
+// ReleaseReferences returns the references the image is released to at this location.
+func (loc *ImageLocation) ReleaseReferences() []string {
+	references := make([]string, len(loc.ReleaseTags))
+	for idx, tag := range loc.ReleaseTags {
+		references[idx] = fmt.Sprintf("%s/%s:%s", *loc.Registry, *loc.Repository, tag)
+	}
+	return references
+}
+
+// DigestReference returns the reference of the image with the given digest in the
+// registry and repository of this location (the tag is ignored).
+func (loc *ImageLocation) DigestReference(digest string) string {
+	return fmt.Sprintf("%s/%s@%s", *loc.Registry, *loc.Repository, digest)
+}
+
+type SigningPrivateKey struct {
+	PrivateKey string
+	Password   string
+}
+
+func (cfg *Config) lookupSigningKeyVar(varName *string, purpose string, signingKeyId string) (string, error) {
+	if varName == nil {
+		return "", fmt.Errorf("signing key '%s' has no %s env var configured", signingKeyId, purpose)
+	}
+	value, exists := cfg.lookupVariable(*varName)
+	if !exists {
+		return "", fmt.Errorf("environment variable '%s' (for %s of signing key '%s') is not set", *varName, purpose, signingKeyId)
+	}
+	return value, nil
+}
+
+// GetSigningPrivateKey returns the private key and (if configured) the key password of the given signing key.
+func (cfg *Config) GetSigningPrivateKey(signingKeyId string) (SigningPrivateKey, error) {
+	signingKey, exists := cfg.SigningKeys[signingKeyId]
+	if !exists {
+		return SigningPrivateKey{}, fmt.Errorf("could not find signing key with id '%s'", signingKeyId)
+	}
+	privateKey, err := cfg.lookupSigningKeyVar(signingKey.PrivateKeyVarName, "private key", signingKeyId)
+	if err != nil {
+		return SigningPrivateKey{}, err
+	}
+	key := SigningPrivateKey{PrivateKey: privateKey}
+	if signingKey.PasswordVarName != nil {
+		key.Password, err = cfg.lookupSigningKeyVar(signingKey.PasswordVarName, "password", signingKeyId)
+		if err != nil {
+			return SigningPrivateKey{}, err
+		}
+	}
+	return key, nil
+}
+
+// GetSigningPublicKey returns the public key of the given signing key.
+func (cfg *Config) GetSigningPublicKey(signingKeyId string) (string, error) {
+	signingKey, exists := cfg.SigningKeys[signingKeyId]
+	if !exists {
+		return "", fmt.Errorf("could not find signing key with id '%s'", signingKeyId)
+	}
+	return cfg.lookupSigningKeyVar(signingKey.PublicKeyVarName, "public key", signingKeyId)
+}
+
+// GetRegistryAuthMap collects the registry credentials of the given locations so that they
+// can be written to a docker config file for tools like cosign.
+func (cfg *Config) GetRegistryAuthMap(locations ...*ImageLocation) (map[string]docker.UsernamePassword, error) {
+	authMap := make(map[string]docker.UsernamePassword)
+	for _, location := range locations {
+		if location.Credentials == nil {
+			continue
+		}
+		up, err := cfg.GetUserNamePassword(*location.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		authMap[*location.Registry] = docker.UsernamePassword{
+			UserName: up.Username,
+			Password: up.Password,
+		}
+	}
+	return authMap, nil
+}
+
+// DefaultStagingRepository returns the per commit staging repository of the given git revision,
+// <defaultStagingRepositoryPrefix>/<git revision> or only the git revision without prefix.
+func (config *Config) DefaultStagingRepository(gitRevision string) string {
+	if config.Defaults.DefaultStagingRepositoryPrefix == nil {
+		return gitRevision
+	}
+	prefix := strings.Trim(*config.Defaults.DefaultStagingRepositoryPrefix, "/")
+	if prefix == "" {
+		return gitRevision
+	}
+	return prefix + "/" + gitRevision
+}
+
+// GetLocationCredentials returns the registry credentials of the location, nil if the location
+// has no credentials configured.
+func (cfg *Config) GetLocationCredentials(location *ImageLocation) (*docker.UsernamePassword, error) {
+	if location.Credentials == nil {
+		return nil, nil
+	}
+	up, err := cfg.GetUserNamePassword(*location.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	return &docker.UsernamePassword{UserName: up.Username, Password: up.Password}, nil
+}
+
 type Image struct {
 	Id                 string
 	ContainerFile      *string          `yaml:"containerFile,omitempty"`
@@ -95,14 +622,51 @@ type Image struct {
 	BaseImage          *ImageLocation   `yaml:"baseImage"`
 	UpdateCheckCommand *[]string        `yaml:"updateCheckCommand,omitempty"`
 	TestCommand        *[]string        `yaml:"testCommand,omitempty"`
-	AssetsToWatch      *[]string        `yaml:"assetsToWatch,omitempty"`
-	BuildArgs          *[]BuildArg      `yaml:"buildArgs,omitempty"`
+	// Artifacts, reports and execution settings of the test command job
+	TestArtifacts *TestSuiteArtifacts `yaml:"testArtifacts,omitempty"`
+	TestExecution *TestExecution      `yaml:"testExecution,omitempty"`
+	// Path to a container-structure-test compatible yaml file, executed by gipgee inside the staging image
+	StructureTests    *string               `yaml:"structureTests,omitempty"`
+	ServiceTest       *ServiceTest          `yaml:"serviceTest,omitempty"`
+	Tests             map[string]*TestSuite `yaml:"tests,omitempty"`
+	AssetsToWatch     *[]string             `yaml:"assetsToWatch,omitempty"`
+	BuildArgs         *[]BuildArg           `yaml:"buildArgs,omitempty"`
+	Signing           *Signing              `yaml:"signing,omitempty"`
+	Sbom              *Sbom                 `yaml:"sbom,omitempty"`
+	VulnerabilityScan *VulnerabilityScan    `yaml:"vulnerabilityScan,omitempty"`
+	// Scan the release images in the update check pipeline and rebuild them if fixable
+	// vulnerabilities are found (fixableOnly is implied, a rebuild doesn't help otherwise)
+	VulnerabilityUpdateCheck *VulnerabilityScan `yaml:"vulnerabilityUpdateCheck,omitempty"`
+	// Team and labels are used to group the images into child pipelines (see sharding)
+	Team   *string           `yaml:"team,omitempty"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+// TestSuiteNames returns the names of the test suites in a stable order.
+func (img Image) TestSuiteNames() []string {
+	names := make([]string, 0, len(img.Tests))
+	for name := range img.Tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (img Image) GetUpdateCheckResultFileName() string {
 	return fmt.Sprintf("/tmp/gipgee-%s-update-check.result", img.Id)
 }
 
+// ImageIds returns the sorted ids of all images. Generators iterate over them instead of
+// the images map, so that the generated pipelines don't change between runs.
+func (config *Config) ImageIds() []string {
+	imageIds := make([]string, 0, len(config.Images))
+	for imageId := range config.Images {
+		imageIds = append(imageIds, imageId)
+	}
+	sort.Strings(imageIds)
+	return imageIds
+}
+
 func LoadConfiguration(relativePath string) (*Config, error) {
 	bytes, err := os.ReadFile(filepath.Clean(relativePath))
 	if err != nil {
@@ -163,12 +727,6 @@ func (config *Config) fillConfigWithDefaultsAndValidate() error {
 			} else {
 				return errors.New("staging registry not defined for image " + imageId + " and no default defined")
 			}
-		} else {
-			if image.StagingLocation.Repository != nil && image.StagingLocation.Tag != nil {
-				log.Printf("Warning: you are using a fixed repository and tag for the staging image." +
-					" Please ensure that your gitlab runner uses 'always' as imagePullPolicy, otherwise you may get wrong test" +
-					" results if your cluster doesn't pull the new staging image\n")
-			}
 		}
 
 		if image.StagingLocation.Registry == nil {
@@ -180,16 +738,16 @@ func (config *Config) fillConfigWithDefaultsAndValidate() error {
 		}
 
 		if image.StagingLocation.Repository == nil {
-			image.StagingLocation.Repository = &[]string{git.GetCurrentGitRevisionHex()}[0]
+			image.StagingLocation.Repository = &[]string{config.DefaultStagingRepository(git.GetCurrentGitRevisionHex())}[0]
 		}
 
 		if image.StagingLocation.Tag == nil {
 			tagName := &[]string{imageId}[0]
 			gitRevision := git.GetCurrentGitRevisionHex()
-			// some gitlab instances might not use imagePullPolicy: always.
-			// That is a problem in the update checks, but at least for the staging
-			// locations we can work around by ensuring as unique names as possible for the
-			// staging image names. So, if someone explicitly defined the repository which can
+			// The test and release jobs reference the staging image by the digest kaniko
+			// reports, so the tag doesn't need to be unique for correctness. We still try to
+			// keep the staging tags as unique as possible so that the staging images of different
+			// commits can be told apart. So, if someone explicitly defined the repository which can
 			// be detected by checking if the git revision is not contained in the string, we
 			// append the first 7 chars of the git rev to the image id in the tag.
 			if !strings.Contains(*image.StagingLocation.Repository, gitRevision) {
@@ -217,6 +775,16 @@ func (config *Config) fillConfigWithDefaultsAndValidate() error {
 			if releaseLocation.Credentials == nil && config.Defaults.DefaultReleaseRegistryCredentials != nil {
 				releaseLocation.Credentials = config.Defaults.DefaultReleaseRegistryCredentials
 			}
+
+			if err := config.validateReleaseTags(imageId, idx, releaseLocation); err != nil {
+				return err
+			}
+
+			if releaseLocation.Retention != nil {
+				if err := validateRetention(imageId, idx, releaseLocation.Retention); err != nil {
+					return err
+				}
+			}
 		}
 
 		if (image.BaseImage == nil || image.BaseImage.Registry == nil || image.BaseImage.Repository == nil || image.BaseImage.Tag == nil) && config.Defaults.DefaultBaseImage == nil {
@@ -247,6 +815,34 @@ func (config *Config) fillConfigWithDefaultsAndValidate() error {
 			image.BaseImage.Credentials = config.Defaults.DefaultBaseImage.Credentials
 		}
 
+		if image.BaseImage.Verify == nil && config.Defaults.DefaultBaseImage != nil {
+			image.BaseImage.Verify = config.Defaults.DefaultBaseImage.Verify
+		}
+
+		if image.BaseImage.Verify != nil {
+			err := config.validateSignatureVerification(imageId, image.BaseImage.Verify)
+			if err != nil {
+				return err
+			}
+		}
+
+		if image.StagingLocation.Verify != nil {
+			return fmt.Errorf("image '%s' defines verify in the staging location, but verify is only allowed for base images", imageId)
+		}
+		for idx, releaseLocation := range image.ReleaseLocations {
+			if releaseLocation.Verify != nil {
+				return fmt.Errorf("image '%s' defines verify in release location %d, but verify is only allowed for base images", imageId, idx)
+			}
+		}
+		for name, location := range map[string]*ImageLocation{"base image": image.BaseImage, "staging location": image.StagingLocation} {
+			if location.TagStrategy != nil || location.ReleaseLatest {
+				return fmt.Errorf("image '%s' defines tagStrategy or releaseLatest in the %s, but they are only allowed for release locations", imageId, name)
+			}
+			if location.Retention != nil {
+				return fmt.Errorf("image '%s' defines retention in the %s, but retention is only allowed for release locations", imageId, name)
+			}
+		}
+
 		if image.UpdateCheckCommand == nil {
 			if config.Defaults.DefaultUpdateCheckCommand != nil {
 				image.UpdateCheckCommand = config.Defaults.DefaultUpdateCheckCommand
@@ -258,11 +854,46 @@ func (config *Config) fillConfigWithDefaultsAndValidate() error {
 		if image.TestCommand == nil {
 			if config.Defaults.DefaultTestCommand != nil {
 				image.TestCommand = config.Defaults.DefaultTestCommand
+			} else if len(image.Tests) > 0 {
+				// the test suites replace the single test command
+				image.TestCommand = &[]string{}
 			} else {
 				return errors.New("image test command not defined and no default given")
 			}
 		}
 
+		if image.StructureTests == nil && config.Defaults.DefaultStructureTests != nil {
+			image.StructureTests = config.Defaults.DefaultStructureTests
+		}
+
+		if image.StructureTests != nil && *image.StructureTests == "" {
+			return fmt.Errorf("structure tests of image '%s' must not be an empty path", imageId)
+		}
+
+		if image.TestArtifacts != nil {
+			if err := validateTestArtifacts(fmt.Sprintf("test command of image '%s'", imageId), image.TestArtifacts); err != nil {
+				return err
+			}
+		}
+
+		if image.TestExecution == nil {
+			image.TestExecution = &TestExecution{}
+		}
+		if err := validateTestExecution(fmt.Sprintf("test command of image '%s'", imageId), image.TestExecution); err != nil {
+			return err
+		}
+
+		if err := validateTestSuites(imageId, image.Tests); err != nil {
+			return err
+		}
+
+		if image.ServiceTest != nil {
+			err := validateServiceTest(imageId, image.ServiceTest)
+			if err != nil {
+				return err
+			}
+		}
+
 		if image.AssetsToWatch == nil {
 			if config.Defaults.DefaultAssetsToWatch != nil {
 				image.AssetsToWatch = config.Defaults.DefaultAssetsToWatch
@@ -276,6 +907,101 @@ func (config *Config) fillConfigWithDefaultsAndValidate() error {
 				image.BuildArgs = config.Defaults.DefaultBuildArgs
 			}
 		}
+
+		if image.Sbom == nil && config.Defaults.DefaultSbom != nil {
+			image.Sbom = config.Defaults.DefaultSbom
+		}
+
+		if image.Sbom != nil {
+			if image.Sbom.Format == nil {
+				image.Sbom.Format = &[]string{SbomFormatCycloneDX}[0]
+			} else if *image.Sbom.Format != SbomFormatCycloneDX && *image.Sbom.Format != SbomFormatSPDX {
+				return fmt.Errorf("sbom format '%s' of image '%s' is not supported (supported formats: %s, %s)", *image.Sbom.Format, imageId, SbomFormatCycloneDX, SbomFormatSPDX)
+			}
+		}
+
+		if image.VulnerabilityScan == nil && config.Defaults.DefaultVulnerabilityScan != nil {
+			image.VulnerabilityScan = config.Defaults.DefaultVulnerabilityScan
+		}
+
+		if image.VulnerabilityScan != nil {
+			err := config.validateVulnerabilityScan(imageId, image.VulnerabilityScan)
+			if err != nil {
+				return err
+			}
+		}
+
+		if image.VulnerabilityUpdateCheck == nil && config.Defaults.DefaultVulnerabilityUpdateCheck != nil {
+			image.VulnerabilityUpdateCheck = config.Defaults.DefaultVulnerabilityUpdateCheck
+		}
+
+		if image.VulnerabilityUpdateCheck != nil {
+			err := config.validateVulnerabilityScan(imageId, image.VulnerabilityUpdateCheck)
+			if err != nil {
+				return err
+			}
+			image.VulnerabilityUpdateCheck.FixableOnly = true
+		}
+
+		if image.Signing == nil && config.Defaults.DefaultSigning != nil {
+			image.Signing = config.Defaults.DefaultSigning
+		}
+
+		if image.Signing != nil {
+			if image.Signing.Key == nil {
+				return fmt.Errorf("signing configured for image '%s' but no signing key defined", imageId)
+			}
+			signingKey, exists := config.SigningKeys[*image.Signing.Key]
+			if !exists {
+				return fmt.Errorf("signing key '%s' of image '%s' is not defined in signingKeys", *image.Signing.Key, imageId)
+			}
+			if signingKey.PrivateKeyVarName == nil {
+				return fmt.Errorf("signing key '%s' of image '%s' has no privateKeyVarName", *image.Signing.Key, imageId)
+			}
+			if image.Signing.VerifyStagingImage && signingKey.PublicKeyVarName == nil {
+				return fmt.Errorf("image '%s' verifies the staging image signature but signing key '%s' has no publicKeyVarName", imageId, *image.Signing.Key)
+			}
+		}
+	}
+
+	if config.StagingCleanup != nil {
+		if err := validateStagingCleanup(config.StagingCleanup); err != nil {
+			return err
+		}
+	}
+	if config.Hooks != nil {
+		if err := config.validateHooks(); err != nil {
+			return err
+		}
+	}
+	if config.Sharding != nil {
+		if err := fillShardingWithDefaultsAndValidate(config.Sharding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (config *Config) validateSignatureVerification(imageId string, verify *SignatureVerification) error {
+	if len(verify.PublicKeys) == 0 && len(verify.CertificateIdentities) == 0 {
+		return fmt.Errorf("base image verification of image '%s' defines neither public keys nor certificate identities", imageId)
+	}
+	for _, keyId := range verify.PublicKeys {
+		signingKey, exists := config.SigningKeys[keyId]
+		if !exists {
+			return fmt.Errorf("base image verification of image '%s' references signing key '%s' which is not defined in signingKeys", imageId, keyId)
+		}
+		if signingKey.PublicKeyVarName == nil {
+			return fmt.Errorf("base image verification of image '%s' references signing key '%s' which has no publicKeyVarName", imageId, keyId)
+		}
+	}
+	for idx, identity := range verify.CertificateIdentities {
+		if identity.Identity == nil && identity.IdentityRegexp == nil {
+			return fmt.Errorf("certificate identity %d of the base image verification of image '%s' needs identity or identityRegexp", idx, imageId)
+		}
+		if identity.Issuer == nil && identity.IssuerRegexp == nil {
+			return fmt.Errorf("certificate identity %d of the base image verification of image '%s' needs issuer or issuerRegexp", idx, imageId)
+		}
 	}
 	return nil
 }
@@ -213,6 +213,18 @@ func TestDefaultValuesForStagingLocation(t *testing.T) {
 	assertStringEquals(*cfg.StagingLocation.Tag, cfg.Id, t)
 }
 
+func TestDefaultStagingRepositoryPrefix(t *testing.T) {
+	configString := strings.Replace(generateMinimalImageConfig("app"), "      repository: devfbe/gipgee-test\n    releaseLocations", "    releaseLocations", 1)
+	configString += "defaults:\n  defaultStagingRepositoryPrefix: gipgee/staging/\n"
+	c, err := loadConfigFromString(configString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the repository still contains the git revision, so the tag is the image id
+	assertStringEquals(*c.Images["app"].StagingLocation.Repository, "gipgee/staging/"+git.GetCurrentGitRevisionHex(), t)
+	assertStringEquals(*c.Images["app"].StagingLocation.Tag, "app", t)
+}
+
 func TestDefaults(t *testing.T) {
 	c, err := LoadConfiguration("testconfig.yml")
 
@@ -383,3 +395,324 @@ func TestImageMinimalConfigWithAllDefaults(t *testing.T) {
 		t.Errorf("imageWithoutDefaults does not exist, but is expected to exist")
 	}
 }
+
+func TestSigningConfig(t *testing.T) {
+	signingKeys := `
+signingKeys:
+  release:
+    privateKeyVarName: GIPGEE_TEST_COSIGN_KEY
+    passwordVarName: GIPGEE_TEST_COSIGN_PASSWORD
+  releaseWithoutPublicKey:
+    privateKeyVarName: GIPGEE_TEST_COSIGN_KEY
+defaults:
+  defaultSigning:
+    key: release
+`
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + signingKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStringEquals(*c.Images["foo"].Signing.Key, "release", t)
+	assertStringEquals(c.Images["foo"].ReleaseLocations[0].DigestReference("sha256:abc"), "docker.io/devfbe/gipgee-test@sha256:abc", t)
+
+	t.Setenv("GIPGEE_TEST_COSIGN_KEY", "privatekey")
+	_, err = c.GetSigningPrivateKey("release")
+	expectedErrorMessage := "environment variable 'GIPGEE_TEST_COSIGN_PASSWORD' (for password of signing key 'release') is not set"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+	t.Setenv("GIPGEE_TEST_COSIGN_PASSWORD", "password")
+	key, err := c.GetSigningPrivateKey("release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStringEquals(key.PrivateKey, "privatekey", t)
+	assertStringEquals(key.Password, "password", t)
+
+	_, err = c.GetSigningPublicKey("release")
+	expectedErrorMessage = "signing key 'release' has no public key env var configured"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + strings.Replace(signingKeys, "key: release", "key: doesnotexist", 1))
+	expectedErrorMessage = "signing key 'doesnotexist' of image 'foo' is not defined in signingKeys"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + signingKeys + "    verifyStagingImage: true\n")
+	if err == nil || err.Error() != "image 'foo' verifies the staging image signature but signing key 'release' has no publicKeyVarName" {
+		t.Errorf("unexpected error '%v'", err)
+	}
+}
+
+func TestBaseImageVerificationConfig(t *testing.T) {
+	verification := `
+signingKeys:
+  vendor:
+    publicKeyVarName: VENDOR_PUBLIC_KEY
+defaults:
+  defaultBaseImage:
+    verify:
+      publicKeys: [vendor]
+      certificateIdentities:
+        - identity: release@example.com
+          issuer: https://accounts.example.com
+`
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + verification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := c.Images["foo"].BaseImage.Verify
+	if verify == nil {
+		t.Fatal("base image verification is not inherited from the defaults")
+	}
+	stringSliceEquals(verify.PublicKeys, []string{"vendor"}, t)
+	assertStringEquals(*verify.CertificateIdentities[0].Identity, "release@example.com", t)
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + strings.Replace(verification, "publicKeys: [vendor]", "publicKeys: [unknown]", 1))
+	expectedErrorMessage := "base image verification of image 'foo' references signing key 'unknown' which is not defined in signingKeys"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + strings.Replace(verification, "issuer: https://accounts.example.com", "", 1))
+	expectedErrorMessage = "certificate identity 0 of the base image verification of image 'foo' needs issuer or issuerRegexp"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+}
+
+func TestSbomConfig(t *testing.T) {
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + `
+defaults:
+  defaultSbom: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Images["foo"].Sbom.IsEnabled() {
+		t.Error("sbom should be enabled by the defaults")
+	}
+	assertStringEquals(*c.Images["foo"].Sbom.Format, SbomFormatCycloneDX, t)
+
+	c, err = loadConfigFromString(generateMinimalImageConfig("foo") + `    sbom:
+      enabled: false
+defaults:
+  defaultSbom:
+    format: spdx
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Images["foo"].Sbom.IsEnabled() {
+		t.Error("sbom should be disabled for image foo")
+	}
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + `    sbom:
+      format: xml
+`)
+	expectedErrorMessage := "sbom format 'xml' of image 'foo' is not supported (supported formats: cyclonedx, spdx)"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+}
+
+func TestVulnerabilityScanConfig(t *testing.T) {
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + `    vulnerabilityScan:
+      severity: critical
+      ignore:
+        - id: CVE-2023-0001
+          expires: 2026-12-31
+          reason: not exploitable in our setup
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := c.Images["foo"].VulnerabilityScan
+	if !scan.IsEnabled() {
+		t.Error("vulnerability scan should be enabled")
+	}
+	assertStringEquals(*scan.Tool, ScanToolTrivy, t)
+	assertStringEquals(*scan.Severity, "CRITICAL", t)
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + `    vulnerabilityScan:
+      ignore:
+        - id: CVE-2023-0001
+          expires: 31.12.2026
+`)
+	expectedErrorMessage := "ignored vulnerability 'CVE-2023-0001' of image 'foo' has an invalid expiry date '31.12.2026' (expected format: YYYY-MM-DD)"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + `    vulnerabilityScan:
+      tool: clair
+`)
+	expectedErrorMessage = "vulnerability scan tool 'clair' of image 'foo' is not supported (supported tools: trivy, grype)"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+}
+
+func TestVulnerabilityUpdateCheckConfig(t *testing.T) {
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + `
+defaults:
+  defaultVulnerabilityUpdateCheck:
+    tool: grype
+    severity: critical
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateCheck := c.Images["foo"].VulnerabilityUpdateCheck
+	if !updateCheck.IsEnabled() {
+		t.Fatal("vulnerability update check should be enabled by the defaults")
+	}
+	if !updateCheck.FixableOnly {
+		t.Error("the vulnerability update check must only consider fixable vulnerabilities")
+	}
+	assertStringEquals(*updateCheck.Tool, ScanToolGrype, t)
+	assertStringEquals(*updateCheck.Severity, "CRITICAL", t)
+}
+
+func TestServiceTestConfig(t *testing.T) {
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + `    serviceTest:
+      alias: nginx
+      probes:
+        - tcp:
+            port: 80
+        - name: index
+          http:
+            port: 80
+            expectedBody: "Welcome to nginx"
+          timeout: 30s
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceTest := c.Images["foo"].ServiceTest
+	tcpProbe := serviceTest.Probes[0]
+	assertStringEquals(*tcpProbe.Name, "probe 0", t)
+	assertStringEquals(*tcpProbe.Tcp.Host, "nginx", t)
+	assertStringEquals(*tcpProbe.Timeout, DefaultServiceProbeTimeout, t)
+	httpProbe := serviceTest.Probes[1].Http
+	assertStringEquals(*httpProbe.Host, "nginx", t)
+	assertStringEquals(*httpProbe.Path, "/", t)
+	assertStringEquals(*serviceTest.Probes[1].Timeout, "30s", t)
+	if len(httpProbe.ExpectedStatus) != 1 || httpProbe.ExpectedStatus[0] != 200 {
+		t.Errorf("expected status should default to [200], is %v", httpProbe.ExpectedStatus)
+	}
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + `    serviceTest:
+      probes:
+        - name: both
+          tcp:
+            port: 80
+          http:
+            port: 80
+`)
+	expectedErrorMessage := "service probe 'both' of image 'foo' must define exactly one of tcp or http"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+}
+
+func TestTestSuitesConfig(t *testing.T) {
+	c, err := loadConfigFromString(strings.Replace(generateMinimalImageConfig("foo"), `    testCommand: ["./testImage.sh"]
+`, "", 1) + `    tests:
+      smoke:
+        command: ["./smoke.sh"]
+      integration:
+        command: ["pytest", "tests/integration"]
+        image: docker.io/library/python:3.11
+        tags: [docker]
+        timeout: 30m
+        required: false
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := c.Images["foo"]
+	if len(*image.TestCommand) != 0 {
+		t.Errorf("test command should be empty if only test suites are defined, is %v", *image.TestCommand)
+	}
+	stringSliceEquals(image.TestSuiteNames(), []string{"integration", "smoke"}, t)
+	if !image.Tests["smoke"].IsRequired() {
+		t.Error("test suites should be required by default")
+	}
+	if image.Tests["integration"].IsRequired() {
+		t.Error("test suite integration should not be required")
+	}
+	assertStringEquals(*image.Tests["integration"].ServiceAlias, DefaultServiceAlias, t)
+	assertNil(image.Tests["smoke"].ServiceAlias, t)
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + `    tests:
+      empty: {}
+`)
+	expectedErrorMessage := "test suite 'empty' of image 'foo' has no command"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+
+	for _, invalidName := range []string{`"smoke'; rm -rf /; '"`, `"smoke test"`, `"$CI_JOB_TOKEN"`, `""`} {
+		_, err = loadConfigFromString(generateMinimalImageConfig("foo") + "    tests:\n      " + invalidName + ":\n        command: [./smoke.sh]\n")
+		if err == nil || !strings.HasPrefix(err.Error(), "test suite name ") || !strings.Contains(err.Error(), "doesn't match the regex") {
+			t.Errorf("test suite name %s should be rejected, error is '%v'", invalidName, err)
+		}
+	}
+}
+
+func TestTestArtifactsConfig(t *testing.T) {
+	_, err := loadConfigFromString(generateMinimalImageConfig("foo") + `    testArtifacts:
+      exposeAs: test results
+      reports:
+        junit: [junit.xml]
+`)
+	expectedErrorMessage := "test command of image 'foo' exposes artifacts as 'test results' but defines no artifact paths"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + `    tests:
+      unit:
+        command: ["./unit.sh"]
+        artifacts:
+          expireIn: 1 week
+          reports:
+            junit: [unit.xml]
+            codequality: [codequality.json]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(c.Images["foo"].Tests["unit"].Artifacts.Reports.Junit, []string{"unit.xml"}, t)
+}
+
+func TestTestExecutionConfig(t *testing.T) {
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + `    testExecution:
+      commandTimeout: 10m
+      retries: 2
+      exitCodes:
+        skip: [77]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execution := c.Images["foo"].TestExecution
+	assertIntEquals(execution.Retries, 2, t)
+	if len(execution.ExitCodes.Pass) != 1 || execution.ExitCodes.Pass[0] != 0 {
+		t.Errorf("pass exit codes should default to [0], are %v", execution.ExitCodes.Pass)
+	}
+
+	_, err = loadConfigFromString(generateMinimalImageConfig("foo") + `    tests:
+      smoke:
+        command: ["./smoke.sh"]
+        commandTimeout: soon
+`)
+	expectedErrorMessage := "test suite 'smoke' of image 'foo' has an invalid command timeout 'soon' (expected a positive duration like 10m)"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+)
+
+// Points of the generated pipelines hook jobs are attached to
+const (
+	HookPointPreBuild        = "pre-build"         // before the staging image is built, after the base image verification
+	HookPointPostTest        = "post-test"         // after all tests passed, the release waits for the hook
+	HookPointPostRelease     = "post-release"      // after the image has been released (and signed)
+	HookPointPostUpdateCheck = "post-update-check" // after the update check decided which images are rebuilt
+)
+
+var validHookPoints = []string{HookPointPreBuild, HookPointPostTest, HookPointPostRelease, HookPointPostUpdateCheck}
+
+// Phases of the generated pipelines whose jobs can be extended
+const (
+	PhaseBuild       = "build"       // the kaniko build job
+	PhaseTest        = "test"        // test command, test suite, structure test and service test jobs
+	PhaseRelease     = "release"     // release, release signing and SBOM attachment jobs
+	PhaseUpdateCheck = "updateCheck" // skopeo, update check command and vulnerability update check jobs
+)
+
+var validPhases = []string{PhaseBuild, PhaseTest, PhaseRelease, PhaseUpdateCheck}
+
+// Hooks extends the generated pipelines with user defined jobs and scripts, e.g. for
+// notifications, compliance steps or a proxy / CA setup in the generated jobs.
+type Hooks struct {
+	Jobs   []*HookJob                 `yaml:"jobs,omitempty"`
+	Phases map[string]*PhaseExtension `yaml:"phases,omitempty"`
+}
+
+// HookJob is an additional job at a hook point. Jobs of the per image points (all but
+// post-update-check) are generated once per image, GIPGEE_IMAGE_ID contains the image id.
+type HookJob struct {
+	Name  *string `yaml:"name"`
+	Point *string `yaml:"point"`
+	// Images restricts the hook to these image ids, all images if not set
+	Images []string `yaml:"images,omitempty"`
+	// Image the job runs in, defaults to the gipgee image
+	Image        *string                `yaml:"image,omitempty"`
+	Script       []string               `yaml:"script"`
+	Variables    map[string]interface{} `yaml:"variables,omitempty"`
+	Tags         []string               `yaml:"tags,omitempty"`
+	AllowFailure bool                   `yaml:"allowFailure,omitempty"`
+}
+
+// PhaseExtension is added to all generated jobs of a phase. The before_script runs
+// before and the after_script after the gipgee commands of the jobs.
+type PhaseExtension struct {
+	BeforeScript []string               `yaml:"beforeScript,omitempty"`
+	AfterScript  []string               `yaml:"afterScript,omitempty"`
+	Variables    map[string]interface{} `yaml:"variables,omitempty"`
+}
+
+// AppliesTo returns true if the hook job is generated for the image.
+func (hook *HookJob) AppliesTo(imageId string) bool {
+	return len(hook.Images) == 0 || contains(hook.Images, imageId)
+}
+
+// GetHookJobs returns the hook jobs of the point in the configured order.
+func (config *Config) GetHookJobs(point string) []*HookJob {
+	hooks := make([]*HookJob, 0)
+	if config.Hooks == nil {
+		return hooks
+	}
+	for _, hook := range config.Hooks.Jobs {
+		if *hook.Point == point {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+// GetPhaseExtension returns the extension of the phase or nil.
+func (config *Config) GetPhaseExtension(phase string) *PhaseExtension {
+	if config.Hooks == nil {
+		return nil
+	}
+	return config.Hooks.Phases[phase]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateReservedVariables prevents overwriting the variables gipgee passes to its own commands.
+func validateReservedVariables(description string, variables map[string]interface{}) error {
+	for name := range variables {
+		if strings.HasPrefix(name, "GIPGEE_") {
+			return fmt.Errorf("%s must not define variable '%s', the GIPGEE_ prefix is reserved", description, name)
+		}
+	}
+	return nil
+}
+
+func (config *Config) validateHooks() error {
+	names := make(map[string]bool)
+	for idx, hook := range config.Hooks.Jobs {
+		if hook == nil || hook.Name == nil || *hook.Name == "" {
+			return fmt.Errorf("hook job %d has no name", idx)
+		}
+		if names[*hook.Name] {
+			return fmt.Errorf("hook job name '%s' is not unique", *hook.Name)
+		}
+		names[*hook.Name] = true
+		if hook.Point == nil || !contains(validHookPoints, *hook.Point) {
+			return fmt.Errorf("hook job '%s' needs a point (valid: %s)", *hook.Name, strings.Join(validHookPoints, ", "))
+		}
+		if len(hook.Script) == 0 {
+			return fmt.Errorf("hook job '%s' has no script", *hook.Name)
+		}
+		if *hook.Point == HookPointPostUpdateCheck && len(hook.Images) > 0 {
+			return fmt.Errorf("hook job '%s' runs once per update check and can't be restricted to images", *hook.Name)
+		}
+		for _, imageId := range hook.Images {
+			if _, exists := config.Images[imageId]; !exists {
+				return fmt.Errorf("hook job '%s' references image '%s' which does not exist", *hook.Name, imageId)
+			}
+		}
+		if hook.Image != nil {
+			if _, err := pm.ContainerImageCoordinatesFromString(*hook.Image); err != nil {
+				return fmt.Errorf("hook job '%s' has an invalid image: %w", *hook.Name, err)
+			}
+		}
+		if err := validateReservedVariables(fmt.Sprintf("hook job '%s'", *hook.Name), hook.Variables); err != nil {
+			return err
+		}
+	}
+	for phase, extension := range config.Hooks.Phases {
+		if !contains(validPhases, phase) {
+			return fmt.Errorf("phase '%s' is not valid (valid: %s)", phase, strings.Join(validPhases, ", "))
+		}
+		if extension == nil {
+			return fmt.Errorf("phase '%s' extension is empty", phase)
+		}
+		if err := validateReservedVariables(fmt.Sprintf("phase '%s'", phase), extension.Variables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewJob creates the pipeline job of the hook. The gipgee variables take precedence over the
+// hook variables, hooks without own image run in the default image of the pipeline (gipgee).
+func (hook *HookJob) NewJob(name string, stage *pm.Stage, gipgeeVariables map[string]interface{}) *pm.Job {
+	var image *pm.ContainerImageCoordinates
+	if hook.Image != nil {
+		coordinates, err := pm.ContainerImageCoordinatesFromString(*hook.Image)
+		if err != nil {
+			panic(err) // validated while loading the config
+		}
+		image = coordinates
+	}
+	variables := make(map[string]interface{}, len(hook.Variables)+len(gipgeeVariables))
+	for key, value := range hook.Variables {
+		variables[key] = value
+	}
+	for key, value := range gipgeeVariables {
+		variables[key] = value
+	}
+	job := pm.Job{
+		Name:   name,
+		Stage:  stage,
+		Image:  image,
+		Script: hook.Script,
+		Tags:   hook.Tags,
+	}
+	if len(variables) > 0 {
+		job.Variables = &variables
+	}
+	if hook.AllowFailure {
+		job.AllowFailure = &pm.JobAllowFailure{Allowed: &[]bool{true}[0]}
+	}
+	return &job
+}
+
+// ApplyTo extends the jobs with the before_script, after_script and variables of the phase.
+// Variables the jobs already define (gipgee or test suite variables) are not overwritten.
+func (extension *PhaseExtension) ApplyTo(jobs ...*pm.Job) {
+	if extension == nil {
+		return
+	}
+	for _, job := range jobs {
+		job.BeforeScript = append(append([]string{}, extension.BeforeScript...), job.BeforeScript...)
+		job.AfterScript = append(job.AfterScript, extension.AfterScript...)
+		if len(extension.Variables) == 0 {
+			continue
+		}
+		if job.Variables == nil {
+			job.Variables = &map[string]interface{}{}
+		}
+		for key, value := range extension.Variables {
+			if _, exists := (*job.Variables)[key]; !exists {
+				(*job.Variables)[key] = value
+			}
+		}
+	}
+}
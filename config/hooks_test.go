@@ -0,0 +1,57 @@
+package config
+
+import "testing"
+
+func TestHooksConfig(t *testing.T) {
+	c, err := loadConfigFromString(generateMinimalImageConfig("foo") + `hooks:
+  jobs:
+    - name: notify
+      point: post-release
+      script: ["./notify.sh"]
+    - name: compliance
+      point: pre-build
+      images: [foo]
+      image: docker.io/library/alpine:3.18
+      script: ["./compliance.sh"]
+  phases:
+    test:
+      beforeScript: ["./setup-proxy.sh"]
+      variables:
+        HTTPS_PROXY: http://proxy:3128
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preBuildHooks := c.GetHookJobs(HookPointPreBuild)
+	if len(preBuildHooks) != 1 || *preBuildHooks[0].Name != "compliance" {
+		t.Errorf("expected exactly the compliance pre-build hook, got %v", preBuildHooks)
+	}
+	if !preBuildHooks[0].AppliesTo("foo") || preBuildHooks[0].AppliesTo("bar") {
+		t.Error("compliance hook should only apply to image foo")
+	}
+	if len(c.GetHookJobs(HookPointPostTest)) != 0 {
+		t.Error("there should be no post-test hooks")
+	}
+	assertNil(c.GetPhaseExtension(PhaseBuild), t)
+	stringSliceEquals(c.GetPhaseExtension(PhaseTest).BeforeScript, []string{"./setup-proxy.sh"}, t)
+
+	for _, testCase := range []struct {
+		hooks           string
+		expectedMessage string
+	}{
+		{"  jobs:\n    - point: pre-build\n      script: [x]\n", "hook job 0 has no name"},
+		{"  jobs:\n    - name: a\n      point: pre-build\n      script: [x]\n    - name: a\n      point: post-test\n      script: [x]\n", "hook job name 'a' is not unique"},
+		{"  jobs:\n    - name: a\n      point: pre-test\n      script: [x]\n", "hook job 'a' needs a point (valid: pre-build, post-test, post-release, post-update-check)"},
+		{"  jobs:\n    - name: a\n      point: post-test\n", "hook job 'a' has no script"},
+		{"  jobs:\n    - name: a\n      point: post-update-check\n      images: [foo]\n      script: [x]\n", "hook job 'a' runs once per update check and can't be restricted to images"},
+		{"  jobs:\n    - name: a\n      point: post-test\n      images: [bar]\n      script: [x]\n", "hook job 'a' references image 'bar' which does not exist"},
+		{"  jobs:\n    - name: a\n      point: post-test\n      script: [x]\n      variables:\n        GIPGEE_IMAGE_ID: bar\n", "hook job 'a' must not define variable 'GIPGEE_IMAGE_ID', the GIPGEE_ prefix is reserved"},
+		{"  phases:\n    deploy:\n      beforeScript: [x]\n", "phase 'deploy' is not valid (valid: build, test, release, updateCheck)"},
+		{"  phases:\n    build:\n      variables:\n        GIPGEE_CONFIG_FILE_NAME: x\n", "phase 'build' must not define variable 'GIPGEE_CONFIG_FILE_NAME', the GIPGEE_ prefix is reserved"},
+	} {
+		_, err := loadConfigFromString(generateMinimalImageConfig("foo") + "hooks:\n" + testCase.hooks)
+		if err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("error is '%v' but should be '%s'", err, testCase.expectedMessage)
+		}
+	}
+}
@@ -10,3 +10,8 @@ var LinterImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afri
 var SecurityScannerImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afriserver.de:5000", Repository: "securego/gosec", Tag: "2.12.0"}
 var KanikoImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afriserver.de:5000", Repository: "kaniko-project/executor", Tag: "v1.13.0-debug"}
 var SkopeoImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afriserver.de:5000", Repository: "skopeo/stable", Tag: "v1.8.0"}
+var CosignImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afriserver.de:5000", Repository: "sigstore/cosign/cosign", Tag: "v2.2.0-dev"}
+var SyftImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afriserver.de:5000", Repository: "anchore/syft", Tag: "v0.98.0-debug"}
+var OrasImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afriserver.de:5000", Repository: "oras-project/oras", Tag: "v1.1.0"}
+var TrivyImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afriserver.de:5000", Repository: "aquasec/trivy", Tag: "0.47.0"}
+var GrypeImage = pm.ContainerImageCoordinates{Registry: "containerregistry.afriserver.de:5000", Repository: "anchore/grype", Tag: "v0.73.0-debug"}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Retention defines which tags of a release location `gipgee retention apply` deletes. Only
+// tags matching the pattern are affected. A matching tag is kept if it is one of the newest
+// keepLast tags, newer than keepNewerThan or currently referenced (the tags of the location).
+type Retention struct {
+	// Pattern is a regular expression the tags have to match, e.g. ^\d{8}-[0-9a-f]{7}$
+	Pattern       *string `yaml:"pattern"`
+	KeepLast      *int    `yaml:"keepLast,omitempty"`
+	KeepNewerThan *string `yaml:"keepNewerThan,omitempty"`
+}
+
+func validateRetention(imageId string, idx int, retention *Retention) error {
+	if retention.Pattern == nil || *retention.Pattern == "" {
+		return fmt.Errorf("retention of release location %d of image '%s' needs a pattern", idx, imageId)
+	}
+	if _, err := regexp.Compile(*retention.Pattern); err != nil {
+		return fmt.Errorf("retention pattern of release location %d of image '%s' is invalid: %w", idx, imageId, err)
+	}
+	if retention.KeepLast == nil && retention.KeepNewerThan == nil {
+		return fmt.Errorf("retention of release location %d of image '%s' needs keepLast or keepNewerThan", idx, imageId)
+	}
+	if retention.KeepLast != nil && *retention.KeepLast < 0 {
+		return fmt.Errorf("retention keepLast of release location %d of image '%s' must not be negative", idx, imageId)
+	}
+	if retention.KeepNewerThan != nil {
+		if _, err := ParseAge(*retention.KeepNewerThan); err != nil {
+			return fmt.Errorf("retention keepNewerThan of release location %d of image '%s': %w", idx, imageId, err)
+		}
+	}
+	return nil
+}
+
+// HasRetention returns true if any release location of any image defines a retention policy.
+func (config *Config) HasRetention() bool {
+	for _, image := range config.Images {
+		for _, location := range image.ReleaseLocations {
+			if location.Retention != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestRetentionConfig(t *testing.T) {
+	c, err := loadConfigFromString(withAdditionalReleaseLocation(generateMinimalImageConfig("foo"), `      - registry: docker.io
+        repository: devfbe/gipgee-test
+        tag: nightly
+        retention:
+          pattern: ^\d{8}$
+          keepLast: 5
+          keepNewerThan: 30d
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.HasRetention() {
+		t.Error("config should have a retention policy")
+	}
+	retention := c.Images["foo"].ReleaseLocations[1].Retention
+	assertStringEquals(*retention.Pattern, `^\d{8}$`, t)
+	assertIntEquals(*retention.KeepLast, 5, t)
+
+	for _, testCase := range []struct {
+		retention       string
+		expectedMessage string
+	}{
+		{"          keepLast: 5\n", "retention of release location 1 of image 'foo' needs a pattern"},
+		{"          pattern: '['\n          keepLast: 5\n", "retention pattern of release location 1 of image 'foo' is invalid: error parsing regexp: missing closing ]: `[`"},
+		{"          pattern: .*\n", "retention of release location 1 of image 'foo' needs keepLast or keepNewerThan"},
+		{"          pattern: .*\n          keepNewerThan: 1w\n", "retention keepNewerThan of release location 1 of image 'foo': '1w' is not a valid age (expected e.g. 14d or 72h)"},
+	} {
+		_, err := loadConfigFromString(withAdditionalReleaseLocation(generateMinimalImageConfig("foo"), `      - registry: docker.io
+        repository: devfbe/gipgee-test
+        tag: nightly
+        retention:
+`+testCase.retention))
+		if err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("error is '%v' but should be '%s'", err, testCase.expectedMessage)
+		}
+	}
+}
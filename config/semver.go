@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/devfbe/gipgee/git"
+)
+
+const (
+	// TagStrategyFixed releases the image with the configured tag.
+	TagStrategyFixed = "fixed"
+	// TagStrategySemver releases the image in tag pipelines with the tags derived from the
+	// semantic version of the git tag (1.4.2, 1.4, 1 and optionally latest).
+	TagStrategySemver = "semver"
+)
+
+// SemverReleaseTagsVarName passes the release tags the pipeline generator derived from the git tags to the
+// generated jobs. They usually run in shallow clones and would see other git tags than the generator.
+const SemverReleaseTagsVarName = "GIPGEE_SEMVER_RELEASE_TAGS"
+
+// from https://semver.org, extended by an optional v prefix
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+type SemanticVersion struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+func ParseSemanticVersion(version string) (*SemanticVersion, error) {
+	matches := semverRegexp.FindStringSubmatch(version)
+	if matches == nil {
+		return nil, fmt.Errorf("'%s' is not a valid semantic version (expected [v]MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD], e.g. v1.4.2)", version)
+	}
+	semver := SemanticVersion{Prerelease: matches[4], Build: matches[5]}
+	for idx, target := range []*int{&semver.Major, &semver.Minor, &semver.Patch} {
+		number, err := strconv.Atoi(matches[idx+1])
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid semantic version: %w", version, err)
+		}
+		*target = number
+	}
+	return &semver, nil
+}
+
+func (v *SemanticVersion) String() string {
+	version := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		version += "-" + v.Prerelease
+	}
+	// the build metadata is not part of the version string because
+	// + is not allowed in container image tags
+	return version
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Compare returns -1, 0 or 1 if v has a lower, the same or a higher precedence than other.
+func (v *SemanticVersion) Compare(other *SemanticVersion) int {
+	for _, c := range []int{compareInts(v.Major, other.Major), compareInts(v.Minor, other.Minor), compareInts(v.Patch, other.Patch)} {
+		if c != 0 {
+			return c
+		}
+	}
+	if v.Prerelease == other.Prerelease {
+		return 0
+	}
+	// a version without prerelease has a higher precedence than its prereleases
+	if v.Prerelease == "" {
+		return 1
+	}
+	if other.Prerelease == "" {
+		return -1
+	}
+	identifiers, otherIdentifiers := strings.Split(v.Prerelease, "."), strings.Split(other.Prerelease, ".")
+	for idx := 0; idx < len(identifiers) && idx < len(otherIdentifiers); idx++ {
+		a, aErr := strconv.Atoi(identifiers[idx])
+		b, bErr := strconv.Atoi(otherIdentifiers[idx])
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInts(a, b); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1 // numeric identifiers have a lower precedence
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(identifiers[idx], otherIdentifiers[idx]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(identifiers), len(otherIdentifiers))
+}
+
+// getSemverReleaseTags returns the image tags for the given git tag. The floating tags
+// (MAJOR.MINOR, MAJOR and optionally latest) are only moved if no other git tag has a higher
+// version in their range, so releasing a fix for an older version doesn't move them back.
+// Prereleases are only released with their full version. Git tags that are no semantic
+// versions are ignored.
+func getSemverReleaseTags(gitTag string, existingGitTags []string, latest bool) ([]string, error) {
+	version, err := ParseSemanticVersion(gitTag)
+	if err != nil {
+		return nil, fmt.Errorf("git tag '%s' cannot be released with tag strategy '%s': %w", gitTag, TagStrategySemver, err)
+	}
+	tags := []string{version.String()}
+	if version.Prerelease != "" {
+		return tags, nil
+	}
+	highestInMinor, highestInMajor, highest := true, true, true
+	for _, existingTag := range existingGitTags {
+		existingVersion, err := ParseSemanticVersion(existingTag)
+		if err != nil || existingVersion.Prerelease != "" || existingVersion.Compare(version) <= 0 {
+			continue
+		}
+		highest = false
+		if existingVersion.Major == version.Major {
+			highestInMajor = false
+			if existingVersion.Minor == version.Minor {
+				highestInMinor = false
+			}
+		}
+	}
+	if highestInMinor {
+		tags = append(tags, fmt.Sprintf("%d.%d", version.Major, version.Minor))
+	}
+	if highestInMajor {
+		tags = append(tags, strconv.Itoa(version.Major))
+	}
+	if latest && highest {
+		tags = append(tags, "latest")
+	}
+	return tags, nil
+}
+
+// semverReleaseTags returns the release tags (including latest) of the git tag. They are taken from
+// SemverReleaseTagsVarName if the generator passed them, otherwise they are derived from the git tags
+// of the clone, which must not be shallow.
+func (config *Config) semverReleaseTags(gitTag string) ([]string, error) {
+	if config.SemverReleaseTags != nil {
+		return config.SemverReleaseTags, nil
+	}
+	if value, exists := os.LookupEnv(SemverReleaseTagsVarName); exists && value != "" {
+		config.SemverReleaseTags = strings.Split(value, ",")
+		log.Printf("Using the release tags %v passed in %s\n", config.SemverReleaseTags, SemverReleaseTagsVarName)
+		return config.SemverReleaseTags, nil
+	}
+	releaseTags, err := getSemverReleaseTags(gitTag, git.GetTags(), true)
+	if err != nil {
+		return nil, err
+	}
+	config.SemverReleaseTags = releaseTags
+	return releaseTags, nil
+}
+
+// validateReleaseTags derives the release tags of the release location from its tag strategy.
+// Release locations with the semver strategy are only released in tag pipelines (CI_COMMIT_TAG).
+func (config *Config) validateReleaseTags(imageId string, idx int, location *ImageLocation) error {
+	if location.TagStrategy == nil {
+		location.TagStrategy = &[]string{TagStrategyFixed}[0]
+	}
+	switch *location.TagStrategy {
+	case TagStrategyFixed:
+		if location.ReleaseLatest {
+			return fmt.Errorf("release location %d of image '%s' sets releaseLatest, which is only supported by the tag strategy '%s'", idx, imageId, TagStrategySemver)
+		}
+		if location.Tag == nil {
+			return fmt.Errorf("tag not defined in release location %d for image %s", idx, imageId)
+		}
+		location.ReleaseTags = []string{*location.Tag}
+	case TagStrategySemver:
+		if location.Tag == nil && location.ReleaseLatest {
+			// used by the update check
+			location.Tag = &[]string{"latest"}[0]
+		}
+		gitTag, isTagPipeline := os.LookupEnv("CI_COMMIT_TAG")
+		if !isTagPipeline || gitTag == "" {
+			location.ReleaseTags = nil
+			return nil
+		}
+		semverReleaseTags, err := config.semverReleaseTags(gitTag)
+		if err != nil {
+			return fmt.Errorf("release location %d of image '%s': %w", idx, imageId, err)
+		}
+		releaseTags := make([]string, 0, len(semverReleaseTags))
+		for _, tag := range semverReleaseTags {
+			if tag != "latest" || location.ReleaseLatest {
+				releaseTags = append(releaseTags, tag)
+			}
+		}
+		log.Printf("Release location %d of image '%s' will be released with tags %v\n", idx, imageId, releaseTags)
+		location.ReleaseTags = releaseTags
+	default:
+		return fmt.Errorf("release location %d of image '%s' has an unknown tag strategy '%s' (valid: %s, %s)", idx, imageId, *location.TagStrategy, TagStrategyFixed, TagStrategySemver)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func withAdditionalReleaseLocation(config, location string) string {
+	return strings.Replace(config, "        tag: latest-integrationtest-a\n", "        tag: latest-integrationtest-a\n"+location, 1)
+}
+
+func TestParseSemanticVersion(t *testing.T) {
+	version, err := ParseSemanticVersion("v1.4.2-rc.1+build.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIntEquals(version.Major, 1, t)
+	assertIntEquals(version.Minor, 4, t)
+	assertIntEquals(version.Patch, 2, t)
+	assertStringEquals(version.Prerelease, "rc.1", t)
+	assertStringEquals(version.Build, "build.5", t)
+	assertStringEquals(version.String(), "1.4.2-rc.1", t)
+
+	for _, invalid := range []string{"1.4", "v1.4.2.1", "01.4.2", "release-1.4.2", "latest"} {
+		if _, err := ParseSemanticVersion(invalid); err == nil {
+			t.Errorf("'%s' should not be a valid semantic version", invalid)
+		}
+	}
+}
+
+func TestCompareSemanticVersions(t *testing.T) {
+	// ordered by precedence, see https://semver.org/#spec-item-11
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "2.0.0"}
+	for idx := 0; idx < len(ordered)-1; idx++ {
+		lower, _ := ParseSemanticVersion(ordered[idx])
+		higher, _ := ParseSemanticVersion(ordered[idx+1])
+		if lower.Compare(higher) != -1 || higher.Compare(lower) != 1 || lower.Compare(lower) != 0 {
+			t.Errorf("'%s' should have a lower precedence than '%s'", ordered[idx], ordered[idx+1])
+		}
+	}
+}
+
+func TestGetSemverReleaseTags(t *testing.T) {
+	existingTags := []string{"v1.3.0", "v1.4.0", "v1.4.1", "v2.0.0-rc.1", "not-a-version"}
+
+	tags, err := getSemverReleaseTags("v1.4.2", existingTags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(tags, []string{"1.4.2", "1.4", "1", "latest"}, t)
+
+	// fix for an older version must not move the floating tags of newer versions
+	tags, err = getSemverReleaseTags("v1.3.1", existingTags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(tags, []string{"1.3.1", "1.3"}, t)
+
+	tags, err = getSemverReleaseTags("v1.4.2", append(existingTags, "v2.0.0"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(tags, []string{"1.4.2", "1.4", "1"}, t)
+
+	tags, err = getSemverReleaseTags("v2.0.0-rc.2", existingTags, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(tags, []string{"2.0.0-rc.2"}, t)
+
+	_, err = getSemverReleaseTags("release-7", existingTags, true)
+	expectedErrorMessage := "git tag 'release-7' cannot be released with tag strategy 'semver': 'release-7' is not a valid semantic version (expected [v]MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD], e.g. v1.4.2)"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+}
+
+func TestSemverTagStrategyConfig(t *testing.T) {
+	semverConfig := withAdditionalReleaseLocation(generateMinimalImageConfig("foo"), `      - registry: docker.io
+        repository: devfbe/gipgee-test
+        tagStrategy: semver
+        releaseLatest: true
+`)
+	t.Setenv("CI_COMMIT_TAG", "")
+	c, err := loadConfigFromString(semverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(c.Images["foo"].ReleaseLocations[0].ReleaseTags, []string{"latest-integrationtest-a"}, t)
+	semverLocation := c.Images["foo"].ReleaseLocations[1]
+	if len(semverLocation.ReleaseTags) != 0 {
+		t.Errorf("semver release locations should not be released outside of tag pipelines, release tags are %v", semverLocation.ReleaseTags)
+	}
+	assertStringEquals(*semverLocation.Tag, "latest", t)
+
+	// the jobs use the release tags of the generator instead of the git tags of their shallow clone
+	t.Setenv("CI_COMMIT_TAG", "v1.4.2")
+	t.Setenv(SemverReleaseTagsVarName, "1.4.2,1.4,1,latest")
+	c, err = loadConfigFromString(withAdditionalReleaseLocation(semverConfig, `      - registry: docker.io
+        repository: devfbe/gipgee-test-versions
+        tagStrategy: semver
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(c.SemverReleaseTags, []string{"1.4.2", "1.4", "1", "latest"}, t)
+	stringSliceEquals(c.Images["foo"].ReleaseLocations[1].ReleaseTags, []string{"1.4.2", "1.4", "1"}, t)
+	stringSliceEquals(c.Images["foo"].ReleaseLocations[2].ReleaseTags, []string{"1.4.2", "1.4", "1", "latest"}, t)
+	t.Setenv(SemverReleaseTagsVarName, "")
+
+	t.Setenv("CI_COMMIT_TAG", "nightly")
+	_, err = loadConfigFromString(semverConfig)
+	if err == nil {
+		t.Error("expected error for git tag that is no semantic version")
+	}
+
+	_, err = loadConfigFromString(withAdditionalReleaseLocation(generateMinimalImageConfig("foo"), `      - registry: docker.io
+        repository: devfbe/gipgee-test
+        tagStrategy: calver
+`))
+	expectedErrorMessage := "release location 1 of image 'foo' has an unknown tag strategy 'calver' (valid: fixed, semver)"
+	if err == nil || err.Error() != expectedErrorMessage {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedErrorMessage)
+	}
+}
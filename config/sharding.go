@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Keys the images can be grouped by
+const (
+	GroupByNone   = "none"   // images are only split by the group size
+	GroupByLabel  = "label"  // value of the configured image label
+	GroupByTeam   = "team"   // team of the image
+	GroupByPrefix = "prefix" // image id up to the first prefix separator
+)
+
+var validGroupByKeys = []string{GroupByNone, GroupByLabel, GroupByTeam, GroupByPrefix}
+
+const (
+	DefaultGroupSize       = 25
+	DefaultPrefixSeparator = "-"
+	// images without label / team / prefix end up in this group
+	UngroupedImageGroupName = "ungrouped"
+)
+
+// Sharding splits the images into groups, each group is built (and rebuilt after the
+// update check) in its own child pipeline.
+type Sharding struct {
+	// GroupSize is the maximum number of images per group, larger groups are split
+	GroupSize       *int    `yaml:"groupSize,omitempty"`
+	GroupBy         *string `yaml:"groupBy,omitempty"`
+	Label           *string `yaml:"label,omitempty"`           // label name for groupBy label
+	PrefixSeparator *string `yaml:"prefixSeparator,omitempty"` // separator for groupBy prefix
+}
+
+// ImageGroup is a group of images sharing one child pipeline.
+type ImageGroup struct {
+	Name     string
+	ImageIds []string
+}
+
+var invalidGroupNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// groupChunkSeparator separates the key and the number of a split group. It is replaced in the keys
+// (see invalidGroupNameChars), so the name of a chunk never collides with the name of another key.
+const groupChunkSeparator = "+"
+
+func (sharding *Sharding) groupKey(image *Image) string {
+	switch *sharding.GroupBy {
+	case GroupByLabel:
+		return image.Labels[*sharding.Label]
+	case GroupByTeam:
+		if image.Team != nil {
+			return *image.Team
+		}
+	case GroupByPrefix:
+		if idx := strings.Index(image.Id, *sharding.PrefixSeparator); idx > 0 {
+			return image.Id[:idx]
+		}
+	}
+	return ""
+}
+
+// ImageGroups returns the image groups sorted by name, the images of each group are sorted, too.
+// The group names are safe to be used in job and file names.
+func (config *Config) ImageGroups() []*ImageGroup {
+	imageIdsByKey := make(map[string][]string)
+	for _, imageId := range config.ImageIds() {
+		key := UngroupedImageGroupName
+		if *config.Sharding.GroupBy == GroupByNone {
+			key = "group"
+		} else if groupKey := config.Sharding.groupKey(config.Images[imageId]); groupKey != "" {
+			key = invalidGroupNameChars.ReplaceAllString(groupKey, "_")
+		}
+		imageIdsByKey[key] = append(imageIdsByKey[key], imageId)
+	}
+	keys := make([]string, 0, len(imageIdsByKey))
+	for key := range imageIdsByKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	groupSize := *config.Sharding.GroupSize
+	groups := make([]*ImageGroup, 0)
+	for _, key := range keys {
+		imageIds := imageIdsByKey[key]
+		chunks := (len(imageIds) + groupSize - 1) / groupSize
+		for chunk := 0; chunk < chunks; chunk++ {
+			end := (chunk + 1) * groupSize
+			if end > len(imageIds) {
+				end = len(imageIds)
+			}
+			name := key
+			if chunks > 1 || *config.Sharding.GroupBy == GroupByNone {
+				name = fmt.Sprintf("%s%s%d", key, groupChunkSeparator, chunk+1)
+			}
+			groups = append(groups, &ImageGroup{Name: name, ImageIds: imageIds[chunk*groupSize : end]})
+		}
+	}
+	return groups
+}
+
+// GetImageGroup returns the group with the given name or nil.
+func (config *Config) GetImageGroup(name string) *ImageGroup {
+	for _, group := range config.ImageGroups() {
+		if group.Name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+// Filter returns the image ids of the group which are part of imageIds.
+func (group *ImageGroup) Filter(imageIds []string) []string {
+	filtered := make([]string, 0)
+	for _, imageId := range group.ImageIds {
+		if contains(imageIds, imageId) {
+			filtered = append(filtered, imageId)
+		}
+	}
+	return filtered
+}
+
+func fillShardingWithDefaultsAndValidate(sharding *Sharding) error {
+	if sharding.GroupSize == nil {
+		sharding.GroupSize = &[]int{DefaultGroupSize}[0]
+	}
+	if *sharding.GroupSize < 1 {
+		return fmt.Errorf("sharding groupSize must be at least 1, is %d", *sharding.GroupSize)
+	}
+	if sharding.GroupBy == nil {
+		sharding.GroupBy = &[]string{GroupByNone}[0]
+	}
+	if !contains(validGroupByKeys, *sharding.GroupBy) {
+		return fmt.Errorf("sharding groupBy '%s' is invalid (valid: %s)", *sharding.GroupBy, strings.Join(validGroupByKeys, ", "))
+	}
+	if (*sharding.GroupBy == GroupByLabel) != (sharding.Label != nil) {
+		return fmt.Errorf("sharding label must be set if and only if the images are grouped by label")
+	}
+	if sharding.PrefixSeparator == nil {
+		sharding.PrefixSeparator = &[]string{DefaultPrefixSeparator}[0]
+	}
+	if *sharding.PrefixSeparator == "" {
+		return fmt.Errorf("sharding prefixSeparator must not be empty")
+	}
+	return nil
+}
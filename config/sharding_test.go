@@ -0,0 +1,77 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func imageGroupNames(groups []*ImageGroup) []string {
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name+":"+strings.Join(group.ImageIds, ","))
+	}
+	return names
+}
+
+func TestImageGroups(t *testing.T) {
+	images := generateMinimalImageConfig("team-a-web") +
+		strings.Replace(generateMinimalImageConfig("team-a-db"), "version: 1\nimages:\n", "", 1) +
+		strings.Replace(generateMinimalImageConfig("team-b-api"), "version: 1\nimages:\n", "", 1) +
+		strings.Replace(generateMinimalImageConfig("base"), "version: 1\nimages:\n", "", 1)
+
+	for _, testCase := range []struct {
+		sharding       string
+		expectedGroups []string
+	}{
+		{"  groupSize: 3\n", []string{"group+1:base,team-a-db,team-a-web", "group+2:team-b-api"}},
+		{"  groupBy: prefix\n", []string{"team:team-a-db,team-a-web,team-b-api", "ungrouped:base"}},
+		{"  groupBy: prefix\n  groupSize: 2\n", []string{"team+1:team-a-db,team-a-web", "team+2:team-b-api", "ungrouped:base"}},
+	} {
+		c, err := loadConfigFromString(images + "sharding:\n" + testCase.sharding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stringSliceEquals(imageGroupNames(c.ImageGroups()), testCase.expectedGroups, t)
+	}
+
+	c, err := loadConfigFromString(strings.Replace(images, "  team-b-api:\n", "  team-b-api:\n    team: platform/api\n    labels:\n      tier: backend\n", 1) + "sharding:\n  groupBy: team\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(imageGroupNames(c.ImageGroups()), []string{"platform_api:team-b-api", "ungrouped:base,team-a-db,team-a-web"}, t)
+	c.Sharding.GroupBy = &[]string{GroupByLabel}[0]
+	c.Sharding.Label = &[]string{"tier"}[0]
+	stringSliceEquals(imageGroupNames(c.ImageGroups()), []string{"backend:team-b-api", "ungrouped:base,team-a-db,team-a-web"}, t)
+	if group := c.GetImageGroup("ungrouped"); group == nil || len(group.Filter([]string{"base", "team-b-api"})) != 1 {
+		t.Errorf("group ungrouped should only contain image base of the selection, group is %v", group)
+	}
+
+	// the chunks of a split group must not collide with a group whose key looks like a chunk name
+	teams := ""
+	for imageId, team := range map[string]string{"a": "web", "b": "web", "c": "web", "d": "web-1"} {
+		teams += strings.Replace(generateMinimalImageConfig(imageId), "version: 1\nimages:\n", "", 1) + "    team: " + team + "\n"
+	}
+	c, err = loadConfigFromString("version: 1\nimages:\n" + teams + "sharding:\n  groupBy: team\n  groupSize: 2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringSliceEquals(imageGroupNames(c.ImageGroups()), []string{"web+1:a,b", "web+2:c", "web-1:d"}, t)
+	if group := c.GetImageGroup("web-1"); group == nil || len(group.ImageIds) != 1 || group.ImageIds[0] != "d" {
+		t.Errorf("group web-1 should contain image d, group is %v", group)
+	}
+
+	for _, testCase := range []struct {
+		sharding        string
+		expectedMessage string
+	}{
+		{"  groupSize: 0\n", "sharding groupSize must be at least 1, is 0"},
+		{"  groupBy: owner\n", "sharding groupBy 'owner' is invalid (valid: none, label, team, prefix)"},
+		{"  groupBy: label\n", "sharding label must be set if and only if the images are grouped by label"},
+		{"  groupBy: prefix\n  prefixSeparator: ''\n", "sharding prefixSeparator must not be empty"},
+	} {
+		_, err := loadConfigFromString(generateMinimalImageConfig("foo") + "sharding:\n" + testCase.sharding)
+		if err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("error is '%v' but should be '%s'", err, testCase.expectedMessage)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 type DockerAuth struct {
@@ -74,3 +75,19 @@ func (da *DockerAuths) ToJsonString() string {
 	}
 	return string(jsonBytes)
 }
+
+// WriteTemporaryDockerConfig writes the given auths to a config.json in a new temporary
+// directory. The directory can be passed as DOCKER_CONFIG to tools like cosign that read
+// their registry credentials from the docker config. The caller has to remove the directory.
+func WriteTemporaryDockerConfig(authMap map[string]UsernamePassword) (string, error) {
+	dir, err := os.MkdirTemp("", "gipgee-docker-config")
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(filepath.Join(dir, "config.json"), []byte(CreateAuth(authMap)), 0600)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
@@ -0,0 +1,30 @@
+package docker
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// RunWithDockerConfig executes the given tool (e.g. cosign, syft or oras) with a temporary
+// docker config containing the given registry auths (passed as DOCKER_CONFIG). The additional
+// env vars are only set for the tool process. Stderr is passed through, stdout is returned.
+func RunWithDockerConfig(authMap map[string]UsernamePassword, additionalEnv map[string]string, name string, args ...string) ([]byte, error) {
+	dockerConfigDir, err := WriteTemporaryDockerConfig(authMap)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dockerConfigDir)
+	}()
+
+	log.Printf("Running '%s %s'\n", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...) // #nosec G204
+	cmd.Env = append(os.Environ(), "DOCKER_CONFIG="+dockerConfigDir)
+	for key, value := range additionalEnv {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
@@ -8,6 +8,7 @@ import (
 
 	git5 "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 func getGitRepository(workDir string) *git5.Repository {
@@ -96,3 +97,87 @@ func getChangedFiles(workDir string, localCiCommitSHA string, originBranchName s
 
 	return filesChanged
 }
+
+// GetTags returns the names of all tags of the repository. The repository must have
+// been cloned with tags (e.g. GIT_DEPTH set to 0), otherwise tags are missing.
+func GetTags() []string {
+	return getTags("")
+}
+
+func getTags(workDir string) []string {
+	repo := getGitRepository(workDir)
+	tagRefs, err := repo.Tags()
+	if err != nil {
+		panic(err)
+	}
+	tags := make([]string, 0)
+	err = tagRefs.ForEach(func(ref *plumbing.Reference) error {
+		tags = append(tags, ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return tags
+}
+
+// GetCommitsReachableFromBranch returns the hashes of all commits reachable from the
+// remote branch origin/<branchName> (falling back to the local branch). Like GetChangedFiles,
+// this requires a non shallow clone (GIT_DEPTH set to 0).
+func GetCommitsReachableFromBranch(branchName string) map[string]bool {
+	return getCommitsReachableFromBranch("", branchName)
+}
+
+func getCommitsReachableFromBranch(workDir string, branchName string) map[string]bool {
+	repo := getGitRepository(workDir)
+
+	branchRef, err := repo.Storer.Reference(plumbing.ReferenceName(fmt.Sprintf("refs/remotes/origin/%s", branchName)))
+	if err != nil {
+		log.Printf("Remote branch 'origin/%s' not found (%s), falling back to local branch\n", branchName, err.Error())
+		branchRef, err = repo.Storer.Reference(plumbing.NewBranchReferenceName(branchName))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	commits, err := repo.Log(&git5.LogOptions{From: branchRef.Hash()})
+	if err != nil {
+		panic(err)
+	}
+	reachable := make(map[string]bool)
+	err = commits.ForEach(func(c *object.Commit) error {
+		reachable[c.Hash.String()] = true
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return reachable
+}
+
+// GetChangedFilesBetweenCommits returns the files changed between the two commits. Unlike
+// GetChangedFiles it doesn't need a remote branch, but both commits must have been fetched.
+func GetChangedFilesBetweenCommits(baseSHA string, headSHA string) ([]string, error) {
+	return getChangedFilesBetweenCommits("", baseSHA, headSHA)
+}
+
+func getChangedFilesBetweenCommits(workDir string, baseSHA string, headSHA string) ([]string, error) {
+	repo := getGitRepository(workDir)
+	baseCommit, err := repo.CommitObject(plumbing.NewHash(baseSHA))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find base commit '%s': %w", baseSHA, err)
+	}
+	headCommit, err := repo.CommitObject(plumbing.NewHash(headSHA))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find head commit '%s': %w", headSHA, err)
+	}
+	patch, err := baseCommit.Patch(headCommit)
+	if err != nil {
+		return nil, err
+	}
+	filesChanged := make([]string, len(patch.Stats()))
+	for idx, stat := range patch.Stats() {
+		filesChanged[idx] = stat.Name
+	}
+	return filesChanged, nil
+}
@@ -132,3 +132,74 @@ func TestFilePathMatch(t *testing.T) {
 		t.Logf("%v matches: %v", v, m)
 	}
 }
+
+func TestGetTags(t *testing.T) {
+	tempGitDir := t.TempDir()
+	execWithPanicOnFail(tempGitDir, "git", []string{"init"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"config", "user.name", "unittest"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"config", "user.email", "unittest@localhost"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"commit", "--allow-empty", "-m", "initial"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"tag", "v1.0.0"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"tag", "-a", "v1.1.0", "-m", "annotated"}, t)
+
+	tags := getTags(tempGitDir)
+	expected := []string{"v1.0.0", "v1.1.0"}
+	less := func(a, b string) bool { return a < b }
+	if !cmp.Equal(tags, expected, cmpopts.SortSlices(less)) {
+		t.Errorf("tags '%v' don't match expected '%v'", tags, expected)
+	}
+}
+
+func TestGetCommitsReachableFromBranch(t *testing.T) {
+	tempGitDir := t.TempDir()
+	execWithPanicOnFail(tempGitDir, "git", []string{"init", "-b", "main"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"config", "user.name", "unittest"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"config", "user.email", "unittest@localhost"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"commit", "--allow-empty", "-m", "initial"}, t)
+	mainCommit := strings.TrimSpace(execWithPanicOnFail(tempGitDir, "git", []string{"rev-parse", "HEAD"}, t))
+	execWithPanicOnFail(tempGitDir, "git", []string{"checkout", "-b", "feature"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"commit", "--allow-empty", "-m", "feature"}, t)
+	featureCommit := strings.TrimSpace(execWithPanicOnFail(tempGitDir, "git", []string{"rev-parse", "HEAD"}, t))
+
+	reachable := getCommitsReachableFromBranch(tempGitDir, "main")
+	if !reachable[mainCommit] {
+		t.Errorf("commit '%s' of main should be reachable", mainCommit)
+	}
+	if reachable[featureCommit] {
+		t.Errorf("commit '%s' of the feature branch should not be reachable from main", featureCommit)
+	}
+}
+
+func TestGetChangedFilesBetweenCommits(t *testing.T) {
+	tempGitDir := t.TempDir()
+	execWithPanicOnFail(tempGitDir, "git", []string{"init"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"config", "user.name", "unittest"}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"config", "user.email", "unittest@localhost"}, t)
+	if err := os.WriteFile(filepath.Join(tempGitDir, "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	execWithPanicOnFail(tempGitDir, "git", []string{"add", "."}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"commit", "-m", "initial"}, t)
+	baseCommit := strings.TrimSpace(execWithPanicOnFail(tempGitDir, "git", []string{"rev-parse", "HEAD"}, t))
+	if err := os.MkdirAll(filepath.Join(tempGitDir, "images", "foo"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempGitDir, "images", "foo", "Containerfile"), []byte("FROM scratch"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	execWithPanicOnFail(tempGitDir, "git", []string{"add", "."}, t)
+	execWithPanicOnFail(tempGitDir, "git", []string{"commit", "-m", "add image"}, t)
+	headCommit := strings.TrimSpace(execWithPanicOnFail(tempGitDir, "git", []string{"rev-parse", "HEAD"}, t))
+
+	changedFiles, err := getChangedFilesBetweenCommits(tempGitDir, baseCommit, headCommit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(changedFiles, []string{"images/foo/Containerfile"}) {
+		t.Errorf("changed files '%v' don't match expected", changedFiles)
+	}
+
+	if _, err := getChangedFilesBetweenCommits(tempGitDir, "0000000000000000000000000000000000000000", headCommit); err == nil {
+		t.Error("expected error for unknown base commit")
+	}
+}
@@ -0,0 +1,63 @@
+package githubactions
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+type GithubActionsCmd struct {
+	GenerateWorkflows GenerateWorkflowsCmd `cmd:""`
+}
+
+type GenerateWorkflowsCmd struct {
+	ConfigFileName      string   `help:"Set the name of the gipgee config file" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
+	GipgeeImage         string   `help:"Overwrite the gipgee container image" env:"GIPGEE_OVERWRITE_GIPGEE_IMAGE" optional:""`
+	WorkflowDir         string   `help:"Directory of the workflows in the repository" default:".github/workflows"`
+	DefaultBranch       string   `help:"Branch the images are released from" default:"main"`
+	UpdateCheckSchedule string   `help:"Cron expression of the scheduled update check" default:"0 4 * * *"`
+	RunsOn              []string `help:"Runner labels of the jobs without tags" default:"ubuntu-latest"`
+}
+
+func (*GenerateWorkflowsCmd) Help() string {
+	return "Generates the github actions workflows (image build, release and update check) from the gipgee config. Commit the generated workflows and generate them again after changing the config"
+}
+
+func (cmd *GenerateWorkflowsCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	if _, exists := os.LookupEnv("DOCKER_AUTH_CONFIG"); exists {
+		// it's merged into the generated pipelines and would end up in the committed workflows
+		log.Println("Ignoring DOCKER_AUTH_CONFIG, the workflows use the registry credentials from the secrets")
+		if err := os.Unsetenv("DOCKER_AUTH_CONFIG"); err != nil {
+			return err
+		}
+	}
+	workflows, err := GenerateWorkflows(WorkflowParams{
+		Config:              config,
+		ConfigFileName:      cmd.ConfigFileName,
+		GipgeeImage:         cmd.GipgeeImage,
+		WorkflowDir:         cmd.WorkflowDir,
+		DefaultBranch:       cmd.DefaultBranch,
+		UpdateCheckSchedule: cmd.UpdateCheckSchedule,
+		RunsOn:              cmd.RunsOn,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(cmd.WorkflowDir, 0750); err != nil {
+		return err
+	}
+	for _, workflow := range workflows {
+		path := filepath.Join(cmd.WorkflowDir, workflow.FileName)
+		log.Printf("Writing github actions workflow '%s'\n", path)
+		if err := workflow.Pipeline.WriteRenderedPipelineToFile(workflow.Renderer, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
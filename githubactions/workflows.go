@@ -0,0 +1,152 @@
+package githubactions
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/git"
+	"github.com/devfbe/gipgee/imagebuild"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+	"github.com/devfbe/gipgee/updatecheck"
+)
+
+// File names of the generated workflows
+const (
+	BuildWorkflowFileName       = "gipgee-image-build.yml"
+	ReleaseWorkflowFileName     = "gipgee-image-release.yml"
+	UpdateCheckWorkflowFileName = "gipgee-update-check.yml"
+)
+
+type WorkflowParams struct {
+	Config         *config.Config
+	ConfigFileName string
+	GipgeeImage    string
+	// WorkflowDir is the directory of the workflows in the repository, the update check calls the release workflow from there
+	WorkflowDir         string
+	DefaultBranch       string
+	UpdateCheckSchedule string
+	RunsOn              []string
+}
+
+// Workflow is a generated workflow, the pipeline rendered with its github actions renderer.
+type Workflow struct {
+	FileName string
+	Pipeline *pm.Pipeline
+	Renderer *pm.GithubActionsRenderer
+}
+
+func (workflow *Workflow) Render() (string, error) {
+	return workflow.Renderer.Render(workflow.Pipeline)
+}
+
+// GenerateWorkflows generates the github actions workflows from the same config as the gitlab pipelines. Github can't
+// run generated workflows, so they are generated once and committed: the image build (without release) runs for
+// pushes to other branches, the release for pushes to the default branch and the update check is scheduled. Instead
+// of a generated child pipeline, the update check calls the release workflow with the ids of the images to rebuild.
+func GenerateWorkflows(params WorkflowParams) ([]*Workflow, error) {
+	cfg := params.Config
+	if cfg.Sharding != nil {
+		return nil, errors.New("sharding is not supported by the github actions workflows yet")
+	}
+	// the workflows are committed, so the credentials must not be resolved now but from the secrets at runtime
+	cfg.SetVariableLookup(func(name string) (string, bool) {
+		return secretExpression(name), true
+	})
+	// the default staging locations contain the revision the workflows are generated at, the jobs use the one they run for
+	revision := git.GetCurrentGitRevisionHex()
+	for _, imageId := range cfg.ImageIds() {
+		stagingLocation := cfg.Images[imageId].StagingLocation
+		for _, value := range []*string{stagingLocation.Repository, stagingLocation.Tag} {
+			*value = strings.ReplaceAll(strings.ReplaceAll(*value, revision, revisionExpression), revision[0:7], revisionExpression)
+		}
+	}
+	env := map[string]string{
+		"CI_DEFAULT_BRANCH": params.DefaultBranch,
+	}
+	for _, name := range cfg.VariableNames() {
+		env[name] = secretExpression(name)
+	}
+	newRenderer := func(name string, on pm.GithubActionsTriggers) *pm.GithubActionsRenderer {
+		return &pm.GithubActionsRenderer{
+			Name:   name,
+			On:     on,
+			RunsOn: params.RunsOn,
+			Env:    env,
+		}
+	}
+
+	buildWorkflow := &Workflow{
+		FileName: BuildWorkflowFileName,
+		Pipeline: imagebuild.NewBuildPipelineGenerator(cfg, cfg.ImageIds(), true, false, nil, "", params.ConfigFileName, params.GipgeeImage).GeneratePipeline(),
+		Renderer: newRenderer("gipgee image build", pm.GithubActionsTriggers{
+			PushBranchesIgnore: []string{params.DefaultBranch},
+			WorkflowDispatch:   true,
+		}),
+	}
+
+	releaseWorkflow := &Workflow{
+		FileName: ReleaseWorkflowFileName,
+		Pipeline: imagebuild.NewBuildPipelineGenerator(cfg, cfg.ImageIds(), true, true, nil, "", params.ConfigFileName, params.GipgeeImage).GeneratePipeline(),
+		Renderer: newRenderer("gipgee image release", pm.GithubActionsTriggers{
+			PushBranches:     []string{params.DefaultBranch},
+			WorkflowDispatch: true,
+			WorkflowCall:     true,
+			Inputs:           []string{updatecheck.RebuildImagesVarName},
+		}),
+	}
+	releaseWorkflow.Renderer.Conditions = imageJobConditions(cfg, params, releaseWorkflow.Pipeline)
+
+	updateCheckWorkflow := &Workflow{
+		FileName: UpdateCheckWorkflowFileName,
+		Pipeline: updatecheck.GeneratePipeline(updatecheck.PipelineParams{
+			GipgeeImage:     params.GipgeeImage,
+			Config:          cfg,
+			ConfigFileName:  params.ConfigFileName,
+			RebuildWorkflow: path.Join(params.WorkflowDir, ReleaseWorkflowFileName),
+		}),
+		Renderer: newRenderer("gipgee update check", pm.GithubActionsTriggers{
+			Schedules:        []string{params.UpdateCheckSchedule},
+			WorkflowDispatch: true,
+		}),
+	}
+	updateCheckWorkflow.Renderer.Outputs = map[string][]string{
+		updatecheck.RebuildSelectionJobName: {updatecheck.RebuildImagesOutputName},
+	}
+	updateCheckWorkflow.Renderer.Conditions = map[string]string{
+		// nothing to rebuild, nothing to release
+		updatecheck.RebuildTriggerJobName: fmt.Sprintf("needs.%s.outputs.%s != ''", pm.GithubActionsJobId(updatecheck.RebuildSelectionJobName), updatecheck.RebuildImagesOutputName),
+	}
+
+	return []*Workflow{buildWorkflow, releaseWorkflow, updateCheckWorkflow}, nil
+}
+
+const revisionExpression = "${{ github.sha }}"
+
+func secretExpression(name string) string {
+	return fmt.Sprintf("${{ secrets.%s }}", name)
+}
+
+// imageJobConditions restricts the jobs of each image to runs which select the image in the rebuild input (or
+// don't select images at all). The jobs of an image are those which are only generated if the image is built.
+func imageJobConditions(cfg *config.Config, params WorkflowParams, pipeline *pm.Pipeline) map[string]string {
+	imagesByJobName := make(map[string][]string)
+	for _, imageId := range cfg.ImageIds() {
+		imagePipeline := imagebuild.NewBuildPipelineGenerator(cfg, []string{imageId}, true, true, nil, "", params.ConfigFileName, params.GipgeeImage).GeneratePipeline()
+		for _, job := range imagePipeline.Jobs {
+			imagesByJobName[job.Name] = append(imagesByJobName[job.Name], imageId)
+		}
+	}
+	input := "inputs." + updatecheck.RebuildImagesVarName
+	conditions := make(map[string]string)
+	for _, job := range pipeline.Jobs {
+		imageIds := imagesByJobName[job.Name]
+		if len(imageIds) != 1 || strings.HasPrefix(job.Name, ".") {
+			continue
+		}
+		conditions[job.Name] = fmt.Sprintf("%s == '' || contains(format(',{0},', %s), ',%s,')", input, input, imageIds[0])
+	}
+	return conditions
+}
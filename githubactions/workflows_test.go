@@ -0,0 +1,70 @@
+package githubactions
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devfbe/gipgee/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+var updateGoldenFiles = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestWorkflowsGolden(t *testing.T) {
+	if value, exists := os.LookupEnv("DOCKER_AUTH_CONFIG"); exists {
+		os.Unsetenv("DOCKER_AUTH_CONFIG")
+		t.Cleanup(func() { os.Setenv("DOCKER_AUTH_CONFIG", value) })
+	}
+	cfg, err := config.LoadConfiguration("../config/testconfig.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workflows, err := GenerateWorkflows(WorkflowParams{
+		Config:              cfg,
+		ConfigFileName:      "gipgee.yml",
+		GipgeeImage:         "registry.example.com/gipgee:1.0.0",
+		WorkflowDir:         ".github/workflows",
+		DefaultBranch:       "main",
+		UpdateCheckSchedule: "0 4 * * *",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workflow := range workflows {
+		rendered, err := workflow.Render()
+		if err != nil {
+			t.Fatalf("%s: %v", workflow.FileName, err)
+		}
+		// the credentials are resolved from the secrets at runtime, they must never end up in the committed workflows
+		if strings.Contains(rendered, "DOCKER_AUTH_CONFIG") {
+			t.Errorf("%s contains DOCKER_AUTH_CONFIG", workflow.FileName)
+		}
+		goldenPath := filepath.Join("testdata", workflow.FileName)
+		if *updateGoldenFiles {
+			if err := os.WriteFile(goldenPath, []byte(rendered), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected, err := os.ReadFile(goldenPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(string(expected), rendered); diff != "" {
+			t.Errorf("rendered workflow doesn't match %s (run the tests with -update to accept the changes):\n%s", goldenPath, diff)
+		}
+	}
+}
+
+func TestShardingIsRejected(t *testing.T) {
+	cfg, err := config.LoadConfiguration("../config/testconfig.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Sharding = &config.Sharding{}
+	if _, err := GenerateWorkflows(WorkflowParams{Config: cfg}); err == nil {
+		t.Error("sharded configs must be rejected")
+	}
+}
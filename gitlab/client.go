@@ -0,0 +1,118 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client is a minimal client for the gitlab rest api v4 (https://docs.gitlab.com/ee/api/rest/).
+// The job token can't create notes, so a project or personal access token with the api scope is needed.
+type Client struct {
+	// ApiUrl is the url of the api, e.g. https://gitlab.com/api/v4 (CI_API_V4_URL)
+	ApiUrl     string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(apiUrl string, token string) *Client {
+	return &Client{
+		ApiUrl:     strings.TrimSuffix(apiUrl, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type Note struct {
+	Id   int    `json:"id"`
+	Body string `json:"body"`
+}
+
+func (client *Client) do(method string, path string, requestBody interface{}, responseBody interface{}) (*http.Response, error) {
+	var body io.Reader
+	if requestBody != nil {
+		requestJson, err := json.Marshal(requestBody)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(requestJson)
+	}
+	request, err := http.NewRequest(method, client.ApiUrl+path, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("PRIVATE-TOKEN", client.token)
+	if requestBody != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	responseBytes, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s failed with status %d: %s", method, path, response.StatusCode, strings.TrimSpace(string(responseBytes)))
+	}
+	if responseBody != nil {
+		if err := json.Unmarshal(responseBytes, responseBody); err != nil {
+			return nil, fmt.Errorf("cannot parse response of %s %s: %w", method, path, err)
+		}
+	}
+	return response, nil
+}
+
+func mergeRequestNotesPath(projectId string, mergeRequestIid string) string {
+	return fmt.Sprintf("/projects/%s/merge_requests/%s/notes", url.PathEscape(projectId), url.PathEscape(mergeRequestIid))
+}
+
+// ListMergeRequestNotes returns all notes of the merge request, following the api pagination.
+func (client *Client) ListMergeRequestNotes(projectId string, mergeRequestIid string) ([]*Note, error) {
+	notes := make([]*Note, 0)
+	page := "1"
+	for page != "" {
+		pageNotes := make([]*Note, 0)
+		response, err := client.do(http.MethodGet, fmt.Sprintf("%s?per_page=100&page=%s", mergeRequestNotesPath(projectId, mergeRequestIid), page), nil, &pageNotes)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, pageNotes...)
+		page = response.Header.Get("X-Next-Page")
+	}
+	return notes, nil
+}
+
+func (client *Client) CreateMergeRequestNote(projectId string, mergeRequestIid string, body string) (*Note, error) {
+	note := Note{}
+	_, err := client.do(http.MethodPost, mergeRequestNotesPath(projectId, mergeRequestIid), map[string]string{"body": body}, &note)
+	return &note, err
+}
+
+func (client *Client) UpdateMergeRequestNote(projectId string, mergeRequestIid string, noteId int, body string) (*Note, error) {
+	note := Note{}
+	_, err := client.do(http.MethodPut, fmt.Sprintf("%s/%d", mergeRequestNotesPath(projectId, mergeRequestIid), noteId), map[string]string{"body": body}, &note)
+	return &note, err
+}
+
+// UpsertMergeRequestNote updates the first note of the merge request containing the marker
+// or creates a new note if there is none. The marker is usually a html comment in the body.
+func (client *Client) UpsertMergeRequestNote(projectId string, mergeRequestIid string, marker string, body string) (*Note, error) {
+	notes, err := client.ListMergeRequestNotes(projectId, mergeRequestIid)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		if strings.Contains(note.Body, marker) {
+			return client.UpdateMergeRequestNote(projectId, mergeRequestIid, note.Id, body)
+		}
+	}
+	return client.CreateMergeRequestNote(projectId, mergeRequestIid, body)
+}
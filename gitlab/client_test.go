@@ -0,0 +1,95 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeNotesApi is a local stand-in for the merge request notes api of gitlab.
+type fakeNotesApi struct {
+	mutex    sync.Mutex
+	notes    []*Note
+	pageSize int
+	requests []string
+}
+
+func (api *fakeNotesApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.requests = append(api.requests, r.Method+" "+r.URL.EscapedPath())
+	if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	notesPath := "/api/v4/projects/group%2Fproject/merge_requests/7/notes"
+	switch {
+	case r.Method == http.MethodGet && r.URL.EscapedPath() == notesPath:
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start := (page - 1) * api.pageSize
+		end := start + api.pageSize
+		if end < len(api.notes) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		} else {
+			end = len(api.notes)
+		}
+		_ = json.NewEncoder(w).Encode(api.notes[start:end])
+	case r.Method == http.MethodPost && r.URL.EscapedPath() == notesPath:
+		note := Note{}
+		_ = json.NewDecoder(r.Body).Decode(&note)
+		note.Id = 100 + len(api.notes)
+		api.notes = append(api.notes, &note)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(note)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.EscapedPath(), notesPath+"/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.EscapedPath(), notesPath+"/"))
+		for _, note := range api.notes {
+			if note.Id == id {
+				_ = json.NewDecoder(r.Body).Decode(note)
+				note.Id = id
+				_ = json.NewEncoder(w).Encode(note)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestUpsertMergeRequestNote(t *testing.T) {
+	api := &fakeNotesApi{pageSize: 2, notes: []*Note{{Id: 1, Body: "lgtm"}, {Id: 2, Body: "nit"}, {Id: 3, Body: "thanks"}}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	client := NewClient(server.URL+"/api/v4/", "secret")
+
+	note, err := client.UpsertMergeRequestNote("group/project", "7", "<!-- marker -->", "<!-- marker -->\nfirst plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Id != 103 || len(api.notes) != 4 {
+		t.Errorf("expected new note with id 103, got id %d and %d notes", note.Id, len(api.notes))
+	}
+
+	note, err = client.UpsertMergeRequestNote("group/project", "7", "<!-- marker -->", "<!-- marker -->\nsecond plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Id != 103 || len(api.notes) != 4 || api.notes[3].Body != "<!-- marker -->\nsecond plan" {
+		t.Errorf("expected updated note 103, got id %d, %d notes and body '%s'", note.Id, len(api.notes), api.notes[3].Body)
+	}
+	lastRequest := api.requests[len(api.requests)-1]
+	if lastRequest != "PUT /api/v4/projects/group%2Fproject/merge_requests/7/notes/103" {
+		t.Errorf("unexpected last request '%s'", lastRequest)
+	}
+
+	_, err = NewClient(server.URL+"/api/v4", "wrong").ListMergeRequestNotes("group/project", "7")
+	expectedMessage := "GET /projects/group%2Fproject/merge_requests/7/notes?per_page=100&page=1 failed with status 401"
+	if err == nil || !strings.HasPrefix(err.Error(), expectedMessage) {
+		t.Errorf("error is '%v' but should start with '%s'", err, expectedMessage)
+	}
+}
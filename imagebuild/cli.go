@@ -1,16 +1,24 @@
 package imagebuild
 
 import (
-	"os"
-	"os/exec"
+	"fmt"
 
 	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/probe"
+	"github.com/devfbe/gipgee/signing"
+	"github.com/devfbe/gipgee/structuretest"
 )
 
 type ImageBuildCmd struct {
-	GenerateKanikoAuth   GenerateKanikoAuthCmd   `cmd:""`
-	GeneratePipeline     GeneratePipelineCmd     `cmd:""`
-	ExecStagingImageTest ExecStagingImageTestCmd `cmd:""`
+	GenerateKanikoAuth      GenerateKanikoAuthCmd              `cmd:""`
+	GeneratePipeline        GeneratePipelineCmd                `cmd:""`
+	GenerateGroupPipeline   GenerateGroupPipelineCmd           `cmd:""`
+	ExecStagingImageTest    ExecStagingImageTestCmd            `cmd:""`
+	ExecStructureTest       structuretest.ExecStructureTestCmd `cmd:""`
+	ExecServiceProbe        probe.ExecServiceProbeCmd          `cmd:""`
+	VerifyBaseImage         signing.VerifyBaseImageCmd         `cmd:""`
+	WriteReleaseMetadata    WriteReleaseMetadataCmd            `cmd:""`
+	CommentMergeRequestPlan CommentMergeRequestPlanCmd         `cmd:""`
 }
 
 type GeneratePipelineCmd struct {
@@ -36,6 +44,7 @@ func (*GenerateKanikoAuthCmd) Help() string {
 type ExecStagingImageTestCmd struct {
 	ImageId        string `arg:""`
 	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	Suite          string `help:"Execute the given test suite instead of the test command" optional:""`
 }
 
 func (cmd *ExecStagingImageTestCmd) Run() error {
@@ -43,16 +52,32 @@ func (cmd *ExecStagingImageTestCmd) Run() error {
 	if err != nil {
 		panic(err)
 	}
-	imageTestCommand := config.Images[cmd.ImageId].TestCommand
-	commandString := (*imageTestCommand)[0]
-	commandArgsString := make([]string, 0)
-	if len(*imageTestCommand) > 1 {
-		commandArgsString = append(commandArgsString, (*imageTestCommand)[1:]...)
+	imageConfig, exists := config.Images[cmd.ImageId]
+	if !exists {
+		return fmt.Errorf("image '%s' does not exist in config", cmd.ImageId)
 	}
-	commandArgsString = append(commandArgsString, cmd.ImageId)
-	executionCmd := exec.Command(commandString, commandArgsString...) // #nosec G204
-	executionCmd.Stderr = os.Stderr
-	executionCmd.Stdout = os.Stdout
-	err = executionCmd.Run()
-	return err
+	imageTestCommand := *imageConfig.TestCommand
+	execution := imageConfig.TestExecution
+	if cmd.Suite != "" {
+		suite, exists := imageConfig.Tests[cmd.Suite]
+		if !exists {
+			return fmt.Errorf("test suite '%s' does not exist for image '%s'", cmd.Suite, cmd.ImageId)
+		}
+		imageTestCommand = suite.Command
+		execution = &suite.TestExecution
+	}
+	if len(imageTestCommand) == 0 {
+		return fmt.Errorf("no test command defined for image '%s'", cmd.ImageId)
+	}
+	outcome, err := executeStagingImageTest(imageConfig, cmd.Suite, imageTestCommand, execution)
+	if err != nil {
+		return err
+	}
+	switch outcome {
+	case testSkipped:
+		return &ExitCodeError{Code: SkippedTestExitCode, Message: fmt.Sprintf("test of image '%s' skipped", cmd.ImageId)}
+	case testFailed:
+		return fmt.Errorf("test of image '%s' failed", cmd.ImageId)
+	}
+	return nil
 }
@@ -0,0 +1,86 @@
+package imagebuild
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+	"github.com/google/go-cmp/cmp"
+)
+
+var updateGoldenFiles = flag.Bool("update", false, "update the golden files in testdata")
+
+// unsetEnv removes the variable for the duration of the test, t.Setenv can only set variables.
+func unsetEnv(t *testing.T, name string) {
+	value, exists := os.LookupEnv(name)
+	os.Unsetenv(name)
+	if exists {
+		t.Cleanup(func() { os.Setenv(name, value) })
+	}
+}
+
+func mustRender(t *testing.T, pipeline *pm.Pipeline) string {
+	rendered, err := pipeline.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rendered
+}
+
+func assertGolden(t *testing.T, goldenFile string, rendered string) {
+	goldenPath := filepath.Join("testdata", goldenFile)
+	if *updateGoldenFiles {
+		if err := os.WriteFile(goldenPath, []byte(rendered), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(expected), rendered); diff != "" {
+		t.Errorf("rendered pipeline doesn't match %s (run the tests with -update to accept the changes):\n%s", goldenPath, diff)
+	}
+	// parsing the rendered pipeline must result in the same pipeline
+	parsed, err := pm.ParsePipeline([]byte(rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(rendered, mustRender(t, parsed)); diff != "" {
+		t.Errorf("parsed pipeline renders differently:\n%s", diff)
+	}
+}
+
+func TestBuildPipelineGolden(t *testing.T) {
+	unsetEnv(t, "DOCKER_AUTH_CONFIG")
+	t.Setenv("CI_COMMIT_TAG", "")
+	config := loadTestConfig(t)
+	// all images of the config, so the golden files break if the images are not iterated sorted by id
+	imagesToBuild := config.ImageIds()
+	if len(imagesToBuild) < 2 {
+		t.Fatalf("the test config must contain at least two images, contains %v", imagesToBuild)
+	}
+
+	for _, testCase := range []struct {
+		goldenFile   string
+		autoStart    bool
+		release      bool
+		mergeRequest *MergeRequest
+	}{
+		{"build-pipeline-release.yml", true, true, nil},
+		{"build-pipeline-manual.yml", false, true, nil},
+		{"build-pipeline-merge-request.yml", true, false, &MergeRequest{Iid: "42", DiffBaseSha: "0123456789abcdef0123456789abcdef01234567"}},
+	} {
+		t.Run(testCase.goldenFile, func(t *testing.T) {
+			generator := NewBuildPipelineGenerator(config, imagesToBuild, testCase.autoStart, testCase.release, testCase.mergeRequest, ".gipgee-gitlab-ci.yml", "gipgee.yml", "registry.example.com/gipgee:1.0.0")
+			first := mustRender(t, generator.GeneratePipeline())
+			// a second generation must render exactly the same pipeline
+			if second := mustRender(t, generator.GeneratePipeline()); first != second {
+				t.Errorf("rendering is not deterministic:\n%s", cmp.Diff(first, second))
+			}
+			assertGolden(t, testCase.goldenFile, first)
+		})
+	}
+}
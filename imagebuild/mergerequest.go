@@ -0,0 +1,155 @@
+package imagebuild
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	c "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/git"
+	"github.com/devfbe/gipgee/gitlab"
+	zglob "github.com/mattn/go-zglob"
+)
+
+// MergeRequestPlanNoteMarker identifies the plan note, so that later pipelines of the merge request update it.
+const MergeRequestPlanNoteMarker = "<!-- gipgee-merge-request-plan -->"
+
+// MergeRequest identifies the merge request of a merge request pipeline. The predefined
+// CI_MERGE_REQUEST_* variables are not available in child pipelines, so the generator
+// passes them to the plan job.
+type MergeRequest struct {
+	Iid         string
+	DiffBaseSha string
+}
+
+// MergeRequestFromEnv returns the merge request of the current pipeline or nil if
+// the pipeline is no merge request pipeline.
+func MergeRequestFromEnv() *MergeRequest {
+	if os.Getenv("CI_PIPELINE_SOURCE") != "merge_request_event" {
+		return nil
+	}
+	return &MergeRequest{
+		Iid:         os.Getenv("CI_MERGE_REQUEST_IID"),
+		DiffBaseSha: os.Getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA"),
+	}
+}
+
+type plannedImage struct {
+	ImageId          string
+	Reasons          []string
+	StagingReference string
+}
+
+// getMergeRequestPlan explains why the images are built. Merge request pipelines build all images,
+// the reasons tell which of them are affected by the changes. changedFiles is nil if the changes are unknown.
+func getMergeRequestPlan(config *c.Config, configFile string, imagesToBuild []string, changedFiles []string) []*plannedImage {
+	plan := make([]*plannedImage, 0, len(imagesToBuild))
+	for _, imageId := range imagesToBuild {
+		image := config.Images[imageId]
+		reasons := make([]string, 0)
+		if changedFiles == nil {
+			reasons = append(reasons, "changes unknown, all images are built")
+		}
+		for _, changedFile := range changedFiles {
+			switch {
+			case changedFile == filepath.ToSlash(filepath.Clean(configFile)):
+				reasons = append(reasons, fmt.Sprintf("gipgee config `%s` changed", changedFile))
+			case changedFile == filepath.ToSlash(filepath.Clean(*image.ContainerFile)):
+				reasons = append(reasons, fmt.Sprintf("container file `%s` changed", changedFile))
+			default:
+				for _, asset := range *image.AssetsToWatch {
+					if matches, err := zglob.Match(asset, changedFile); err == nil && matches {
+						reasons = append(reasons, fmt.Sprintf("watched asset `%s` changed", changedFile))
+						break
+					}
+				}
+			}
+		}
+		if len(reasons) == 0 {
+			reasons = append(reasons, "not affected by the changes, built anyway")
+		}
+		plan = append(plan, &plannedImage{
+			ImageId:          imageId,
+			Reasons:          reasons,
+			StagingReference: image.StagingLocation.String(),
+		})
+	}
+	return plan
+}
+
+// GetMergeRequestReasons returns the reasons of getMergeRequestPlan by image id.
+func GetMergeRequestReasons(config *c.Config, configFile string, imagesToBuild []string, changedFiles []string) map[string][]string {
+	reasons := make(map[string][]string, len(imagesToBuild))
+	for _, image := range getMergeRequestPlan(config, configFile, imagesToBuild, changedFiles) {
+		reasons[image.ImageId] = image.Reasons
+	}
+	return reasons
+}
+
+func renderMergeRequestPlanNote(plan []*plannedImage, pipelineUrl string) string {
+	note := strings.Builder{}
+	note.WriteString(MergeRequestPlanNoteMarker + "\n")
+	note.WriteString("### 🏗️ gipgee build plan\n\n")
+	if len(plan) == 0 {
+		note.WriteString("This merge request pipeline builds no images.\n")
+	} else {
+		note.WriteString("This merge request pipeline builds and tests the following images. Nothing is released.\n\n")
+		note.WriteString("| Image | Reasons | Staging image |\n")
+		note.WriteString("|---|---|---|\n")
+		for _, image := range plan {
+			note.WriteString(fmt.Sprintf("| `%s` | %s | `%s` |\n", image.ImageId, strings.ReplaceAll(strings.Join(image.Reasons, "<br>"), "|", "\\|"), image.StagingReference))
+		}
+	}
+	if pipelineUrl != "" {
+		note.WriteString(fmt.Sprintf("\nPipeline: %s\n", pipelineUrl))
+	}
+	return note.String()
+}
+
+type CommentMergeRequestPlanCmd struct {
+	ImageIds        []string `arg:"" optional:""`
+	ConfigFileName  string   `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	MergeRequestIid string   `required:"" env:"GIPGEE_MERGE_REQUEST_IID"`
+	DiffBaseSha     string   `optional:"" env:"GIPGEE_MERGE_REQUEST_DIFF_BASE_SHA"`
+	CommitSha       string   `required:"" env:"CI_COMMIT_SHA"`
+	ApiUrl          string   `required:"" env:"CI_API_V4_URL"`
+	ProjectId       string   `required:"" env:"CI_PROJECT_ID"`
+	PipelineUrl     string   `optional:"" env:"CI_PIPELINE_URL"`
+	Token           string   `required:"" env:"GIPGEE_GITLAB_API_TOKEN" help:"Gitlab access token with api scope, the job token is not allowed to create notes"`
+}
+
+func (*CommentMergeRequestPlanCmd) Help() string {
+	return "Only for gipgee internal use in the merge request pipeline. Posts or updates the build plan note of the merge request"
+}
+
+func (cmd *CommentMergeRequestPlanCmd) Run() error {
+	config, err := c.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	for _, imageId := range cmd.ImageIds {
+		if _, exists := config.Images[imageId]; !exists {
+			return fmt.Errorf("image with id '%s' does not exist in the configuration", imageId)
+		}
+	}
+
+	var changedFiles []string
+	if cmd.DiffBaseSha != "" {
+		changedFiles, err = git.GetChangedFilesBetweenCommits(cmd.DiffBaseSha, cmd.CommitSha)
+		if err != nil {
+			log.Printf("Cannot determine the changes of the merge request (%s), is GIT_DEPTH set to 0?\n", err.Error())
+			changedFiles = nil
+		}
+	}
+
+	note := renderMergeRequestPlanNote(getMergeRequestPlan(config, cmd.ConfigFileName, cmd.ImageIds, changedFiles), cmd.PipelineUrl)
+	client := gitlab.NewClient(cmd.ApiUrl, cmd.Token)
+	created, err := client.UpsertMergeRequestNote(cmd.ProjectId, cmd.MergeRequestIid, MergeRequestPlanNoteMarker, note)
+	if err != nil {
+		return fmt.Errorf("cannot post the plan to merge request !%s: %w", cmd.MergeRequestIid, err)
+	}
+	log.Printf("Posted the build plan as note %d of merge request !%s\n", created.Id, cmd.MergeRequestIid)
+	return nil
+}
@@ -0,0 +1,88 @@
+package imagebuild
+
+import (
+	"strings"
+	"testing"
+
+	c "github.com/devfbe/gipgee/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func loadTestConfig(t *testing.T) *c.Config {
+	t.Setenv("FOO", "staging-user")
+	t.Setenv("BAR", "staging-password")
+	config, err := c.LoadConfiguration("../config/testconfig.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestGetMergeRequestPlan(t *testing.T) {
+	config := loadTestConfig(t)
+	changedFiles := []string{"Containerfile.withoutDefaults", "build-assets/nodefaultimage/packages.txt", "README.md"}
+	plan := getMergeRequestPlan(config, "gipgee.yml", []string{"imageWithoutDefaults"}, changedFiles)
+	expectedReasons := []string{"container file `Containerfile.withoutDefaults` changed", "watched asset `build-assets/nodefaultimage/packages.txt` changed"}
+	if diff := cmp.Diff(expectedReasons, plan[0].Reasons); diff != "" {
+		t.Errorf("reasons mismatch (-want +got):\n%s", diff)
+	}
+	if plan[0].StagingReference != "nodefaultstagingregistry.example.com/nodefaultstagingimage:nodefaultstagingtag" {
+		t.Errorf("unexpected staging reference '%s'", plan[0].StagingReference)
+	}
+
+	plan = getMergeRequestPlan(config, "gipgee.yml", []string{"imageWithoutDefaults"}, []string{"gipgee.yml"})
+	if diff := cmp.Diff([]string{"gipgee config `gipgee.yml` changed"}, plan[0].Reasons); diff != "" {
+		t.Errorf("reasons mismatch (-want +got):\n%s", diff)
+	}
+	plan = getMergeRequestPlan(config, "gipgee.yml", []string{"imageWithoutDefaults"}, nil)
+	if diff := cmp.Diff([]string{"changes unknown, all images are built"}, plan[0].Reasons); diff != "" {
+		t.Errorf("reasons mismatch (-want +got):\n%s", diff)
+	}
+
+	note := renderMergeRequestPlanNote(plan, "https://gitlab.example.com/pipelines/1")
+	expectedNote := MergeRequestPlanNoteMarker + `
+### 🏗️ gipgee build plan
+
+This merge request pipeline builds and tests the following images. Nothing is released.
+
+| Image | Reasons | Staging image |
+|---|---|---|
+| ` + "`imageWithoutDefaults` | changes unknown, all images are built | `nodefaultstagingregistry.example.com/nodefaultstagingimage:nodefaultstagingtag`" + ` |
+
+Pipeline: https://gitlab.example.com/pipelines/1
+`
+	if note != expectedNote {
+		t.Errorf("note\n%s\ndoesn't match expected\n%s", note, expectedNote)
+	}
+}
+
+func TestMergeRequestPipelineDoesNotRelease(t *testing.T) {
+	config := loadTestConfig(t)
+	mergeRequest := &MergeRequest{Iid: "42", DiffBaseSha: "0123456789abcdef0123456789abcdef01234567"}
+	pipeline := NewBuildPipelineGenerator(config, []string{"imageWithoutDefaults"}, true, false, mergeRequest, ".gipgee-gitlab-ci.yml", "gipgee.yml", "").GeneratePipeline()
+
+	jobNames := make(map[string]bool)
+	for _, job := range pipeline.Jobs {
+		if strings.HasPrefix(job.Name, "✨ Release") {
+			t.Errorf("merge request pipeline should not contain release job '%s'", job.Name)
+		}
+		jobNames[job.Name] = true
+	}
+	for _, expectedJob := range []string{"🐋 Build staging image imageWithoutDefaults using kaniko", "🧪 Test staging image imageWithoutDefaults", "💬 Comment build plan on merge request"} {
+		if !jobNames[expectedJob] {
+			t.Errorf("job '%s' is missing in merge request pipeline, jobs: %v", expectedJob, jobNames)
+		}
+	}
+
+	pipeline = NewBuildPipelineGenerator(config, []string{"imageWithoutDefaults"}, true, true, nil, ".gipgee-gitlab-ci.yml", "gipgee.yml", "").GeneratePipeline()
+	released := false
+	for _, job := range pipeline.Jobs {
+		released = released || job.Name == "✨ Release staging image imageWithoutDefaults"
+		if job.Name == "💬 Comment build plan on merge request" {
+			t.Error("default branch pipeline should not comment on a merge request")
+		}
+	}
+	if !released {
+		t.Error("default branch pipeline should release the image")
+	}
+}
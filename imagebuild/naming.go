@@ -0,0 +1,73 @@
+package imagebuild
+
+import "fmt"
+
+const (
+	// StagingImageDigestVarName is the name of the dotenv variable that contains the digest
+	// of the staging image built by kaniko. It's available in all jobs that need the build job
+	// with artifacts.
+	StagingImageDigestVarName = "GIPGEE_STAGING_IMAGE_DIGEST"
+)
+
+func getStagingImageDigestFileName(imageId string) string {
+	return fmt.Sprintf("gipgee-staging-image-%s.digest", imageId)
+}
+
+func getStagingImageDotenvFileName(imageId string) string {
+	return fmt.Sprintf("gipgee-staging-image-%s.env", imageId)
+}
+
+func getBaseImageDotenvFileName(imageId string) string {
+	return fmt.Sprintf("gipgee-base-image-%s.env", imageId)
+}
+
+func getReleaseMetadataFileName(imageId string) string {
+	return fmt.Sprintf("gipgee-release-metadata-%s.json", imageId)
+}
+
+func getContainerScanningReportFileName(imageId string) string {
+	return fmt.Sprintf("gl-container-scanning-report-%s.json", imageId)
+}
+
+func getStagingImageConfigFileName(imageId string) string {
+	return fmt.Sprintf("gipgee-staging-image-config-%s.json", imageId)
+}
+
+func getStructureTestReportFileName(imageId string) string {
+	return fmt.Sprintf("gipgee-structure-test-report-%s.xml", imageId)
+}
+
+// GetImageGroupPipelineFileName returns the name of the child pipeline file of an image group.
+func GetImageGroupPipelineFileName(group string) string {
+	return fmt.Sprintf(".gipgee-gitlab-ci-%s.yml", group)
+}
+
+// The names of the jobs of an image, the plan looks up the phases of the images by them.
+
+func GetBuildJobName(imageId string) string {
+	return fmt.Sprintf("🐋 Build staging image %s using kaniko", imageId)
+}
+
+func GetTestJobName(imageId string) string {
+	return "🧪 Test staging image " + imageId
+}
+
+func GetTestSuiteJobName(imageId string, suiteName string) string {
+	return fmt.Sprintf("🧪 Test staging image %s: %s", imageId, suiteName)
+}
+
+func GetStructureTestJobName(imageId string) string {
+	return "🧱 Structure test staging image " + imageId
+}
+
+func GetServiceTestJobName(imageId string) string {
+	return "📡 Service test staging image " + imageId
+}
+
+func GetReleaseJobName(imageId string) string {
+	return "✨ Release staging image " + imageId
+}
+
+func GetImageGroupTriggerJobName(group string) string {
+	return "🚀 Build image group " + group
+}
@@ -1,14 +1,17 @@
 package imagebuild
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	c "github.com/devfbe/gipgee/config"
 	"github.com/devfbe/gipgee/docker"
 	pm "github.com/devfbe/gipgee/pipelinemodel"
+	"github.com/devfbe/gipgee/sbom"
+	"github.com/devfbe/gipgee/scan"
+	"github.com/devfbe/gipgee/signing"
 )
 
 type ImageBuildPipelineGenerator interface {
@@ -19,23 +22,48 @@ type imageBuildPipelineGeneratorImpl struct {
 	config        *c.Config
 	imagesToBuild []string
 	autoStart     bool
+	release       bool
+	mergeRequest  *MergeRequest
 	pipelineFile  string
 	configFile    string
 	gipgeeImage   string
+	imageGroup    *c.ImageGroup // set if the generator generates the child pipeline of an image group
 }
 
-func NewBuildPipelineGenerator(config *c.Config, imagesToBuild []string, autoStart bool, pipelineFile string, configFile string, gipgeeImage string) ImageBuildPipelineGenerator {
+// NewBuildPipelineGenerator creates the generator for the image build pipeline. Without release, the
+// images are only built and tested. If mergeRequest is set, the pipeline posts its plan as merge request note.
+func NewBuildPipelineGenerator(config *c.Config, imagesToBuild []string, autoStart bool, release bool, mergeRequest *MergeRequest, pipelineFile string, configFile string, gipgeeImage string) ImageBuildPipelineGenerator {
 	return &imageBuildPipelineGeneratorImpl{
 		config:        config,
 		imagesToBuild: imagesToBuild,
 		autoStart:     autoStart,
+		release:       release,
+		mergeRequest:  mergeRequest,
 		pipelineFile:  pipelineFile,
 		configFile:    configFile,
 		gipgeeImage:   gipgeeImage,
 	}
 }
 
+// NewImageGroupPipelineGenerator creates the generator for the child pipeline of an image group (see sharding),
+// it builds the images of the group that are part of imagesToBuild.
+func NewImageGroupPipelineGenerator(config *c.Config, group *c.ImageGroup, imagesToBuild []string, autoStart bool, release bool, pipelineFile string, configFile string, gipgeeImage string) ImageBuildPipelineGenerator {
+	return &imageBuildPipelineGeneratorImpl{
+		config:        config,
+		imagesToBuild: group.Filter(imagesToBuild),
+		autoStart:     autoStart,
+		release:       release,
+		pipelineFile:  pipelineFile,
+		configFile:    configFile,
+		gipgeeImage:   gipgeeImage,
+		imageGroup:    group,
+	}
+}
+
 func (pipelineGenerator *imageBuildPipelineGeneratorImpl) GeneratePipeline() *pm.Pipeline {
+	if pipelineGenerator.config.Sharding != nil && pipelineGenerator.imageGroup == nil {
+		return pipelineGenerator.generateImageGroupsPipeline()
+	}
 
 	allInOneStage := pm.Stage{Name: "🏗️ All in One 🧪"}
 	pipelineJobs := make([]*pm.Job, 0)
@@ -55,33 +83,9 @@ func (pipelineGenerator *imageBuildPipelineGeneratorImpl) GeneratePipeline() *pm
 		pipelineJobs = append(pipelineJobs, &job)
 	}
 
-	var gipgeeImageCoordinates pm.ContainerImageCoordinates
-
-	if pipelineGenerator.gipgeeImage == "" {
-		gipgeeImageCoordinates = pm.ContainerImageCoordinates{
-			Registry:   "docker.io",
-			Repository: "devfbe/gipgee",
-			Tag:        "latest",
-		}
-	} else {
-		coords, err := pm.ContainerImageCoordinatesFromString(pipelineGenerator.gipgeeImage)
-		if err != nil {
-			panic(err)
-		}
-		gipgeeImageCoordinates = *coords
-	}
-
-	copyGipgeeToArtifact := pm.Job{
-		Name:  "🧰 provide gipgee binary as artifact",
-		Image: &gipgeeImageCoordinates,
-		Stage: &allInOneStage,
-		Script: []string{
-			"mkdir .gipgee && cd .gipgee && cp $(which gipgee) gipgee",
-		},
-		Artifacts: &pm.JobArtifacts{
-			Paths: []string{".gipgee"},
-		},
-	}
+	gipgeeImageCoordinates := pipelineGenerator.getGipgeeImageCoordinates()
+	copyGipgeeToArtifact := newCopyGipgeeToArtifactJob(&allInOneStage)
+	pipelineJobs = append(pipelineJobs, copyGipgeeToArtifact)
 
 	for _, imageToBuild := range pipelineGenerator.imagesToBuild {
 		log.Printf("Building image build jobs for image '%s'\n", imageToBuild)
@@ -95,54 +99,187 @@ func (pipelineGenerator *imageBuildPipelineGeneratorImpl) GeneratePipeline() *pm
 		baseImage := pipelineGenerator.config.Images[imageToBuild].BaseImage.String()
 		destination := pipelineGenerator.config.Images[imageToBuild].StagingLocation.String()
 
+		digestFile := getStagingImageDigestFileName(imageToBuild)
+		dotenvFile := getStagingImageDotenvFileName(imageToBuild)
+
+		buildStagingImageNeeds := []pm.JobNeeds{{
+			Job:       copyGipgeeToArtifact,
+			Artifacts: true,
+		}}
+
+		var verifyBaseImageJob *pm.Job
+		if baseImageLocation := pipelineGenerator.config.Images[imageToBuild].BaseImage; baseImageLocation.Verify != nil {
+			baseImageDotenvFile := getBaseImageDotenvFileName(imageToBuild)
+			verifyBaseImageJob = &pm.Job{
+				Name:   "🔐 Verify base image signature " + imageToBuild,
+				Image:  &c.CosignImage,
+				Stage:  &allInOneStage,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee image-build verify-base-image %s --dotenv-file %s", imageToBuild, baseImageDotenvFile)},
+				Needs: []pm.JobNeeds{{
+					Job:       copyGipgeeToArtifact,
+					Artifacts: true,
+				}},
+				Artifacts: &pm.JobArtifacts{
+					Paths: []string{baseImageDotenvFile},
+					Reports: &pm.JobArtifactsReports{
+						Dotenv: baseImageDotenvFile,
+					},
+				},
+			}
+			buildStagingImageNeeds = append(buildStagingImageNeeds, pm.JobNeeds{
+				Job:       verifyBaseImageJob,
+				Artifacts: true,
+			})
+			// Build on the verified digest, not on the tag which might have been moved since the verification
+			baseImage = fmt.Sprintf("%s/%s@${%s}", *baseImageLocation.Registry, *baseImageLocation.Repository, signing.BaseImageDigestVarName)
+			pipelineJobs = append(pipelineJobs, verifyBaseImageJob)
+		}
+
+		// pre-build hooks run one after another in the configured order, the build waits for the last one
+		preBuildHookJobs := make([]*pm.Job, 0)
+		previousJob := verifyBaseImageJob
+		for _, hook := range pipelineGenerator.config.GetHookJobs(c.HookPointPreBuild) {
+			if !hook.AppliesTo(imageToBuild) {
+				continue
+			}
+			hookJob := newHookJob(hook, imageToBuild, &allInOneStage)
+			hookJob.Needs = []pm.JobNeeds{{Job: copyGipgeeToArtifact, Artifacts: true}}
+			if previousJob != nil {
+				hookJob.Needs = append(hookJob.Needs, pm.JobNeeds{Job: previousJob, Artifacts: false})
+			}
+			preBuildHookJobs = append(preBuildHookJobs, hookJob)
+			pipelineJobs = append(pipelineJobs, hookJob)
+			previousJob = hookJob
+		}
+		if len(preBuildHookJobs) > 0 {
+			buildStagingImageNeeds = append(buildStagingImageNeeds, pm.JobNeeds{
+				Job:       preBuildHookJobs[len(preBuildHookJobs)-1],
+				Artifacts: false,
+			})
+		}
+
 		kanikoScript = append(kanikoScript, "./.gipgee/gipgee image-build generate-kaniko-auth --config-file-name='"+pipelineGenerator.configFile+"' --image-id '"+imageToBuild+"'")
-		kanikoScript = append(kanikoScript, "/kaniko/executor "+ignoredPaths+" --context ${CI_PROJECT_DIR} --dockerfile ${CI_PROJECT_DIR}/"+containerFile+" --build-arg=GIPGEE_BASE_IMAGE="+baseImage+" --build-arg=GIPGEE_IMAGE_ID="+imageToBuild+" --destination "+destination)
+		kanikoScript = append(kanikoScript, "/kaniko/executor "+ignoredPaths+" --context ${CI_PROJECT_DIR} --dockerfile ${CI_PROJECT_DIR}/"+containerFile+" --build-arg=GIPGEE_BASE_IMAGE="+baseImage+" --build-arg=GIPGEE_IMAGE_ID="+imageToBuild+" --destination "+destination+" --digest-file ${CI_PROJECT_DIR}/"+digestFile)
+		// The digest is passed as dotenv variable to the test and release jobs, so that they
+		// operate on exactly the image that has been built, regardless of the runner pull policy
+		// or other pipelines pushing the same staging tag in the meantime.
+		kanikoScript = append(kanikoScript, fmt.Sprintf(`echo "%s=$(cat ${CI_PROJECT_DIR}/%s)" > ${CI_PROJECT_DIR}/%s`, StagingImageDigestVarName, digestFile, dotenvFile))
 
 		buildStagingImageJob := pm.Job{
-			Name:   "🐋 Build staging image " + imageToBuild + " using kaniko",
+			Name:   GetBuildJobName(imageToBuild),
 			Image:  &c.KanikoImage,
 			Stage:  &allInOneStage,
 			Script: kanikoScript,
-			Needs: []pm.JobNeeds{{
-				Job:       &copyGipgeeToArtifact,
-				Artifacts: true,
-			}},
+			Needs:  buildStagingImageNeeds,
+			Artifacts: &pm.JobArtifacts{
+				Paths: []string{digestFile},
+				Reports: &pm.JobArtifactsReports{
+					Dotenv: dotenvFile,
+				},
+			},
+		}
+		pipelineGenerator.config.GetPhaseExtension(c.PhaseBuild).ApplyTo(&buildStagingImageJob)
+		pipelineJobs = append(pipelineJobs, &buildStagingImageJob)
+		// the jobs which only need the staging image share a template, it's placed right after the build job
+		stagingImageTemplateIndex := len(pipelineJobs)
+		stagingImageJobs := make([]*pm.Job, 0)
+		// Without auto start, the first job of the image chain has to be started manually. All other jobs
+		// of the chain (directly or indirectly) need it, so they wait until it has been started.
+		if !pipelineGenerator.autoStart {
+			firstJob := &buildStagingImageJob
+			if verifyBaseImageJob != nil {
+				firstJob = verifyBaseImageJob
+			} else if len(preBuildHookJobs) > 0 {
+				firstJob = preBuildHookJobs[0]
+			}
+			pipelineGenerator.gateJob(firstJob, imageToBuild)
 		}
-		imageConfig := pipelineGenerator.config.Images[imageToBuild]
-		stagingImageCoordinates, err := pm.ContainerImageCoordinatesFromString(imageConfig.StagingLocation.String())
 
-		if err != nil {
-			panic(err)
+		imageConfig := pipelineGenerator.config.Images[imageToBuild]
+		stagingImageCoordinates := pm.ContainerImageCoordinates{
+			Registry:   *imageConfig.StagingLocation.Registry,
+			Repository: *imageConfig.StagingLocation.Repository,
+			Digest:     "${" + StagingImageDigestVarName + "}",
 		}
+
 		releaseJobNeeds := []pm.JobNeeds{
 			{
-				Job:       &copyGipgeeToArtifact,
+				Job:       copyGipgeeToArtifact,
 				Artifacts: true,
 			},
 		}
+		testPhase := pipelineGenerator.config.GetPhaseExtension(c.PhaseTest)
 		if len(*imageConfig.TestCommand) > 0 {
 			stagingTestJob := pm.Job{
-				Name:   "🧪 Test staging image " + imageToBuild,
-				Image:  stagingImageCoordinates,
+				Name:   GetTestJobName(imageToBuild),
+				Image:  &stagingImageCoordinates,
 				Stage:  &allInOneStage,
 				Script: []string{fmt.Sprintf("./.gipgee/gipgee image-build exec-staging-image-test %s", imageToBuild)},
 				Needs: []pm.JobNeeds{
 					{
 						Job:       &buildStagingImageJob,
-						Artifacts: false,
+						Artifacts: true,
 					},
 					{
-						Job:       &copyGipgeeToArtifact,
+						Job:       copyGipgeeToArtifact,
 						Artifacts: true,
 					},
 				},
-				Variables: &map[string]interface{}{
-					"GIPGEE_CONFIG_FILE_NAME": pipelineGenerator.configFile,
-				},
+				Artifacts:    getTestArtifacts(imageConfig.TestArtifacts),
+				AllowFailure: getTestAllowFailure(imageConfig.TestExecution),
 			}
+			testPhase.ApplyTo(&stagingTestJob)
+			stagingImageJobs = append(stagingImageJobs, &stagingTestJob)
 			releaseJobNeeds = append(releaseJobNeeds, pm.JobNeeds{Job: &stagingTestJob})
 		}
 
+		for _, suiteName := range imageConfig.TestSuiteNames() {
+			suite := imageConfig.Tests[suiteName]
+			suiteJob := pm.Job{
+				Name:   GetTestSuiteJobName(imageToBuild, suiteName),
+				Image:  &stagingImageCoordinates,
+				Stage:  &allInOneStage,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee image-build exec-staging-image-test %s --suite '%s'", imageToBuild, suiteName)},
+				Needs: []pm.JobNeeds{
+					{Job: &buildStagingImageJob, Artifacts: true},
+					{Job: copyGipgeeToArtifact, Artifacts: true},
+				},
+				Tags: suite.Tags,
+			}
+			if len(suite.Variables) > 0 {
+				variables := make(map[string]interface{}, len(suite.Variables))
+				for key, value := range suite.Variables {
+					variables[key] = value
+				}
+				suiteJob.Variables = &variables
+			}
+			if suite.Timeout != nil {
+				suiteJob.Timeout = *suite.Timeout
+			}
+			if suite.Image != nil {
+				suiteImage, err := pm.ContainerImageCoordinatesFromString(*suite.Image)
+				if err != nil {
+					panic(err)
+				}
+				suiteJob.Image = suiteImage
+				suiteJob.Services = []pm.JobService{{
+					Image: &stagingImageCoordinates,
+					Alias: *suite.ServiceAlias,
+				}}
+			}
+			suiteJob.Artifacts = getTestArtifacts(suite.Artifacts)
+			suiteJob.AllowFailure = getTestAllowFailure(&suite.TestExecution)
+			testPhase.ApplyTo(&suiteJob)
+			stagingImageJobs = append(stagingImageJobs, &suiteJob)
+			if suite.IsRequired() {
+				releaseJobNeeds = append(releaseJobNeeds, pm.JobNeeds{Job: &suiteJob})
+			} else {
+				// optional suites don't block the release and don't fail the pipeline
+				suiteJob.AllowFailure = &pm.JobAllowFailure{Allowed: &[]bool{true}[0]}
+				pipelineJobs = append(pipelineJobs, &suiteJob)
+			}
+		}
+
 		authMap := make(map[string]docker.UsernamePassword, 0)
 
 		if imageConfig.BaseImage.Credentials != nil {
@@ -185,37 +322,434 @@ func (pipelineGenerator *imageBuildPipelineGeneratorImpl) GeneratePipeline() *pm
 				}
 				skopeoDestCredentials = fmt.Sprintf("--dest-username '%s' --dest-password '%s'", up.Username, up.Password)
 			}
-			releaseScript = append(releaseScript, fmt.Sprintf("skopeo copy %s %s docker://%s docker://%s", skopeoSrcCredentials, skopeoDestCredentials, imageConfig.StagingLocation.String(), releaseLocation.String()))
+			if len(releaseLocation.ReleaseTags) == 0 {
+				releaseScript = append(releaseScript, fmt.Sprintf(`echo "Not releasing to %s, the tag strategy %s only releases in tag pipelines"`, releaseLocation.String(), *releaseLocation.TagStrategy))
+			}
+			for _, reference := range releaseLocation.ReleaseReferences() {
+				releaseScript = append(releaseScript, fmt.Sprintf("skopeo copy --preserve-digests %s %s docker://%s docker://%s", skopeoSrcCredentials, skopeoDestCredentials, stagingImageCoordinates.String(), reference))
+			}
+		}
+		if imageConfig.StructureTests != nil {
+			skopeoInspectCredentials := ""
+			if imageConfig.StagingLocation.Credentials != nil {
+				up, err := pipelineGenerator.config.GetUserNamePassword(*imageConfig.StagingLocation.Credentials)
+				if err != nil {
+					panic(err)
+				}
+				skopeoInspectCredentials = fmt.Sprintf("--creds '%s:%s'", up.Username, up.Password)
+			}
+			// The image config (ports, entrypoint, labels, ...) is not visible from inside the
+			// running container, so it's fetched separately for the metadata tests.
+			imageConfigFile := getStagingImageConfigFileName(imageToBuild)
+			inspectStagingImageJob := pm.Job{
+				Name:   "🔬 Inspect staging image config " + imageToBuild,
+				Stage:  &allInOneStage,
+				Image:  &c.SkopeoImage,
+				Script: []string{fmt.Sprintf("skopeo inspect --config %s docker://%s > %s", skopeoInspectCredentials, stagingImageCoordinates.String(), imageConfigFile)},
+				Needs: []pm.JobNeeds{
+					{Job: &buildStagingImageJob, Artifacts: true},
+				},
+				Artifacts: &pm.JobArtifacts{
+					Paths: []string{imageConfigFile},
+				},
+			}
+			reportFile := getStructureTestReportFileName(imageToBuild)
+			structureTestJob := pm.Job{
+				Name:   GetStructureTestJobName(imageToBuild),
+				Stage:  &allInOneStage,
+				Image:  &stagingImageCoordinates,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee image-build exec-structure-test %s --image-config-file %s --junit-report-file %s", imageToBuild, imageConfigFile, reportFile)},
+				Needs: []pm.JobNeeds{
+					{Job: &buildStagingImageJob, Artifacts: true},
+					{Job: &inspectStagingImageJob, Artifacts: true},
+					{Job: copyGipgeeToArtifact, Artifacts: true},
+				},
+				Artifacts: &pm.JobArtifacts{
+					When:  &[]string{"always"}[0],
+					Paths: []string{reportFile},
+					Reports: &pm.JobArtifactsReports{
+						Junit: []string{reportFile},
+					},
+				},
+			}
+			testPhase.ApplyTo(&structureTestJob)
+			pipelineJobs = append(pipelineJobs, &inspectStagingImageJob)
+			releaseJobNeeds = append(releaseJobNeeds, pm.JobNeeds{Job: &structureTestJob})
+		}
+
+		if serviceTest := imageConfig.ServiceTest; serviceTest != nil {
+			// The staging image runs as service (e.g. a web server or database), gipgee
+			// probes it over the network instead of running commands inside of it.
+			serviceTestJob := pm.Job{
+				Name:   GetServiceTestJobName(imageToBuild),
+				Stage:  &allInOneStage,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee image-build exec-service-probe %s", imageToBuild)},
+				Services: []pm.JobService{{
+					Image:      &stagingImageCoordinates,
+					Alias:      *serviceTest.Alias,
+					Entrypoint: serviceTest.Entrypoint,
+					Command:    serviceTest.Command,
+					Variables:  serviceTest.Variables,
+				}},
+				Needs: []pm.JobNeeds{
+					{Job: &buildStagingImageJob, Artifacts: true},
+					{Job: copyGipgeeToArtifact, Artifacts: true},
+				},
+			}
+			testPhase.ApplyTo(&serviceTestJob)
+			stagingImageJobs = append(stagingImageJobs, &serviceTestJob)
+			releaseJobNeeds = append(releaseJobNeeds, pm.JobNeeds{Job: &serviceTestJob})
+		}
+
+		var sbomJob *pm.Job
+		var sbomFile string
+		if imageConfig.Sbom.IsEnabled() {
+			sbomFile = sbom.GetSbomFileName(imageToBuild, *imageConfig.Sbom.Format)
+			sbomJob = &pm.Job{
+				Name:   "📋 Generate SBOM " + imageToBuild,
+				Stage:  &allInOneStage,
+				Image:  &c.SyftImage,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee sbom generate %s --output-file %s", imageToBuild, sbomFile)},
+				Needs: []pm.JobNeeds{
+					{Job: &buildStagingImageJob, Artifacts: true},
+					{Job: copyGipgeeToArtifact, Artifacts: true},
+				},
+				Artifacts: &pm.JobArtifacts{
+					Paths: []string{sbomFile},
+				},
+			}
+			if *imageConfig.Sbom.Format == c.SbomFormatCycloneDX {
+				sbomJob.Artifacts.Reports = &pm.JobArtifactsReports{
+					Cyclonedx: []string{sbomFile},
+				}
+			}
+			stagingImageJobs = append(stagingImageJobs, sbomJob)
+			// don't release images without SBOM
+			releaseJobNeeds = append(releaseJobNeeds, pm.JobNeeds{Job: sbomJob})
+		}
+
+		if imageConfig.VulnerabilityScan.IsEnabled() {
+			reportFile := getContainerScanningReportFileName(imageToBuild)
+			scanJob := pm.Job{
+				Name:   "🔎 Scan staging image " + imageToBuild,
+				Stage:  &allInOneStage,
+				Image:  scan.GetToolImage(*imageConfig.VulnerabilityScan.Tool),
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee scan image %s --report-file %s", imageToBuild, reportFile)},
+				Needs: []pm.JobNeeds{
+					{Job: &buildStagingImageJob, Artifacts: true},
+					{Job: copyGipgeeToArtifact, Artifacts: true},
+				},
+				Artifacts: &pm.JobArtifacts{
+					// the report is especially interesting if the scan blocks the release
+					When:  &[]string{"always"}[0],
+					Paths: []string{reportFile},
+					Reports: &pm.JobArtifactsReports{
+						ContainerScanning: []string{reportFile},
+					},
+				},
+			}
+			stagingImageJobs = append(stagingImageJobs, &scanJob)
+			releaseJobNeeds = append(releaseJobNeeds, pm.JobNeeds{Job: &scanJob})
+		}
+
+		if imageConfig.Signing != nil && imageConfig.Signing.VerifyStagingImage {
+			signStagingImageJob := pm.Job{
+				Name:   "🔏 Sign staging image " + imageToBuild,
+				Stage:  &allInOneStage,
+				Image:  &c.CosignImage,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee sign %s --target staging", imageToBuild)},
+				Needs: []pm.JobNeeds{
+					{Job: &buildStagingImageJob, Artifacts: true},
+					{Job: copyGipgeeToArtifact, Artifacts: true},
+				},
+			}
+			// The verification waits for the tests, so the signature is checked right before the release.
+			verifyStagingImageNeeds := append([]pm.JobNeeds{
+				{Job: &buildStagingImageJob, Artifacts: true},
+				{Job: &signStagingImageJob, Artifacts: false},
+			}, releaseJobNeeds...)
+			verifyStagingImageJob := pm.Job{
+				Name:   "🔍 Verify staging image signature " + imageToBuild,
+				Stage:  &allInOneStage,
+				Image:  &c.CosignImage,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee verify %s --target staging", imageToBuild)},
+				Needs:  verifyStagingImageNeeds,
+			}
+			stagingImageJobs = append(stagingImageJobs, &signStagingImageJob)
+			pipelineJobs = append(pipelineJobs, &signStagingImageJob)
+			releaseJobNeeds = append(releaseJobNeeds, pm.JobNeeds{Job: &verifyStagingImageJob})
+		}
+
+		// post-test hooks run after all tests and checks passed, the release waits for them
+		postTestHookNeeds := append([]pm.JobNeeds{{Job: &buildStagingImageJob, Artifacts: true}}, releaseJobNeeds...)
+		for _, hook := range pipelineGenerator.config.GetHookJobs(c.HookPointPostTest) {
+			if !hook.AppliesTo(imageToBuild) {
+				continue
+			}
+			hookJob := newHookJob(hook, imageToBuild, &allInOneStage)
+			hookJob.Needs = postTestHookNeeds
+			releaseJobNeeds = append(releaseJobNeeds, pm.JobNeeds{Job: hookJob})
+		}
+
+		if template := pm.ExtractTemplate(".gipgee-staging-image-"+imageToBuild, stagingImageJobs); template != nil {
+			pipelineJobs = append(pipelineJobs[:stagingImageTemplateIndex], append([]*pm.Job{template}, pipelineJobs[stagingImageTemplateIndex:]...)...)
+		}
+
+		for _, j := range releaseJobNeeds {
+			if j.Job != copyGipgeeToArtifact {
+				pipelineJobs = append(pipelineJobs, j.Job)
+			}
+		}
+
+		if !pipelineGenerator.release {
+			log.Printf("Release disabled, not generating release jobs for image '%s'\n", imageToBuild)
+			continue
+		}
+
+		releaseMetadataFile := getReleaseMetadataFileName(imageToBuild)
+		releaseScript = append(releaseScript, fmt.Sprintf("./.gipgee/gipgee image-build write-release-metadata %s --output-file %s", imageToBuild, releaseMetadataFile))
+		performReleaseJobNeeds := append(releaseJobNeeds, pm.JobNeeds{
+			Job:       &buildStagingImageJob,
+			Artifacts: true,
+		})
+		if verifyBaseImageJob != nil {
+			// needed for the base image verification result in the release metadata
+			performReleaseJobNeeds = append(performReleaseJobNeeds, pm.JobNeeds{
+				Job:       verifyBaseImageJob,
+				Artifacts: true,
+			})
 		}
 		performReleaseJob := pm.Job{
-			Name:   "✨ Release staging image " + imageToBuild,
+			Name:   GetReleaseJobName(imageToBuild),
 			Stage:  &allInOneStage,
 			Image:  &c.SkopeoImage,
 			Script: releaseScript,
-			Needs:  releaseJobNeeds,
+			Needs:  performReleaseJobNeeds,
+			Artifacts: &pm.JobArtifacts{
+				Paths: []string{releaseMetadataFile},
+			},
 		}
 
-		pipelineJobs = append(pipelineJobs, &buildStagingImageJob, &performReleaseJob)
-		for _, j := range releaseJobNeeds {
-			pipelineJobs = append(pipelineJobs, j.Job)
+		pipelineJobs = append(pipelineJobs, &performReleaseJob)
+		releasePhaseJobs := []*pm.Job{&performReleaseJob}
+		postReleaseHookNeeds := []pm.JobNeeds{
+			{Job: &performReleaseJob, Artifacts: true},
+			{Job: &buildStagingImageJob, Artifacts: true},
+			{Job: copyGipgeeToArtifact, Artifacts: true},
+		}
+
+		if imageConfig.Signing != nil {
+			signReleasedImageJob := pm.Job{
+				Name:   "🔏 Sign released image " + imageToBuild,
+				Stage:  &allInOneStage,
+				Image:  &c.CosignImage,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee sign %s --target release", imageToBuild)},
+				Needs: []pm.JobNeeds{
+					{Job: &performReleaseJob, Artifacts: false},
+					{Job: &buildStagingImageJob, Artifacts: true},
+					{Job: copyGipgeeToArtifact, Artifacts: true},
+				},
+			}
+			pipelineJobs = append(pipelineJobs, &signReleasedImageJob)
+			releasePhaseJobs = append(releasePhaseJobs, &signReleasedImageJob)
+			postReleaseHookNeeds = append(postReleaseHookNeeds, pm.JobNeeds{Job: &signReleasedImageJob})
+		}
+
+		if sbomJob != nil {
+			attachSbomJob := pm.Job{
+				Name:   "📎 Attach SBOM to released image " + imageToBuild,
+				Stage:  &allInOneStage,
+				Image:  &c.OrasImage,
+				Script: []string{fmt.Sprintf("./.gipgee/gipgee sbom attach %s --sbom-file %s", imageToBuild, sbomFile)},
+				Needs: []pm.JobNeeds{
+					{Job: &performReleaseJob, Artifacts: false},
+					{Job: &buildStagingImageJob, Artifacts: true},
+					{Job: sbomJob, Artifacts: true},
+					{Job: copyGipgeeToArtifact, Artifacts: true},
+				},
+			}
+			pipelineJobs = append(pipelineJobs, &attachSbomJob)
+			releasePhaseJobs = append(releasePhaseJobs, &attachSbomJob)
+			postReleaseHookNeeds = append(postReleaseHookNeeds, pm.JobNeeds{Job: &attachSbomJob})
+		}
+		pipelineGenerator.config.GetPhaseExtension(c.PhaseRelease).ApplyTo(releasePhaseJobs...)
+
+		for _, hook := range pipelineGenerator.config.GetHookJobs(c.HookPointPostRelease) {
+			if !hook.AppliesTo(imageToBuild) {
+				continue
+			}
+			hookJob := newHookJob(hook, imageToBuild, &allInOneStage)
+			hookJob.Needs = postReleaseHookNeeds
+			pipelineJobs = append(pipelineJobs, hookJob)
 		}
 	}
 
-	pipelineJobs = append(pipelineJobs, &copyGipgeeToArtifact)
+	if pipelineGenerator.mergeRequest != nil {
+		pipelineJobs = append(pipelineJobs, pipelineGenerator.newCommentPlanJob(&allInOneStage, copyGipgeeToArtifact))
+	}
 
 	pipeline := pm.Pipeline{
-		Stages: []*pm.Stage{&allInOneStage},
-		Jobs:   pipelineJobs,
+		Default: &pm.PipelineDefault{Image: &gipgeeImageCoordinates},
+		Stages:  []*pm.Stage{&allInOneStage},
+		Jobs:    pipelineJobs,
 		Variables: map[string]interface{}{
-			"DOCKER_AUTH_CONFIG": generateDockerAuthConfig(pipelineGenerator.config),
+			"DOCKER_AUTH_CONFIG":      generateDockerAuthConfig(pipelineGenerator.config, pipelineGenerator.dockerAuthImageIds()),
+			"GIPGEE_CONFIG_FILE_NAME": pipelineGenerator.configFile,
 		},
 	}
+	pipelineGenerator.addSemverReleaseTagsVariable(pipeline.Variables)
 
 	return &pipeline
 
 }
 
-func generateDockerAuthConfig(config *c.Config) string {
+// addSemverReleaseTagsVariable passes the release tags derived from the git tags at generation time to the
+// jobs, so that they release and report the same tags without a full clone.
+func (pipelineGenerator *imageBuildPipelineGeneratorImpl) addSemverReleaseTagsVariable(variables map[string]interface{}) {
+	if len(pipelineGenerator.config.SemverReleaseTags) > 0 {
+		variables[c.SemverReleaseTagsVarName] = strings.Join(pipelineGenerator.config.SemverReleaseTags, ",")
+	}
+}
+
+// newHookJob creates the job of a per image hook, the image id is passed in GIPGEE_IMAGE_ID.
+func newHookJob(hook *c.HookJob, imageId string, stage *pm.Stage) *pm.Job {
+	return hook.NewJob(fmt.Sprintf("🪝 %s %s", *hook.Name, imageId), stage, map[string]interface{}{
+		"GIPGEE_IMAGE_ID": imageId,
+	})
+}
+
+func (pipelineGenerator *imageBuildPipelineGeneratorImpl) getGipgeeImageCoordinates() pm.ContainerImageCoordinates {
+	if pipelineGenerator.gipgeeImage == "" {
+		return pm.ContainerImageCoordinates{
+			Registry:   "docker.io",
+			Repository: "devfbe/gipgee",
+			Tag:        "latest",
+		}
+	}
+	coords, err := pm.ContainerImageCoordinatesFromString(pipelineGenerator.gipgeeImage)
+	if err != nil {
+		panic(err)
+	}
+	return *coords
+}
+
+// newCopyGipgeeToArtifactJob creates the job providing the gipgee binary to the jobs running in other
+// images. Like all jobs without own image, it runs in the gipgee image (the default image of the pipeline).
+func newCopyGipgeeToArtifactJob(stage *pm.Stage) *pm.Job {
+	return &pm.Job{
+		Name:  "🧰 provide gipgee binary as artifact",
+		Stage: stage,
+		Script: []string{
+			"mkdir .gipgee && cd .gipgee && cp $(which gipgee) gipgee",
+		},
+		Artifacts: &pm.JobArtifacts{
+			Paths: []string{".gipgee"},
+		},
+	}
+}
+
+func (pipelineGenerator *imageBuildPipelineGeneratorImpl) newCommentPlanJob(stage *pm.Stage, copyGipgeeToArtifact *pm.Job) *pm.Job {
+	mergeRequest := pipelineGenerator.mergeRequest
+	// The note is just information, a missing token or an unreachable api must not fail the pipeline
+	return &pm.Job{
+		Name:   "💬 Comment build plan on merge request",
+		Stage:  stage,
+		Script: []string{strings.TrimSpace("./.gipgee/gipgee image-build comment-merge-request-plan " + strings.Join(pipelineGenerator.imagesToBuild, " "))},
+		Needs: []pm.JobNeeds{
+			{Job: copyGipgeeToArtifact, Artifacts: true},
+		},
+		Variables: &map[string]interface{}{
+			"GIPGEE_MERGE_REQUEST_IID":           mergeRequest.Iid,
+			"GIPGEE_MERGE_REQUEST_DIFF_BASE_SHA": mergeRequest.DiffBaseSha,
+			"GIT_DEPTH":                          "0", // the diff needs the merge request base commit
+		},
+		AllowFailure: &pm.JobAllowFailure{
+			Allowed: &[]bool{true}[0],
+		},
+	}
+}
+
+// dockerAuthImageIds returns the images whose staging registry credentials are part of DOCKER_AUTH_CONFIG.
+// The child pipeline of an image group only contains the credentials of its own images.
+func (pipelineGenerator *imageBuildPipelineGeneratorImpl) dockerAuthImageIds() []string {
+	if pipelineGenerator.imageGroup != nil {
+		return pipelineGenerator.imageGroup.ImageIds
+	}
+	return pipelineGenerator.config.ImageIds()
+}
+
+// gateJob makes the job a blocking manual job. Gitlab allows manual jobs to fail by default, which
+// makes them non blocking (the jobs needing them would run right away), so allow_failure has to be false.
+func (pipelineGenerator *imageBuildPipelineGeneratorImpl) gateJob(job *pm.Job, imageId string) {
+	job.When = pm.WhenManual
+	job.AllowFailure = &pm.JobAllowFailure{Allowed: &[]bool{false}[0]}
+	if pipelineGenerator.release {
+		job.ManualConfirmation = fmt.Sprintf("This builds, tests and releases image '%s'. Continue?", imageId)
+	}
+}
+
+// IsAutoStart decides if the image build pipeline starts automatically. Manually triggered pipelines
+// (via the web ui) on the default branch wait until the first job of each image is started, unless
+// GIPGEE_FORCE_AUTOSTART is true.
+func IsAutoStart() bool {
+	if strings.ToLower(os.Getenv("GIPGEE_FORCE_AUTOSTART")) == "true" {
+		log.Println("GIPGEE_FORCE_AUTOSTART is true, the pipeline starts automatically")
+		return true
+	}
+	defaultBranch := os.Getenv("CI_DEFAULT_BRANCH")
+	if os.Getenv("CI_PIPELINE_SOURCE") == "web" && defaultBranch != "" && os.Getenv("CI_COMMIT_BRANCH") == defaultBranch {
+		log.Println("Manually triggered pipeline on the default branch, the image builds have to be started manually")
+		return false
+	}
+	return true
+}
+
+// getTestAllowFailure lets the test job end with a warning instead of an error
+// if the test has been skipped.
+func getTestAllowFailure(execution *c.TestExecution) *pm.JobAllowFailure {
+	if len(execution.ExitCodes.Skip) == 0 {
+		return nil
+	}
+	return &pm.JobAllowFailure{
+		Allowed:   &[]bool{true}[0],
+		ExitCodes: &[]int{SkippedTestExitCode},
+	}
+}
+
+// getTestArtifacts maps the configured test artifacts and reports to the job artifacts.
+func getTestArtifacts(artifacts *c.TestSuiteArtifacts) *pm.JobArtifacts {
+	if artifacts == nil {
+		return nil
+	}
+	jobArtifacts := pm.JobArtifacts{
+		Paths: artifacts.Paths,
+		When:  artifacts.When,
+	}
+	if artifacts.ExpireIn != nil {
+		jobArtifacts.ExpireIn = *artifacts.ExpireIn
+	}
+	if artifacts.ExposeAs != nil {
+		jobArtifacts.ExposeAs = *artifacts.ExposeAs
+	}
+	if reports := artifacts.Reports; reports != nil {
+		jobArtifacts.Reports = &pm.JobArtifactsReports{
+			Junit:             reports.Junit,
+			Codequality:       reports.Codequality,
+			ContainerScanning: reports.ContainerScanning,
+			Cyclonedx:         reports.Cyclonedx,
+		}
+		if reports.Dotenv != nil {
+			jobArtifacts.Reports.Dotenv = *reports.Dotenv
+		}
+		if jobArtifacts.When == nil {
+			// test reports are most interesting if tests fail
+			jobArtifacts.When = &[]string{"always"}[0]
+		}
+	}
+	return &jobArtifacts
+}
+
+func generateDockerAuthConfig(config *c.Config, imageIds []string) string {
 	env, exists := os.LookupEnv("DOCKER_AUTH_CONFIG")
 	dockerAuthConfig := &docker.DockerAuths{Auths: make(map[string]docker.DockerAuth)}
 	if exists {
@@ -228,7 +762,8 @@ func generateDockerAuthConfig(config *c.Config) string {
 	// in the image build pipeline we - currently - only need the staging location as DOCKER_AUTH_CONFIG because
 	// only the test jobs download the images via gitlab. The release to staging skopeo job or the kaniko build
 	// both craft their credentials manually and do not depend on the DOCKER_AUTH_CONFIG
-	for imageId, imageConfig := range config.Images {
+	for _, imageId := range imageIds {
+		imageConfig := config.Images[imageId]
 		if imageConfig.StagingLocation.Credentials != nil {
 			_, exists := dockerAuthConfig.Auths[*imageConfig.StagingLocation.Registry]
 			if exists {
@@ -267,18 +802,13 @@ func (*ImagesToBuildSelectorImpl) SelectImagesToBuild(imageSelectionFile string,
 	// If an image selection file is defined, always choose this.
 	if imageSelectionFile != "" {
 		log.Printf("Image selection file defined ('%s'), loading image selection.\n", imageSelectionFile)
-		bytes, err := os.ReadFile(imageSelectionFile) // #nosec G304
+		selection, err := LoadImageSelection(imageSelectionFile)
 		if err != nil {
 			panic(err)
 		}
-		imagesToLoadMap := make(map[string]bool, 0)
-		err = json.Unmarshal(bytes, &imagesToLoadMap)
-		if err != nil {
-			panic(err)
-		}
-		for key := range imagesToLoadMap {
-			log.Printf("Added image with id '%s'\n", key)
-			imagesToBuild = append(imagesToBuild, key)
+		for _, imageId := range selection.ImageIds() {
+			log.Printf("Added image with id '%s' (reasons: %s)\n", imageId, strings.Join(selection[imageId].Reasons, "; "))
+			imagesToBuild = append(imagesToBuild, imageId)
 		}
 
 		return imagesToBuild
@@ -294,10 +824,7 @@ func (*ImagesToBuildSelectorImpl) SelectImagesToBuild(imageSelectionFile string,
 	// 3) If it's a manually triggered build: rebuild everything
 	// 4) Everything else (scheduled, ...): select no image
 
-	for key := range config.Images {
-		imagesToBuild = append(imagesToBuild, key)
-	}
-	return imagesToBuild
+	return config.ImageIds()
 }
 
 func (params *GeneratePipelineCmd) Run() error {
@@ -312,8 +839,14 @@ func (params *GeneratePipelineCmd) Run() error {
 		FIXME: select depending on git diff
 	*/
 
+	// Merge request pipelines only build and test the images, the release happens after the merge
+	mergeRequest := MergeRequestFromEnv()
+	if mergeRequest != nil {
+		log.Printf("Detected merge request pipeline for merge request !%s, not releasing the images\n", mergeRequest.Iid)
+	}
+
 	var generator = NewBuildPipelineGenerator(
-		config, imagesToBuild, true, params.PipelineFile, params.ConfigFileName, params.GipgeeImage,
+		config, imagesToBuild, IsAutoStart(), mergeRequest == nil, mergeRequest, params.PipelineFile, params.ConfigFileName, params.GipgeeImage,
 	)
 
 	pipeline := generator.GeneratePipeline()
@@ -0,0 +1,179 @@
+package imagebuild
+
+import (
+	"testing"
+
+	c "github.com/devfbe/gipgee/config"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestGetTestArtifacts(t *testing.T) {
+	if getTestArtifacts(nil) != nil {
+		t.Error("no artifacts configured should result in no job artifacts")
+	}
+
+	artifacts := getTestArtifacts(&c.TestSuiteArtifacts{
+		Paths:    []string{"results/"},
+		ExpireIn: &[]string{"1 week"}[0],
+		ExposeAs: &[]string{"test results"}[0],
+		Reports: &c.TestReports{
+			Junit:       []string{"results/junit.xml"},
+			Codequality: []string{"results/codequality.json"},
+		},
+	})
+	rendered, err := yaml.Marshal(artifacts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `paths:
+    - results/
+when: always
+expire_in: 1 week
+expose_as: test results
+reports:
+    junit:
+        - results/junit.xml
+    codequality:
+        - results/codequality.json
+`
+	if string(rendered) != expected {
+		t.Errorf("rendered artifacts\n%s\ndon't match expected\n%s", string(rendered), expected)
+	}
+
+	artifacts = getTestArtifacts(&c.TestSuiteArtifacts{
+		Paths: []string{"results/"},
+		When:  &[]string{"on_failure"}[0],
+		Reports: &c.TestReports{
+			Dotenv: &[]string{"test.env"}[0],
+		},
+	})
+	expectedArtifacts := pm.JobArtifacts{
+		Paths:   []string{"results/"},
+		When:    &[]string{"on_failure"}[0],
+		Reports: &pm.JobArtifactsReports{Dotenv: "test.env"},
+	}
+	if *artifacts.When != *expectedArtifacts.When || artifacts.Reports.Dotenv != expectedArtifacts.Reports.Dotenv {
+		t.Errorf("artifacts '%+v' don't match expected '%+v'", artifacts, expectedArtifacts)
+	}
+}
+
+func TestIsAutoStart(t *testing.T) {
+	t.Setenv("CI_DEFAULT_BRANCH", "main")
+	t.Setenv("CI_COMMIT_BRANCH", "main")
+	t.Setenv("CI_PIPELINE_SOURCE", "push")
+	t.Setenv("GIPGEE_FORCE_AUTOSTART", "")
+	if !IsAutoStart() {
+		t.Error("push pipelines should start automatically")
+	}
+	t.Setenv("CI_PIPELINE_SOURCE", "web")
+	if IsAutoStart() {
+		t.Error("manually triggered default branch pipelines should not start automatically")
+	}
+	t.Setenv("GIPGEE_FORCE_AUTOSTART", "true")
+	if !IsAutoStart() {
+		t.Error("GIPGEE_FORCE_AUTOSTART should force the auto start")
+	}
+	t.Setenv("GIPGEE_FORCE_AUTOSTART", "")
+	t.Setenv("CI_COMMIT_BRANCH", "feature")
+	if !IsAutoStart() {
+		t.Error("manually triggered feature branch pipelines should start automatically")
+	}
+}
+
+func TestManualStartGatesFirstJob(t *testing.T) {
+	config := loadTestConfig(t)
+	pipeline := NewBuildPipelineGenerator(config, []string{"imageWithoutDefaults"}, false, true, nil, ".gipgee-gitlab-ci.yml", "gipgee.yml", "").GeneratePipeline()
+	manualJobs := make([]string, 0)
+	for _, job := range pipeline.Jobs {
+		if job.When == pm.WhenManual {
+			manualJobs = append(manualJobs, job.Name)
+			if job.AllowFailure == nil || job.AllowFailure.Allowed == nil || *job.AllowFailure.Allowed {
+				t.Errorf("manual job '%s' must not allow failure, otherwise it doesn't block the chain", job.Name)
+			}
+			if job.ManualConfirmation != "This builds, tests and releases image 'imageWithoutDefaults'. Continue?" {
+				t.Errorf("unexpected manual confirmation '%s'", job.ManualConfirmation)
+			}
+		}
+	}
+	if len(manualJobs) != 1 || manualJobs[0] != "🐋 Build staging image imageWithoutDefaults using kaniko" {
+		t.Errorf("expected only the build job to be manual, manual jobs are %v", manualJobs)
+	}
+	// rendering validates the when / manual_confirmation combination
+	if _, err := pipeline.Render(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSemverReleaseTagsArePassedToTheJobs(t *testing.T) {
+	config := loadTestConfig(t)
+	pipeline := NewBuildPipelineGenerator(config, []string{"imageWithoutDefaults"}, true, true, nil, ".gipgee-gitlab-ci.yml", "gipgee.yml", "").GeneratePipeline()
+	if _, exists := pipeline.Variables[c.SemverReleaseTagsVarName]; exists {
+		t.Errorf("%s must only be set in tag pipelines", c.SemverReleaseTagsVarName)
+	}
+
+	config.SemverReleaseTags = []string{"1.4.2", "1.4", "1", "latest"}
+	pipeline = NewBuildPipelineGenerator(config, []string{"imageWithoutDefaults"}, true, true, nil, ".gipgee-gitlab-ci.yml", "gipgee.yml", "").GeneratePipeline()
+	if value := pipeline.Variables[c.SemverReleaseTagsVarName]; value != "1.4.2,1.4,1,latest" {
+		t.Errorf("%s is '%v', expected the release tags of the generator", c.SemverReleaseTagsVarName, value)
+	}
+}
+
+func TestHookJobsAreWiredIntoTheNeedsGraph(t *testing.T) {
+	config := loadTestConfig(t)
+	name := func(n string) *string { return &n }
+	config.Hooks = &c.Hooks{
+		Jobs: []*c.HookJob{
+			{Name: name("compliance"), Point: name(c.HookPointPreBuild), Script: []string{"./compliance.sh"}},
+			{Name: name("approve"), Point: name(c.HookPointPostTest), Script: []string{"./approve.sh"}},
+			{Name: name("notify"), Point: name(c.HookPointPostRelease), Script: []string{"./notify.sh"}, AllowFailure: true},
+			{Name: name("other image"), Point: name(c.HookPointPreBuild), Images: []string{"otherImage"}, Script: []string{"exit 1"}},
+		},
+		Phases: map[string]*c.PhaseExtension{
+			c.PhaseBuild: {BeforeScript: []string{"./setup-proxy.sh"}, Variables: map[string]interface{}{"HTTPS_PROXY": "http://proxy:3128"}},
+		},
+	}
+	pipeline := NewBuildPipelineGenerator(config, []string{"imageWithoutDefaults"}, false, true, nil, ".gipgee-gitlab-ci.yml", "gipgee.yml", "").GeneratePipeline()
+	jobs := make(map[string]*pm.Job)
+	for _, job := range pipeline.Jobs {
+		jobs[job.Name] = job
+	}
+	needs := func(job *pm.Job, needed *pm.Job) bool {
+		for _, need := range job.Needs {
+			if need.Job == needed {
+				return true
+			}
+		}
+		return false
+	}
+
+	compliance := jobs["🪝 compliance imageWithoutDefaults"]
+	build := jobs["🐋 Build staging image imageWithoutDefaults using kaniko"]
+	approve := jobs["🪝 approve imageWithoutDefaults"]
+	release := jobs["✨ Release staging image imageWithoutDefaults"]
+	notify := jobs["🪝 notify imageWithoutDefaults"]
+	if compliance == nil || approve == nil || notify == nil {
+		t.Fatalf("hook jobs are missing, jobs are %v", pipeline.Jobs)
+	}
+	if _, exists := jobs["🪝 other image imageWithoutDefaults"]; exists {
+		t.Error("hook restricted to another image must not be generated")
+	}
+	if (*compliance.Variables)["GIPGEE_IMAGE_ID"] != "imageWithoutDefaults" {
+		t.Errorf("hook job should know the image id, variables are %v", *compliance.Variables)
+	}
+	if compliance.When != pm.WhenManual || build.When != "" {
+		t.Error("the pre-build hook is the first job of the chain and should be gated instead of the build")
+	}
+	if !needs(build, compliance) || !needs(approve, build) || !needs(release, approve) || !needs(notify, release) {
+		t.Error("hook jobs are not wired into the needs graph")
+	}
+	if notify.AllowFailure == nil || !*notify.AllowFailure.Allowed {
+		t.Error("notify hook should allow failure")
+	}
+	if build.BeforeScript[0] != "./setup-proxy.sh" || (*build.Variables)["HTTPS_PROXY"] != "http://proxy:3128" {
+		t.Errorf("build phase extension not applied, before_script is %v", build.BeforeScript)
+	}
+	if _, err := pipeline.Render(); err != nil {
+		t.Error(err)
+	}
+}
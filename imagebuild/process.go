@@ -0,0 +1,25 @@
+//go:build !windows
+
+package imagebuild
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+func prepareProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessGroup sends SIGTERM to the process group and SIGKILL if the processes
+// don't exit within the grace period. It consumes the result of cmd.Wait() from done.
+func terminateProcessGroup(cmd *exec.Cmd, done <-chan error, gracePeriod time.Duration) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(gracePeriod):
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+	}
+}
@@ -0,0 +1,14 @@
+package imagebuild
+
+import (
+	"os/exec"
+	"time"
+)
+
+func prepareProcessGroup(cmd *exec.Cmd) {}
+
+// terminateProcessGroup kills the test process, there are no process groups on windows.
+func terminateProcessGroup(cmd *exec.Cmd, done <-chan error, gracePeriod time.Duration) {
+	_ = cmd.Process.Kill()
+	<-done
+}
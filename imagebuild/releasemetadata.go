@@ -0,0 +1,78 @@
+package imagebuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+// ReleaseMetadata is written by the release job and kept as job artifact. It documents
+// what has been released and on which base image it is built.
+type ReleaseMetadata struct {
+	ImageId          string            `json:"imageId"`
+	Digest           string            `json:"digest"`
+	StagingImage     string            `json:"stagingImage"`
+	ReleaseLocations []string          `json:"releaseLocations"`
+	BaseImage        BaseImageMetadata `json:"baseImage"`
+	GitCommitSha     string            `json:"gitCommitSha,omitempty"`
+	PipelineUrl      string            `json:"pipelineUrl,omitempty"`
+}
+
+type BaseImageMetadata struct {
+	Reference         string `json:"reference"`
+	Digest            string `json:"digest,omitempty"`
+	SignatureVerified bool   `json:"signatureVerified"`
+	VerifiedBy        string `json:"verifiedBy,omitempty"`
+}
+
+type WriteReleaseMetadataCmd struct {
+	ImageId             string `arg:""`
+	ConfigFileName      string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	OutputFile          string `required:""`
+	Digest              string `required:"" env:"GIPGEE_STAGING_IMAGE_DIGEST"`
+	BaseImageDigest     string `optional:"" env:"GIPGEE_BASE_IMAGE_DIGEST"`
+	BaseImageVerifiedBy string `optional:"" env:"GIPGEE_BASE_IMAGE_VERIFIED_BY"`
+}
+
+func (*WriteReleaseMetadataCmd) Help() string {
+	return "Only for gipgee internal use in the image build pipeline"
+}
+
+func (cmd *WriteReleaseMetadataCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	imageConfig, exists := config.Images[cmd.ImageId]
+	if !exists {
+		return fmt.Errorf("image with id '%s' does not exist in the configuration", cmd.ImageId)
+	}
+
+	metadata := ReleaseMetadata{
+		ImageId:          cmd.ImageId,
+		Digest:           cmd.Digest,
+		StagingImage:     imageConfig.StagingLocation.DigestReference(cmd.Digest),
+		ReleaseLocations: make([]string, 0, len(imageConfig.ReleaseLocations)),
+		BaseImage: BaseImageMetadata{
+			Reference:         imageConfig.BaseImage.String(),
+			Digest:            cmd.BaseImageDigest,
+			SignatureVerified: cmd.BaseImageVerifiedBy != "",
+			VerifiedBy:        cmd.BaseImageVerifiedBy,
+		},
+		GitCommitSha: os.Getenv("CI_COMMIT_SHA"),
+		PipelineUrl:  os.Getenv("CI_PIPELINE_URL"),
+	}
+	for _, releaseLocation := range imageConfig.ReleaseLocations {
+		metadata.ReleaseLocations = append(metadata.ReleaseLocations, releaseLocation.ReleaseReferences()...)
+	}
+
+	metadataJson, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	log.Printf("Release metadata of image '%s':\n%s\n", cmd.ImageId, metadataJson)
+	return os.WriteFile(cmd.OutputFile, metadataJson, 0600)
+}
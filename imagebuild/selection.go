@@ -0,0 +1,74 @@
+package imagebuild
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ImageSelection is the content of the image selection file. It maps the ids of the
+// images to rebuild to the reasons why they have been selected.
+type ImageSelection map[string]*ImageSelectionEntry
+
+type ImageSelectionEntry struct {
+	Reasons []string `json:"reasons"`
+}
+
+// Add selects the image with the given reason. An image can be selected for multiple reasons.
+func (selection ImageSelection) Add(imageId string, reason string) {
+	entry, exists := selection[imageId]
+	if !exists {
+		entry = &ImageSelectionEntry{Reasons: make([]string, 0)}
+		selection[imageId] = entry
+	}
+	entry.Reasons = append(entry.Reasons, reason)
+}
+
+// ImageIds returns the sorted ids of all selected images.
+func (selection ImageSelection) ImageIds() []string {
+	imageIds := make([]string, 0, len(selection))
+	for imageId := range selection {
+		imageIds = append(imageIds, imageId)
+	}
+	sort.Strings(imageIds)
+	return imageIds
+}
+
+func (selection ImageSelection) WriteToFile(path string) error {
+	selectionJson, err := json.MarshalIndent(selection, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, selectionJson, 0600)
+}
+
+// LoadImageSelection loads an image selection file. For compatibility, the old
+// format (image id -> true) is accepted, too.
+func LoadImageSelection(path string) (ImageSelection, error) {
+	bytes, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	rawSelection := make(map[string]json.RawMessage)
+	err = json.Unmarshal(bytes, &rawSelection)
+	if err != nil {
+		return nil, err
+	}
+	selection := make(ImageSelection, len(rawSelection))
+	for imageId, raw := range rawSelection {
+		var selected bool
+		if err := json.Unmarshal(raw, &selected); err == nil {
+			if selected {
+				selection.Add(imageId, "selected in image selection file")
+			}
+			continue
+		}
+		entry := ImageSelectionEntry{}
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("invalid image selection entry for image '%s': %w", imageId, err)
+		}
+		selection[imageId] = &entry
+	}
+	return selection, nil
+}
@@ -0,0 +1,47 @@
+package imagebuild
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestImageSelectionRoundTrip(t *testing.T) {
+	selection := make(ImageSelection)
+	selection.Add("b", "package updates available")
+	selection.Add("a", "base image changed")
+	selection.Add("b", "fixable vulnerabilities")
+
+	path := filepath.Join(t.TempDir(), "selection.json")
+	err := selection.WriteToFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadImageSelection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(loaded.ImageIds(), []string{"a", "b"}) {
+		t.Errorf("unexpected image ids '%v'", loaded.ImageIds())
+	}
+	if !cmp.Equal(loaded["b"].Reasons, []string{"package updates available", "fixable vulnerabilities"}) {
+		t.Errorf("unexpected reasons '%v'", loaded["b"].Reasons)
+	}
+}
+
+func TestLoadLegacyImageSelection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "selection.json")
+	err := os.WriteFile(path, []byte(`{"a": true, "b": false}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadImageSelection(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(loaded.ImageIds(), []string{"a"}) {
+		t.Errorf("unexpected image ids '%v'", loaded.ImageIds())
+	}
+}
@@ -0,0 +1,122 @@
+package imagebuild
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	c "github.com/devfbe/gipgee/config"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+)
+
+// generateImageGroupsPipeline generates the parent pipeline of a sharded config. Each image group with
+// images to build gets a job generating its child pipeline and a trigger job running it. The trigger
+// jobs depend on their child pipelines, so the parent pipeline aggregates their results.
+func (pipelineGenerator *imageBuildPipelineGeneratorImpl) generateImageGroupsPipeline() *pm.Pipeline {
+	allInOneStage := pm.Stage{Name: "🏗️ All in One 🧪"}
+	gipgeeImageCoordinates := pipelineGenerator.getGipgeeImageCoordinates()
+	copyGipgeeToArtifact := newCopyGipgeeToArtifactJob(&allInOneStage)
+	pipelineJobs := []*pm.Job{copyGipgeeToArtifact}
+
+	for _, group := range pipelineGenerator.config.ImageGroups() {
+		imagesToBuild := group.Filter(pipelineGenerator.imagesToBuild)
+		if len(imagesToBuild) == 0 {
+			log.Printf("No images of image group '%s' are built, not generating its child pipeline\n", group.Name)
+			continue
+		}
+		log.Printf("Building child pipeline jobs for image group '%s' (images: %s)\n", group.Name, strings.Join(imagesToBuild, ", "))
+		groupPipelineFile := GetImageGroupPipelineFileName(group.Name)
+		// The child pipeline doesn't see the predefined variables (pipeline source, merge request, ...) of this
+		// pipeline, so the decisions made here are passed to the generation of the child pipeline.
+		variables := map[string]interface{}{
+			"GIPGEE_IMAGE_GROUP_AUTO_START": strconv.FormatBool(pipelineGenerator.autoStart),
+			"GIPGEE_IMAGE_GROUP_RELEASE":    strconv.FormatBool(pipelineGenerator.release),
+		}
+		if pipelineGenerator.gipgeeImage != "" {
+			variables["GIPGEE_OVERWRITE_GIPGEE_IMAGE"] = pipelineGenerator.gipgeeImage
+		}
+		generateGroupPipelineJob := pm.Job{
+			Name:   "🧩 Generate pipeline for image group " + group.Name,
+			Stage:  &allInOneStage,
+			Script: []string{fmt.Sprintf("./.gipgee/gipgee image-build generate-group-pipeline '%s' --images '%s' --pipeline-file %s", group.Name, strings.Join(imagesToBuild, ","), groupPipelineFile)},
+			Needs: []pm.JobNeeds{
+				{Job: copyGipgeeToArtifact, Artifacts: true},
+			},
+			Variables: &variables,
+			Artifacts: &pm.JobArtifacts{
+				Paths: []string{groupPipelineFile},
+			},
+		}
+		triggerGroupPipelineJob := pm.Job{
+			Name:  GetImageGroupTriggerJobName(group.Name),
+			Stage: &allInOneStage,
+			Trigger: &pm.JobTrigger{
+				Include: []pm.JobTriggerInclude{{
+					Artifact: groupPipelineFile,
+					Job:      &generateGroupPipelineJob,
+				}},
+				Strategy: "depend",
+			},
+			Needs: []pm.JobNeeds{
+				{Job: &generateGroupPipelineJob, Artifacts: true},
+			},
+		}
+		pipelineJobs = append(pipelineJobs, &generateGroupPipelineJob, &triggerGroupPipelineJob)
+	}
+
+	if pipelineGenerator.mergeRequest != nil {
+		pipelineJobs = append(pipelineJobs, pipelineGenerator.newCommentPlanJob(&allInOneStage, copyGipgeeToArtifact))
+	}
+
+	pipeline := pm.Pipeline{
+		Default: &pm.PipelineDefault{Image: &gipgeeImageCoordinates},
+		Stages:  []*pm.Stage{&allInOneStage},
+		Jobs:    pipelineJobs,
+		Variables: map[string]interface{}{
+			"GIPGEE_CONFIG_FILE_NAME": pipelineGenerator.configFile,
+		},
+	}
+	pipelineGenerator.addSemverReleaseTagsVariable(pipeline.Variables)
+	return &pipeline
+}
+
+type GenerateGroupPipelineCmd struct {
+	ImageGroup         string   `arg:"" help:"Name of the image group"`
+	Images             []string `help:"Images to build, images which are not part of the group are ignored" optional:"" xor:"selection"`
+	ImageSelectionFile string   `help:"Select the images to build with an image selection file instead of --images" optional:"" xor:"selection"`
+	AutoStart          bool     `help:"Start the image builds automatically" env:"GIPGEE_IMAGE_GROUP_AUTO_START" default:"true"`
+	Release            bool     `help:"Release the images" env:"GIPGEE_IMAGE_GROUP_RELEASE" default:"true"`
+	PipelineFile       string   `help:"Set the name of the pipeline file" required:""`
+	ConfigFileName     string   `help:"Set the name of the gipgee config file" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
+	GipgeeImage        string   `help:"Overwrite the gipgee container image" env:"GIPGEE_OVERWRITE_GIPGEE_IMAGE" optional:""`
+}
+
+func (*GenerateGroupPipelineCmd) Help() string {
+	return "Only for gipgee internal use, generates the child pipeline of an image group if the images are sharded"
+}
+
+func (cmd *GenerateGroupPipelineCmd) Run() error {
+	config, err := c.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	if config.Sharding == nil {
+		return fmt.Errorf("config '%s' doesn't shard the images into groups", cmd.ConfigFileName)
+	}
+	group := config.GetImageGroup(cmd.ImageGroup)
+	if group == nil {
+		return fmt.Errorf("image group '%s' does not exist", cmd.ImageGroup)
+	}
+	imagesToBuild := cmd.Images
+	if cmd.ImageSelectionFile != "" {
+		selection, err := LoadImageSelection(cmd.ImageSelectionFile)
+		if err != nil {
+			return err
+		}
+		imagesToBuild = selection.ImageIds()
+	}
+	log.Printf("Generating child pipeline of image group '%s' (images: %s)\n", group.Name, strings.Join(group.Filter(imagesToBuild), ", "))
+	pipeline := NewImageGroupPipelineGenerator(config, group, imagesToBuild, cmd.AutoStart, cmd.Release, cmd.PipelineFile, cmd.ConfigFileName, cmd.GipgeeImage).GeneratePipeline()
+	return pipeline.WritePipelineToFile(cmd.PipelineFile)
+}
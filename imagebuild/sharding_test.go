@@ -0,0 +1,61 @@
+package imagebuild
+
+import (
+	"strings"
+	"testing"
+
+	c "github.com/devfbe/gipgee/config"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+)
+
+func jobNames(pipeline *pm.Pipeline) []string {
+	names := make([]string, 0, len(pipeline.Jobs))
+	for _, job := range pipeline.Jobs {
+		names = append(names, job.Name)
+	}
+	return names
+}
+
+func TestShardedBuildPipeline(t *testing.T) {
+	config := loadTestConfig(t)
+	config.Sharding = &c.Sharding{GroupSize: &[]int{2}[0], GroupBy: &[]string{c.GroupByNone}[0]}
+	// group+1: imageWithDefaults, imageWithEmptyButSetStagingLocation, group+2: imageWithFixedRepositoryInStagingLocation, imageWithoutDefaults
+	pipeline := NewBuildPipelineGenerator(config, []string{"imageWithDefaults", "imageWithoutDefaults"}, false, true, nil, ".gipgee-gitlab-ci.yml", "gipgee.yml", "").GeneratePipeline()
+	expectedJobs := []string{
+		"🧰 provide gipgee binary as artifact",
+		"🧩 Generate pipeline for image group group+1",
+		"🚀 Build image group group+1",
+		"🧩 Generate pipeline for image group group+2",
+		"🚀 Build image group group+2",
+	}
+	if names := jobNames(pipeline); strings.Join(names, "\n") != strings.Join(expectedJobs, "\n") {
+		t.Errorf("jobs are %v but should be %v", names, expectedJobs)
+	}
+	generateJob := pipeline.Jobs[3]
+	if generateJob.Script[0] != "./.gipgee/gipgee image-build generate-group-pipeline 'group+2' --images 'imageWithoutDefaults' --pipeline-file .gipgee-gitlab-ci-group+2.yml" {
+		t.Errorf("unexpected script %v", generateJob.Script)
+	}
+	if (*generateJob.Variables)["GIPGEE_IMAGE_GROUP_AUTO_START"] != "false" || (*generateJob.Variables)["GIPGEE_IMAGE_GROUP_RELEASE"] != "true" {
+		t.Errorf("the decisions of the parent pipeline are not passed to the group, variables are %v", *generateJob.Variables)
+	}
+	if _, err := pipeline.Render(); err != nil {
+		t.Error(err)
+	}
+
+	group := config.GetImageGroup("group+2")
+	groupPipeline := NewImageGroupPipelineGenerator(config, group, []string{"imageWithDefaults", "imageWithoutDefaults"}, false, true, ".gipgee-gitlab-ci-group+2.yml", "gipgee.yml", "").GeneratePipeline()
+	if names := strings.Join(jobNames(groupPipeline), "\n"); !strings.Contains(names, "🐋 Build staging image imageWithoutDefaults using kaniko") {
+		t.Errorf("group pipeline doesn't build imageWithoutDefaults, jobs are %v", names)
+	}
+	for _, job := range groupPipeline.Jobs {
+		if strings.Contains(job.Name, "imageWithDefaults") {
+			t.Errorf("group pipeline contains job '%s' of an image of another group", job.Name)
+		}
+		if job.When == pm.WhenManual && job.Name != "🐋 Build staging image imageWithoutDefaults using kaniko" {
+			t.Errorf("unexpected manual job '%s'", job.Name)
+		}
+	}
+	if _, err := groupPipeline.Render(); err != nil {
+		t.Error(err)
+	}
+}
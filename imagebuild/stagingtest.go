@@ -0,0 +1,180 @@
+package imagebuild
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/git"
+)
+
+const (
+	// SkippedTestExitCode is the exit code of exec-staging-image-test for skipped tests. The
+	// test jobs allow failure with this exit code, so skipped tests show up as warning.
+	SkippedTestExitCode = 77
+	// terminationGracePeriod is the time between SIGTERM and SIGKILL if a test times out.
+	terminationGracePeriod = 10 * time.Second
+)
+
+// ExitCodeError is returned by commands that end with a specific exit code instead of the generic
+// failure exit code, e.g. skipped tests. The main function exits with the code.
+type ExitCodeError struct {
+	Code    int
+	Message string
+}
+
+func (err *ExitCodeError) Error() string {
+	return err.Message
+}
+
+type testOutcome int
+
+const (
+	testPassed testOutcome = iota
+	testFailed
+	testSkipped
+)
+
+func (outcome testOutcome) String() string {
+	return [...]string{"passed", "failed", "skipped"}[outcome]
+}
+
+func getTestResultsDir(imageId, suite string) string {
+	baseDir, exists := os.LookupEnv("CI_PROJECT_DIR")
+	if !exists {
+		baseDir = "."
+	}
+	dir := filepath.Join(baseDir, "gipgee-test-results", imageId)
+	if suite != "" {
+		dir = filepath.Join(dir, strings.ReplaceAll(suite, string(filepath.Separator), "_"))
+	}
+	return dir
+}
+
+// getStagingTestEnv returns the GIPGEE_* env vars of the test contract, see docs/TestEnvironment.md.
+func getStagingTestEnv(imageConfig *cfg.Image, suite, resultsDir string) map[string]string {
+	stagingImage := imageConfig.StagingLocation.String()
+	digest := os.Getenv(StagingImageDigestVarName)
+	if digest != "" {
+		stagingImage = imageConfig.StagingLocation.DigestReference(digest)
+	}
+	releaseLocations := make([]string, 0, len(imageConfig.ReleaseLocations))
+	for _, location := range imageConfig.ReleaseLocations {
+		releaseLocations = append(releaseLocations, location.ReleaseReferences()...)
+	}
+	gitSha, exists := os.LookupEnv("CI_COMMIT_SHA")
+	if !exists {
+		gitSha = git.GetCurrentGitRevisionHex()
+	}
+	return map[string]string{
+		"GIPGEE_IMAGE_ID":          imageConfig.Id,
+		"GIPGEE_TEST_SUITE":        suite,
+		"GIPGEE_STAGING_IMAGE":     stagingImage,
+		StagingImageDigestVarName:  digest,
+		"GIPGEE_BASE_IMAGE":        imageConfig.BaseImage.String(),
+		"GIPGEE_RELEASE_LOCATIONS": strings.Join(releaseLocations, " "),
+		"GIPGEE_GIT_SHA":           gitSha,
+		"GIPGEE_TEST_RESULTS_DIR":  resultsDir,
+	}
+}
+
+func getTestOutcome(exitCode int, exitCodes *cfg.TestExitCodes) testOutcome {
+	for _, code := range exitCodes.Pass {
+		if code == exitCode {
+			return testPassed
+		}
+	}
+	for _, code := range exitCodes.Skip {
+		if code == exitCode {
+			return testSkipped
+		}
+	}
+	return testFailed
+}
+
+// runTestCommand executes the command in its own process group, so that the whole process
+// tree can be terminated when the timeout (0 means no timeout) is exceeded.
+func runTestCommand(command []string, env []string, timeout time.Duration) (int, bool, error) {
+	cmd := exec.Command(command[0], command[1:]...) // #nosec G204
+	cmd.Env = env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	prepareProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return 0, false, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			return 0, false, nil
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), false, nil
+		}
+		return 0, false, err
+	case <-timeoutChan:
+		terminateProcessGroup(cmd, done, terminationGracePeriod)
+		return -1, true, nil
+	}
+}
+
+func executeStagingImageTest(imageConfig *cfg.Image, suite string, command []string, execution *cfg.TestExecution) (testOutcome, error) {
+	resultsDir := getTestResultsDir(imageConfig.Id, suite)
+	if err := os.MkdirAll(resultsDir, 0750); err != nil {
+		return testFailed, fmt.Errorf("cannot create test results dir '%s': %w", resultsDir, err)
+	}
+	var timeout time.Duration
+	if execution.CommandTimeout != nil {
+		var err error
+		timeout, err = time.ParseDuration(*execution.CommandTimeout)
+		if err != nil {
+			return testFailed, err
+		}
+	}
+
+	testEnv := getStagingTestEnv(imageConfig, suite, resultsDir)
+	// the image id is appended for compatibility with test scripts written before the env vars existed
+	commandWithArgs := append(append([]string{}, command...), imageConfig.Id)
+
+	outcome := testFailed
+	for attempt := 1; attempt <= execution.Retries+1; attempt++ {
+		env := os.Environ()
+		for key, value := range testEnv {
+			env = append(env, key+"="+value)
+		}
+		env = append(env, "GIPGEE_TEST_ATTEMPT="+strconv.Itoa(attempt))
+
+		exitCode, timedOut, err := runTestCommand(commandWithArgs, env, timeout)
+		if err != nil {
+			return testFailed, err
+		}
+		if timedOut {
+			log.Printf("Test attempt %d of image '%s' timed out after %s\n", attempt, imageConfig.Id, timeout)
+			outcome = testFailed
+		} else {
+			outcome = getTestOutcome(exitCode, execution.ExitCodes)
+			log.Printf("Test attempt %d of image '%s' exited with code %d (%s)\n", attempt, imageConfig.Id, exitCode, outcome)
+		}
+		if outcome != testFailed {
+			break
+		}
+	}
+	return outcome, nil
+}
@@ -0,0 +1,122 @@
+package imagebuild
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+func TestGetTestOutcome(t *testing.T) {
+	exitCodes := &cfg.TestExitCodes{Pass: []int{0, 3}, Skip: []int{77}}
+	for exitCode, expected := range map[int]testOutcome{0: testPassed, 3: testPassed, 77: testSkipped, 1: testFailed, -1: testFailed} {
+		if outcome := getTestOutcome(exitCode, exitCodes); outcome != expected {
+			t.Errorf("exit code %d results in '%s', expected '%s'", exitCode, outcome, expected)
+		}
+	}
+}
+
+func TestRunTestCommandTimeout(t *testing.T) {
+	start := time.Now()
+	_, timedOut, err := runTestCommand([]string{"sh", "-c", "sleep 30 & wait"}, os.Environ(), 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !timedOut {
+		t.Error("command should have timed out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("terminating the test took %s, the process group should have been terminated with SIGTERM", elapsed)
+	}
+}
+
+func TestExecuteStagingImageTest(t *testing.T) {
+	projectDir := t.TempDir()
+	t.Setenv("CI_PROJECT_DIR", projectDir)
+	t.Setenv("CI_COMMIT_SHA", "0123456789abcdef")
+	t.Setenv(StagingImageDigestVarName, "sha256:abc")
+
+	str := func(s string) *string { return &s }
+	imageConfig := &cfg.Image{
+		Id:              "foo",
+		StagingLocation: &cfg.ImageLocation{Registry: str("staging.example.com"), Repository: str("foo"), Tag: str("foo-0123456")},
+		BaseImage:       &cfg.ImageLocation{Registry: str("docker.io"), Repository: str("alpine"), Tag: str("latest")},
+		ReleaseLocations: []*cfg.ImageLocation{
+			{Registry: str("release.example.com"), Repository: str("foo"), Tag: str("latest"), ReleaseTags: []string{"latest"}},
+			{Registry: str("release.example.com"), Repository: str("foo"), ReleaseTags: []string{"1.4.2", "1"}},
+		},
+	}
+	execution := &cfg.TestExecution{
+		Retries:   2,
+		ExitCodes: &cfg.TestExitCodes{Pass: []int{0}, Skip: []int{77}},
+	}
+	// the first attempt fails, the second one is skipped, so there is no third attempt
+	script := `echo "$1 $GIPGEE_TEST_SUITE $GIPGEE_TEST_ATTEMPT $GIPGEE_STAGING_IMAGE $GIPGEE_GIT_SHA $GIPGEE_RELEASE_LOCATIONS" >> "$GIPGEE_TEST_RESULTS_DIR/log"
+[ "$GIPGEE_TEST_ATTEMPT" -lt 2 ] && exit 1
+exit 77`
+	outcome, err := executeStagingImageTest(imageConfig, "smoke", []string{"sh", "-c", script, "sh"}, execution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcome != testSkipped {
+		t.Errorf("outcome is '%s', expected '%s'", outcome, testSkipped)
+	}
+
+	log, err := os.ReadFile(filepath.Join(projectDir, "gipgee-test-results", "foo", "smoke", "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `foo smoke 1 staging.example.com/foo@sha256:abc 0123456789abcdef release.example.com/foo:latest release.example.com/foo:1.4.2 release.example.com/foo:1
+foo smoke 2 staging.example.com/foo@sha256:abc 0123456789abcdef release.example.com/foo:latest release.example.com/foo:1.4.2 release.example.com/foo:1
+`
+	if string(log) != expected {
+		t.Errorf("test log\n%s\ndoesn't match expected\n%s", string(log), expected)
+	}
+}
+
+func TestExecStagingImageTestCmdSkipped(t *testing.T) {
+	projectDir := t.TempDir()
+	t.Setenv("CI_PROJECT_DIR", projectDir)
+	t.Setenv("CI_COMMIT_SHA", "0123456789abcdef")
+	t.Setenv(StagingImageDigestVarName, "sha256:abc")
+	configFileName := filepath.Join(projectDir, "gipgee.yml")
+	config := `
+version: 1
+images:
+  foo:
+    containerFile: Containerfile
+    baseImage:
+      registry: docker.io
+      repository: alpine
+      tag: latest
+    stagingLocation:
+      registry: staging.example.com
+      repository: foo
+    releaseLocations:
+      - registry: release.example.com
+        repository: foo
+        tag: latest
+    updateCheckCommand: ["gipgee", "update-check"]
+    testCommand: ["sh", "-c", "exit 77"]
+    testExecution:
+      exitCodes:
+        skip: [77]
+    assetsToWatch: []
+`
+	if err := os.WriteFile(configFileName, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := ExecStagingImageTestCmd{ImageId: "foo", ConfigFileName: configFileName}
+	err := cmd.Run()
+	exitCodeError := &ExitCodeError{}
+	if !errors.As(err, &exitCodeError) || exitCodeError.Code != SkippedTestExitCode {
+		t.Fatalf("error is '%v' but should be an exit code error with code %d", err, SkippedTestExitCode)
+	}
+	if exitCodeError.Error() != "test of image 'foo' skipped" {
+		t.Errorf("unexpected error message '%s'", exitCodeError.Error())
+	}
+}
@@ -0,0 +1,178 @@
+package pipelinemodel
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// expressionValue is an operand of a rules expression. Undefined variables are null.
+type expressionValue struct {
+	value  string
+	isNull bool
+	regex  string // set for /pattern/flags literals
+}
+
+func (value expressionValue) truthy() bool {
+	return !value.isNull && (value.value != "" || value.regex != "")
+}
+
+type expressionParser struct {
+	expression string
+	tokens     []string
+	position   int
+	variables  map[string]string
+}
+
+var expressionTokenPattern = regexp.MustCompile(`^(\$\{[A-Za-z_][A-Za-z0-9_]*\}|\$[A-Za-z_][A-Za-z0-9_]*|"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|/(?:[^/\\]|\\.)*/[a-z]*|==|!=|=~|!~|&&|\|\||\(|\)|null\b)`)
+
+// EvaluateExpression evaluates the if expression of a rule like gitlab does with the given variables. Supported
+// are variables ($VAR and ${VAR}), string, regex and null literals, the operators ==, !=, =~, !~, && and || and
+// parentheses. A variable alone is true if it's defined and not empty.
+func EvaluateExpression(expression string, variables map[string]string) (bool, error) {
+	parser := expressionParser{expression: expression, variables: variables}
+	remaining := strings.TrimSpace(expression)
+	for remaining != "" {
+		token := expressionTokenPattern.FindString(remaining)
+		if token == "" {
+			return false, fmt.Errorf("invalid expression '%s' at '%s'", expression, remaining)
+		}
+		parser.tokens = append(parser.tokens, token)
+		remaining = strings.TrimSpace(remaining[len(token):])
+	}
+	result, err := parser.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if parser.position < len(parser.tokens) {
+		return false, fmt.Errorf("invalid expression '%s', unexpected '%s'", expression, parser.tokens[parser.position])
+	}
+	return result, nil
+}
+
+func (parser *expressionParser) peek() string {
+	if parser.position < len(parser.tokens) {
+		return parser.tokens[parser.position]
+	}
+	return ""
+}
+
+func (parser *expressionParser) parseOr() (bool, error) {
+	result, err := parser.parseAnd()
+	if err != nil {
+		return false, err
+	}
+	for parser.peek() == "||" {
+		parser.position++
+		right, err := parser.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		result = result || right
+	}
+	return result, nil
+}
+
+func (parser *expressionParser) parseAnd() (bool, error) {
+	result, err := parser.parseComparison()
+	if err != nil {
+		return false, err
+	}
+	for parser.peek() == "&&" {
+		parser.position++
+		right, err := parser.parseComparison()
+		if err != nil {
+			return false, err
+		}
+		result = result && right
+	}
+	return result, nil
+}
+
+func (parser *expressionParser) parseComparison() (bool, error) {
+	if parser.peek() == "(" {
+		parser.position++
+		result, err := parser.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if parser.peek() != ")" {
+			return false, fmt.Errorf("invalid expression '%s', missing ')'", parser.expression)
+		}
+		parser.position++
+		return result, nil
+	}
+	left, err := parser.parseOperand()
+	if err != nil {
+		return false, err
+	}
+	operator := parser.peek()
+	switch operator {
+	case "==", "!=", "=~", "!~":
+		parser.position++
+	default:
+		return left.truthy(), nil
+	}
+	right, err := parser.parseOperand()
+	if err != nil {
+		return false, err
+	}
+	switch operator {
+	case "==":
+		return left.isNull == right.isNull && left.value == right.value, nil
+	case "!=":
+		return left.isNull != right.isNull || left.value != right.value, nil
+	}
+	matches, err := parser.match(left, right)
+	if err != nil {
+		return false, err
+	}
+	return matches == (operator == "=~"), nil
+}
+
+func (parser *expressionParser) match(left expressionValue, right expressionValue) (bool, error) {
+	pattern := right.regex
+	if pattern == "" && !right.isNull {
+		// the pattern can be stored in a variable, too
+		pattern = right.value
+	}
+	if !strings.HasPrefix(pattern, "/") || strings.LastIndex(pattern, "/") == 0 {
+		return false, fmt.Errorf("invalid expression '%s', '%s' is no regular expression", parser.expression, pattern)
+	}
+	flagsIndex := strings.LastIndex(pattern, "/")
+	flags := pattern[flagsIndex+1:]
+	pattern = strings.ReplaceAll(pattern[1:flagsIndex], `\/`, "/")
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid expression '%s': %w", parser.expression, err)
+	}
+	if left.isNull {
+		return false, nil
+	}
+	return compiled.MatchString(left.value), nil
+}
+
+func (parser *expressionParser) parseOperand() (expressionValue, error) {
+	token := parser.peek()
+	if token == "" {
+		return expressionValue{}, fmt.Errorf("invalid expression '%s', unexpected end", parser.expression)
+	}
+	parser.position++
+	switch {
+	case token == "null":
+		return expressionValue{isNull: true}, nil
+	case strings.HasPrefix(token, "$"):
+		name := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(token, "$"), "{"), "}")
+		value, defined := parser.variables[name]
+		return expressionValue{value: value, isNull: !defined}, nil
+	case strings.HasPrefix(token, `"`), strings.HasPrefix(token, "'"):
+		quote := token[0:1]
+		return expressionValue{value: strings.ReplaceAll(token[1:len(token)-1], `\`+quote, quote)}, nil
+	case strings.HasPrefix(token, "/"):
+		return expressionValue{regex: token}, nil
+	}
+	return expressionValue{}, fmt.Errorf("invalid expression '%s', unexpected '%s'", parser.expression, token)
+}
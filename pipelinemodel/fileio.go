@@ -6,8 +6,28 @@ import (
 )
 
 func (pipeline *Pipeline) WritePipelineToFile(path string) error {
-	yamlString := pipeline.Render()
-	fmt.Print("Generated pipeline is:\n" + yamlString)
-	err := os.WriteFile(path, []byte(yamlString), 0600)
+	return pipeline.WriteRenderedPipelineToFile(GitlabRenderer{}, path)
+}
+
+// WriteRenderedPipelineToFile renders the pipeline with the renderer of the target ci system and writes it to the file.
+func (pipeline *Pipeline) WriteRenderedPipelineToFile(renderer Renderer, path string) error {
+	rendered, err := renderer.Render(pipeline)
+	if err != nil {
+		return fmt.Errorf("generated pipeline is invalid: %w", err)
+	}
+	fmt.Print("Generated pipeline is:\n" + rendered)
+	err = os.WriteFile(path, []byte(rendered), 0600)
 	return err
 }
+
+func ReadPipelineFromFile(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := ParsePipeline(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse pipeline file '%s': %w", path, err)
+	}
+	return pipeline, nil
+}
@@ -0,0 +1,772 @@
+package pipelinemodel
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Actions used by the rendered github actions workflows
+const (
+	GithubCheckoutAction         = "actions/checkout@v4"
+	GithubUploadArtifactAction   = "actions/upload-artifact@v4"
+	GithubDownloadArtifactAction = "actions/download-artifact@v4"
+)
+
+const githubDefaultRunner = "ubuntu-latest"
+
+var (
+	githubJobIdInvalidCharacters = regexp.MustCompile(`[^a-z0-9_-]+`)
+	githubVariableReference      = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)\}?`)
+	githubTimeoutPart            = regexp.MustCompile(`^(\d+)\s*([a-z]*)$`)
+	// The gitlab runner variables used by the jobs are provided from the github ones. CI_PROJECT_DIR has to be set in
+	// a step, in container jobs the workspace is mounted elsewhere than ${{ github.workspace }} tells.
+	githubGitlabVariablesScript = []string{
+		`echo "CI_PROJECT_DIR=$GITHUB_WORKSPACE" >> "$GITHUB_ENV"`,
+		`echo "CI_COMMIT_SHA=$GITHUB_SHA" >> "$GITHUB_ENV"`,
+		`echo "CI_PIPELINE_URL=$GITHUB_SERVER_URL/$GITHUB_REPOSITORY/actions/runs/$GITHUB_RUN_ID" >> "$GITHUB_ENV"`,
+		`if [ "$GITHUB_REF_TYPE" = tag ]; then echo "CI_COMMIT_TAG=$GITHUB_REF_NAME" >> "$GITHUB_ENV"; else echo "CI_COMMIT_BRANCH=$GITHUB_REF_NAME" >> "$GITHUB_ENV"; fi`,
+	}
+	// docker hub is known under several names in docker auth configs
+	githubDockerHubRegistries = []string{"https://index.docker.io/v1/", "index.docker.io", "registry-1.docker.io"}
+)
+
+// GithubActionsTriggers are the events starting the workflow (on).
+type GithubActionsTriggers struct {
+	PushBranches       []string
+	PushBranchesIgnore []string
+	PullRequest        bool
+	Schedules          []string // cron expressions
+	WorkflowDispatch   bool
+	WorkflowCall       bool
+	// Inputs of workflow_dispatch and workflow_call (optional strings), the variables of gitlab trigger jobs are passed as inputs.
+	Inputs []string
+}
+
+// GithubActionsRenderer renders the pipeline as github actions workflow. Github has no stages and no generated child
+// pipelines, so jobs without needs need all jobs of the previous stages, trigger jobs call reusable workflows
+// (workflow_call) and the artifacts are passed with the upload and download artifact actions.
+type GithubActionsRenderer struct {
+	Name string
+	On   GithubActionsTriggers
+	// RunsOn are the runner labels of jobs without tags (default ubuntu-latest). Jobs with tags run on self-hosted runners with these labels.
+	RunsOn []string
+	// Env are additional workflow variables, e.g. the secrets the credentials refer to
+	Env map[string]string
+	// Conditions are the if expressions of jobs by job name
+	Conditions map[string]string
+	// Outputs are the outputs the scripts of jobs (by job name) write to $GITHUB_OUTPUT
+	Outputs map[string][]string
+}
+
+type githubWorkflow struct {
+	Name string                 `yaml:"name"`
+	On   map[string]interface{} `yaml:"on"`
+	Env  map[string]interface{} `yaml:"env,omitempty"`
+	Jobs *yaml.Node             `yaml:"jobs"`
+}
+
+type githubJob struct {
+	Name            string                      `yaml:"name"`
+	Needs           []string                    `yaml:"needs,omitempty"`
+	If              string                      `yaml:"if,omitempty"`
+	Uses            string                      `yaml:"uses,omitempty"`
+	With            map[string]string           `yaml:"with,omitempty"`
+	Secrets         string                      `yaml:"secrets,omitempty"`
+	RunsOn          interface{}                 `yaml:"runs-on,omitempty"`
+	Container       *githubContainer            `yaml:"container,omitempty"`
+	Services        map[string]*githubContainer `yaml:"services,omitempty"`
+	Env             map[string]interface{}      `yaml:"env,omitempty"`
+	Outputs         map[string]string           `yaml:"outputs,omitempty"`
+	Concurrency     string                      `yaml:"concurrency,omitempty"`
+	TimeoutMinutes  int                         `yaml:"timeout-minutes,omitempty"`
+	ContinueOnError bool                        `yaml:"continue-on-error,omitempty"`
+	Steps           []githubStep                `yaml:"steps,omitempty"`
+}
+
+type githubContainer struct {
+	Image       string                 `yaml:"image"`
+	Credentials *githubCredentials     `yaml:"credentials,omitempty"`
+	Env         map[string]interface{} `yaml:"env,omitempty"`
+}
+
+type githubCredentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type githubStep struct {
+	Name            string                 `yaml:"name"`
+	Id              string                 `yaml:"id,omitempty"`
+	If              string                 `yaml:"if,omitempty"`
+	Uses            string                 `yaml:"uses,omitempty"`
+	With            map[string]interface{} `yaml:"with,omitempty"`
+	Run             string                 `yaml:"run,omitempty"`
+	ContinueOnError bool                   `yaml:"continue-on-error,omitempty"`
+}
+
+// GithubActionsJobId returns the id of the job in the rendered workflow, e.g. to refer to its outputs.
+func GithubActionsJobId(jobName string) string {
+	id := strings.Trim(githubJobIdInvalidCharacters.ReplaceAllString(strings.ToLower(jobName), "-"), "-")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "job-" + id
+	}
+	return id
+}
+
+// githubRenderContext is the state of a single rendering.
+type githubRenderContext struct {
+	renderer    *GithubActionsRenderer
+	pipeline    *Pipeline
+	jobs        []*Job // the resolved (extends and defaults applied) visible jobs
+	jobsByName  map[string]*Job
+	ids         map[string]string
+	credentials map[string]*githubCredentials
+	// dotenv variables a job has to provide as outputs, because other jobs use them in their image
+	dotenvOutputs map[string]map[string]bool
+}
+
+func (renderer *GithubActionsRenderer) Render(pipeline *Pipeline) (string, error) {
+	if err := pipeline.validate(); err != nil {
+		return "", err
+	}
+	if len(pipeline.Include) > 0 {
+		return "", fmt.Errorf("include is not supported by github actions")
+	}
+	if pipeline.Workflow != nil {
+		return "", fmt.Errorf("workflow is not supported by github actions, use the triggers of the renderer")
+	}
+	context := githubRenderContext{
+		renderer:      renderer,
+		pipeline:      pipeline,
+		jobsByName:    make(map[string]*Job, len(pipeline.Jobs)),
+		ids:           make(map[string]string, len(pipeline.Jobs)),
+		dotenvOutputs: make(map[string]map[string]bool),
+	}
+	allJobsByName := make(map[string]*Job, len(pipeline.Jobs))
+	for _, job := range pipeline.Jobs {
+		allJobsByName[job.Name] = job
+	}
+	jobIdOwners := make(map[string]string, len(pipeline.Jobs))
+	for _, job := range pipeline.Jobs {
+		if strings.HasPrefix(job.Name, ".") {
+			continue // templates are merged into the jobs extending them
+		}
+		resolved := resolveExtends(job, allJobsByName, 1)
+		if err := context.applyDefaults(resolved); err != nil {
+			return "", err
+		}
+		id := GithubActionsJobId(job.Name)
+		if owner, exists := jobIdOwners[id]; exists {
+			return "", fmt.Errorf("jobs '%s' and '%s' have the same github actions job id '%s'", owner, job.Name, id)
+		}
+		jobIdOwners[id] = job.Name
+		context.ids[job.Name] = id
+		context.jobs = append(context.jobs, resolved)
+		context.jobsByName[job.Name] = resolved
+	}
+
+	workflowEnv := make(map[string]interface{}, len(pipeline.Variables)+len(renderer.Env))
+	for key, value := range pipeline.Variables {
+		workflowEnv[key] = value
+	}
+	for key, value := range renderer.Env {
+		workflowEnv[key] = value
+	}
+	credentials, err := extractDockerAuthConfig(workflowEnv, nil)
+	if err != nil {
+		return "", fmt.Errorf("workflow: %w", err)
+	}
+	context.credentials = credentials
+
+	// the outputs of the dotenv variables used in images have to be known before the producing jobs are rendered
+	for _, job := range context.jobs {
+		if err := context.collectDotenvOutputs(job); err != nil {
+			return "", err
+		}
+	}
+
+	jobsNode := &yaml.Node{Kind: yaml.MappingNode}
+	for _, job := range context.jobs {
+		githubJob, err := context.renderJob(job)
+		if err != nil {
+			return "", err
+		}
+		keyNode, valueNode := &yaml.Node{}, &yaml.Node{}
+		if err := keyNode.Encode(context.ids[job.Name]); err != nil {
+			return "", err
+		}
+		if err := valueNode.Encode(githubJob); err != nil {
+			return "", fmt.Errorf("cannot render job '%s': %w", job.Name, err)
+		}
+		jobsNode.Content = append(jobsNode.Content, keyNode, valueNode)
+	}
+	workflow := githubWorkflow{
+		Name: renderer.Name,
+		On:   renderer.On.render(),
+		Env:  workflowEnv,
+		Jobs: jobsNode,
+	}
+	bytes, err := yaml.Marshal(&workflow)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+func (triggers *GithubActionsTriggers) render() map[string]interface{} {
+	on := make(map[string]interface{})
+	if len(triggers.PushBranches) > 0 || len(triggers.PushBranchesIgnore) > 0 {
+		push := make(map[string][]string)
+		if len(triggers.PushBranches) > 0 {
+			push["branches"] = triggers.PushBranches
+		}
+		if len(triggers.PushBranchesIgnore) > 0 {
+			push["branches-ignore"] = triggers.PushBranchesIgnore
+		}
+		on["push"] = push
+	}
+	if triggers.PullRequest {
+		on["pull_request"] = map[string]interface{}{}
+	}
+	if len(triggers.Schedules) > 0 {
+		schedules := make([]map[string]string, len(triggers.Schedules))
+		for idx, cron := range triggers.Schedules {
+			schedules[idx] = map[string]string{"cron": cron}
+		}
+		on["schedule"] = schedules
+	}
+	inputs := make(map[string]interface{}, len(triggers.Inputs))
+	for _, input := range triggers.Inputs {
+		inputs[input] = map[string]interface{}{"type": "string", "required": false, "default": ""}
+	}
+	for _, event := range []struct {
+		name    string
+		enabled bool
+	}{{"workflow_dispatch", triggers.WorkflowDispatch}, {"workflow_call", triggers.WorkflowCall}} {
+		if !event.enabled {
+			continue
+		}
+		if len(inputs) > 0 {
+			on[event.name] = map[string]interface{}{"inputs": inputs}
+		} else {
+			on[event.name] = map[string]interface{}{}
+		}
+	}
+	return on
+}
+
+func (context *githubRenderContext) applyDefaults(job *Job) error {
+	pipelineDefault := context.pipeline.Default
+	if pipelineDefault == nil {
+		return nil
+	}
+	if pipelineDefault.Artifacts != nil || len(pipelineDefault.Cache) > 0 || pipelineDefault.Retry != nil || len(pipelineDefault.Services) > 0 || len(pipelineDefault.IdTokens) > 0 {
+		return fmt.Errorf("default: only image, before_script, after_script, tags and timeout are supported by github actions")
+	}
+	if job.Trigger != nil {
+		return nil
+	}
+	if job.Image == nil {
+		job.Image = pipelineDefault.Image
+	}
+	if job.BeforeScript == nil {
+		job.BeforeScript = pipelineDefault.BeforeScript
+	}
+	if job.AfterScript == nil {
+		job.AfterScript = pipelineDefault.AfterScript
+	}
+	if job.Tags == nil {
+		job.Tags = pipelineDefault.Tags
+	}
+	if job.Timeout == "" {
+		job.Timeout = pipelineDefault.Timeout
+	}
+	return nil
+}
+
+// validateGithubSupport rejects the keywords github actions has no equivalent for.
+func validateGithubSupport(job *Job) error {
+	unsupported := []struct {
+		keyword string
+		isSet   bool
+	}{
+		{"rules", len(job.Rules) > 0},
+		{"retry", job.Retry != nil},
+		{"cache", len(job.Cache) > 0},
+		{"environment", job.Environment != nil},
+		{"parallel", job.Parallel != nil},
+		{"release", job.Release != nil},
+		{"secrets", len(job.Secrets) > 0},
+		{"inherit", job.Inherit != nil},
+		{"id_tokens", len(job.IdTokens) > 0},
+		{"when manual", job.When == WhenManual},
+		{"when delayed", job.When == WhenDelayed},
+	}
+	for _, keyword := range unsupported {
+		if keyword.isSet {
+			return fmt.Errorf("job '%s': %s is not supported by github actions", job.Name, keyword.keyword)
+		}
+	}
+	return nil
+}
+
+func (context *githubRenderContext) stageIndex(job *Job) (int, error) {
+	stageName := "test" // the default stage of gitlab
+	if job.Stage != nil {
+		stageName = job.Stage.Name
+	}
+	for idx, stage := range context.pipeline.Stages {
+		if stage.Name == stageName {
+			return idx, nil
+		}
+	}
+	return 0, fmt.Errorf("job '%s' is in stage '%s' which is not part of the pipeline", job.Name, stageName)
+}
+
+// needs returns the jobs the job waits for and the jobs whose artifacts it downloads. Without needs, a job
+// waits for all jobs of the previous stages and downloads their artifacts (unless limited by dependencies).
+func (context *githubRenderContext) needs(job *Job) ([]*Job, []*Job, error) {
+	needed := make([]*Job, 0)
+	withArtifacts := make([]*Job, 0)
+	if len(job.Needs) > 0 {
+		for _, need := range job.Needs {
+			neededJob, exists := context.jobsByName[need.Job.Name]
+			if !exists {
+				continue // optional need of a job that is not part of the pipeline
+			}
+			needed = append(needed, neededJob)
+			if need.Artifacts {
+				withArtifacts = append(withArtifacts, neededJob)
+			}
+		}
+	} else {
+		jobStage, err := context.stageIndex(job)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, other := range context.jobs {
+			otherStage, err := context.stageIndex(other)
+			if err != nil {
+				return nil, nil, err
+			}
+			if otherStage < jobStage {
+				needed = append(needed, other)
+				withArtifacts = append(withArtifacts, other)
+			}
+		}
+	}
+	if job.Dependencies != nil {
+		withArtifacts = make([]*Job, 0, len(job.Dependencies.Jobs))
+		for _, dependency := range job.Dependencies.Jobs {
+			withArtifacts = append(withArtifacts, context.jobsByName[dependency.Name])
+		}
+	}
+	downloads := make([]*Job, 0, len(withArtifacts))
+	for _, neededJob := range withArtifacts {
+		if len(artifactPaths(neededJob)) > 0 {
+			downloads = append(downloads, neededJob)
+		}
+	}
+	return needed, downloads, nil
+}
+
+// artifactPaths returns the paths of the artifacts including the report files, which are artifacts, too.
+func artifactPaths(job *Job) []string {
+	if job.Artifacts == nil {
+		return nil
+	}
+	paths := append([]string{}, job.Artifacts.Paths...)
+	if reports := job.Artifacts.Reports; reports != nil {
+		if reports.Dotenv != "" {
+			paths = append(paths, reports.Dotenv)
+		}
+		for _, reportPaths := range [][]string{reports.Cyclonedx, reports.ContainerScanning, reports.Junit, reports.Codequality} {
+			paths = append(paths, reportPaths...)
+		}
+	}
+	unique := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !contains(unique, path) {
+			unique = append(unique, path)
+		}
+	}
+	return unique
+}
+
+func dotenvFile(job *Job) string {
+	if job.Artifacts == nil || job.Artifacts.Reports == nil {
+		return ""
+	}
+	return job.Artifacts.Reports.Dotenv
+}
+
+// collectDotenvOutputs finds the dotenv variables used in the images of the job. Github resolves the images
+// before the job starts, so they can't use the environment and the jobs providing them declare them as outputs.
+func (context *githubRenderContext) collectDotenvOutputs(job *Job) error {
+	if job.Trigger != nil {
+		return nil
+	}
+	_, downloads, err := context.needs(job)
+	if err != nil {
+		return err
+	}
+	for _, name := range context.imageVariables(job) {
+		provided := false
+		for _, neededJob := range downloads {
+			if dotenvFile(neededJob) == "" {
+				continue
+			}
+			if context.dotenvOutputs[neededJob.Name] == nil {
+				context.dotenvOutputs[neededJob.Name] = make(map[string]bool)
+			}
+			context.dotenvOutputs[neededJob.Name][name] = true
+			provided = true
+		}
+		if !provided {
+			return fmt.Errorf("job '%s' uses variable '%s' in an image, github actions can only resolve dotenv variables of needed jobs there", job.Name, name)
+		}
+	}
+	return nil
+}
+
+func (context *githubRenderContext) imageVariables(job *Job) []string {
+	images := make([]*ContainerImageCoordinates, 0, len(job.Services)+1)
+	if job.Image != nil {
+		images = append(images, job.Image)
+	}
+	for _, service := range job.Services {
+		images = append(images, service.Image)
+	}
+	names := make([]string, 0)
+	for _, image := range images {
+		for _, match := range githubVariableReference.FindAllStringSubmatch(image.String(), -1) {
+			if !contains(names, match[1]) {
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// image renders the image, the dotenv variables are replaced with the outputs of the needed jobs providing them.
+func (context *githubRenderContext) image(coordinates *ContainerImageCoordinates, downloads []*Job) string {
+	return githubVariableReference.ReplaceAllStringFunc(coordinates.String(), func(reference string) string {
+		name := githubVariableReference.FindStringSubmatch(reference)[1]
+		outputs := make([]string, 0)
+		for _, neededJob := range downloads {
+			if context.dotenvOutputs[neededJob.Name][name] {
+				outputs = append(outputs, fmt.Sprintf("needs.%s.outputs.%s", context.ids[neededJob.Name], name))
+			}
+		}
+		return "${{ " + strings.Join(outputs, " || ") + " }}"
+	})
+}
+
+func (context *githubRenderContext) container(coordinates *ContainerImageCoordinates, downloads []*Job, credentials map[string]*githubCredentials) *githubContainer {
+	registry := coordinates.Registry
+	if contains(githubDockerHubRegistries, registry) {
+		registry = "docker.io"
+	}
+	return &githubContainer{
+		Image:       context.image(coordinates, downloads),
+		Credentials: credentials[registry],
+	}
+}
+
+func (context *githubRenderContext) renderJob(job *Job) (*githubJob, error) {
+	if err := validateGithubSupport(job); err != nil {
+		return nil, err
+	}
+	needed, downloads, err := context.needs(job)
+	if err != nil {
+		return nil, err
+	}
+	rendered := githubJob{Name: job.Name}
+	for _, neededJob := range needed {
+		rendered.Needs = append(rendered.Needs, context.ids[neededJob.Name])
+	}
+	conditions := make([]string, 0, 2)
+	switch job.When {
+	case WhenAlways:
+		conditions = append(conditions, "always()")
+	case WhenOnFailure:
+		conditions = append(conditions, "failure()")
+	}
+	if condition := context.renderer.Conditions[job.Name]; condition != "" {
+		if len(conditions) > 0 {
+			condition = "(" + condition + ")"
+		}
+		conditions = append(conditions, condition)
+	}
+	rendered.If = strings.Join(conditions, " && ")
+
+	variables := make(map[string]interface{})
+	if job.Variables != nil {
+		for key, value := range *job.Variables {
+			variables[key] = value
+		}
+	}
+	if job.Trigger != nil {
+		return context.renderTriggerJob(job, &rendered, variables)
+	}
+
+	credentials, err := extractDockerAuthConfig(variables, context.credentials)
+	if err != nil {
+		return nil, fmt.Errorf("job '%s': %w", job.Name, err)
+	}
+	checkout := githubStep{Name: "Checkout", Uses: GithubCheckoutAction}
+	if depth, exists := variables["GIT_DEPTH"]; exists {
+		depth, err := strconv.Atoi(fmt.Sprint(depth))
+		if err != nil {
+			return nil, fmt.Errorf("job '%s': invalid GIT_DEPTH: %w", job.Name, err)
+		}
+		checkout.With = map[string]interface{}{"fetch-depth": depth}
+		delete(variables, "GIT_DEPTH")
+	}
+	if len(variables) > 0 {
+		rendered.Env = variables
+	}
+
+	if len(job.Tags) > 0 {
+		rendered.RunsOn = append([]string{"self-hosted"}, job.Tags...)
+	} else if len(context.renderer.RunsOn) > 1 {
+		rendered.RunsOn = context.renderer.RunsOn
+	} else if len(context.renderer.RunsOn) == 1 {
+		rendered.RunsOn = context.renderer.RunsOn[0]
+	} else {
+		rendered.RunsOn = githubDefaultRunner
+	}
+	if job.Image != nil {
+		rendered.Container = context.container(job.Image, downloads, credentials)
+	}
+	for idx, service := range job.Services {
+		if len(service.Entrypoint) > 0 || len(service.Command) > 0 {
+			return nil, fmt.Errorf("job '%s': service entrypoint and command are not supported by github actions", job.Name)
+		}
+		alias := service.Alias
+		if alias == "" {
+			alias = fmt.Sprintf("service-%d", idx)
+		}
+		if rendered.Services == nil {
+			rendered.Services = make(map[string]*githubContainer, len(job.Services))
+		}
+		serviceContainer := context.container(service.Image, downloads, credentials)
+		if len(service.Variables) > 0 {
+			serviceContainer.Env = service.Variables
+		}
+		rendered.Services[alias] = serviceContainer
+	}
+	rendered.Concurrency = job.ResourceGroup
+	if job.Timeout != "" {
+		if rendered.TimeoutMinutes, err = parseTimeoutMinutes(job.Timeout); err != nil {
+			return nil, fmt.Errorf("job '%s': %w", job.Name, err)
+		}
+	}
+	if job.AllowFailure != nil && job.AllowFailure.Allowed != nil && *job.AllowFailure.Allowed && job.AllowFailure.ExitCodes == nil {
+		rendered.ContinueOnError = true
+	}
+
+	rendered.Steps = append(rendered.Steps, checkout)
+	prepareScript := append([]string{}, githubGitlabVariablesScript...)
+	for _, neededJob := range downloads {
+		id := context.ids[neededJob.Name]
+		rendered.Steps = append(rendered.Steps, githubStep{
+			Name: "Download artifacts of " + neededJob.Name,
+			Uses: GithubDownloadArtifactAction,
+			With: map[string]interface{}{"name": id},
+		})
+		// the artifacts are archived to keep the file permissions (e.g. of the gipgee binary)
+		prepareScript = append(prepareScript, fmt.Sprintf(`tar -xf %s && rm %s`, githubArtifactArchive(id), githubArtifactArchive(id)))
+		if dotenv := dotenvFile(neededJob); dotenv != "" {
+			prepareScript = append(prepareScript, fmt.Sprintf(`cat %s >> "$GITHUB_ENV"`, dotenv))
+		}
+	}
+	rendered.Steps = append(rendered.Steps, githubStep{Name: "Prepare", Run: strings.Join(prepareScript, "\n")})
+	rendered.Steps = append(rendered.Steps, githubStep{Name: "Script", Id: "script", Run: githubScript(job)})
+	if len(job.AfterScript) > 0 {
+		rendered.Steps = append(rendered.Steps, githubStep{
+			Name:            "After script",
+			If:              "always()",
+			Run:             strings.Join(job.AfterScript, "\n"),
+			ContinueOnError: true, // like in gitlab, a failing after_script doesn't fail the job
+		})
+	}
+
+	outputs := make(map[string]string)
+	for _, output := range context.renderer.Outputs[job.Name] {
+		outputs[output] = fmt.Sprintf("${{ steps.script.outputs.%s }}", output)
+	}
+	if dotenv := dotenvFile(job); dotenv != "" && len(context.dotenvOutputs[job.Name]) > 0 {
+		rendered.Steps = append(rendered.Steps, githubStep{Name: "Provide dotenv variables as outputs", Id: "dotenv", Run: fmt.Sprintf(`cat %s >> "$GITHUB_OUTPUT"`, dotenv)})
+		for name := range context.dotenvOutputs[job.Name] {
+			outputs[name] = fmt.Sprintf("${{ steps.dotenv.outputs.%s }}", name)
+		}
+	}
+	if len(outputs) > 0 {
+		rendered.Outputs = outputs
+	}
+
+	if paths := artifactPaths(job); len(paths) > 0 {
+		id := context.ids[job.Name]
+		condition := ""
+		if job.Artifacts.When != nil {
+			switch *job.Artifacts.When {
+			case "always":
+				condition = "always()"
+			case "on_failure":
+				condition = "failure()"
+			}
+		}
+		rendered.Steps = append(rendered.Steps,
+			githubStep{
+				Name: "Archive artifacts",
+				If:   condition,
+				// like gitlab, missing artifacts are skipped
+				Run: strings.Join([]string{
+					fmt.Sprintf(`paths=""; for path in %s; do if [ -e "$path" ]; then paths="$paths $path"; fi; done`, strings.Join(paths, " ")),
+					fmt.Sprintf(`if [ -n "$paths" ]; then tar -cf %s $paths; fi`, githubArtifactArchive(id)),
+				}, "\n"),
+			},
+			githubStep{
+				Name: "Upload artifacts",
+				If:   condition,
+				Uses: GithubUploadArtifactAction,
+				With: map[string]interface{}{
+					"name":              id,
+					"path":              githubArtifactArchive(id),
+					"if-no-files-found": "ignore",
+				},
+			},
+		)
+	}
+	return &rendered, nil
+}
+
+// renderTriggerJob renders a trigger job as call of a reusable workflow, the variables are passed as inputs.
+func (context *githubRenderContext) renderTriggerJob(job *Job, rendered *githubJob, variables map[string]interface{}) (*githubJob, error) {
+	trigger := job.Trigger
+	if len(trigger.Include) != 1 || trigger.Include[0].Local == "" {
+		return nil, fmt.Errorf("trigger job '%s': github actions can only call a single local reusable workflow, generated child pipelines (artifact), templates and projects are not supported", job.Name)
+	}
+	rendered.Uses = "./" + strings.TrimPrefix(trigger.Include[0].Local, "/")
+	rendered.Secrets = "inherit"
+	if len(variables) > 0 {
+		rendered.With = make(map[string]string, len(variables))
+		for key, value := range variables {
+			rendered.With[key] = fmt.Sprint(value)
+		}
+	}
+	return rendered, nil
+}
+
+func githubArtifactArchive(jobId string) string {
+	return fmt.Sprintf("artifacts-%s.tar", jobId)
+}
+
+// githubScript joins before_script and script. Allowed exit codes end the step successfully with a warning.
+func githubScript(job *Job) string {
+	script := strings.Join(append(append([]string{}, job.BeforeScript...), job.Script...), "\n")
+	if job.AllowFailure == nil || job.AllowFailure.ExitCodes == nil {
+		return script
+	}
+	exitCodes := make([]string, len(*job.AllowFailure.ExitCodes))
+	for idx, exitCode := range *job.AllowFailure.ExitCodes {
+		exitCodes[idx] = strconv.Itoa(exitCode)
+	}
+	return strings.Join([]string{
+		"set +e",
+		"(",
+		"set -e",
+		script,
+		")",
+		"exitCode=$?",
+		fmt.Sprintf(`case " %s " in *" $exitCode "*) echo "::warning::script failed with allowed exit code $exitCode"; exit 0;; esac`, strings.Join(exitCodes, " ")),
+		"exit $exitCode",
+	}, "\n")
+}
+
+// extractDockerAuthConfig removes DOCKER_AUTH_CONFIG from the variables. The gitlab runner uses it to pull the
+// job images, github needs the credentials of the containers instead. The result extends the given credentials.
+func extractDockerAuthConfig(variables map[string]interface{}, inherited map[string]*githubCredentials) (map[string]*githubCredentials, error) {
+	credentials := make(map[string]*githubCredentials, len(inherited))
+	for registry, credential := range inherited {
+		credentials[registry] = credential
+	}
+	value, exists := variables["DOCKER_AUTH_CONFIG"]
+	if !exists {
+		return credentials, nil
+	}
+	delete(variables, "DOCKER_AUTH_CONFIG")
+	dockerAuths := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	if err := json.Unmarshal([]byte(fmt.Sprint(value)), &dockerAuths); err != nil {
+		return nil, fmt.Errorf("cannot parse DOCKER_AUTH_CONFIG: %w", err)
+	}
+	registries := make([]string, 0, len(dockerAuths.Auths))
+	for registry := range dockerAuths.Auths {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+	for _, registry := range registries {
+		decoded, err := base64.StdEncoding.DecodeString(dockerAuths.Auths[registry].Auth)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode DOCKER_AUTH_CONFIG auth of registry '%s': %w", registry, err)
+		}
+		usernamePassword := strings.SplitN(string(decoded), ":", 2)
+		if len(usernamePassword) != 2 {
+			return nil, fmt.Errorf("DOCKER_AUTH_CONFIG auth of registry '%s' is not username:password", registry)
+		}
+		if contains(githubDockerHubRegistries, registry) {
+			registry = "docker.io"
+		}
+		credentials[registry] = &githubCredentials{Username: usernamePassword[0], Password: usernamePassword[1]}
+	}
+	return credentials, nil
+}
+
+// parseTimeoutMinutes converts a gitlab timeout (e.g. "1h 30m", "90 minutes" or "3600") to minutes, rounded up.
+func parseTimeoutMinutes(timeout string) (int, error) {
+	seconds := 0
+	fields := strings.Fields(strings.ToLower(timeout))
+	for idx := 0; idx < len(fields); idx++ {
+		part := fields[idx]
+		// the unit may be separated from the number ("90 minutes")
+		if idx+1 < len(fields) {
+			if _, err := strconv.Atoi(fields[idx+1]); err != nil && githubTimeoutPart.MatchString(part) && githubTimeoutPart.FindStringSubmatch(part)[2] == "" {
+				part += fields[idx+1]
+				idx++
+			}
+		}
+		match := githubTimeoutPart.FindStringSubmatch(part)
+		if match == nil {
+			return 0, fmt.Errorf("cannot convert timeout '%s' to minutes", timeout)
+		}
+		value, _ := strconv.Atoi(match[1])
+		switch {
+		case match[2] == "" || strings.HasPrefix(match[2], "s"):
+			seconds += value
+		case strings.HasPrefix(match[2], "m"):
+			seconds += value * 60
+		case strings.HasPrefix(match[2], "h"):
+			seconds += value * 3600
+		case strings.HasPrefix(match[2], "d"):
+			seconds += value * 86400
+		default:
+			return 0, fmt.Errorf("cannot convert timeout '%s' to minutes", timeout)
+		}
+	}
+	if seconds == 0 {
+		return 0, fmt.Errorf("cannot convert timeout '%s' to minutes", timeout)
+	}
+	return (seconds + 59) / 60, nil
+}
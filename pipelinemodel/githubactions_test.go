@@ -0,0 +1,86 @@
+package pipelinemodel
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGithubActionsRenderer(t *testing.T) {
+	build, test := Stage{Name: "build"}, Stage{Name: "test"}
+	image, err := ContainerImageCoordinatesFromString("registry.example.com/builder:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templateVariables := map[string]interface{}{"SHARED": "1"}
+	template := &Job{Name: ".template", Image: image, Timeout: "1h 30m", Variables: &templateVariables}
+	compileVariables := map[string]interface{}{"OWN": "2"}
+	compile := &Job{Name: "Compile it!", Stage: &build, Extends: []string{".template"}, Script: []string{"make"}, Variables: &compileVariables}
+	unitTest := &Job{Name: "unit test", Stage: &test, Script: []string{"make test"}}
+	auth := base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	pipeline := Pipeline{
+		Stages:    []*Stage{&build, &test},
+		Variables: map[string]interface{}{"DOCKER_AUTH_CONFIG": fmt.Sprintf(`{"auths":{"registry.example.com":{"auth":"%s"}}}`, auth)},
+		Jobs:      []*Job{template, compile, unitTest},
+	}
+	renderer := GithubActionsRenderer{Name: "test", On: GithubActionsTriggers{WorkflowDispatch: true}}
+	rendered, err := renderer.Render(&pipeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"compile-it:",                 // job id
+		"timeout-minutes: 90",         // inherited from the template
+		"SHARED: \"1\"",               // variables of the template are merged
+		"OWN: \"2\"",                  // with the variables of the job
+		"- compile-it",                // unit test needs the jobs of the previous stage
+		"username: user",              // DOCKER_AUTH_CONFIG became the container credentials
+		"image: registry.example.com", // of the image of the template
+	} {
+		if !strings.Contains(rendered, expected) {
+			t.Errorf("rendered workflow doesn't contain '%s':\n%s", expected, rendered)
+		}
+	}
+	if strings.Contains(rendered, ".template") || strings.Contains(rendered, "DOCKER_AUTH_CONFIG") {
+		t.Errorf("template or DOCKER_AUTH_CONFIG must not be rendered:\n%s", rendered)
+	}
+
+	unitTest.Rules = []JobRule{{If: "$CI_COMMIT_BRANCH"}}
+	if _, err := renderer.Render(&pipeline); err == nil || !strings.Contains(err.Error(), "rules") {
+		t.Errorf("expected an error for the unsupported rules, got %v", err)
+	}
+}
+
+func TestGithubActionsJobId(t *testing.T) {
+	for name, expected := range map[string]string{
+		"🛠️ Build image foo/bar": "build-image-foo-bar",
+		"my_job":                 "my_job",
+		"1st job":                "job-1st-job",
+		"🚀":                      "job-",
+	} {
+		if id := GithubActionsJobId(name); id != expected {
+			t.Errorf("job id of '%s' is '%s', expected '%s'", name, id, expected)
+		}
+	}
+}
+
+func TestParseTimeoutMinutes(t *testing.T) {
+	for timeout, expected := range map[string]int{
+		"3600":       60,
+		"90 minutes": 90,
+		"1h 30m":     90,
+		"1 day":      1440,
+		"30s":        1,
+	} {
+		minutes, err := parseTimeoutMinutes(timeout)
+		if err != nil {
+			t.Errorf("timeout '%s': %v", timeout, err)
+		} else if minutes != expected {
+			t.Errorf("timeout '%s' is %d minutes, expected %d", timeout, minutes, expected)
+		}
+	}
+	if _, err := parseTimeoutMinutes("soon"); err == nil {
+		t.Error("expected an error for an invalid timeout")
+	}
+}
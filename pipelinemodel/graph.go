@@ -0,0 +1,143 @@
+package pipelinemodel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of gitlab.com, self managed instances use the same defaults.
+const (
+	MaxJobNameLength = 255
+	MaxNeedsPerJob   = 50
+	MaxExtendsDepth  = 11
+)
+
+// validateJobGraph checks the job names and that all jobs referenced by needs, dependencies,
+// trigger includes, environments and extends are part of the pipeline and that the needs are acyclic.
+func (pipeline *Pipeline) validateJobGraph() error {
+	jobsByName := make(map[string]*Job, len(pipeline.Jobs))
+	for _, job := range pipeline.Jobs {
+		if job.Name == "" {
+			return errors.New("found job without name")
+		}
+		if length := utf8.RuneCountInString(job.Name); length > MaxJobNameLength {
+			return fmt.Errorf("job name '%s' has %d characters, gitlab allows at most %d", job.Name, length, MaxJobNameLength)
+		}
+		if _, exists := jobsByName[job.Name]; exists {
+			return fmt.Errorf("found more than one job with name '%s'", job.Name)
+		}
+		jobsByName[job.Name] = job
+	}
+
+	isPartOfPipeline := func(job *Job) bool {
+		return job != nil && jobsByName[job.Name] == job
+	}
+	for _, job := range pipeline.Jobs {
+		// jobs of included files can't be checked
+		if len(pipeline.Include) == 0 {
+			if err := validateExtends(job, jobsByName, 1); err != nil {
+				return err
+			}
+		}
+		if len(job.Needs) > MaxNeedsPerJob {
+			return fmt.Errorf("job '%s' has %d needs, gitlab allows at most %d", job.Name, len(job.Needs), MaxNeedsPerJob)
+		}
+		for _, need := range job.Needs {
+			if need.Job == nil {
+				return fmt.Errorf("job '%s' has needs without job", job.Name)
+			}
+			// optional needs and needs of jobs from included files may point to jobs which are not part of the pipeline
+			if !need.Optional && len(pipeline.Include) == 0 && !isPartOfPipeline(need.Job) {
+				return fmt.Errorf("job '%s' needs job '%s' which is not part of the pipeline", job.Name, need.Job.Name)
+			}
+		}
+		for _, rule := range job.Rules {
+			if len(rule.Needs) > MaxNeedsPerJob {
+				return fmt.Errorf("rule of job '%s' has %d needs, gitlab allows at most %d", job.Name, len(rule.Needs), MaxNeedsPerJob)
+			}
+			for _, need := range rule.Needs {
+				if need.Job == nil || (!need.Optional && len(pipeline.Include) == 0 && !isPartOfPipeline(need.Job)) {
+					return fmt.Errorf("rule of job '%s' needs a job which is not part of the pipeline", job.Name)
+				}
+			}
+		}
+		if job.Dependencies != nil {
+			for _, dependency := range job.Dependencies.Jobs {
+				if !isPartOfPipeline(dependency) {
+					return fmt.Errorf("job '%s' depends on a job which is not part of the pipeline", job.Name)
+				}
+			}
+		}
+		if job.Trigger != nil {
+			for _, include := range job.Trigger.Include {
+				if include.Artifact != "" && !isPartOfPipeline(include.Job) {
+					return fmt.Errorf("trigger job '%s' includes artifact '%s' of a job which is not part of the pipeline", job.Name, include.Artifact)
+				}
+			}
+		}
+		if job.Environment != nil && job.Environment.OnStop != nil && !isPartOfPipeline(job.Environment.OnStop) {
+			return fmt.Errorf("job '%s' stops its environment with job '%s' which is not part of the pipeline", job.Name, job.Environment.OnStop.Name)
+		}
+	}
+	return pipeline.validateNeedsAreAcyclic(jobsByName)
+}
+
+// validateExtends follows the extends of the job, which also detects cycles as they exceed the maximum depth.
+func validateExtends(job *Job, jobsByName map[string]*Job, depth int) error {
+	for _, name := range job.Extends {
+		extended, exists := jobsByName[name]
+		if !exists {
+			return fmt.Errorf("job '%s' extends job '%s' which is not part of the pipeline", job.Name, name)
+		}
+		if depth > MaxExtendsDepth {
+			return fmt.Errorf("job '%s' extends more than %d levels deep (or the extends form a cycle)", job.Name, MaxExtendsDepth)
+		}
+		if err := validateExtends(extended, jobsByName, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNeedsAreAcyclic searches the needs graph depth first, a job that is reached again
+// while it is still on the stack closes a cycle.
+func (pipeline *Pipeline) validateNeedsAreAcyclic(jobsByName map[string]*Job) error {
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+	state := make(map[*Job]int, len(pipeline.Jobs))
+	stack := make([]*Job, 0)
+	var visit func(job *Job) error
+	visit = func(job *Job) error {
+		switch state[job] {
+		case done:
+			return nil
+		case onStack:
+			cycle := []string{job.Name}
+			for idx := len(stack) - 1; idx >= 0 && stack[idx] != job; idx-- {
+				cycle = append([]string{stack[idx].Name}, cycle...)
+			}
+			return fmt.Errorf("needs form a cycle: %s -> %s", job.Name, strings.Join(cycle, " -> "))
+		}
+		state[job] = onStack
+		stack = append(stack, job)
+		for _, need := range effectiveNeeds(job, jobsByName, 0) {
+			if err := visit(need.Job); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[job] = done
+		return nil
+	}
+	for _, job := range pipeline.Jobs {
+		if err := visit(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
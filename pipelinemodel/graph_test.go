@@ -0,0 +1,102 @@
+package pipelinemodel
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJobGraphValidation(t *testing.T) {
+	stage := Stage{Name: "test"}
+	newJob := func(name string) *Job {
+		return &Job{Name: name, Stage: &stage, Script: []string{"true"}}
+	}
+	outside := newJob("outside")
+
+	for _, testCase := range []struct {
+		description     string
+		jobs            func() []*Job
+		expectedMessage string
+	}{
+		{"valid dag", func() []*Job {
+			a, b, c := newJob("a"), newJob("b"), newJob("c")
+			b.Needs = []JobNeeds{{Job: a}, {Job: outside, Optional: true}}
+			c.Needs = []JobNeeds{{Job: a}, {Job: b}}
+			return []*Job{a, b, c}
+		}, ""},
+		{"duplicate name", func() []*Job {
+			return []*Job{newJob("a"), newJob("a")}
+		}, "found more than one job with name 'a'"},
+		{"long name", func() []*Job {
+			return []*Job{newJob(strings.Repeat("🐋", 256))}
+		}, fmt.Sprintf("job name '%s' has 256 characters, gitlab allows at most 255", strings.Repeat("🐋", 256))},
+		{"missing need", func() []*Job {
+			a := newJob("a")
+			a.Needs = []JobNeeds{{Job: outside}}
+			return []*Job{a}
+		}, "job 'a' needs job 'outside' which is not part of the pipeline"},
+		{"need on other job with the same name", func() []*Job {
+			a := newJob("a")
+			a.Needs = []JobNeeds{{Job: newJob("b")}}
+			return []*Job{a, newJob("b")}
+		}, "job 'a' needs job 'b' which is not part of the pipeline"},
+		{"too many needs", func() []*Job {
+			jobs := []*Job{newJob("a")}
+			for idx := 0; idx < 51; idx++ {
+				need := newJob(fmt.Sprintf("need-%d", idx))
+				jobs[0].Needs = append(jobs[0].Needs, JobNeeds{Job: need})
+				jobs = append(jobs, need)
+			}
+			return jobs
+		}, "job 'a' has 51 needs, gitlab allows at most 50"},
+		{"cycle", func() []*Job {
+			a, b, c := newJob("a"), newJob("b"), newJob("c")
+			a.Needs = []JobNeeds{{Job: c}}
+			b.Needs = []JobNeeds{{Job: a}}
+			c.Needs = []JobNeeds{{Job: b}}
+			return []*Job{a, b, c}
+		}, "needs form a cycle: a -> c -> b -> a"},
+		{"self need", func() []*Job {
+			a := newJob("a")
+			a.Needs = []JobNeeds{{Job: a}}
+			return []*Job{a}
+		}, "needs form a cycle: a -> a"},
+		{"trigger include of missing job", func() []*Job {
+			trigger := &Job{Name: "trigger", Stage: &stage, Trigger: &JobTrigger{Include: []JobTriggerInclude{{Artifact: "child.yml", Job: outside}}}}
+			return []*Job{trigger}
+		}, "trigger job 'trigger' includes artifact 'child.yml' of a job which is not part of the pipeline"},
+		{"missing dependency", func() []*Job {
+			a := newJob("a")
+			a.Dependencies = &JobDependencies{Jobs: []*Job{outside}}
+			return []*Job{a}
+		}, "job 'a' depends on a job which is not part of the pipeline"},
+		{"missing extended job", func() []*Job {
+			a := newJob("a")
+			a.Extends = []string{".template"}
+			return []*Job{a}
+		}, "job 'a' extends job '.template' which is not part of the pipeline"},
+		{"extends cycle", func() []*Job {
+			a, b := &Job{Name: ".a", Extends: []string{".b"}}, &Job{Name: ".b", Extends: []string{".a"}}
+			c := newJob("c")
+			c.Extends = []string{".a"}
+			return []*Job{a, b, c}
+		}, "job '.b' extends more than 11 levels deep (or the extends form a cycle)"},
+		{"cycle through inherited needs", func() []*Job {
+			a, b := newJob("a"), newJob("b")
+			template := &Job{Name: ".template", Needs: []JobNeeds{{Job: b}}}
+			a.Extends = []string{".template"}
+			b.Needs = []JobNeeds{{Job: a}}
+			return []*Job{template, a, b}
+		}, "needs form a cycle: b -> a -> b"},
+	} {
+		pipeline := Pipeline{Stages: []*Stage{&stage}, Jobs: testCase.jobs()}
+		err := pipeline.validate()
+		if testCase.expectedMessage == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error '%v'", testCase.description, err)
+			}
+		} else if err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("%s: error is '%v' but should be '%s'", testCase.description, err, testCase.expectedMessage)
+		}
+	}
+}
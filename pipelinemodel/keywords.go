@@ -0,0 +1,554 @@
+package pipelinemodel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// This file contains the typed representation of the gitlab ci keywords, see https://docs.gitlab.com/ee/ci/yaml/.
+// Keywords with a short and a long form (e.g. retry: 2 vs. retry: {max: 2, when: [...]}) render the short form if possible.
+
+var (
+	validRuleWhenValues         = []string{WhenOnSuccess, WhenManual, WhenAlways, WhenNever, WhenDelayed}
+	validWorkflowRuleWhenValues = []string{WhenAlways, WhenNever}
+	validCachePolicies          = []string{"pull", "push", "pull-push"}
+	validCacheWhenValues        = []string{WhenOnSuccess, WhenOnFailure, WhenAlways}
+	validEnvironmentActions     = []string{"start", "prepare", "stop", "verify", "access"}
+	validEnvironmentTiers       = []string{"production", "staging", "testing", "development", "other"}
+	validAutoCancelOnNewCommit  = []string{"conservative", "interruptible", "none"}
+	validAutoCancelOnJobFailure = []string{"all", "none"}
+	validReleaseAssetLinkTypes  = []string{"other", "runbook", "image", "package"}
+	validTriggerStrategies      = []string{"depend"}
+	validRetryWhenValues        = []string{"always", "unknown_failure", "script_failure", "api_failure", "stuck_or_timeout_failure", "runner_system_failure", "runner_unsupported", "stale_schedule", "job_execution_timeout", "archived_failure", "unmet_prerequisites", "scheduler_failure", "data_integrity_failure"}
+)
+
+const (
+	maxRetries          = 2
+	maxCachesPerJob     = 4
+	maxParallelJobs     = 200
+	minParallelJobs     = 2
+	maxRuleChangesPaths = 50
+)
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOneOf checks an optional keyword value, the empty string means not set.
+func validateOneOf(description string, value string, validValues []string) error {
+	if value != "" && !contains(validValues, value) {
+		return fmt.Errorf("%s '%s' is invalid (valid: %s)", description, value, strings.Join(validValues, ", "))
+	}
+	return nil
+}
+
+// JobRule is an entry of the rules keyword of a job.
+type JobRule struct {
+	If            string                 `yaml:"if,omitempty"`
+	Changes       []string               `yaml:"changes,omitempty"`
+	Exists        []string               `yaml:"exists,omitempty"`
+	When          string                 `yaml:"when,omitempty"`
+	StartIn       string                 `yaml:"start_in,omitempty"`
+	AllowFailure  *bool                  `yaml:"allow_failure,omitempty"`
+	Needs         []JobNeeds             `yaml:"needs,omitempty"`
+	Variables     map[string]interface{} `yaml:"variables,omitempty"`
+	Interruptible *bool                  `yaml:"interruptible,omitempty"`
+}
+
+func (rule *JobRule) validate() error {
+	if err := validateOneOf("rule when", rule.When, validRuleWhenValues); err != nil {
+		return err
+	}
+	if rule.StartIn != "" && rule.When != WhenDelayed {
+		return errors.New("rule start_in is only allowed with when delayed")
+	}
+	if rule.When == WhenDelayed && rule.StartIn == "" {
+		return errors.New("rule with when delayed needs start_in")
+	}
+	if len(rule.Changes) > maxRuleChangesPaths {
+		return fmt.Errorf("rule changes has %d paths, gitlab allows at most %d", len(rule.Changes), maxRuleChangesPaths)
+	}
+	return nil
+}
+
+// JobRetry configures the automatic retries of a job. Only max renders the short form retry: <max>.
+type JobRetry struct {
+	Max       int
+	When      []string
+	ExitCodes []int
+}
+
+func (retry *JobRetry) MarshalYAML() (interface{}, error) {
+	if len(retry.When) == 0 && len(retry.ExitCodes) == 0 {
+		return retry.Max, nil
+	}
+	return struct {
+		Max       int      `yaml:"max"`
+		When      []string `yaml:"when,omitempty"`
+		ExitCodes []int    `yaml:"exit_codes,omitempty"`
+	}{retry.Max, retry.When, retry.ExitCodes}, nil
+}
+
+func (retry *JobRetry) validate() error {
+	if retry.Max < 0 || retry.Max > maxRetries {
+		return fmt.Errorf("retry max must be between 0 and %d, is %d", maxRetries, retry.Max)
+	}
+	for _, when := range retry.When {
+		if err := validateOneOf("retry when", when, validRetryWhenValues); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JobCacheKey is either a fixed key or a key computed from files (with optional prefix).
+type JobCacheKey struct {
+	Key    string
+	Files  []string
+	Prefix string
+}
+
+func (key *JobCacheKey) MarshalYAML() (interface{}, error) {
+	if len(key.Files) == 0 {
+		return key.Key, nil
+	}
+	return struct {
+		Files  []string `yaml:"files"`
+		Prefix string   `yaml:"prefix,omitempty"`
+	}{key.Files, key.Prefix}, nil
+}
+
+type JobCache struct {
+	Key          *JobCacheKey `yaml:"key,omitempty"`
+	Paths        []string     `yaml:"paths,omitempty"`
+	Untracked    bool         `yaml:"untracked,omitempty"`
+	Unprotect    bool         `yaml:"unprotect,omitempty"`
+	When         string       `yaml:"when,omitempty"`
+	Policy       string       `yaml:"policy,omitempty"`
+	FallbackKeys []string     `yaml:"fallback_keys,omitempty"`
+}
+
+func (cache *JobCache) validate() error {
+	if cache.Key != nil {
+		if cache.Key.Key != "" && len(cache.Key.Files) > 0 {
+			return errors.New("cache key must either be a fixed key or files")
+		}
+		if len(cache.Key.Files) > 2 {
+			return fmt.Errorf("cache key files allows at most 2 files, has %d", len(cache.Key.Files))
+		}
+		if cache.Key.Prefix != "" && len(cache.Key.Files) == 0 {
+			return errors.New("cache key prefix is only allowed with files")
+		}
+		if strings.Contains(cache.Key.Key, "/") || cache.Key.Key == "." || cache.Key.Key == ".." {
+			return fmt.Errorf("cache key '%s' must not contain / or be . or ..", cache.Key.Key)
+		}
+	}
+	if err := validateOneOf("cache policy", cache.Policy, validCachePolicies); err != nil {
+		return err
+	}
+	return validateOneOf("cache when", cache.When, validCacheWhenValues)
+}
+
+func validateCaches(caches []JobCache) error {
+	if len(caches) > maxCachesPerJob {
+		return fmt.Errorf("gitlab allows at most %d caches, found %d", maxCachesPerJob, len(caches))
+	}
+	for idx := range caches {
+		if err := caches[idx].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JobEnvironment is the environment a job deploys to. Only a name renders the short form environment: <name>.
+type JobEnvironment struct {
+	Name                string
+	Url                 string
+	Action              string
+	OnStop              *Job
+	AutoStopIn          string
+	DeploymentTier      string
+	KubernetesNamespace string
+}
+
+func (environment *JobEnvironment) MarshalYAML() (interface{}, error) {
+	if environment.Url == "" && environment.Action == "" && environment.OnStop == nil && environment.AutoStopIn == "" && environment.DeploymentTier == "" && environment.KubernetesNamespace == "" {
+		return environment.Name, nil
+	}
+	type kubernetes struct {
+		Namespace string `yaml:"namespace"`
+	}
+	long := struct {
+		Name           string      `yaml:"name"`
+		Url            string      `yaml:"url,omitempty"`
+		Action         string      `yaml:"action,omitempty"`
+		OnStop         string      `yaml:"on_stop,omitempty"`
+		AutoStopIn     string      `yaml:"auto_stop_in,omitempty"`
+		DeploymentTier string      `yaml:"deployment_tier,omitempty"`
+		Kubernetes     *kubernetes `yaml:"kubernetes,omitempty"`
+	}{
+		Name:           environment.Name,
+		Url:            environment.Url,
+		Action:         environment.Action,
+		AutoStopIn:     environment.AutoStopIn,
+		DeploymentTier: environment.DeploymentTier,
+	}
+	if environment.OnStop != nil {
+		long.OnStop = environment.OnStop.Name
+	}
+	if environment.KubernetesNamespace != "" {
+		long.Kubernetes = &kubernetes{Namespace: environment.KubernetesNamespace}
+	}
+	return long, nil
+}
+
+func (environment *JobEnvironment) validate() error {
+	if environment.Name == "" {
+		return errors.New("environment needs a name")
+	}
+	if err := validateOneOf("environment action", environment.Action, validEnvironmentActions); err != nil {
+		return err
+	}
+	return validateOneOf("environment deployment tier", environment.DeploymentTier, validEnvironmentTiers)
+}
+
+// JobParallel runs a job multiple times, either count times or once per matrix combination.
+type JobParallel struct {
+	Count  int
+	Matrix []map[string][]string
+}
+
+func (parallel *JobParallel) MarshalYAML() (interface{}, error) {
+	if len(parallel.Matrix) == 0 {
+		return parallel.Count, nil
+	}
+	return struct {
+		Matrix []map[string][]string `yaml:"matrix"`
+	}{parallel.Matrix}, nil
+}
+
+func (parallel *JobParallel) validate() error {
+	if len(parallel.Matrix) > 0 {
+		if parallel.Count != 0 {
+			return errors.New("parallel must either define a count or a matrix")
+		}
+		combinations := 0
+		for _, entry := range parallel.Matrix {
+			entryCombinations := 1
+			for _, values := range entry {
+				entryCombinations *= len(values)
+			}
+			combinations += entryCombinations
+		}
+		if combinations > maxParallelJobs {
+			return fmt.Errorf("parallel matrix creates %d jobs, gitlab allows at most %d", combinations, maxParallelJobs)
+		}
+		return nil
+	}
+	if parallel.Count < minParallelJobs || parallel.Count > maxParallelJobs {
+		return fmt.Errorf("parallel count must be between %d and %d, is %d", minParallelJobs, maxParallelJobs, parallel.Count)
+	}
+	return nil
+}
+
+// JobDependencies restricts the jobs whose artifacts are downloaded. An empty list (no artifacts) is rendered, too.
+type JobDependencies struct {
+	Jobs []*Job
+}
+
+func (dependencies *JobDependencies) MarshalYAML() (interface{}, error) {
+	names := make([]string, len(dependencies.Jobs))
+	for idx, job := range dependencies.Jobs {
+		if job == nil {
+			return nil, errors.New("dependencies: job must not be nil")
+		}
+		names[idx] = job.Name
+	}
+	return names, nil
+}
+
+type JobReleaseAssetLink struct {
+	Name     string `yaml:"name"`
+	Url      string `yaml:"url"`
+	Filepath string `yaml:"filepath,omitempty"`
+	LinkType string `yaml:"link_type,omitempty"`
+}
+
+type JobReleaseAssets struct {
+	Links []JobReleaseAssetLink `yaml:"links"`
+}
+
+// JobRelease creates a gitlab release, the job needs the release-cli in its image.
+type JobRelease struct {
+	TagName     string            `yaml:"tag_name"`
+	TagMessage  string            `yaml:"tag_message,omitempty"`
+	Name        string            `yaml:"name,omitempty"`
+	Description string            `yaml:"description"`
+	Ref         string            `yaml:"ref,omitempty"`
+	Milestones  []string          `yaml:"milestones,omitempty"`
+	ReleasedAt  string            `yaml:"released_at,omitempty"`
+	Assets      *JobReleaseAssets `yaml:"assets,omitempty"`
+}
+
+func (release *JobRelease) validate() error {
+	if release.TagName == "" {
+		return errors.New("release needs a tag_name")
+	}
+	if release.Description == "" {
+		return errors.New("release needs a description")
+	}
+	if release.Assets != nil {
+		for _, link := range release.Assets.Links {
+			if link.Name == "" || link.Url == "" {
+				return errors.New("release asset links need a name and an url")
+			}
+			if err := validateOneOf("release asset link type", link.LinkType, validReleaseAssetLinkTypes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type JobSecretVaultEngine struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+// JobSecretVault references a secret in hashicorp vault, without engine gitlab uses the kv-v2 engine.
+type JobSecretVault struct {
+	Engine *JobSecretVaultEngine `yaml:"engine,omitempty"`
+	Path   string                `yaml:"path"`
+	Field  string                `yaml:"field"`
+}
+
+type JobSecret struct {
+	Vault            *JobSecretVault `yaml:"vault,omitempty"`
+	AzureKeyVault    *JobSecretAzure `yaml:"azure_key_vault,omitempty"`
+	GcpSecretManager *JobSecretGcp   `yaml:"gcp_secret_manager,omitempty"`
+	File             *bool           `yaml:"file,omitempty"`
+	Token            string          `yaml:"token,omitempty"`
+}
+
+type JobSecretAzure struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version,omitempty"`
+}
+
+type JobSecretGcp struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version,omitempty"`
+}
+
+func (secret *JobSecret) validate(name string) error {
+	providers := 0
+	for _, configured := range []bool{secret.Vault != nil, secret.AzureKeyVault != nil, secret.GcpSecretManager != nil} {
+		if configured {
+			providers++
+		}
+	}
+	if providers != 1 {
+		return fmt.Errorf("secret '%s' needs exactly one of vault, azure_key_vault or gcp_secret_manager", name)
+	}
+	if secret.Vault != nil && (secret.Vault.Path == "" || secret.Vault.Field == "") {
+		return fmt.Errorf("vault secret '%s' needs a path and a field", name)
+	}
+	return nil
+}
+
+// JobInheritSetting is either true / false (inherit all or nothing) or a list of inherited keys.
+type JobInheritSetting struct {
+	All  *bool
+	Keys []string
+}
+
+func (setting *JobInheritSetting) MarshalYAML() (interface{}, error) {
+	if setting.All != nil && len(setting.Keys) > 0 {
+		return nil, errors.New("inherit setting must either be a boolean or a list of keys")
+	}
+	if setting.All != nil {
+		return *setting.All, nil
+	}
+	return setting.Keys, nil
+}
+
+type JobInherit struct {
+	Default   *JobInheritSetting `yaml:"default,omitempty"`
+	Variables *JobInheritSetting `yaml:"variables,omitempty"`
+}
+
+func (inherit *JobInherit) validate() error {
+	if inherit.Default != nil && inherit.Default.All == nil {
+		for _, key := range inherit.Default.Keys {
+			if !contains(defaultKeywords, key) {
+				return fmt.Errorf("inherit default key '%s' is invalid (valid: %s)", key, strings.Join(defaultKeywords, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// JobIdToken is an OIDC id token, a single audience renders the short form aud: <audience>.
+type JobIdToken struct {
+	Aud []string
+}
+
+func (token *JobIdToken) MarshalYAML() (interface{}, error) {
+	if len(token.Aud) == 1 {
+		return map[string]string{"aud": token.Aud[0]}, nil
+	}
+	return map[string][]string{"aud": token.Aud}, nil
+}
+
+func validateIdTokens(tokens map[string]*JobIdToken) error {
+	for name, token := range tokens {
+		if token == nil || len(token.Aud) == 0 {
+			return fmt.Errorf("id token '%s' needs at least one aud", name)
+		}
+	}
+	return nil
+}
+
+// JobTriggerForward controls which variables are forwarded to the downstream pipeline.
+type JobTriggerForward struct {
+	YamlVariables     *bool `yaml:"yaml_variables,omitempty"`
+	PipelineVariables *bool `yaml:"pipeline_variables,omitempty"`
+}
+
+func (trigger *JobTrigger) validate() error {
+	if len(trigger.Include) > 0 && trigger.Project != "" {
+		return errors.New("trigger must either include a child pipeline or trigger a project")
+	}
+	if len(trigger.Include) == 0 && trigger.Project == "" {
+		return errors.New("trigger needs an include or a project")
+	}
+	if trigger.Branch != "" && trigger.Project == "" {
+		return errors.New("trigger branch is only allowed for multi project pipelines")
+	}
+	return validateOneOf("trigger strategy", trigger.Strategy, validTriggerStrategies)
+}
+
+var (
+	// Keywords allowed in the default section, see https://docs.gitlab.com/ee/ci/yaml/#default
+	defaultKeywords = []string{"after_script", "artifacts", "before_script", "cache", "hooks", "id_tokens", "image", "interruptible", "retry", "services", "tags", "timeout"}
+)
+
+// PipelineDefault sets defaults for all jobs of the pipeline.
+type PipelineDefault struct {
+	Image         *ContainerImageCoordinates `yaml:"image,omitempty"`
+	BeforeScript  []string                   `yaml:"before_script,omitempty"`
+	AfterScript   []string                   `yaml:"after_script,omitempty"`
+	Artifacts     *JobArtifacts              `yaml:"artifacts,omitempty"`
+	Cache         []JobCache                 `yaml:"cache,omitempty"`
+	Interruptible *bool                      `yaml:"interruptible,omitempty"`
+	Retry         *JobRetry                  `yaml:"retry,omitempty"`
+	Services      []JobService               `yaml:"services,omitempty"`
+	Tags          []string                   `yaml:"tags,omitempty"`
+	Timeout       string                     `yaml:"timeout,omitempty"`
+	IdTokens      map[string]*JobIdToken     `yaml:"id_tokens,omitempty"`
+}
+
+func (pipelineDefault *PipelineDefault) validate() error {
+	if err := validateCaches(pipelineDefault.Cache); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	if pipelineDefault.Retry != nil {
+		if err := pipelineDefault.Retry.validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	if err := validateIdTokens(pipelineDefault.IdTokens); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	return nil
+}
+
+type WorkflowRule struct {
+	If         string                 `yaml:"if,omitempty"`
+	Changes    []string               `yaml:"changes,omitempty"`
+	Exists     []string               `yaml:"exists,omitempty"`
+	When       string                 `yaml:"when,omitempty"`
+	Variables  map[string]interface{} `yaml:"variables,omitempty"`
+	AutoCancel *WorkflowAutoCancel    `yaml:"auto_cancel,omitempty"`
+}
+
+type WorkflowAutoCancel struct {
+	OnNewCommit  string `yaml:"on_new_commit,omitempty"`
+	OnJobFailure string `yaml:"on_job_failure,omitempty"`
+}
+
+func (autoCancel *WorkflowAutoCancel) validate() error {
+	if err := validateOneOf("workflow auto_cancel on_new_commit", autoCancel.OnNewCommit, validAutoCancelOnNewCommit); err != nil {
+		return err
+	}
+	return validateOneOf("workflow auto_cancel on_job_failure", autoCancel.OnJobFailure, validAutoCancelOnJobFailure)
+}
+
+// Workflow controls if and how the pipeline is created.
+type Workflow struct {
+	Name       string              `yaml:"name,omitempty"`
+	Rules      []WorkflowRule      `yaml:"rules,omitempty"`
+	AutoCancel *WorkflowAutoCancel `yaml:"auto_cancel,omitempty"`
+}
+
+func (workflow *Workflow) validate() error {
+	for _, rule := range workflow.Rules {
+		if err := validateOneOf("workflow rule when", rule.When, validWorkflowRuleWhenValues); err != nil {
+			return err
+		}
+		if rule.AutoCancel != nil {
+			if err := rule.AutoCancel.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if workflow.AutoCancel != nil {
+		return workflow.AutoCancel.validate()
+	}
+	return nil
+}
+
+// PipelineInclude includes external yaml files, exactly one of local, remote, template,
+// project or component has to be set.
+type PipelineInclude struct {
+	Local     string                 `yaml:"local,omitempty"`
+	Remote    string                 `yaml:"remote,omitempty"`
+	Template  string                 `yaml:"template,omitempty"`
+	Project   string                 `yaml:"project,omitempty"`
+	Ref       string                 `yaml:"ref,omitempty"`
+	File      []string               `yaml:"file,omitempty"`
+	Component string                 `yaml:"component,omitempty"`
+	Inputs    map[string]interface{} `yaml:"inputs,omitempty"`
+	Rules     []JobRule              `yaml:"rules,omitempty"`
+}
+
+func (include *PipelineInclude) validate() error {
+	sources := 0
+	for _, source := range []string{include.Local, include.Remote, include.Template, include.Project, include.Component} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("include needs exactly one of local, remote, template, project or component")
+	}
+	if include.Project != "" && len(include.File) == 0 {
+		return fmt.Errorf("include of project '%s' needs at least one file", include.Project)
+	}
+	if include.Project == "" && (len(include.File) > 0 || include.Ref != "") {
+		return errors.New("include file and ref are only allowed for project includes")
+	}
+	for idx := range include.Rules {
+		if err := include.Rules[idx].validate(); err != nil {
+			return fmt.Errorf("include: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package pipelinemodel
+
+import (
+	"testing"
+)
+
+func TestKeywordsMarshalling(t *testing.T) {
+	stage := Stage{Name: "deploy"}
+	build := Job{Name: "build", Stage: &stage, Script: []string{"make"}}
+	stop := Job{Name: "stop", Stage: &stage, Script: []string{"./stop.sh"}, When: WhenManual, Environment: &JobEnvironment{Name: "review", Action: "stop"}}
+	deploy := Job{
+		Name:   "deploy",
+		Stage:  &stage,
+		Script: []string{"./deploy.sh"},
+		Needs:  []JobNeeds{{Job: &build, Artifacts: true, Optional: true}},
+		Rules: []JobRule{
+			{If: `$CI_COMMIT_BRANCH == "main"`, When: WhenAlways},
+			{When: WhenNever},
+		},
+		Retry:         &JobRetry{Max: 2, When: []string{"runner_system_failure"}},
+		Cache:         []JobCache{{Key: &JobCacheKey{Files: []string{"go.sum"}}, Paths: []string{".cache/"}, Policy: "pull"}},
+		Environment:   &JobEnvironment{Name: "review", Url: "https://review.example.com", OnStop: &stop},
+		ResourceGroup: "review",
+		Parallel:      &JobParallel{Matrix: []map[string][]string{{"ARCH": {"amd64", "arm64"}}}},
+		Dependencies:  &JobDependencies{Jobs: []*Job{}},
+		Secrets:       map[string]*JobSecret{"DB_PASSWORD": {Vault: &JobSecretVault{Path: "db", Field: "password"}}},
+		Inherit:       &JobInherit{Variables: &JobInheritSetting{All: &[]bool{false}[0]}},
+		IdTokens:      map[string]*JobIdToken{"VAULT_ID_TOKEN": {Aud: []string{"https://vault.example.com"}}},
+	}
+	trigger := Job{
+		Name:  "downstream",
+		Stage: &stage,
+		Trigger: &JobTrigger{
+			Project: "group/deployments",
+			Branch:  "main",
+			Forward: &JobTriggerForward{PipelineVariables: &[]bool{true}[0]},
+		},
+	}
+	pipeline := Pipeline{
+		Default:  &PipelineDefault{Retry: &JobRetry{Max: 1}, Interruptible: &[]bool{true}[0]},
+		Include:  []PipelineInclude{{Project: "group/templates", Ref: "v1", File: []string{"/lint.yml"}}},
+		Workflow: &Workflow{Rules: []WorkflowRule{{If: `$CI_PIPELINE_SOURCE == "push"`}}},
+		Stages:   []*Stage{&stage},
+		Jobs:     []*Job{&build, &stop, &deploy, &trigger},
+	}
+	expected := `default:
+    interruptible: true
+    retry: 1
+include:
+    - project: group/templates
+      ref: v1
+      file:
+        - /lint.yml
+stages:
+    - deploy
+workflow:
+    rules:
+        - if: $CI_PIPELINE_SOURCE == "push"
+build:
+    stage: deploy
+    script:
+        - make
+stop:
+    stage: deploy
+    script:
+        - ./stop.sh
+    when: manual
+    environment:
+        name: review
+        action: stop
+deploy:
+    stage: deploy
+    script:
+        - ./deploy.sh
+    needs:
+        - artifacts: true
+          job: build
+          optional: true
+    rules:
+        - if: $CI_COMMIT_BRANCH == "main"
+          when: always
+        - when: never
+    retry:
+        max: 2
+        when:
+            - runner_system_failure
+    cache:
+        - key:
+            files:
+                - go.sum
+          paths:
+            - .cache/
+          policy: pull
+    environment:
+        name: review
+        url: https://review.example.com
+        on_stop: stop
+    resource_group: review
+    parallel:
+        matrix:
+            - ARCH:
+                - amd64
+                - arm64
+    dependencies: []
+    secrets:
+        DB_PASSWORD:
+            vault:
+                path: db
+                field: password
+    inherit:
+        variables: false
+    id_tokens:
+        VAULT_ID_TOKEN:
+            aud: https://vault.example.com
+downstream:
+    stage: deploy
+    trigger:
+        project: group/deployments
+        branch: main
+        forward:
+            pipeline_variables: true
+`
+	rendered, err := pipeline.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != expected {
+		t.Errorf("rendered pipeline\n%s\ndoesn't match expected\n%s", rendered, expected)
+	}
+}
+
+func TestKeywordsValidation(t *testing.T) {
+	stage := Stage{Name: "test"}
+	for _, testCase := range []struct {
+		job             Job
+		expectedMessage string
+	}{
+		{Job{Script: []string{"x"}, Retry: &JobRetry{Max: 3}}, "job 'invalid': retry max must be between 0 and 2, is 3"},
+		{Job{Script: []string{"x"}, Retry: &JobRetry{Max: 1, When: []string{"sometimes"}}}, "job 'invalid': retry when 'sometimes' is invalid (valid: always, unknown_failure, script_failure, api_failure, stuck_or_timeout_failure, runner_system_failure, runner_unsupported, stale_schedule, job_execution_timeout, archived_failure, unmet_prerequisites, scheduler_failure, data_integrity_failure)"},
+		{Job{Script: []string{"x"}, Rules: []JobRule{{When: WhenDelayed}}}, "job 'invalid': rule with when delayed needs start_in"},
+		{Job{Script: []string{"x"}, When: WhenDelayed}, "job 'invalid' must define start_in if and only if it is a delayed job"},
+		{Job{Script: []string{"x"}, Cache: []JobCache{{Policy: "pull-only"}}}, "job 'invalid': cache policy 'pull-only' is invalid (valid: pull, push, pull-push)"},
+		{Job{Script: []string{"x"}, Cache: make([]JobCache, 5)}, "job 'invalid': gitlab allows at most 4 caches, found 5"},
+		{Job{Script: []string{"x"}, Environment: &JobEnvironment{Action: "stop"}}, "job 'invalid': environment needs a name"},
+		{Job{Script: []string{"x"}, Parallel: &JobParallel{Count: 1}}, "job 'invalid': parallel count must be between 2 and 200, is 1"},
+		{Job{Script: []string{"x"}, Release: &JobRelease{Description: "foo"}}, "job 'invalid': release needs a tag_name"},
+		{Job{Script: []string{"x"}, Secrets: map[string]*JobSecret{"S": {}}}, "job 'invalid': secret 'S' needs exactly one of vault, azure_key_vault or gcp_secret_manager"},
+		{Job{Script: []string{"x"}, IdTokens: map[string]*JobIdToken{"T": {}}}, "job 'invalid': id token 'T' needs at least one aud"},
+		{Job{Script: []string{"x"}, Inherit: &JobInherit{Default: &JobInheritSetting{Keys: []string{"variables"}}}}, "job 'invalid': inherit default key 'variables' is invalid (valid: after_script, artifacts, before_script, cache, hooks, id_tokens, image, interruptible, retry, services, tags, timeout)"},
+		{Job{}, "job 'invalid' needs a script or a trigger"},
+		{Job{Script: []string{"x"}, Trigger: &JobTrigger{Project: "a/b"}}, "trigger job 'invalid' must not define script or image"},
+		{Job{Trigger: &JobTrigger{Branch: "main", Include: []JobTriggerInclude{{Artifact: "a.yml"}}}}, "job 'invalid': trigger branch is only allowed for multi project pipelines"},
+	} {
+		job := testCase.job
+		job.Name = "invalid"
+		job.Stage = &stage
+		pipeline := Pipeline{Stages: []*Stage{&stage}, Jobs: []*Job{&job}}
+		if err := pipeline.validate(); err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("error is '%v' but should be '%s'", err, testCase.expectedMessage)
+		}
+	}
+
+	for _, testCase := range []struct {
+		pipeline        Pipeline
+		expectedMessage string
+	}{
+		{Pipeline{Include: []PipelineInclude{{Local: "a.yml", Remote: "https://example.com/b.yml"}}}, "include needs exactly one of local, remote, template, project or component"},
+		{Pipeline{Include: []PipelineInclude{{Project: "group/templates"}}}, "include of project 'group/templates' needs at least one file"},
+		{Pipeline{Workflow: &Workflow{Rules: []WorkflowRule{{When: WhenManual}}}}, "workflow: workflow rule when 'manual' is invalid (valid: always, never)"},
+		{Pipeline{Default: &PipelineDefault{Retry: &JobRetry{Max: 5}}}, "default: retry max must be between 0 and 2, is 5"},
+	} {
+		if err := testCase.pipeline.validate(); err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("error is '%v' but should be '%s'", err, testCase.expectedMessage)
+		}
+	}
+}
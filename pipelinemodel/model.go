@@ -9,7 +9,18 @@ import (
 	yaml "gopkg.in/yaml.v3"
 )
 
+// Values of the job keyword when, see https://docs.gitlab.com/ee/ci/yaml/#when
+const (
+	WhenOnSuccess = "on_success"
+	WhenOnFailure = "on_failure"
+	WhenAlways    = "always"
+	WhenManual    = "manual"
+	WhenDelayed   = "delayed"
+	WhenNever     = "never"
+)
+
 var (
+	validWhenValues = []string{WhenOnSuccess, WhenOnFailure, WhenAlways, WhenManual, WhenDelayed, WhenNever}
 	// From https://docs.gitlab.com/ee/ci/yaml/
 	globalKeywords = []string{
 		"default", "include", "stages", "variables", "workflow",
@@ -20,6 +31,9 @@ type ContainerImageCoordinates struct {
 	Registry   string
 	Repository string
 	Tag        string
+	// Digest pins the coordinates to an exact manifest (e.g. sha256:...). If set, it
+	// takes precedence over the tag when the coordinates are rendered.
+	Digest string
 }
 
 func ContainerImageCoordinatesFromString(containerCoordinates string) (*ContainerImageCoordinates, error) {
@@ -33,6 +47,13 @@ func ContainerImageCoordinatesFromString(containerCoordinates string) (*Containe
 	remaining := containerCoordinates[firstSlashIdx+1:]
 	var repository string
 	var tag string
+	if indexOfAt := strings.Index(remaining, "@"); indexOfAt != -1 {
+		return &ContainerImageCoordinates{
+			Registry:   registry,
+			Repository: remaining[:indexOfAt],
+			Digest:     remaining[indexOfAt+1:],
+		}, nil
+	}
 	indexOfColon := strings.Index(remaining, ":")
 	if indexOfColon == -1 {
 		tag = "latest"
@@ -51,6 +72,9 @@ func ContainerImageCoordinatesFromString(containerCoordinates string) (*Containe
 }
 
 func (c *ContainerImageCoordinates) String() string {
+	if c.Digest != "" {
+		return fmt.Sprintf("%s/%s@%s", c.Registry, c.Repository, c.Digest)
+	}
 	return fmt.Sprintf("%s/%s:%s", c.Registry, c.Repository, c.Tag)
 }
 
@@ -58,57 +82,179 @@ func (coordinates *ContainerImageCoordinates) MarshalYAML() (interface{}, error)
 	// We don't use the url parsing here because the container
 	// coordinates are NOT a valid url (there is no scheme:// at
 	// the beginning, so just use the filepath)
-	joined := filepath.Join(coordinates.Registry, coordinates.Repository) + ":" + coordinates.Tag
-	return joined, nil
+	joined := filepath.Join(coordinates.Registry, coordinates.Repository)
+	if coordinates.Digest != "" {
+		return joined + "@" + coordinates.Digest, nil
+	}
+	if coordinates.Tag == "" {
+		// only parsed pipelines, the generators always set a tag
+		return joined, nil
+	}
+	return joined + ":" + coordinates.Tag, nil
 }
 
+// MarshalYAML renders the global keywords first (default, include, stages, variables, workflow)
+// and then the jobs in the order they were added to the pipeline, so that the rendered
+// pipeline is stable and reads in generation order.
 func (pipeline *Pipeline) MarshalYAML() (interface{}, error) {
-	pipelineMap := make(map[string]interface{})
+	pipelineNode := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string, value interface{}) error {
+		keyNode := &yaml.Node{}
+		if err := keyNode.Encode(key); err != nil {
+			return err
+		}
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(value); err != nil {
+			return fmt.Errorf("cannot render '%s': %w", key, err)
+		}
+		pipelineNode.Content = append(pipelineNode.Content, keyNode, valueNode)
+		return nil
+	}
+
 	pipelineStages := make([]string, len(pipeline.Stages))
 	for idx, stage := range pipeline.Stages {
 		pipelineStages[idx] = stage.Name
 	}
-	pipelineMap["stages"] = pipelineStages
-	for _, job := range pipeline.Jobs {
-		pipelineMap[job.Name] = job
+	globalKeywords := []struct {
+		name  string
+		value interface{}
+		isSet bool
+	}{
+		{"default", pipeline.Default, pipeline.Default != nil},
+		{"include", pipeline.Include, len(pipeline.Include) > 0},
+		{"stages", pipelineStages, len(pipelineStages) > 0},
+		{"variables", pipeline.Variables, len(pipeline.Variables) > 0},
+		{"workflow", pipeline.Workflow, pipeline.Workflow != nil},
 	}
-	if len(pipeline.Variables) > 0 {
-		pipelineMap["variables"] = pipeline.Variables
+	for _, keyword := range globalKeywords {
+		if !keyword.isSet {
+			continue
+		}
+		if err := add(keyword.name, keyword.value); err != nil {
+			return nil, err
+		}
+	}
+	for _, job := range pipeline.Jobs {
+		if err := add(job.Name, job); err != nil {
+			return nil, err
+		}
 	}
-	return pipelineMap, nil
+	return pipelineNode, nil
 }
 
 type Pipeline struct {
+	Default   *PipelineDefault
+	Include   []PipelineInclude
+	Workflow  *Workflow
 	Stages    []*Stage
 	Jobs      []*Job
 	Variables map[string]interface{}
 }
 
 func (pipeline *Pipeline) validate() error {
+	if pipeline.Default != nil {
+		if err := pipeline.Default.validate(); err != nil {
+			return err
+		}
+	}
+	for idx := range pipeline.Include {
+		if err := pipeline.Include[idx].validate(); err != nil {
+			return err
+		}
+	}
+	if pipeline.Workflow != nil {
+		if err := pipeline.Workflow.validate(); err != nil {
+			return fmt.Errorf("workflow: %w", err)
+		}
+	}
 	for _, job := range pipeline.Jobs {
 		for _, globalKeyword := range globalKeywords {
 			if job.Name == globalKeyword {
 				return errors.New("Found job with name" + job.Name + " which is a reserved keyword. Pipeline validation failed.")
 			}
 		}
+		if err := job.validate(); err != nil {
+			return err
+		}
 	}
-	return nil
+	return pipeline.validateJobGraph()
 }
 
-func (pipeline *Pipeline) Render() string {
-
-	err := pipeline.validate()
-	if err != nil {
-		panic(err)
+func (job *Job) validate() error {
+	if job.When != "" {
+		valid := false
+		for _, when := range validWhenValues {
+			valid = valid || job.When == when
+		}
+		if !valid {
+			return fmt.Errorf("job '%s' has invalid when '%s' (valid: %s)", job.Name, job.When, strings.Join(validWhenValues, ", "))
+		}
+	}
+	if job.ManualConfirmation != "" && job.When != WhenManual {
+		return fmt.Errorf("job '%s' defines manual_confirmation but is not a manual job", job.Name)
+	}
+	if (job.StartIn != "") != (job.When == WhenDelayed) {
+		return fmt.Errorf("job '%s' must define start_in if and only if it is a delayed job", job.Name)
 	}
+	if job.Trigger != nil {
+		if len(job.Script) > 0 || len(job.BeforeScript) > 0 || len(job.AfterScript) > 0 || job.Image != nil {
+			return fmt.Errorf("trigger job '%s' must not define script or image", job.Name)
+		}
+		if err := job.Trigger.validate(); err != nil {
+			return fmt.Errorf("job '%s': %w", job.Name, err)
+		}
+	} else if len(job.Script) == 0 && len(job.Extends) == 0 && !strings.HasPrefix(job.Name, ".") {
+		return fmt.Errorf("job '%s' needs a script or a trigger", job.Name)
+	}
+	for idx := range job.Rules {
+		if err := job.Rules[idx].validate(); err != nil {
+			return fmt.Errorf("job '%s': %w", job.Name, err)
+		}
+	}
+	validators := []func() error{
+		func() error { return validateCaches(job.Cache) },
+		func() error { return validateIdTokens(job.IdTokens) },
+	}
+	if job.Retry != nil {
+		validators = append(validators, job.Retry.validate)
+	}
+	if job.Environment != nil {
+		validators = append(validators, job.Environment.validate)
+	}
+	if job.Parallel != nil {
+		validators = append(validators, job.Parallel.validate)
+	}
+	if job.Release != nil {
+		validators = append(validators, job.Release.validate)
+	}
+	if job.Inherit != nil {
+		validators = append(validators, job.Inherit.validate)
+	}
+	for name, secret := range job.Secrets {
+		name, secret := name, secret
+		validators = append(validators, func() error { return secret.validate(name) })
+	}
+	for _, validator := range validators {
+		if err := validator(); err != nil {
+			return fmt.Errorf("job '%s': %w", job.Name, err)
+		}
+	}
+	return nil
+}
 
+// Render validates the pipeline, renders it and checks the result against the embedded gitlab ci schema.
+func (pipeline *Pipeline) Render() (string, error) {
+	if err := pipeline.validate(); err != nil {
+		return "", err
+	}
 	bytes, err := yaml.Marshal(pipeline)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-
-	return string(bytes)
-
+	if err := validateAgainstSchema(bytes); err != nil {
+		return "", err
+	}
+	return string(bytes), nil
 }
 
 type Stage struct {
@@ -123,9 +269,30 @@ func (pipelineStage *Stage) MarshalYAML() (interface{}, error) {
 }
 
 type JobArtifacts struct {
-	Paths   []string `yaml:"paths,omitempty"`
-	Exclude []string `yaml:"exclude,omitempty"`
-	When    *string  `yaml:"when,omitempty"`
+	Paths    []string             `yaml:"paths,omitempty"`
+	Exclude  []string             `yaml:"exclude,omitempty"`
+	When     *string              `yaml:"when,omitempty"`
+	ExpireIn string               `yaml:"expire_in,omitempty"`
+	ExposeAs string               `yaml:"expose_as,omitempty"`
+	Reports  *JobArtifactsReports `yaml:"reports,omitempty"`
+}
+
+type JobArtifactsReports struct {
+	// The dotenv report is used to pass variables (e.g. the staging image digest)
+	// to the jobs that need this job.
+	Dotenv            string   `yaml:"dotenv,omitempty"`
+	Cyclonedx         []string `yaml:"cyclonedx,omitempty"`
+	ContainerScanning []string `yaml:"container_scanning,omitempty"`
+	Junit             []string `yaml:"junit,omitempty"`
+	Codequality       []string `yaml:"codequality,omitempty"`
+}
+
+type JobService struct {
+	Image      *ContainerImageCoordinates `yaml:"name"`
+	Alias      string                     `yaml:"alias,omitempty"`
+	Entrypoint []string                   `yaml:"entrypoint,omitempty"`
+	Command    []string                   `yaml:"command,omitempty"`
+	Variables  map[string]interface{}     `yaml:"variables,omitempty"`
 }
 
 type JobAllowFailure struct {
@@ -136,80 +303,97 @@ type JobAllowFailure struct {
 type JobNeeds struct {
 	Job       *Job
 	Artifacts bool
+	// Optional needs are ignored if the job is not part of the pipeline (e.g. excluded by rules)
+	Optional bool
 }
 
-// TODO in gitlab 14.10 it's possible to use a trigger:forward setting to configure if vars are forwarded
-// we can really use this feature, so we should add this here later.
-
+// JobTriggerInclude is the configuration of a child pipeline, either an artifact of a job
+// of the pipeline (generated child pipelines) or a file.
 type JobTriggerInclude struct {
 	Artifact string
 	Job      *Job
+	Local    string
+	Template string
+	Project  string
+	Ref      string
+	File     string
 }
 
 func (jobTriggerInclude JobTriggerInclude) MarshalYAML() (interface{}, error) {
+	if jobTriggerInclude.Artifact == "" {
+		return struct {
+			Local    string `yaml:"local,omitempty"`
+			Template string `yaml:"template,omitempty"`
+			Project  string `yaml:"project,omitempty"`
+			Ref      string `yaml:"ref,omitempty"`
+			File     string `yaml:"file,omitempty"`
+		}{jobTriggerInclude.Local, jobTriggerInclude.Template, jobTriggerInclude.Project, jobTriggerInclude.Ref, jobTriggerInclude.File}, nil
+	}
+	if jobTriggerInclude.Job == nil {
+		return nil, errors.New("trigger include: needs job to be defined")
+	}
 	return map[string]string{
 		"artifact": jobTriggerInclude.Artifact,
 		"job":      jobTriggerInclude.Job.Name,
 	}, nil
 }
 
+// JobTrigger starts a child pipeline (include) or a multi project pipeline (project).
 type JobTrigger struct {
-	Include  []JobTriggerInclude `yaml:"include"`
-	Strategy string              `yaml:"strategy"`
+	Include  []JobTriggerInclude `yaml:"include,omitempty"`
+	Project  string              `yaml:"project,omitempty"`
+	Branch   string              `yaml:"branch,omitempty"`
+	Strategy string              `yaml:"strategy,omitempty"`
+	Forward  *JobTriggerForward  `yaml:"forward,omitempty"`
 }
 
 func (jobNeeds JobNeeds) MarshalYAML() (interface{}, error) {
 	if jobNeeds.Job == nil {
 		return nil, errors.New("needs: needs job to be defined")
 	}
-	return map[string]interface{}{
+	needs := map[string]interface{}{
 		"job":       jobNeeds.Job.Name,
 		"artifacts": jobNeeds.Artifacts,
-	}, nil
+	}
+	if jobNeeds.Optional {
+		needs["optional"] = true
+	}
+	return needs, nil
 
 }
 
 type Job struct {
-	Name          string                     `yaml:"-"`
-	Stage         *Stage                     `yaml:"stage"`
-	Script        []string                   `yaml:"script,omitempty"`
-	AfterScript   []string                   `yaml:"after_script,omitempty"`
-	BeforeScript  []string                   `yaml:"before_script,omitempty"`
-	AllowFailure  *JobAllowFailure           `yaml:"allow_failure,omitempty"` // FIXME: use struct representing the simple bool value or exit_codes as child
-	Artifacts     *JobArtifacts              `yaml:"artifacts,omitempty"`
-	Image         *ContainerImageCoordinates `yaml:"image,omitempty"`
-	Needs         []JobNeeds                 `yaml:"needs,omitempty"` // empty array explicitly allowed
-	Interruptible *bool                      `yaml:"interruptible,omitempty"`
-	Trigger       *JobTrigger                `yaml:"trigger,omitempty"`
-	Variables     *map[string]interface{}    `yaml:"variables,omitempty"`
-	/*
-		cache 	List of files that should be cached between subsequent runs.
-		coverage 	Code coverage settings for a given job.
-		dast_configuration 	Use configuration from DAST profiles on a job level.
-		dependencies 	Restrict which artifacts are passed to a specific job by providing a list of jobs to fetch artifacts from.
-		environment 	Name of an environment to which the job deploys.
-		except 	Control when jobs are not created.
-		extends 	Configuration entries that this job inherits from.
-		image 	Use Docker images.
-		inherit 	Select which global defaults all jobs inherit.
-		interruptible 	Defines if a job can be canceled when made redundant by a newer run.
-		only 	Control when jobs are created.
-		pages 	Upload the result of a job to use with GitLab Pages.
-		parallel 	How many instances of a job should be run in parallel.
-		release 	Instructs the runner to generate a release object.
-		resource_group 	Limit job concurrency.
-		retry 	When and how many times a job can be auto-retried in case of a failure.
-		rules 	List of conditions to evaluate and determine selected attributes of a job, and whether or not it’s created.
-		script 	Shell script that is executed by a runner.
-		secrets 	The CI/CD secrets the job needs.
-		services 	Use Docker services images.
-		stage 	Defines a job stage.
-		tags 	List of tags that are used to select a runner.
-		timeout 	Define a custom job-level timeout that takes precedence over the project-wide setting.
-		trigger 	Defines a downstream pipeline trigger.
-		variables 	Define job variables on a job level.
-		when
-	*/
+	Name               string                     `yaml:"-"`
+	Stage              *Stage                     `yaml:"stage,omitempty"`
+	Script             []string                   `yaml:"script,omitempty"`
+	AfterScript        []string                   `yaml:"after_script,omitempty"`
+	BeforeScript       []string                   `yaml:"before_script,omitempty"`
+	AllowFailure       *JobAllowFailure           `yaml:"allow_failure,omitempty"` // FIXME: use struct representing the simple bool value or exit_codes as child
+	Artifacts          *JobArtifacts              `yaml:"artifacts,omitempty"`
+	Image              *ContainerImageCoordinates `yaml:"image,omitempty"`
+	Needs              []JobNeeds                 `yaml:"needs,omitempty"` // empty array explicitly allowed
+	Interruptible      *bool                      `yaml:"interruptible,omitempty"`
+	Trigger            *JobTrigger                `yaml:"trigger,omitempty"`
+	Variables          *map[string]interface{}    `yaml:"variables,omitempty"`
+	Services           []JobService               `yaml:"services,omitempty"`
+	Tags               []string                   `yaml:"tags,omitempty"`
+	Timeout            string                     `yaml:"timeout,omitempty"`
+	When               string                     `yaml:"when,omitempty"`
+	ManualConfirmation string                     `yaml:"manual_confirmation,omitempty"` // message shown before a manual job starts
+	StartIn            string                     `yaml:"start_in,omitempty"`            // only for when: delayed
+	Rules              []JobRule                  `yaml:"rules,omitempty"`
+	Retry              *JobRetry                  `yaml:"retry,omitempty"`
+	Cache              []JobCache                 `yaml:"cache,omitempty"`
+	Environment        *JobEnvironment            `yaml:"environment,omitempty"`
+	ResourceGroup      string                     `yaml:"resource_group,omitempty"`
+	Parallel           *JobParallel               `yaml:"parallel,omitempty"`
+	Extends            []string                   `yaml:"extends,omitempty"`
+	Dependencies       *JobDependencies           `yaml:"dependencies,omitempty"` // nil: all artifacts, empty: no artifacts
+	Release            *JobRelease                `yaml:"release,omitempty"`
+	Secrets            map[string]*JobSecret      `yaml:"secrets,omitempty"`
+	Inherit            *JobInherit                `yaml:"inherit,omitempty"`
+	IdTokens           map[string]*JobIdToken     `yaml:"id_tokens,omitempty"`
+	Coverage           string                     `yaml:"coverage,omitempty"`
 }
 
 func (jaf *JobAllowFailure) MarshalYAML() (interface{}, error) {
@@ -95,3 +95,105 @@ func TestContainerImageCoordinatesParsing(t *testing.T) {
 	}
 
 }
+
+func TestContainerImageCoordinatesWithDigest(t *testing.T) {
+	imageCoordinatesString := "containerregistry.afriserver.de:5000/devfbe/gipgee-test@sha256:0123456789abcdef"
+	coordinates, err := ContainerImageCoordinatesFromString(imageCoordinatesString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if coordinates.Registry != "containerregistry.afriserver.de:5000" {
+		t.Errorf("wrong registry '%s'", coordinates.Registry)
+	}
+	if coordinates.Repository != "devfbe/gipgee-test" {
+		t.Errorf("wrong repository '%s'", coordinates.Repository)
+	}
+	if coordinates.Digest != "sha256:0123456789abcdef" {
+		t.Errorf("wrong digest '%s'", coordinates.Digest)
+	}
+	if coordinates.Tag != "" {
+		t.Errorf("expected empty tag, got '%s'", coordinates.Tag)
+	}
+
+	marshalled, err := coordinates.MarshalYAML()
+	if err != nil {
+		t.Error(err)
+	}
+	if marshalled != imageCoordinatesString {
+		t.Errorf("expected container coordinates '%s' doesn't match given container image coordinates '%s'", imageCoordinatesString, marshalled)
+	}
+	if coordinates.String() != imageCoordinatesString {
+		t.Errorf("expected container coordinates '%s' doesn't match given container image coordinates '%s'", imageCoordinatesString, coordinates.String())
+	}
+}
+
+func TestJobServicesMarshalling(t *testing.T) {
+	stage := Stage{Name: "test"}
+	job := Job{
+		Name:   "probe",
+		Stage:  &stage,
+		Script: []string{"true"},
+		Services: []JobService{{
+			Image: &ContainerImageCoordinates{Registry: "docker.io", Repository: "library/nginx", Digest: "${GIPGEE_STAGING_IMAGE_DIGEST}"},
+			Alias: "nginx",
+		}},
+	}
+	pipeline := Pipeline{Stages: []*Stage{&stage}, Jobs: []*Job{&job}}
+	expected := `stages:
+    - test
+probe:
+    stage: test
+    script:
+        - "true"
+    services:
+        - name: docker.io/library/nginx@${GIPGEE_STAGING_IMAGE_DIGEST}
+          alias: nginx
+`
+	rendered, err := pipeline.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != expected {
+		t.Errorf("rendered pipeline\n%s\ndoesn't match expected\n%s", rendered, expected)
+	}
+}
+
+func TestManualJobMarshalling(t *testing.T) {
+	stage := Stage{Name: "build"}
+	job := Job{
+		Name:               "build",
+		Stage:              &stage,
+		Script:             []string{"make"},
+		AllowFailure:       &JobAllowFailure{Allowed: &[]bool{false}[0]},
+		When:               WhenManual,
+		ManualConfirmation: "Really?",
+	}
+	pipeline := Pipeline{Stages: []*Stage{&stage}, Jobs: []*Job{&job}}
+	expected := `stages:
+    - build
+build:
+    stage: build
+    script:
+        - make
+    allow_failure: false
+    when: manual
+    manual_confirmation: Really?
+`
+	rendered, err := pipeline.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != expected {
+		t.Errorf("rendered pipeline\n%s\ndoesn't match expected\n%s", rendered, expected)
+	}
+
+	job.When = WhenOnSuccess
+	if err := pipeline.validate(); err == nil || err.Error() != "job 'build' defines manual_confirmation but is not a manual job" {
+		t.Errorf("unexpected validation result '%v'", err)
+	}
+	job.When = "sometimes"
+	if err := pipeline.validate(); err == nil || err.Error() != "job 'build' has invalid when 'sometimes' (valid: on_success, on_failure, always, manual, delayed, never)" {
+		t.Errorf("unexpected validation result '%v'", err)
+	}
+}
@@ -0,0 +1,766 @@
+package pipelinemodel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ParsePipeline parses a gitlab ci yaml into the pipeline model. The yaml is checked against the
+// embedded gitlab ci schema first. Valid keywords the model doesn't know (e.g. only and except) are
+// rejected with an error naming them instead of being dropped. References to jobs (needs, dependencies,
+// trigger includes, on_stop) are resolved to the parsed jobs, so that rendering the parsed pipeline results
+// in the same pipeline.
+func ParsePipeline(data []byte) (*Pipeline, error) {
+	if err := validateAgainstSchema(data); err != nil {
+		return nil, err
+	}
+	pipeline := Pipeline{}
+	if err := yaml.Unmarshal(data, &pipeline); err != nil {
+		return nil, err
+	}
+	return &pipeline, nil
+}
+
+// Global keywords which are deprecated in favor of the default section, gitlab treats them as defaults.
+var globalDefaultKeywords = []string{"image", "services", "before_script", "after_script", "cache"}
+
+func (pipeline *Pipeline) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return errors.New("pipeline must be a mapping")
+	}
+	pairs := mappingContent(value)
+	var defaultSection *yaml.Node
+	globalDefaults := make([]*yaml.Node, 0)
+	for idx := 0; idx+1 < len(pairs); idx += 2 {
+		key, content := pairs[idx].Value, pairs[idx+1]
+		var err error
+		switch {
+		case key == "default":
+			defaultSection = content
+		case contains(globalDefaultKeywords, key):
+			globalDefaults = append(globalDefaults, pairs[idx], content)
+		case key == "$schema":
+			err = errors.New("global keyword is not supported")
+		case key == "include":
+			pipeline.Include, err = decodeIncludes(content)
+		case key == "stages":
+			stageNames := []string{}
+			err = content.Decode(&stageNames)
+			for _, stageName := range stageNames {
+				pipeline.Stages = append(pipeline.Stages, &Stage{Name: stageName})
+			}
+		case key == "variables":
+			err = content.Decode(&pipeline.Variables)
+		case key == "workflow":
+			pipeline.Workflow = &Workflow{}
+			err = content.Decode(pipeline.Workflow)
+		default:
+			job := Job{Name: key}
+			err = content.Decode(&job)
+			pipeline.Jobs = append(pipeline.Jobs, &job)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot parse '%s': %w", key, err)
+		}
+	}
+	if defaultSection != nil || len(globalDefaults) > 0 {
+		pipeline.Default = &PipelineDefault{}
+		if err := mergeGlobalDefaults(defaultSection, globalDefaults).Decode(pipeline.Default); err != nil {
+			return fmt.Errorf("cannot parse 'default': %w", err)
+		}
+	}
+	return pipeline.resolveReferences()
+}
+
+// mergeGlobalDefaults adds the global default keywords to the default section, the keys of the
+// default section win.
+func mergeGlobalDefaults(defaultSection *yaml.Node, globalDefaults []*yaml.Node) *yaml.Node {
+	if defaultSection == nil {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: globalDefaults}
+	}
+	if len(globalDefaults) == 0 || (defaultSection.Kind != yaml.MappingNode && defaultSection.Kind != yaml.AliasNode) {
+		return defaultSection
+	}
+	content := mappingContent(defaultSection)
+	defined := make(map[string]bool, len(content)/2)
+	for idx := 0; idx < len(content); idx += 2 {
+		defined[content[idx].Value] = true
+	}
+	for idx := 0; idx+1 < len(globalDefaults); idx += 2 {
+		if !defined[globalDefaults[idx].Value] {
+			content = append(content, globalDefaults[idx], globalDefaults[idx+1])
+		}
+	}
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: defaultSection.Line, Column: defaultSection.Column, Content: content}
+}
+
+// resolveReferences replaces the placeholders of stages and jobs, which only carry the name, with
+// the parsed stages and jobs. Stages which are not listed in stages (e.g. .pre) keep their placeholder.
+func (pipeline *Pipeline) resolveReferences() error {
+	stagesByName := make(map[string]*Stage, len(pipeline.Stages))
+	for _, stage := range pipeline.Stages {
+		stagesByName[stage.Name] = stage
+	}
+	jobsByName := make(map[string]*Job, len(pipeline.Jobs))
+	for _, job := range pipeline.Jobs {
+		jobsByName[job.Name] = job
+	}
+	resolveNeeds := func(job *Job, needs []JobNeeds) error {
+		for idx := range needs {
+			if resolved, exists := jobsByName[needs[idx].Job.Name]; exists {
+				needs[idx].Job = resolved
+			} else if !needs[idx].Optional && len(pipeline.Include) == 0 {
+				// needs of jobs from included files keep their placeholder
+				return fmt.Errorf("job '%s' needs unknown job '%s'", job.Name, needs[idx].Job.Name)
+			}
+		}
+		return nil
+	}
+	resolveJob := func(job *Job, reference **Job, description string) error {
+		resolved, exists := jobsByName[(*reference).Name]
+		if !exists {
+			return fmt.Errorf("job '%s' references unknown job '%s' in %s", job.Name, (*reference).Name, description)
+		}
+		*reference = resolved
+		return nil
+	}
+
+	for _, job := range pipeline.Jobs {
+		if job.Stage != nil && stagesByName[job.Stage.Name] != nil {
+			job.Stage = stagesByName[job.Stage.Name]
+		}
+		if err := resolveNeeds(job, job.Needs); err != nil {
+			return err
+		}
+		for idx := range job.Rules {
+			if err := resolveNeeds(job, job.Rules[idx].Needs); err != nil {
+				return err
+			}
+		}
+		if job.Dependencies != nil {
+			for idx := range job.Dependencies.Jobs {
+				if err := resolveJob(job, &job.Dependencies.Jobs[idx], "dependencies"); err != nil {
+					return err
+				}
+			}
+		}
+		if job.Trigger != nil {
+			for idx := range job.Trigger.Include {
+				if job.Trigger.Include[idx].Job != nil {
+					if err := resolveJob(job, &job.Trigger.Include[idx].Job, "trigger include"); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if job.Environment != nil && job.Environment.OnStop != nil {
+			if err := resolveJob(job, &job.Environment.OnStop, "environment on_stop"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stringList is a string or a (nested, e.g. by yaml anchors in scripts) list of strings.
+type stringList []string
+
+func (list *stringList) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		*list = append(*list, value.Value)
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if err := list.UnmarshalYAML(item); err != nil {
+				return err
+			}
+		}
+	case yaml.AliasNode:
+		return list.UnmarshalYAML(value.Alias)
+	default:
+		return fmt.Errorf("line %d: expected a string or a list of strings", value.Line)
+	}
+	return nil
+}
+
+// mappingContent returns the keys and values of the mapping with the merge keys (<<) resolved. Like in
+// yaml, the keys of the mapping win over the merged ones and earlier merged mappings over later ones.
+func mappingContent(value *yaml.Node) []*yaml.Node {
+	if value.Kind == yaml.AliasNode {
+		value = value.Alias
+	}
+	own := make([]*yaml.Node, 0, len(value.Content))
+	merges := make([]*yaml.Node, 0)
+	for idx := 0; idx+1 < len(value.Content); idx += 2 {
+		key, content := value.Content[idx], value.Content[idx+1]
+		if key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge" {
+			if content.Kind == yaml.SequenceNode {
+				merges = append(merges, content.Content...)
+			} else {
+				merges = append(merges, content)
+			}
+			continue
+		}
+		own = append(own, key, content)
+	}
+	if len(merges) == 0 {
+		return own
+	}
+	defined := make(map[string]bool, len(own)/2)
+	for idx := 0; idx < len(own); idx += 2 {
+		defined[own[idx].Value] = true
+	}
+	content := make([]*yaml.Node, 0, len(own))
+	for _, merge := range merges {
+		mergedContent := mappingContent(merge)
+		for idx := 0; idx+1 < len(mergedContent); idx += 2 {
+			if !defined[mergedContent[idx].Value] {
+				defined[mergedContent[idx].Value] = true
+				content = append(content, mergedContent[idx], mergedContent[idx+1])
+			}
+		}
+	}
+	return append(content, own...)
+}
+
+// splitMapping separates the keys with several forms (e.g. a string or a list) from the mapping,
+// so that the remaining keys can be decoded into the plain type.
+func splitMapping(value *yaml.Node, keys ...string) (*yaml.Node, map[string]*yaml.Node) {
+	if value.Kind == yaml.AliasNode {
+		value = value.Alias
+	}
+	content := mappingContent(value)
+	remaining := *value
+	remaining.Content = nil
+	extracted := make(map[string]*yaml.Node)
+	for idx := 0; idx+1 < len(content); idx += 2 {
+		if contains(keys, content[idx].Value) {
+			extracted[content[idx].Value] = content[idx+1]
+		} else {
+			remaining.Content = append(remaining.Content, content[idx], content[idx+1])
+		}
+	}
+	return &remaining, extracted
+}
+
+// unsupportedKeyword returns the first key of the mapping which is not one of the yaml keys of the type.
+func unsupportedKeyword(value *yaml.Node, modelType reflect.Type) string {
+	supported := make(map[string]bool, modelType.NumField())
+	for idx := 0; idx < modelType.NumField(); idx++ {
+		supported[strings.Split(modelType.Field(idx).Tag.Get("yaml"), ",")[0]] = true
+	}
+	content := mappingContent(value)
+	for idx := 0; idx+1 < len(content); idx += 2 {
+		if key := content[idx].Value; !supported[key] {
+			return key
+		}
+	}
+	return ""
+}
+
+// decodeStringList decodes the string or list of strings if the node is set.
+func decodeStringList(value *yaml.Node) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list := stringList{}
+	return list, value.Decode(&list)
+}
+
+// intList is an integer or a list of integers.
+type intList []int
+
+func (list *intList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		return value.Decode((*[]int)(list))
+	}
+	single := 0
+	if err := value.Decode(&single); err != nil {
+		return err
+	}
+	*list = []int{single}
+	return nil
+}
+
+func (pipelineStage *Stage) UnmarshalYAML(value *yaml.Node) error {
+	return value.Decode(&pipelineStage.Name)
+}
+
+func (coordinates *ContainerImageCoordinates) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.MappingNode {
+		image := struct {
+			Name string `yaml:"name"`
+		}{}
+		if err := value.Decode(&image); err != nil {
+			return err
+		}
+		if keyword := unsupportedKeyword(value, reflect.TypeOf(image)); keyword != "" {
+			return fmt.Errorf("line %d: image keyword '%s' is not supported", value.Line, keyword)
+		}
+		return coordinates.parse(image.Name)
+	}
+	reference := ""
+	if err := value.Decode(&reference); err != nil {
+		return err
+	}
+	return coordinates.parse(reference)
+}
+
+// parse splits an image reference. Unlike ContainerImageCoordinatesFromString the registry
+// is optional (docker hub images like alpine:3) and a missing tag stays empty.
+func (coordinates *ContainerImageCoordinates) parse(reference string) error {
+	if reference == "" {
+		return errors.New("image must not be empty")
+	}
+	*coordinates = ContainerImageCoordinates{}
+	remaining := reference
+	if slashIdx := strings.Index(reference, "/"); slashIdx != -1 {
+		// same heuristic as docker: the first component is a registry if it looks like a host
+		if firstComponent := reference[:slashIdx]; strings.ContainsAny(firstComponent, ".:$") || firstComponent == "localhost" {
+			coordinates.Registry = firstComponent
+			remaining = reference[slashIdx+1:]
+		}
+	}
+	if atIdx := strings.Index(remaining, "@"); atIdx != -1 {
+		coordinates.Repository, coordinates.Digest = remaining[:atIdx], remaining[atIdx+1:]
+		return nil
+	}
+	if colonIdx := strings.LastIndex(remaining, ":"); colonIdx > strings.LastIndex(remaining, "/") {
+		coordinates.Repository, coordinates.Tag = remaining[:colonIdx], remaining[colonIdx+1:]
+		return nil
+	}
+	coordinates.Repository = remaining
+	return nil
+}
+
+func (service *JobService) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		service.Image = &ContainerImageCoordinates{}
+		return value.Decode(service.Image)
+	}
+	type plainService JobService
+	return value.Decode((*plainService)(service))
+}
+
+func (jaf *JobAllowFailure) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		jaf.Allowed = new(bool)
+		return value.Decode(jaf.Allowed)
+	}
+	allowFailure := struct {
+		ExitCodes intList `yaml:"exit_codes"`
+	}{}
+	if err := value.Decode(&allowFailure); err != nil {
+		return err
+	}
+	exitCodes := []int(allowFailure.ExitCodes)
+	jaf.Allowed = &[]bool{true}[0]
+	jaf.ExitCodes = &exitCodes
+	return nil
+}
+
+func (artifacts *JobArtifacts) UnmarshalYAML(value *yaml.Node) error {
+	if keyword := unsupportedKeyword(value, reflect.TypeOf(*artifacts)); keyword != "" {
+		return fmt.Errorf("line %d: artifacts keyword '%s' is not supported", value.Line, keyword)
+	}
+	type plainArtifacts JobArtifacts
+	return value.Decode((*plainArtifacts)(artifacts))
+}
+
+func (reports *JobArtifactsReports) UnmarshalYAML(value *yaml.Node) error {
+	parsed := struct {
+		Dotenv            stringList `yaml:"dotenv"`
+		Cyclonedx         stringList `yaml:"cyclonedx"`
+		ContainerScanning stringList `yaml:"container_scanning"`
+		Junit             stringList `yaml:"junit"`
+		Codequality       stringList `yaml:"codequality"`
+	}{}
+	if err := value.Decode(&parsed); err != nil {
+		return err
+	}
+	if keyword := unsupportedKeyword(value, reflect.TypeOf(parsed)); keyword != "" {
+		return fmt.Errorf("line %d: artifacts report '%s' is not supported", value.Line, keyword)
+	}
+	if len(parsed.Dotenv) > 1 {
+		return fmt.Errorf("line %d: only one dotenv report is supported", value.Line)
+	}
+	*reports = JobArtifactsReports{
+		Cyclonedx:         parsed.Cyclonedx,
+		ContainerScanning: parsed.ContainerScanning,
+		Junit:             parsed.Junit,
+		Codequality:       parsed.Codequality,
+	}
+	if len(parsed.Dotenv) == 1 {
+		reports.Dotenv = parsed.Dotenv[0]
+	}
+	return nil
+}
+
+// jobReference is a placeholder with the name of the referenced job, the pipeline resolves it.
+func jobReference(name string) *Job {
+	return &Job{Name: name}
+}
+
+func (jobNeeds *JobNeeds) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*jobNeeds = JobNeeds{Job: jobReference(value.Value), Artifacts: true}
+		return nil
+	}
+	needs := struct {
+		Job       string `yaml:"job"`
+		Artifacts *bool  `yaml:"artifacts"`
+		Optional  bool   `yaml:"optional"`
+	}{}
+	if err := value.Decode(&needs); err != nil {
+		return err
+	}
+	if keyword := unsupportedKeyword(value, reflect.TypeOf(needs)); keyword != "" {
+		return fmt.Errorf("line %d: needs keyword '%s' is not supported", value.Line, keyword)
+	}
+	// gitlab downloads the artifacts of needed jobs by default
+	*jobNeeds = JobNeeds{Job: jobReference(needs.Job), Artifacts: needs.Artifacts == nil || *needs.Artifacts, Optional: needs.Optional}
+	return nil
+}
+
+func (jobTriggerInclude *JobTriggerInclude) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*jobTriggerInclude = JobTriggerInclude{Local: value.Value}
+		return nil
+	}
+	include := struct {
+		Artifact string `yaml:"artifact"`
+		Job      string `yaml:"job"`
+		Local    string `yaml:"local"`
+		Template string `yaml:"template"`
+		Project  string `yaml:"project"`
+		Ref      string `yaml:"ref"`
+		File     string `yaml:"file"`
+	}{}
+	if err := value.Decode(&include); err != nil {
+		return err
+	}
+	*jobTriggerInclude = JobTriggerInclude{Artifact: include.Artifact, Local: include.Local, Template: include.Template, Project: include.Project, Ref: include.Ref, File: include.File}
+	if include.Job != "" {
+		jobTriggerInclude.Job = jobReference(include.Job)
+	}
+	return nil
+}
+
+func (trigger *JobTrigger) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*trigger = JobTrigger{Project: value.Value}
+		return nil
+	}
+	parsed := struct {
+		Include  yaml.Node          `yaml:"include"`
+		Project  string             `yaml:"project"`
+		Branch   string             `yaml:"branch"`
+		Strategy string             `yaml:"strategy"`
+		Forward  *JobTriggerForward `yaml:"forward"`
+	}{}
+	if err := value.Decode(&parsed); err != nil {
+		return err
+	}
+	*trigger = JobTrigger{Project: parsed.Project, Branch: parsed.Branch, Strategy: parsed.Strategy, Forward: parsed.Forward}
+	switch parsed.Include.Kind {
+	case 0:
+	case yaml.SequenceNode:
+		return parsed.Include.Decode(&trigger.Include)
+	default:
+		include := JobTriggerInclude{}
+		if err := parsed.Include.Decode(&include); err != nil {
+			return err
+		}
+		trigger.Include = []JobTriggerInclude{include}
+	}
+	return nil
+}
+
+// decodeChanges only supports the list form of changes, compare_to has no counterpart in the model.
+func decodeChanges(value *yaml.Node) ([]string, error) {
+	if value != nil && value.Kind == yaml.MappingNode {
+		changes := struct {
+			Paths     []string `yaml:"paths"`
+			CompareTo string   `yaml:"compare_to"`
+		}{}
+		if err := value.Decode(&changes); err != nil {
+			return nil, err
+		}
+		if changes.CompareTo != "" {
+			return nil, fmt.Errorf("line %d: changes compare_to is not supported", value.Line)
+		}
+		return changes.Paths, nil
+	}
+	return decodeStringList(value)
+}
+
+func (rule *JobRule) UnmarshalYAML(value *yaml.Node) error {
+	type plainRule JobRule
+	remaining, extracted := splitMapping(value, "changes", "exists")
+	if err := remaining.Decode((*plainRule)(rule)); err != nil {
+		return err
+	}
+	var err error
+	if rule.Changes, err = decodeChanges(extracted["changes"]); err != nil {
+		return err
+	}
+	rule.Exists, err = decodeStringList(extracted["exists"])
+	return err
+}
+
+func (rule *WorkflowRule) UnmarshalYAML(value *yaml.Node) error {
+	type plainRule WorkflowRule
+	remaining, extracted := splitMapping(value, "changes", "exists")
+	if err := remaining.Decode((*plainRule)(rule)); err != nil {
+		return err
+	}
+	var err error
+	if rule.Changes, err = decodeChanges(extracted["changes"]); err != nil {
+		return err
+	}
+	rule.Exists, err = decodeStringList(extracted["exists"])
+	return err
+}
+
+func (retry *JobRetry) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*retry = JobRetry{}
+		return value.Decode(&retry.Max)
+	}
+	parsed := struct {
+		Max       int        `yaml:"max"`
+		When      stringList `yaml:"when"`
+		ExitCodes intList    `yaml:"exit_codes"`
+	}{}
+	if err := value.Decode(&parsed); err != nil {
+		return err
+	}
+	*retry = JobRetry{Max: parsed.Max, When: parsed.When, ExitCodes: parsed.ExitCodes}
+	return nil
+}
+
+func (key *JobCacheKey) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*key = JobCacheKey{Key: value.Value}
+		return nil
+	}
+	parsed := struct {
+		Files  []string `yaml:"files"`
+		Prefix string   `yaml:"prefix"`
+	}{}
+	if err := value.Decode(&parsed); err != nil {
+		return err
+	}
+	*key = JobCacheKey{Files: parsed.Files, Prefix: parsed.Prefix}
+	return nil
+}
+
+// decodeCaches accepts a single cache or a list of caches.
+func decodeCaches(value *yaml.Node) ([]JobCache, error) {
+	switch {
+	case value == nil:
+		return nil, nil
+	case value.Kind == yaml.SequenceNode:
+		caches := []JobCache{}
+		return caches, value.Decode(&caches)
+	default:
+		cache := JobCache{}
+		return []JobCache{cache}, value.Decode(&cache)
+	}
+}
+
+func (environment *JobEnvironment) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*environment = JobEnvironment{Name: value.Value}
+		return nil
+	}
+	parsed := struct {
+		Name           string `yaml:"name"`
+		Url            string `yaml:"url"`
+		Action         string `yaml:"action"`
+		OnStop         string `yaml:"on_stop"`
+		AutoStopIn     string `yaml:"auto_stop_in"`
+		DeploymentTier string `yaml:"deployment_tier"`
+		Kubernetes     struct {
+			Namespace string `yaml:"namespace"`
+		} `yaml:"kubernetes"`
+	}{}
+	if err := value.Decode(&parsed); err != nil {
+		return err
+	}
+	*environment = JobEnvironment{
+		Name:                parsed.Name,
+		Url:                 parsed.Url,
+		Action:              parsed.Action,
+		AutoStopIn:          parsed.AutoStopIn,
+		DeploymentTier:      parsed.DeploymentTier,
+		KubernetesNamespace: parsed.Kubernetes.Namespace,
+	}
+	if parsed.OnStop != "" {
+		environment.OnStop = jobReference(parsed.OnStop)
+	}
+	return nil
+}
+
+func (parallel *JobParallel) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*parallel = JobParallel{}
+		return value.Decode(&parallel.Count)
+	}
+	parsed := struct {
+		Matrix []map[string]stringList `yaml:"matrix"`
+	}{}
+	if err := value.Decode(&parsed); err != nil {
+		return err
+	}
+	*parallel = JobParallel{Matrix: make([]map[string][]string, len(parsed.Matrix))}
+	for idx, entry := range parsed.Matrix {
+		parallel.Matrix[idx] = make(map[string][]string, len(entry))
+		for name, values := range entry {
+			parallel.Matrix[idx][name] = values
+		}
+	}
+	return nil
+}
+
+func (dependencies *JobDependencies) UnmarshalYAML(value *yaml.Node) error {
+	names := []string{}
+	if err := value.Decode(&names); err != nil {
+		return err
+	}
+	dependencies.Jobs = make([]*Job, len(names))
+	for idx, name := range names {
+		dependencies.Jobs[idx] = jobReference(name)
+	}
+	return nil
+}
+
+func (secret *JobSecret) UnmarshalYAML(value *yaml.Node) error {
+	type plainSecret JobSecret
+	remaining, extracted := splitMapping(value, "vault")
+	if err := remaining.Decode((*plainSecret)(secret)); err != nil {
+		return err
+	}
+	vault := extracted["vault"]
+	if vault == nil {
+		return nil
+	}
+	if vault.Kind != yaml.ScalarNode {
+		secret.Vault = &JobSecretVault{}
+		return vault.Decode(secret.Vault)
+	}
+	// short form <path>/<field>@<engine path> of the kv-v2 engine
+	reference, enginePath := vault.Value, ""
+	if atIdx := strings.LastIndex(reference, "@"); atIdx != -1 {
+		reference, enginePath = reference[:atIdx], reference[atIdx+1:]
+	}
+	slashIdx := strings.LastIndex(reference, "/")
+	if slashIdx == -1 {
+		return fmt.Errorf("line %d: vault secret '%s' must be <path>/<field>", vault.Line, vault.Value)
+	}
+	secret.Vault = &JobSecretVault{Path: reference[:slashIdx], Field: reference[slashIdx+1:]}
+	if enginePath != "" {
+		secret.Vault.Engine = &JobSecretVaultEngine{Name: "kv-v2", Path: enginePath}
+	}
+	return nil
+}
+
+func (setting *JobInheritSetting) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*setting = JobInheritSetting{All: new(bool)}
+		return value.Decode(setting.All)
+	}
+	*setting = JobInheritSetting{}
+	return value.Decode(&setting.Keys)
+}
+
+func (token *JobIdToken) UnmarshalYAML(value *yaml.Node) error {
+	parsed := struct {
+		Aud stringList `yaml:"aud"`
+	}{}
+	if err := value.Decode(&parsed); err != nil {
+		return err
+	}
+	token.Aud = parsed.Aud
+	return nil
+}
+
+func (include *PipelineInclude) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		// a string is a remote include if it is an url, otherwise a local include
+		if strings.HasPrefix(value.Value, "http://") || strings.HasPrefix(value.Value, "https://") {
+			*include = PipelineInclude{Remote: value.Value}
+		} else {
+			*include = PipelineInclude{Local: value.Value}
+		}
+		return nil
+	}
+	type plainInclude PipelineInclude
+	remaining, extracted := splitMapping(value, "file")
+	if err := remaining.Decode((*plainInclude)(include)); err != nil {
+		return err
+	}
+	var err error
+	include.File, err = decodeStringList(extracted["file"])
+	return err
+}
+
+// decodeIncludes accepts a single include or a list of includes.
+func decodeIncludes(value *yaml.Node) ([]PipelineInclude, error) {
+	if value.Kind == yaml.SequenceNode {
+		includes := []PipelineInclude{}
+		return includes, value.Decode(&includes)
+	}
+	include := PipelineInclude{}
+	return []PipelineInclude{include}, value.Decode(&include)
+}
+
+func (pipelineDefault *PipelineDefault) UnmarshalYAML(value *yaml.Node) error {
+	type plainDefault PipelineDefault
+	remaining, extracted := splitMapping(value, "before_script", "after_script", "cache")
+	if err := remaining.Decode((*plainDefault)(pipelineDefault)); err != nil {
+		return err
+	}
+	var err error
+	if pipelineDefault.BeforeScript, err = decodeStringList(extracted["before_script"]); err != nil {
+		return err
+	}
+	if pipelineDefault.AfterScript, err = decodeStringList(extracted["after_script"]); err != nil {
+		return err
+	}
+	pipelineDefault.Cache, err = decodeCaches(extracted["cache"])
+	return err
+}
+
+func (job *Job) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode && value.Kind != yaml.AliasNode {
+		return fmt.Errorf("line %d: job must be a mapping", value.Line)
+	}
+	type plainJob Job
+	if keyword := unsupportedKeyword(value, reflect.TypeOf(*job)); keyword != "" {
+		return fmt.Errorf("line %d: job keyword '%s' is not supported", value.Line, keyword)
+	}
+	remaining, extracted := splitMapping(value, "script", "before_script", "after_script", "cache", "extends")
+	name := job.Name
+	if err := remaining.Decode((*plainJob)(job)); err != nil {
+		return err
+	}
+	job.Name = name
+	var err error
+	for key, target := range map[string]*[]string{
+		"script":        &job.Script,
+		"before_script": &job.BeforeScript,
+		"after_script":  &job.AfterScript,
+		"extends":       &job.Extends,
+	} {
+		if *target, err = decodeStringList(extracted[key]); err != nil {
+			return err
+		}
+	}
+	job.Cache, err = decodeCaches(extracted["cache"])
+	return err
+}
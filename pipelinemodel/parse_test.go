@@ -0,0 +1,219 @@
+package pipelinemodel
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePipeline(t *testing.T) {
+	input := `
+stages: [build, deploy]
+variables:
+    GLOBAL: value
+default:
+    before_script: ./setup-proxy.sh
+    cache: {key: default, paths: [.cache/]}
+.template:
+    tags: [docker]
+build:
+    stage: build
+    image: alpine:3.18
+    script:
+        - make
+        - [make test, make lint]
+    artifacts:
+        paths: [out/]
+        reports:
+            junit: report.xml
+            dotenv: [build.env]
+    retry: 1
+    allow_failure: {exit_codes: 3}
+    extends: .template
+deploy:
+    stage: deploy
+    image: {name: "registry.example.com/deploy@sha256:0123"}
+    script: ./deploy.sh
+    needs: [build, {job: optional-job, optional: true}]
+    dependencies: [build]
+    environment: {name: production, on_stop: stop}
+    services: [docker.io/library/postgres:15]
+    secrets:
+        DB_PASSWORD:
+            vault: production/db/password@ops
+    rules:
+        - if: $CI_COMMIT_TAG
+          changes: [deploy/*]
+stop:
+    stage: deploy
+    script: ./stop.sh
+    when: manual
+    environment: {name: production, action: stop}
+child:
+    stage: deploy
+    needs: [{job: build, artifacts: false}]
+    trigger:
+        include: [{artifact: child.yml, job: build}]
+        strategy: depend
+`
+	pipeline, err := ParsePipeline([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pipeline.Jobs) != 5 || len(pipeline.Stages) != 2 {
+		t.Fatalf("expected 5 jobs and 2 stages, got %d and %d", len(pipeline.Jobs), len(pipeline.Stages))
+	}
+	template, build, deploy, stop, child := pipeline.Jobs[0], pipeline.Jobs[1], pipeline.Jobs[2], pipeline.Jobs[3], pipeline.Jobs[4]
+	if build.Stage != pipeline.Stages[0] || deploy.Stage != pipeline.Stages[1] {
+		t.Error("stages of the jobs are not resolved to the stages of the pipeline")
+	}
+	if deploy.Needs[0].Job != build || !deploy.Needs[0].Artifacts || deploy.Dependencies.Jobs[0] != build || deploy.Environment.OnStop != stop {
+		t.Error("job references of deploy are not resolved to the parsed jobs")
+	}
+	if deploy.Needs[1].Job.Name != "optional-job" || !deploy.Needs[1].Optional {
+		t.Error("optional needs of jobs which are not part of the pipeline must be kept")
+	}
+	if child.Trigger.Include[0].Job != build || child.Needs[0].Artifacts {
+		t.Error("trigger include or needs of child are not parsed correctly")
+	}
+	if diff := cmp.Diff([]string{"make", "make test", "make lint"}, build.Script); diff != "" {
+		t.Errorf("nested script is not flattened: %s", diff)
+	}
+	if build.Image.Registry != "" || build.Image.Repository != "alpine" || build.Image.Tag != "3.18" || deploy.Image.Registry != "registry.example.com" || deploy.Image.Digest != "sha256:0123" {
+		t.Errorf("images are not parsed correctly: %+v, %+v", build.Image, deploy.Image)
+	}
+	if vault := deploy.Secrets["DB_PASSWORD"].Vault; vault.Path != "production/db" || vault.Field != "password" || vault.Engine.Path != "ops" {
+		t.Errorf("short form vault secret is not parsed correctly: %+v", vault)
+	}
+	if template.Name != ".template" || build.Extends[0] != ".template" {
+		t.Error("hidden job or extends not parsed")
+	}
+
+	rendered, err := pipeline.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rendered pipeline uses the long forms, parsing and rendering it again must not change it
+	reparsed, err := ParsePipeline([]byte(rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rerendered, err := reparsed.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(rendered, rerendered); diff != "" {
+		t.Errorf("pipeline doesn't round trip:\n%s", diff)
+	}
+	if diff := cmp.Diff(pipeline, reparsed); diff != "" {
+		t.Errorf("reparsed pipeline differs:\n%s", diff)
+	}
+}
+
+func TestParsePipelineMergeKeys(t *testing.T) {
+	input := `
+.defaults: &defaults
+    stage: test
+    script: make
+    tags: [docker]
+.cache: &cache
+    tags: [shell]
+    retry: 2
+build:
+    <<: [*defaults, *cache]
+    script: [make build]
+    before_script: ./setup.sh
+`
+	pipeline, err := ParsePipeline([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := pipeline.Jobs[2]
+	// the keys of the job win over the merged ones, earlier merged mappings over later ones
+	if diff := cmp.Diff([]string{"make build"}, build.Script); diff != "" {
+		t.Errorf("script of the job must win over the merged one: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"docker"}, build.Tags); diff != "" {
+		t.Errorf("tags of the first merged mapping must win: %s", diff)
+	}
+	if build.Stage == nil || build.Stage.Name != "test" || build.Retry == nil || build.Retry.Max != 2 || len(build.BeforeScript) != 1 {
+		t.Errorf("merged keys are missing: %+v", build)
+	}
+}
+
+func TestParsePipelineGlobalDefaults(t *testing.T) {
+	input := `
+image: alpine:3.18
+services: [docker:dind]
+before_script: ./setup.sh
+cache: {paths: [.cache/]}
+default:
+    image: debian:12
+    tags: [docker]
+build:
+    script: make
+`
+	pipeline, err := ParsePipeline([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the global keywords are defaults, the default section wins
+	if pipeline.Default == nil || pipeline.Default.Image == nil || pipeline.Default.Image.Repository != "debian" {
+		t.Fatalf("image of the default section must win: %+v", pipeline.Default)
+	}
+	if len(pipeline.Default.Services) != 1 || len(pipeline.Default.Cache) != 1 || len(pipeline.Default.Tags) != 1 {
+		t.Errorf("global keywords are not added to the defaults: %+v", pipeline.Default)
+	}
+	if diff := cmp.Diff([]string{"./setup.sh"}, pipeline.Default.BeforeScript); diff != "" {
+		t.Errorf("global before_script is not a default: %s", diff)
+	}
+
+	pipeline, err = ParsePipeline([]byte("image: alpine:3.18\nbuild:\n    script: make\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipeline.Default == nil || pipeline.Default.Image == nil || pipeline.Default.Image.Repository != "alpine" {
+		t.Errorf("global image without default section is not a default: %+v", pipeline.Default)
+	}
+}
+
+func TestParsePipelineNeedsOfIncludedJobs(t *testing.T) {
+	input := `
+include: [{local: build.yml}]
+deploy:
+    script: ./deploy.sh
+    needs: [build]
+`
+	pipeline, err := ParsePipeline([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if need := pipeline.Jobs[0].Needs[0].Job; need == nil || need.Name != "build" {
+		t.Errorf("needs of a job from an included file must keep its placeholder, is %+v", need)
+	}
+	if _, err := pipeline.Render(); err != nil {
+		t.Errorf("pipeline with needs of included jobs can't be rendered: %v", err)
+	}
+}
+
+func TestParsePipelineErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"build:\n    script: make\n    needs: [missing]\n", "job 'build' needs unknown job 'missing'"},
+		{"build:\n    script: make\n    dependencies: [missing]\n", "job 'build' references unknown job 'missing' in dependencies"},
+		{"$schema: https://example.com/ci.json\nbuild:\n    script: make\n", "cannot parse '$schema': global keyword is not supported"},
+		{"build:\n    script: make\n    image: {name: alpine, entrypoint: ['']}\n", "cannot parse 'build': line 3: image keyword 'entrypoint' is not supported"},
+		// valid gitlab ci keywords the model doesn't know are named instead of failing the schema validation
+		{"build:\n    script: make\n    only: [main]\n", "cannot parse 'build': line 2: job keyword 'only' is not supported"},
+		{"build:\n    script: make\n    except: {refs: [tags]}\n", "cannot parse 'build': line 2: job keyword 'except' is not supported"},
+		{"build:\n    script: make\n    artifacts:\n        reports:\n            sast: gl-sast-report.json\n", "cannot parse 'build': line 5: artifacts report 'sast' is not supported"},
+		{"build:\n    script: make\n    artifacts: {paths: [out/], untracked: true}\n", "cannot parse 'build': line 3: artifacts keyword 'untracked' is not supported"},
+		{"build:\n    script: make\n    unknown: keyword\n", "pipeline doesn't match the gitlab ci schema: /build: additionalProperties 'unknown' not allowed"},
+	} {
+		if _, err := ParsePipeline([]byte(testCase.input)); err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("error is '%v' but should be '%s'", err, testCase.expectedMessage)
+		}
+	}
+}
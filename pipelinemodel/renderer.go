@@ -0,0 +1,13 @@
+package pipelinemodel
+
+// Renderer turns the pipeline model into the configuration of a ci system.
+type Renderer interface {
+	Render(pipeline *Pipeline) (string, error)
+}
+
+// GitlabRenderer renders the pipeline as gitlab ci yaml, see Pipeline.Render.
+type GitlabRenderer struct{}
+
+func (GitlabRenderer) Render(pipeline *Pipeline) (string, error) {
+	return pipeline.Render()
+}
@@ -0,0 +1,115 @@
+package pipelinemodel
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	yaml "gopkg.in/yaml.v3"
+)
+
+//go:embed schema/gitlab-ci.json
+var gitlabCiSchemaJson []byte
+
+const gitlabCiSchemaUrl = "gitlab-ci.json"
+
+var (
+	gitlabCiSchema      *jsonschema.Schema
+	gitlabCiSchemaError error
+	gitlabCiSchemaOnce  sync.Once
+)
+
+// getGitlabCiSchema compiles the embedded gitlab ci schema on first use.
+func getGitlabCiSchema() (*jsonschema.Schema, error) {
+	gitlabCiSchemaOnce.Do(func() {
+		gitlabCiSchema, gitlabCiSchemaError = compileSchema(gitlabCiSchemaUrl, gitlabCiSchemaJson)
+	})
+	return gitlabCiSchema, gitlabCiSchemaError
+}
+
+// compileSchema compiles a draft 07 json schema. Invalid schemas, e.g. with patterns go regular expressions
+// don't support, are returned as error.
+func compileSchema(url string, schemaJson []byte) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft7
+	if err := compiler.AddResource(url, bytes.NewReader(schemaJson)); err != nil {
+		return nil, fmt.Errorf("cannot load schema '%s': %w", url, err)
+	}
+	schema, err := compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("cannot compile schema '%s': %w", url, err)
+	}
+	return schema, nil
+}
+
+// validateAgainstSchema checks the rendered pipeline against the embedded gitlab ci schema.
+func validateAgainstSchema(renderedPipeline []byte) error {
+	schema, err := getGitlabCiSchema()
+	if err != nil {
+		return err
+	}
+	document, err := yamlToJsonDocument(renderedPipeline)
+	if err != nil {
+		return fmt.Errorf("cannot parse rendered pipeline: %w", err)
+	}
+	err = schema.Validate(document)
+	validationError := &jsonschema.ValidationError{}
+	if errors.As(err, &validationError) {
+		return fmt.Errorf("pipeline doesn't match the gitlab ci schema: %s", strings.Join(describeValidationError(validationError), "; "))
+	}
+	return err
+}
+
+// yamlToJsonDocument converts the yaml document into the values encoding/json produces, which is what
+// the schema validation expects (e.g. no time.Time for unquoted dates).
+func yamlToJsonDocument(yamlDocument []byte) (interface{}, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(yamlDocument, &document); err != nil {
+		return nil, err
+	}
+	jsonDocument, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonDocument))
+	decoder.UseNumber()
+	var converted interface{}
+	if err := decoder.Decode(&converted); err != nil {
+		return nil, err
+	}
+	return converted, nil
+}
+
+// describeValidationError returns the sorted messages of the innermost errors. The causes of oneOf and anyOf
+// are not descended, the failures of every single alternative don't tell which one was meant.
+func describeValidationError(validationError *jsonschema.ValidationError) []string {
+	messages := make([]string, 0)
+	var collect func(*jsonschema.ValidationError)
+	collect = func(current *jsonschema.ValidationError) {
+		keyword := current.KeywordLocation[strings.LastIndex(current.KeywordLocation, "/")+1:]
+		if len(current.Causes) == 0 || keyword == "oneOf" || keyword == "anyOf" {
+			location := current.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			message := current.Message
+			if message == keyword+" failed" {
+				message = "matches none of the allowed forms"
+			}
+			messages = append(messages, fmt.Sprintf("%s: %s", location, message))
+			return
+		}
+		for _, cause := range current.Causes {
+			collect(cause)
+		}
+	}
+	collect(validationError)
+	sort.Strings(messages)
+	return messages
+}
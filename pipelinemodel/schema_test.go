@@ -0,0 +1,81 @@
+package pipelinemodel
+
+import (
+	"testing"
+)
+
+func TestValidateAgainstSchema(t *testing.T) {
+	for _, testCase := range []struct {
+		pipeline        string
+		expectedMessage string
+	}{
+		{`stages: [test]
+variables:
+    GLOBAL: value
+.hidden:
+    anything: goes
+build:
+    stage: test
+    script: make
+    needs: [{job: lint, artifacts: true}]
+    retry: {max: 2, when: runner_system_failure}
+    parallel: {matrix: [{ARCH: [amd64, arm64]}]}
+lint:
+    stage: test
+    script: [make lint]
+    allow_failure: {exit_codes: [2, 3]}
+downstream:
+    trigger: {include: [{artifact: child.yml, job: build}], strategy: depend}
+`, ""},
+		{`build:
+    stage: test
+`, "pipeline doesn't match the gitlab ci schema: /build: matches none of the allowed forms"},
+		{`build:
+    script: make
+    scrpit: make
+`, "pipeline doesn't match the gitlab ci schema: /build: additionalProperties 'scrpit' not allowed"},
+		{`build:
+    script: make
+    retry: 3
+`, "pipeline doesn't match the gitlab ci schema: /build/retry: matches none of the allowed forms"},
+		{`build:
+    script: make
+    when: sometimes
+    variables:
+        ENABLED: true
+`, "pipeline doesn't match the gitlab ci schema: /build/variables/ENABLED: matches none of the allowed forms; /build/when: value must be one of \"on_success\", \"on_failure\", \"always\", \"manual\", \"delayed\", \"never\""},
+		{`stages: []
+`, "pipeline doesn't match the gitlab ci schema: /stages: minimum 1 items required, but found 0 items"},
+	} {
+		err := validateAgainstSchema([]byte(testCase.pipeline))
+		if testCase.expectedMessage == "" {
+			if err != nil {
+				t.Errorf("unexpected error '%v' for pipeline\n%s", err, testCase.pipeline)
+			}
+		} else if err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("error is '%v' but should be '%s'", err, testCase.expectedMessage)
+		}
+	}
+}
+
+func TestRenderReturnsSchemaErrors(t *testing.T) {
+	stage := Stage{Name: "test"}
+	// the model doesn't restrict variable values, gitlab only accepts strings and numbers
+	job := Job{Name: "build", Stage: &stage, Script: []string{"make"}, Variables: &map[string]interface{}{"ENABLED": true}}
+	pipeline := Pipeline{Stages: []*Stage{&stage}, Jobs: []*Job{&job}}
+	rendered, err := pipeline.Render()
+	expectedMessage := "pipeline doesn't match the gitlab ci schema: /build/variables/ENABLED: matches none of the allowed forms"
+	if err == nil || err.Error() != expectedMessage || rendered != "" {
+		t.Errorf("error is '%v' but should be '%s'", err, expectedMessage)
+	}
+}
+
+func TestCompileSchemaReturnsErrors(t *testing.T) {
+	// lookaheads are valid in ecmascript but not in go regular expressions
+	if _, err := compileSchema("lookahead.json", []byte(`{"properties": {"name": {"pattern": "^(?!x)"}}}`)); err == nil {
+		t.Error("expected an error for a pattern go doesn't support")
+	}
+	if _, err := compileSchema("valid.json", []byte(`{"properties": {"name": {"pattern": "^[a-z]+$"}}}`)); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
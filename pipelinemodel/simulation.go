@@ -0,0 +1,272 @@
+package pipelinemodel
+
+import (
+	"fmt"
+	"strings"
+
+	zglob "github.com/mattn/go-zglob"
+)
+
+// JobSimulation is the outcome of a job in a simulated pipeline.
+type JobSimulation struct {
+	// Runs is false if the rules or when exclude the job from the pipeline
+	Runs bool
+	When string
+	// Reason explains the when of jobs with rules, e.g. which rule matched
+	Reason string
+	// WaitsFor is the manual job the job waits for, directly or through the jobs it needs
+	WaitsFor string
+}
+
+// Simulation is the outcome of the pipeline for a set of ci variables, without running it.
+type Simulation struct {
+	Created bool
+	// Reason explains why the pipeline is (not) created if workflow rules decided it
+	Reason string
+	Jobs   map[string]*JobSimulation
+}
+
+// simulationContext is the state of a single simulation.
+type simulationContext struct {
+	pipeline   *Pipeline
+	variables  map[string]string
+	jobs       []*Job // the resolved visible jobs
+	jobsByName map[string]*Job
+	needs      map[string][]JobNeeds
+	blocking   map[string]bool // blocking manual jobs hold the later stages
+	simulation *Simulation
+}
+
+// Simulate evaluates the workflow rules and the rules and when of the jobs like gitlab does when it creates the
+// pipeline with the given ci variables. Rules with changes can't be evaluated offline and are assumed to match,
+// exists is checked against the working directory.
+func (pipeline *Pipeline) Simulate(variables map[string]string) (*Simulation, error) {
+	if err := pipeline.validate(); err != nil {
+		return nil, err
+	}
+	context := simulationContext{
+		pipeline:   pipeline,
+		variables:  make(map[string]string, len(pipeline.Variables)+len(variables)),
+		jobsByName: make(map[string]*Job, len(pipeline.Jobs)),
+		needs:      make(map[string][]JobNeeds, len(pipeline.Jobs)),
+		blocking:   make(map[string]bool),
+		simulation: &Simulation{Created: true, Jobs: make(map[string]*JobSimulation, len(pipeline.Jobs))},
+	}
+	for key, value := range pipeline.Variables {
+		context.variables[key] = fmt.Sprint(value)
+	}
+	if pipeline.Workflow != nil && len(pipeline.Workflow.Rules) > 0 {
+		if err := context.evaluateWorkflowRules(variables); err != nil {
+			return nil, err
+		}
+		if !context.simulation.Created {
+			return context.simulation, nil
+		}
+	}
+	for key, value := range variables {
+		context.variables[key] = value
+	}
+
+	allJobsByName := make(map[string]*Job, len(pipeline.Jobs))
+	for _, job := range pipeline.Jobs {
+		allJobsByName[job.Name] = job
+	}
+	for _, job := range pipeline.Jobs {
+		if strings.HasPrefix(job.Name, ".") {
+			continue
+		}
+		resolved := resolveExtends(job, allJobsByName, 1)
+		context.jobs = append(context.jobs, resolved)
+		context.jobsByName[job.Name] = resolved
+		if err := context.evaluateJob(resolved); err != nil {
+			return nil, err
+		}
+	}
+	for _, job := range context.jobs {
+		if _, err := context.waitsFor(job, nil); err != nil {
+			return nil, err
+		}
+	}
+	return context.simulation, nil
+}
+
+func (context *simulationContext) evaluateWorkflowRules(variables map[string]string) error {
+	ruleVariables := make(map[string]string, len(context.variables)+len(variables))
+	for _, source := range []map[string]string{context.variables, variables} {
+		for key, value := range source {
+			ruleVariables[key] = value
+		}
+	}
+	for idx, rule := range context.pipeline.Workflow.Rules {
+		matches, err := ruleMatches(rule.If, rule.Exists, ruleVariables)
+		if err != nil {
+			return fmt.Errorf("workflow rule %d: %w", idx, err)
+		}
+		if !matches {
+			continue
+		}
+		if rule.When == WhenNever {
+			context.simulation.Created = false
+			context.simulation.Reason = fmt.Sprintf("workflow rule %d (%s) prevents the pipeline", idx, describeRule(rule.If, len(rule.Changes) > 0))
+			return nil
+		}
+		context.simulation.Reason = fmt.Sprintf("workflow rule %d (%s) creates the pipeline", idx, describeRule(rule.If, len(rule.Changes) > 0))
+		// workflow rule variables overwrite the global variables, not the ci variables
+		for key, value := range rule.Variables {
+			context.variables[key] = fmt.Sprint(value)
+		}
+		return nil
+	}
+	context.simulation.Created = false
+	context.simulation.Reason = "no workflow rule matches"
+	return nil
+}
+
+func (context *simulationContext) evaluateJob(job *Job) error {
+	variables := context.variables
+	if job.Variables != nil {
+		variables = make(map[string]string, len(context.variables)+len(*job.Variables))
+		for key, value := range *job.Variables {
+			variables[key] = fmt.Sprint(value)
+		}
+		for key, value := range context.variables {
+			variables[key] = value
+		}
+	}
+	result := &JobSimulation{When: job.When}
+	if result.When == "" {
+		result.When = WhenOnSuccess
+	}
+	context.needs[job.Name] = job.Needs
+	allowFailure := job.AllowFailure != nil && job.AllowFailure.Allowed != nil && *job.AllowFailure.Allowed
+	// manual jobs without rules don't block the pipeline unless allow_failure is false
+	blockingManual := job.AllowFailure != nil && !allowFailure
+	if len(job.Rules) > 0 {
+		result.When = WhenNever
+		result.Reason = "no rule matches"
+		for idx, rule := range job.Rules {
+			matches, err := ruleMatches(rule.If, rule.Exists, variables)
+			if err != nil {
+				return fmt.Errorf("rule %d of job '%s': %w", idx, job.Name, err)
+			}
+			if !matches {
+				continue
+			}
+			result.When = rule.When
+			if result.When == "" {
+				result.When = job.When
+			}
+			if result.When == "" {
+				result.When = WhenOnSuccess
+			}
+			result.Reason = fmt.Sprintf("rule %d (%s) matches", idx, describeRule(rule.If, len(rule.Changes) > 0))
+			if rule.Needs != nil {
+				context.needs[job.Name] = rule.Needs
+			}
+			// manual jobs added by rules block the pipeline unless allow_failure is true
+			blockingManual = !allowFailure
+			if rule.AllowFailure != nil {
+				blockingManual = !*rule.AllowFailure
+			}
+			break
+		}
+	}
+	result.Runs = result.When != WhenNever
+	context.blocking[job.Name] = result.When == WhenManual && blockingManual
+	context.simulation.Jobs[job.Name] = result
+	return nil
+}
+
+// waitsFor determines the manual job the job waits for. Jobs with needs wait for the manual jobs they
+// (indirectly) need, the others for the blocking manual jobs of the previous stages.
+func (context *simulationContext) waitsFor(job *Job, visiting []string) (string, error) {
+	result := context.simulation.Jobs[job.Name]
+	if !result.Runs || result.WaitsFor != "" {
+		return result.WaitsFor, nil
+	}
+	for _, name := range visiting {
+		if name == job.Name {
+			return "", nil // cycles are reported by the validation
+		}
+	}
+	visiting = append(visiting, job.Name)
+	needs := context.needs[job.Name]
+	if needs != nil {
+		for _, need := range needs {
+			neededResult, exists := context.simulation.Jobs[need.Job.Name]
+			if !exists || !neededResult.Runs {
+				if need.Optional {
+					continue
+				}
+				return "", fmt.Errorf("job '%s' needs job '%s', which is not part of the pipeline", job.Name, need.Job.Name)
+			}
+			if neededResult.When == WhenManual {
+				result.WaitsFor = need.Job.Name
+				return result.WaitsFor, nil
+			}
+			waitsFor, err := context.waitsFor(context.jobsByName[need.Job.Name], visiting)
+			if err != nil {
+				return "", err
+			}
+			if waitsFor != "" {
+				result.WaitsFor = waitsFor
+				return result.WaitsFor, nil
+			}
+		}
+		return "", nil
+	}
+	stage := context.stageIndex(job)
+	for _, other := range context.jobs {
+		if context.stageIndex(other) >= stage || !context.simulation.Jobs[other.Name].Runs {
+			continue
+		}
+		if context.blocking[other.Name] {
+			result.WaitsFor = other.Name
+			return result.WaitsFor, nil
+		}
+	}
+	return "", nil
+}
+
+func (context *simulationContext) stageIndex(job *Job) int {
+	stageName := "test" // the default stage of gitlab
+	if job.Stage != nil {
+		stageName = job.Stage.Name
+	}
+	for idx, stage := range context.pipeline.Stages {
+		if stage.Name == stageName {
+			return idx
+		}
+	}
+	return len(context.pipeline.Stages)
+}
+
+// ruleMatches evaluates the if and exists of a rule, changes are assumed to match.
+func ruleMatches(ifExpression string, exists []string, variables map[string]string) (bool, error) {
+	if ifExpression != "" {
+		matches, err := EvaluateExpression(ifExpression, variables)
+		if err != nil || !matches {
+			return false, err
+		}
+	}
+	if len(exists) == 0 {
+		return true, nil
+	}
+	for _, pattern := range exists {
+		if files, err := zglob.Glob(pattern); err == nil && len(files) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func describeRule(ifExpression string, hasChanges bool) string {
+	description := "always"
+	if ifExpression != "" {
+		description = "if: " + ifExpression
+	}
+	if hasChanges {
+		description += ", changes assumed"
+	}
+	return description
+}
@@ -0,0 +1,103 @@
+package pipelinemodel
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	variables := map[string]string{
+		"CI_COMMIT_BRANCH":   "main",
+		"CI_DEFAULT_BRANCH":  "main",
+		"CI_PIPELINE_SOURCE": "push",
+		"EMPTY":              "",
+		"PATTERN":            "/^feature-/",
+	}
+	for expression, expected := range map[string]bool{
+		`$CI_COMMIT_BRANCH`:  true,
+		`$EMPTY`:             false,
+		`$UNDEFINED`:         false,
+		`$UNDEFINED == null`: true,
+		`$EMPTY == null`:     false,
+		`$EMPTY == ""`:       true,
+		`$CI_COMMIT_BRANCH == $CI_DEFAULT_BRANCH`:                                  true,
+		`${CI_COMMIT_BRANCH} != "main"`:                                            false,
+		`$CI_COMMIT_BRANCH =~ /^MA/i`:                                              true,
+		`$CI_COMMIT_BRANCH !~ /^ma/`:                                               false,
+		`$CI_COMMIT_BRANCH =~ $PATTERN`:                                            false,
+		`$UNDEFINED =~ /.*/`:                                                       false,
+		`$CI_PIPELINE_SOURCE == "schedule" || $CI_COMMIT_BRANCH`:                   true,
+		`$CI_PIPELINE_SOURCE == "schedule" && $CI_COMMIT_BRANCH`:                   false,
+		`($CI_PIPELINE_SOURCE == "push" || $EMPTY) && 'main' == $CI_COMMIT_BRANCH`: true,
+	} {
+		result, err := EvaluateExpression(expression, variables)
+		if err != nil {
+			t.Errorf("expression '%s': %v", expression, err)
+		} else if result != expected {
+			t.Errorf("expression '%s' is %v, expected %v", expression, result, expected)
+		}
+	}
+	for _, invalid := range []string{`$A ==`, `($A`, `$A == "b" )`, `$A =~ "b"`, `$A = "b"`} {
+		if _, err := EvaluateExpression(invalid, variables); err == nil {
+			t.Errorf("expected an error for expression '%s'", invalid)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	build, test := Stage{Name: "build"}, Stage{Name: "test"}
+	allowed := false
+	gate := &Job{Name: "gate", Stage: &build, Script: []string{"true"}, When: WhenManual, AllowFailure: &JobAllowFailure{Allowed: &allowed}}
+	compile := &Job{Name: "compile", Stage: &build, Script: []string{"make"}, Needs: []JobNeeds{{Job: gate}}}
+	release := &Job{Name: "release", Stage: &test, Script: []string{"make release"}, Extends: []string{".default-branch"}}
+	template := &Job{Name: ".default-branch", Rules: []JobRule{{If: "$CI_COMMIT_BRANCH == $CI_DEFAULT_BRANCH"}}}
+	unitTest := &Job{Name: "unit test", Stage: &test, Script: []string{"make test"}}
+	pipeline := Pipeline{
+		Stages:    []*Stage{&build, &test},
+		Variables: map[string]interface{}{"CI_DEFAULT_BRANCH": "main"},
+		Jobs:      []*Job{gate, compile, template, release, unitTest},
+	}
+
+	simulation, err := pipeline.Simulate(map[string]string{"CI_COMMIT_BRANCH": "feature"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := simulation.Jobs[".default-branch"]; exists {
+		t.Error("hidden jobs must not be simulated")
+	}
+	if job := simulation.Jobs["release"]; job.Runs || job.Reason != "no rule matches" {
+		t.Errorf("release must not run on feature branches: %+v", job)
+	}
+	if job := simulation.Jobs["compile"]; !job.Runs || job.WaitsFor != "gate" {
+		t.Errorf("compile must wait for the gate it needs: %+v", job)
+	}
+	if job := simulation.Jobs["unit test"]; !job.Runs || job.WaitsFor != "gate" {
+		t.Errorf("unit test must wait for the blocking manual job of the previous stage: %+v", job)
+	}
+
+	simulation, err = pipeline.Simulate(map[string]string{"CI_COMMIT_BRANCH": "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := simulation.Jobs["release"]; !job.Runs || job.When != WhenOnSuccess || !strings.HasPrefix(job.Reason, "rule 0") {
+		t.Errorf("release must run on the default branch: %+v", job)
+	}
+
+	unitTest.Needs = []JobNeeds{{Job: release}}
+	if _, err := pipeline.Simulate(map[string]string{"CI_COMMIT_BRANCH": "feature"}); err == nil || !strings.Contains(err.Error(), "not part of the pipeline") {
+		t.Errorf("expected an error for the need of a job excluded by its rules, got %v", err)
+	}
+	unitTest.Needs = []JobNeeds{{Job: release, Optional: true}}
+	if _, err := pipeline.Simulate(map[string]string{"CI_COMMIT_BRANCH": "feature"}); err != nil {
+		t.Errorf("optional needs of excluded jobs must be ignored: %v", err)
+	}
+
+	pipeline.Workflow = &Workflow{Rules: []WorkflowRule{{If: `$CI_PIPELINE_SOURCE == "schedule"`, When: WhenNever}, {When: WhenAlways}}}
+	simulation, err = pipeline.Simulate(map[string]string{"CI_PIPELINE_SOURCE": "schedule"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulation.Created || !strings.Contains(simulation.Reason, "workflow rule 0") {
+		t.Errorf("the workflow rules must prevent the pipeline: %+v", simulation)
+	}
+}
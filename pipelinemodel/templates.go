@@ -0,0 +1,152 @@
+package pipelinemodel
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ExtractTemplate moves the keywords all jobs have in common (stage, image, needs, tags and variables) into
+// a hidden template job, which the jobs extend. The template has to be added to the pipeline by the caller.
+// It returns nil and leaves the jobs untouched if there are less than two jobs or they have nothing in common.
+func ExtractTemplate(name string, jobs []*Job) *Job {
+	if !strings.HasPrefix(name, ".") {
+		panic(fmt.Errorf("template name '%s' must start with a dot to hide the template job", name))
+	}
+	if len(jobs) < 2 {
+		return nil
+	}
+	first := jobs[0]
+	template := Job{Name: name}
+	extracted := false
+	allJobs := func(sameAsFirst func(job *Job) bool) bool {
+		for _, job := range jobs[1:] {
+			if !sameAsFirst(job) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if first.Stage != nil && allJobs(func(job *Job) bool { return job.Stage == first.Stage }) {
+		template.Stage = first.Stage
+		for _, job := range jobs {
+			job.Stage = nil
+		}
+		extracted = true
+	}
+	if first.Image != nil && allJobs(func(job *Job) bool { return job.Image != nil && job.Image.String() == first.Image.String() }) {
+		template.Image = first.Image
+		for _, job := range jobs {
+			job.Image = nil
+		}
+		extracted = true
+	}
+	// needs are not merged by extends, so they are only extracted if they are the same in all jobs
+	if len(first.Needs) > 0 && allJobs(func(job *Job) bool { return reflect.DeepEqual(job.Needs, first.Needs) }) {
+		template.Needs = first.Needs
+		for _, job := range jobs {
+			job.Needs = nil
+		}
+		extracted = true
+	}
+	if len(first.Tags) > 0 && allJobs(func(job *Job) bool { return reflect.DeepEqual(job.Tags, first.Tags) }) {
+		template.Tags = first.Tags
+		for _, job := range jobs {
+			job.Tags = nil
+		}
+		extracted = true
+	}
+	// variables are merged by extends, so each variable the jobs have in common is extracted
+	if first.Variables != nil {
+		common := make(map[string]interface{})
+		for key, value := range *first.Variables {
+			if allJobs(func(job *Job) bool {
+				other, exists := (*job.variables())[key]
+				return exists && reflect.DeepEqual(other, value)
+			}) {
+				common[key] = value
+			}
+		}
+		if len(common) > 0 {
+			template.Variables = &common
+			for _, job := range jobs {
+				for key := range common {
+					delete(*job.Variables, key)
+				}
+				if len(*job.Variables) == 0 {
+					job.Variables = nil
+				}
+			}
+			extracted = true
+		}
+	}
+
+	if !extracted {
+		return nil
+	}
+	for _, job := range jobs {
+		job.Extends = append(job.Extends, name)
+	}
+	return &template
+}
+
+func (job *Job) variables() *map[string]interface{} {
+	if job.Variables == nil {
+		return &map[string]interface{}{}
+	}
+	return job.Variables
+}
+
+// effectiveNeeds returns the needs of the job including the needs inherited from the jobs it extends.
+// Needs are not merged, the last extended job defining needs wins and the job's own needs win over all.
+// The depth stops at cyclic extends, which are reported by the graph validation.
+func effectiveNeeds(job *Job, jobsByName map[string]*Job, depth int) []JobNeeds {
+	if len(job.Needs) > 0 || depth > MaxExtendsDepth {
+		return job.Needs
+	}
+	for idx := len(job.Extends) - 1; idx >= 0; idx-- {
+		if extended, exists := jobsByName[job.Extends[idx]]; exists {
+			if needs := effectiveNeeds(extended, jobsByName, depth+1); len(needs) > 0 {
+				return needs
+			}
+		}
+	}
+	return nil
+}
+
+// resolveExtends returns a copy of the job with the jobs it extends merged in. Like in gitlab, the variables
+// are merged, all other keywords are taken from the job or else from the last extended job defining them.
+func resolveExtends(job *Job, jobsByName map[string]*Job, depth int) *Job {
+	resolved := Job{}
+	if depth <= MaxExtendsDepth { // deeper extends are reported by the graph validation
+		for _, name := range job.Extends {
+			if extended, exists := jobsByName[name]; exists {
+				mergeJob(&resolved, resolveExtends(extended, jobsByName, depth+1))
+			}
+		}
+	}
+	mergeJob(&resolved, job)
+	resolved.Name = job.Name
+	resolved.Extends = nil
+	return &resolved
+}
+
+func mergeJob(target *Job, source *Job) {
+	inheritedVariables := target.Variables
+	targetValue, sourceValue := reflect.ValueOf(target).Elem(), reflect.ValueOf(source).Elem()
+	for idx := 0; idx < sourceValue.NumField(); idx++ {
+		if !sourceValue.Field(idx).IsZero() {
+			targetValue.Field(idx).Set(sourceValue.Field(idx))
+		}
+	}
+	if inheritedVariables != nil && source.Variables != nil {
+		variables := make(map[string]interface{}, len(*inheritedVariables)+len(*source.Variables))
+		for _, merged := range []*map[string]interface{}{inheritedVariables, source.Variables} {
+			for key, value := range *merged {
+				variables[key] = value
+			}
+		}
+		target.Variables = &variables
+	}
+}
@@ -0,0 +1,63 @@
+package pipelinemodel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractTemplate(t *testing.T) {
+	stage := Stage{Name: "test"}
+	build := &Job{Name: "build", Stage: &stage, Script: []string{"true"}}
+	image, err := ContainerImageCoordinatesFromString("docker.io/library/alpine:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newJob := func(name string, variables map[string]interface{}) *Job {
+		return &Job{
+			Name:      name,
+			Stage:     &stage,
+			Image:     image,
+			Needs:     []JobNeeds{{Job: build, Artifacts: true}},
+			Script:    []string{"true"},
+			Variables: &variables,
+		}
+	}
+	a := newJob("a", map[string]interface{}{"SHARED": "1", "OWN": "a"})
+	b := newJob("b", map[string]interface{}{"SHARED": "1"})
+	b.Tags = []string{"docker"}
+
+	template := ExtractTemplate(".template", []*Job{a, b})
+	if template == nil {
+		t.Fatal("expected a template")
+	}
+	if template.Stage != &stage || template.Image != image || len(template.Needs) != 1 || template.Tags != nil {
+		t.Errorf("unexpected template keywords: %+v", template)
+	}
+	if !reflect.DeepEqual(*template.Variables, map[string]interface{}{"SHARED": "1"}) {
+		t.Errorf("unexpected template variables %v", *template.Variables)
+	}
+	if !reflect.DeepEqual(*a.Variables, map[string]interface{}{"OWN": "a"}) || b.Variables != nil {
+		t.Errorf("common variables were not removed from the jobs: %v, %v", *a.Variables, b.Variables)
+	}
+	if a.Stage != nil || a.Image != nil || a.Needs != nil || len(b.Tags) != 1 {
+		t.Error("extracted keywords were not removed from the jobs")
+	}
+	for _, job := range []*Job{a, b} {
+		if !reflect.DeepEqual(job.Extends, []string{".template"}) {
+			t.Errorf("job '%s' extends %v", job.Name, job.Extends)
+		}
+	}
+
+	pipeline := Pipeline{Stages: []*Stage{&stage}, Jobs: []*Job{build, template, a, b}}
+	if _, err := pipeline.Render(); err != nil {
+		t.Errorf("pipeline with template can't be rendered: %v", err)
+	}
+
+	if ExtractTemplate(".single", []*Job{newJob("c", nil)}) != nil {
+		t.Error("a single job must not get a template")
+	}
+	d, e := &Job{Name: "d", Script: []string{"true"}}, &Job{Name: "e", Script: []string{"true"}}
+	if ExtractTemplate(".nothing", []*Job{d, e}) != nil || d.Extends != nil {
+		t.Error("jobs without common keywords must not get a template")
+	}
+}
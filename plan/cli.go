@@ -0,0 +1,114 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/git"
+)
+
+type PlanCmd struct {
+	ConfigFileName string            `help:"Set the name of the gipgee config file" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
+	GipgeeImage    string            `help:"Overwrite the gipgee container image" env:"GIPGEE_OVERWRITE_GIPGEE_IMAGE" optional:""`
+	Var            map[string]string `help:"CI variable of the simulated pipeline, e.g. --var CI_COMMIT_BRANCH=main (overwrites the env file)" mapsep:"none"`
+	EnvFile        string            `help:"File with the CI variables of the simulated pipeline, one KEY=VALUE per line" optional:"" type:"existingfile"`
+	Output         string            `help:"Output format" enum:"table,json" default:"table"`
+}
+
+func (*PlanCmd) Help() string {
+	return "Simulates offline which pipeline gipgee run would generate for the given CI variables and prints which images are built, tested and released and why. The CI variables of the environment gipgee run decides on are ignored"
+}
+
+func (cmd *PlanCmd) Run() error {
+	variables := make(map[string]string)
+	if cmd.EnvFile != "" {
+		content, err := os.ReadFile(cmd.EnvFile)
+		if err != nil {
+			return err
+		}
+		if variables, err = parseEnvFile(string(content)); err != nil {
+			return fmt.Errorf("cannot parse env file '%s': %w", cmd.EnvFile, err)
+		}
+	}
+	for key, value := range cmd.Var {
+		variables[key] = value
+	}
+
+	// gipgee run (and the config) read the ci variables from the environment, so the simulated ones replace them
+	for _, name := range DecisionVariableNames {
+		if err := os.Unsetenv(name); err != nil {
+			return err
+		}
+	}
+	for key, value := range variables {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+
+	decision := Decide()
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	// the credentials are not needed to plan, the generated scripts only refer to them
+	config.SetVariableLookup(func(name string) (string, bool) {
+		if value, exists := os.LookupEnv(name); exists {
+			return value, true
+		}
+		return "$" + name, true
+	})
+
+	var changedFiles []string
+	if decision.MergeRequest != nil && decision.MergeRequest.DiffBaseSha != "" {
+		headSha, exists := variables["CI_COMMIT_SHA"]
+		if !exists {
+			headSha = git.GetCurrentGitRevisionHex()
+		}
+		if changedFiles, err = git.GetChangedFilesBetweenCommits(decision.MergeRequest.DiffBaseSha, headSha); err != nil {
+			log.Printf("Cannot determine the changes of the merge request (%s)\n", err.Error())
+			changedFiles = nil
+		}
+	}
+
+	plan, err := NewPlan(config, decision, cmd.ConfigFileName, cmd.GipgeeImage, variables, changedFiles)
+	if err != nil {
+		return err
+	}
+	if cmd.Output == "json" {
+		planJson, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(planJson))
+		return nil
+	}
+	return plan.WriteTable(os.Stdout)
+}
+
+// parseEnvFile parses KEY=VALUE lines, empty lines and comments are ignored. Like in shell env files,
+// the lines may start with export and the values may be quoted.
+func parseEnvFile(content string) (map[string]string, error) {
+	variables := make(map[string]string)
+	for idx, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		keyValue := strings.SplitN(line, "=", 2)
+		if len(keyValue) != 2 || strings.TrimSpace(keyValue[0]) == "" {
+			return nil, fmt.Errorf("line %d is not KEY=VALUE", idx+1)
+		}
+		value := strings.TrimSpace(keyValue[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		variables[strings.TrimSpace(keyValue[0])] = value
+	}
+	return variables, nil
+}
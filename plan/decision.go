@@ -0,0 +1,97 @@
+package plan
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/imagebuild"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+	"github.com/devfbe/gipgee/updatecheck"
+)
+
+// DecisionVariableNames are the ci variables the decision (and the config, e.g. the semver release tags) depends on.
+var DecisionVariableNames = []string{
+	"CI_PIPELINE_SOURCE",
+	"CI_DEFAULT_BRANCH",
+	"CI_COMMIT_BRANCH",
+	"CI_COMMIT_TAG",
+	"CI_MERGE_REQUEST_IID",
+	"CI_MERGE_REQUEST_DIFF_BASE_SHA",
+	"GIPGEE_UPDATE_CHECK",
+	"GIPGEE_FORCE_AUTOSTART",
+}
+
+// Decision is the pipeline gipgee run generates for the ci variables of the pipeline.
+type Decision struct {
+	UpdateCheck  bool
+	Release      bool
+	AutoStart    bool
+	MergeRequest *imagebuild.MergeRequest
+	Reason       string
+}
+
+// Decide decides from the ci variables gitlab sets which pipeline to generate: the update check pipeline for
+// update check schedules, otherwise the image build pipeline, which releases in tag and default branch pipelines.
+func Decide() *Decision {
+	log.Println("Checking if CI_PIPELINE_SOURCE is == 'schedule' and GIPGEE_UPDATE_CHECK is == true")
+	// see https://docs.gitlab.com/ee/ci/variables/predefined_variables.html
+	if os.Getenv("CI_PIPELINE_SOURCE") == "schedule" && strings.ToLower(os.Getenv("GIPGEE_UPDATE_CHECK")) == "true" {
+		return logDecision(&Decision{
+			UpdateCheck: true,
+			Reason:      "Pipeline source is schedule and GIPGEE_UPDATE_CHECK is true, generating update check pipeline",
+		})
+	}
+	log.Println("Detected no update check pipeline schedule, assuming image build pipeline. Checking if merge request, feature branch or default branch pipeline")
+	defaultBranch := os.Getenv("CI_DEFAULT_BRANCH")
+	commitBranch := os.Getenv("CI_COMMIT_BRANCH")
+	if mergeRequest := imagebuild.MergeRequestFromEnv(); mergeRequest != nil {
+		return logDecision(&Decision{
+			AutoStart:    true,
+			MergeRequest: mergeRequest,
+			Reason:       fmt.Sprintf("Detected merge request pipeline for merge request !%s. Generating image build pipeline that builds and tests but does not release the images", mergeRequest.Iid),
+		})
+	} else if commitTag := os.Getenv("CI_COMMIT_TAG"); commitTag != "" {
+		// CI_COMMIT_BRANCH is not set in tag pipelines, the semver tag strategy releases in them
+		return logDecision(&Decision{
+			AutoStart: imagebuild.IsAutoStart(),
+			Release:   true,
+			Reason:    fmt.Sprintf("Detected tag pipeline for tag '%s'. Generating image build pipeline that releases the images", commitTag),
+		})
+	} else if commitBranch == defaultBranch {
+		return logDecision(&Decision{
+			AutoStart: imagebuild.IsAutoStart(),
+			Release:   true,
+			Reason:    fmt.Sprintf("Detected that the commit branch '%s' is the default branch '%s'. Generating image build pipeline that releases the images", commitBranch, defaultBranch),
+		})
+	}
+	return logDecision(&Decision{
+		AutoStart: true,
+		Reason:    fmt.Sprintf("Detected that the commit branch '%s' is not the default branch '%s'. Generating image build pipeline that builds and tests but does not release the images", commitBranch, defaultBranch),
+	})
+}
+
+func logDecision(decision *Decision) *Decision {
+	log.Println(decision.Reason)
+	return decision
+}
+
+// DecideImagesToBuild returns the images the image build pipeline builds.
+func DecideImagesToBuild(cfg *config.Config) []string {
+	return cfg.ImageIds()
+}
+
+// GeneratePipeline generates the decided pipeline.
+func (decision *Decision) GeneratePipeline(cfg *config.Config, pipelineFile string, configFileName string, gipgeeImage string) *pm.Pipeline {
+	if decision.UpdateCheck {
+		return updatecheck.GeneratePipeline(updatecheck.PipelineParams{
+			SkipRebuild:    false, // only for self release integration test true
+			GipgeeImage:    gipgeeImage,
+			ConfigFileName: configFileName,
+			Config:         cfg,
+		})
+	}
+	return imagebuild.NewBuildPipelineGenerator(cfg, DecideImagesToBuild(cfg), decision.AutoStart, decision.Release, decision.MergeRequest, pipelineFile, configFileName, gipgeeImage).GeneratePipeline()
+}
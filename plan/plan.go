@@ -0,0 +1,218 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/imagebuild"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+)
+
+// Outcomes of the phases of an image
+const (
+	OutcomeYes      = "yes"
+	OutcomeManual   = "manual" // after the manual start of a job
+	OutcomeNo       = "no"
+	OutcomeOnUpdate = "on update" // by the rebuild pipeline of the update check
+)
+
+// Generated pipelines
+const (
+	PipelineImageBuild  = "image build"
+	PipelineUpdateCheck = "update check"
+)
+
+type ImagePlan struct {
+	ImageId string   `json:"imageId"`
+	Group   string   `json:"group,omitempty"`
+	Build   string   `json:"build"`
+	Test    string   `json:"test"`
+	Release string   `json:"release"`
+	Reasons []string `json:"reasons"`
+}
+
+// Plan is what the pipeline generated for a set of ci variables would do with the images.
+type Plan struct {
+	Pipeline string       `json:"pipeline"`
+	Reason   string       `json:"reason"`
+	Images   []*ImagePlan `json:"images"`
+}
+
+// NewPlan generates the decided pipeline (and the child pipelines of the image groups) and evaluates their rules
+// and when with the variables. changedFiles are the changes of a merge request, nil if they are unknown.
+func NewPlan(cfg *config.Config, decision *Decision, configFileName string, gipgeeImage string, variables map[string]string, changedFiles []string) (*Plan, error) {
+	plan := &Plan{Reason: decision.Reason, Images: make([]*ImagePlan, 0)}
+	pipeline := decision.GeneratePipeline(cfg, "", configFileName, gipgeeImage)
+	simulation, err := pipeline.Simulate(variables)
+	if err != nil {
+		return nil, fmt.Errorf("cannot simulate the generated pipeline: %w", err)
+	}
+	if decision.UpdateCheck {
+		plan.Pipeline = PipelineUpdateCheck
+		for _, imageId := range cfg.ImageIds() {
+			plan.Images = append(plan.Images, planUpdateCheck(cfg, imageId, simulation))
+		}
+		return plan, nil
+	}
+
+	plan.Pipeline = PipelineImageBuild
+	imagesToBuild := DecideImagesToBuild(cfg)
+	var mergeRequestReasons map[string][]string
+	if decision.MergeRequest != nil {
+		mergeRequestReasons = imagebuild.GetMergeRequestReasons(cfg, configFileName, imagesToBuild, changedFiles)
+	}
+	if cfg.Sharding == nil {
+		for _, imageId := range imagesToBuild {
+			image := planImage(cfg, imageId, simulation, decision)
+			image.Reasons = append(append([]string{}, mergeRequestReasons[imageId]...), image.Reasons...)
+			plan.Images = append(plan.Images, image)
+		}
+		return plan, nil
+	}
+
+	for _, group := range cfg.ImageGroups() {
+		groupImages := group.Filter(imagesToBuild)
+		if len(groupImages) == 0 {
+			continue
+		}
+		groupSimulation := simulation
+		if trigger := simulation.Jobs[imagebuild.GetImageGroupTriggerJobName(group.Name)]; simulation.Created && (trigger == nil || !trigger.Runs) {
+			groupSimulation = &pm.Simulation{Reason: fmt.Sprintf("the child pipeline of image group '%s' is not triggered", group.Name)}
+		} else if simulation.Created {
+			groupPipeline := imagebuild.NewImageGroupPipelineGenerator(cfg, group, imagesToBuild, decision.AutoStart, decision.Release, imagebuild.GetImageGroupPipelineFileName(group.Name), configFileName, gipgeeImage).GeneratePipeline()
+			if groupSimulation, err = groupPipeline.Simulate(variables); err != nil {
+				return nil, fmt.Errorf("cannot simulate the child pipeline of image group '%s': %w", group.Name, err)
+			}
+		}
+		for _, imageId := range groupImages {
+			image := planImage(cfg, imageId, groupSimulation, decision)
+			image.Group = group.Name
+			image.Reasons = append(append([]string{}, mergeRequestReasons[imageId]...), image.Reasons...)
+			plan.Images = append(plan.Images, image)
+		}
+	}
+	return plan, nil
+}
+
+func planUpdateCheck(cfg *config.Config, imageId string, simulation *pm.Simulation) *ImagePlan {
+	image := &ImagePlan{ImageId: imageId, Build: OutcomeNo, Test: OutcomeNo, Release: OutcomeNo, Reasons: make([]string, 0)}
+	if !simulation.Created {
+		image.Reasons = append(image.Reasons, "the pipeline is not created: "+simulation.Reason)
+		return image
+	}
+	for _, location := range cfg.Images[imageId].ReleaseLocations {
+		if location.Tag != nil {
+			image.Build, image.Test, image.Release = OutcomeOnUpdate, OutcomeOnUpdate, OutcomeOnUpdate
+			image.Reasons = append(image.Reasons, "checked for updates, the rebuild pipeline builds, tests and releases the image if there are updates")
+			return image
+		}
+	}
+	image.Reasons = append(image.Reasons, "no release location with a tag to check for updates")
+	return image
+}
+
+func planImage(cfg *config.Config, imageId string, simulation *pm.Simulation, decision *Decision) *ImagePlan {
+	image := &ImagePlan{ImageId: imageId, Build: OutcomeNo, Test: OutcomeNo, Release: OutcomeNo, Reasons: make([]string, 0)}
+	if !simulation.Created {
+		image.Reasons = append(image.Reasons, "the pipeline is not created: "+simulation.Reason)
+		return image
+	}
+	imageConfig := cfg.Images[imageId]
+
+	image.Build, image.Reasons = evaluatePhase(simulation, []string{imagebuild.GetBuildJobName(imageId)}, image.Reasons)
+	if image.Build == OutcomeNo {
+		return image
+	}
+
+	testJobNames := []string{imagebuild.GetTestJobName(imageId), imagebuild.GetStructureTestJobName(imageId), imagebuild.GetServiceTestJobName(imageId)}
+	for _, suiteName := range imageConfig.TestSuiteNames() {
+		testJobNames = append(testJobNames, imagebuild.GetTestSuiteJobName(imageId, suiteName))
+	}
+	image.Test, image.Reasons = evaluatePhase(simulation, testJobNames, image.Reasons)
+	if image.Test == OutcomeNo {
+		image.Reasons = append(image.Reasons, "no test jobs in the pipeline")
+	}
+
+	if !decision.Release {
+		image.Reasons = append(image.Reasons, "the pipeline doesn't release")
+		return image
+	}
+	image.Release, image.Reasons = evaluatePhase(simulation, []string{imagebuild.GetReleaseJobName(imageId)}, image.Reasons)
+	if image.Release == OutcomeNo {
+		return image
+	}
+	released := false
+	for _, location := range imageConfig.ReleaseLocations {
+		if references := location.ReleaseReferences(); len(references) > 0 {
+			released = true
+			image.Reasons = append(image.Reasons, "released as "+strings.Join(references, ", "))
+		} else {
+			image.Reasons = append(image.Reasons, fmt.Sprintf("not released to %s, the tag strategy %s only releases in tag pipelines", location.String(), *location.TagStrategy))
+		}
+	}
+	if !released {
+		image.Release = OutcomeNo
+	}
+	return image
+}
+
+// evaluatePhase returns the outcome of the jobs of a phase which are part of the pipeline and adds the reasons of the
+// rules and manual jobs deciding it.
+func evaluatePhase(simulation *pm.Simulation, jobNames []string, reasons []string) (string, []string) {
+	outcome := OutcomeNo
+	for _, jobName := range jobNames {
+		job, exists := simulation.Jobs[jobName]
+		if !exists {
+			continue
+		}
+		if job.Reason != "" {
+			reasons = addReason(reasons, fmt.Sprintf("%s: %s", jobName, job.Reason))
+		}
+		if !job.Runs {
+			continue
+		}
+		switch {
+		case job.When == pm.WhenManual:
+			reasons = addReason(reasons, fmt.Sprintf("waits for the manual start of '%s'", jobName))
+			if outcome == OutcomeNo {
+				outcome = OutcomeManual
+			}
+		case job.WaitsFor != "":
+			reasons = addReason(reasons, fmt.Sprintf("waits for the manual start of '%s'", job.WaitsFor))
+			if outcome == OutcomeNo {
+				outcome = OutcomeManual
+			}
+		default:
+			outcome = OutcomeYes
+		}
+	}
+	return outcome, reasons
+}
+
+func addReason(reasons []string, reason string) []string {
+	for _, existing := range reasons {
+		if existing == reason {
+			return reasons
+		}
+	}
+	return append(reasons, reason)
+}
+
+func (plan *Plan) WriteTable(writer io.Writer) error {
+	if _, err := fmt.Fprintf(writer, "Pipeline: %s\nReason: %s\n\n", plan.Pipeline, plan.Reason); err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "IMAGE\tGROUP\tBUILD\tTEST\tRELEASE\tREASONS")
+	for _, image := range plan.Images {
+		group := image.Group
+		if group == "" {
+			group = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n", image.ImageId, group, image.Build, image.Test, image.Release, strings.Join(image.Reasons, "; "))
+	}
+	return table.Flush()
+}
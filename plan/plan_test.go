@@ -0,0 +1,79 @@
+package plan
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/devfbe/gipgee/config"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	variables, err := parseEnvFile("# simulated pipeline\nCI_COMMIT_BRANCH=main\n\nexport CI_DEFAULT_BRANCH = \"main\"\nCI_COMMIT_MESSAGE='a=b'\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"CI_COMMIT_BRANCH": "main", "CI_DEFAULT_BRANCH": "main", "CI_COMMIT_MESSAGE": "a=b"}
+	if !reflect.DeepEqual(variables, expected) {
+		t.Errorf("parsed %v, expected %v", variables, expected)
+	}
+	if _, err := parseEnvFile("CI_COMMIT_BRANCH"); err == nil {
+		t.Error("expected an error for a line without value")
+	}
+}
+
+func newTestPlan(t *testing.T, variables map[string]string) *Plan {
+	t.Setenv("FOO", "staging-user")
+	t.Setenv("BAR", "staging-password")
+	for _, name := range DecisionVariableNames {
+		t.Setenv(name, variables[name])
+	}
+	decision := Decide()
+	cfg, err := config.LoadConfiguration("../config/testconfig.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := NewPlan(cfg, decision, "gipgee.yml", "registry.example.com/gipgee:1.0.0", variables, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Images) != len(cfg.ImageIds()) {
+		t.Fatalf("plan has %d images, the config %d", len(plan.Images), len(cfg.ImageIds()))
+	}
+	return plan
+}
+
+func TestPlan(t *testing.T) {
+	plan := newTestPlan(t, map[string]string{"CI_COMMIT_BRANCH": "feature", "CI_DEFAULT_BRANCH": "main"})
+	if plan.Pipeline != PipelineImageBuild {
+		t.Errorf("expected an image build pipeline, got %s", plan.Pipeline)
+	}
+	for _, image := range plan.Images {
+		if image.Build != OutcomeYes || image.Test != OutcomeYes || image.Release != OutcomeNo {
+			t.Errorf("feature branch pipeline must build and test but not release image '%s': %+v", image.ImageId, image)
+		}
+	}
+
+	plan = newTestPlan(t, map[string]string{"CI_COMMIT_BRANCH": "main", "CI_DEFAULT_BRANCH": "main", "CI_PIPELINE_SOURCE": "web"})
+	for _, image := range plan.Images {
+		if image.Build != OutcomeManual || image.Release != OutcomeManual {
+			t.Errorf("manually triggered default branch pipeline must wait for the manual start of image '%s': %+v", image.ImageId, image)
+		}
+		if !strings.HasPrefix(image.Reasons[len(image.Reasons)-1], "released as ") {
+			t.Errorf("expected the release references as reason of image '%s': %v", image.ImageId, image.Reasons)
+		}
+	}
+
+	plan = newTestPlan(t, map[string]string{"CI_PIPELINE_SOURCE": "schedule", "GIPGEE_UPDATE_CHECK": "true"})
+	if plan.Pipeline != PipelineUpdateCheck || plan.Images[0].Release != OutcomeOnUpdate {
+		t.Errorf("expected an update check plan, got %+v", plan)
+	}
+	table := bytes.Buffer{}
+	if err := plan.WriteTable(&table); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(table.String(), "IMAGE") || !strings.Contains(table.String(), plan.Images[0].ImageId) {
+		t.Errorf("unexpected table:\n%s", table.String())
+	}
+}
@@ -0,0 +1,43 @@
+package probe
+
+import (
+	"fmt"
+	"log"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+type ExecServiceProbeCmd struct {
+	ImageId        string `arg:""`
+	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+}
+
+func (*ExecServiceProbeCmd) Help() string {
+	return "Only for gipgee internal use in the image build pipeline. Probes the staging image running as gitlab service"
+}
+
+func (cmd *ExecServiceProbeCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	image, exists := config.Images[cmd.ImageId]
+	if !exists {
+		return fmt.Errorf("image '%s' does not exist in config", cmd.ImageId)
+	}
+	if image.ServiceTest == nil {
+		return fmt.Errorf("image '%s' has no service test configured", cmd.ImageId)
+	}
+	// the probes run sequentially, later probes usually don't need to wait anymore
+	failed := 0
+	for _, probe := range image.ServiceTest.Probes {
+		if err := Run(probe); err != nil {
+			log.Println(err.Error())
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d probes failed for image '%s'", failed, len(image.ServiceTest.Probes), cmd.ImageId)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package probe
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+// maxBodySize limits how much of the http response body is matched against the expected body.
+const maxBodySize = 1024 * 1024
+
+type check func(timeout time.Duration) error
+
+func tcpCheck(probe *cfg.TcpProbe) check {
+	address := net.JoinHostPort(*probe.Host, strconv.Itoa(probe.Port))
+	return func(timeout time.Duration) error {
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+func httpUrl(probe *cfg.HttpProbe) string {
+	path := *probe.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return fmt.Sprintf("%s://%s%s", *probe.Scheme, net.JoinHostPort(*probe.Host, strconv.Itoa(probe.Port)), path)
+}
+
+func httpCheck(probe *cfg.HttpProbe) check {
+	url := httpUrl(probe)
+	return func(timeout time.Duration) error {
+		request, err := http.NewRequest(*probe.Method, url, nil)
+		if err != nil {
+			return err
+		}
+		for key, value := range probe.Headers {
+			request.Header.Set(key, value)
+		}
+		client := http.Client{Timeout: timeout}
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		statusOk := false
+		for _, status := range probe.ExpectedStatus {
+			if response.StatusCode == status {
+				statusOk = true
+			}
+		}
+		if !statusOk {
+			return fmt.Errorf("%s %s returned status %d, expected one of %v", *probe.Method, url, response.StatusCode, probe.ExpectedStatus)
+		}
+		if probe.ExpectedBody != nil {
+			body, err := io.ReadAll(io.LimitReader(response.Body, maxBodySize))
+			if err != nil {
+				return err
+			}
+			matched, err := regexp.Match(*probe.ExpectedBody, body)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				return fmt.Errorf("response body of %s %s doesn't match '%s'", *probe.Method, url, *probe.ExpectedBody)
+			}
+		}
+		return nil
+	}
+}
+
+// Run repeats the probe until it succeeds, the timeout is exceeded or the retries are exhausted.
+func Run(probe *cfg.ServiceProbe) error {
+	timeout, err := time.ParseDuration(*probe.Timeout)
+	if err != nil {
+		return err
+	}
+	interval, err := time.ParseDuration(*probe.Interval)
+	if err != nil {
+		return err
+	}
+	var probeCheck check
+	if probe.Tcp != nil {
+		probeCheck = tcpCheck(probe.Tcp)
+	} else {
+		probeCheck = httpCheck(probe.Http)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		err := probeCheck(time.Until(deadline))
+		if err == nil {
+			log.Printf("Probe '%s' succeeded (attempt %d)\n", *probe.Name, attempt)
+			return nil
+		}
+		log.Printf("Probe '%s' attempt %d failed: %s\n", *probe.Name, attempt, err.Error())
+		if probe.Retries != nil && attempt > *probe.Retries {
+			return fmt.Errorf("probe '%s' failed after %d attempts: %w", *probe.Name, attempt, err)
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("probe '%s' timed out after %s: %w", *probe.Name, timeout, err)
+		}
+		time.Sleep(interval)
+	}
+}
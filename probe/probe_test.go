@@ -0,0 +1,100 @@
+package probe
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+func hostPort(rawUrl string, t *testing.T) (string, int) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(parsed.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Hostname(), port
+}
+
+func newProbe(name string) *cfg.ServiceProbe {
+	return &cfg.ServiceProbe{
+		Name:     &name,
+		Timeout:  &[]string{"2s"}[0],
+		Interval: &[]string{"10ms"}[0],
+	}
+}
+
+func TestHttpProbe(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the service needs some time to start up
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("X-Test") != "gipgee" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status": "healthy"}`))
+	}))
+	defer server.Close()
+	host, port := hostPort(server.URL, t)
+
+	probe := newProbe("health")
+	probe.Http = &cfg.HttpProbe{
+		Scheme:         &[]string{"http"}[0],
+		Host:           &host,
+		Port:           port,
+		Path:           &[]string{"health"}[0],
+		Method:         &[]string{"GET"}[0],
+		Headers:        map[string]string{"X-Test": "gipgee"},
+		ExpectedStatus: []int{200},
+		ExpectedBody:   &[]string{`"status":\s*"healthy"`}[0],
+	}
+	if err := Run(probe); err != nil {
+		t.Error(err)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+
+	probe.Http.ExpectedBody = &[]string{"unhealthy"}[0]
+	probe.Retries = &[]int{2}[0]
+	requests = 0
+	if err := Run(probe); err == nil {
+		t.Error("expected probe to fail because of the body expectation")
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests (1 + 2 retries), got %d", requests)
+	}
+}
+
+func TestTcpProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().(*net.TCPAddr)
+	host := address.IP.String()
+
+	probe := newProbe("port")
+	probe.Tcp = &cfg.TcpProbe{Host: &host, Port: address.Port}
+	if err := Run(probe); err != nil {
+		t.Error(err)
+	}
+
+	listener.Close()
+	probe.Timeout = &[]string{"100ms"}[0]
+	if err := Run(probe); err == nil {
+		t.Error("expected probe on closed port to time out")
+	}
+}
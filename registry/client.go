@@ -0,0 +1,326 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/devfbe/gipgee/docker"
+)
+
+// manifestMediaTypes are accepted when fetching manifests, kaniko pushes docker v2 schema 2 manifests,
+// other tools often push oci manifests or indexes.
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+var (
+	challengeParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	nextLinkRegexp       = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+)
+
+// Client is a minimal client for the docker registry http api v2
+// (https://docs.docker.com/registry/spec/api/), supporting basic and bearer token auth.
+type Client struct {
+	// BaseUrl of the registry api, e.g. https://registry.example.com
+	BaseUrl     string
+	credentials *docker.UsernamePassword
+	httpClient  *http.Client
+	tokens      map[string]string
+}
+
+func NewClient(registry string, credentials *docker.UsernamePassword) *Client {
+	host := registry
+	if host == "docker.io" || host == "index.docker.io" {
+		host = "registry-1.docker.io" // the docker hub api is not served by the registry name
+	}
+	return &Client{
+		BaseUrl:     "https://" + host,
+		credentials: credentials,
+		httpClient:  &http.Client{Timeout: 60 * time.Second},
+		tokens:      make(map[string]string),
+	}
+}
+
+// ClientPool reuses the clients (and thereby their cached tokens) per registry and user.
+type ClientPool struct {
+	clients map[string]*Client
+}
+
+func NewClientPool() *ClientPool {
+	return &ClientPool{clients: make(map[string]*Client)}
+}
+
+func (pool *ClientPool) Get(registry string, credentials *docker.UsernamePassword) *Client {
+	key := registry
+	if credentials != nil {
+		key += "/" + credentials.UserName
+	}
+	if client, exists := pool.clients[key]; exists {
+		return client
+	}
+	client := NewClient(registry, credentials)
+	pool.clients[key] = client
+	return client
+}
+
+type HttpError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("%s %s failed with status %d: %s", e.Method, e.Url, e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+func IsNotFound(err error) bool {
+	var httpErr *HttpError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound
+}
+
+func (client *Client) fetchToken(challenge string) (string, error) {
+	params := map[string]string{}
+	for _, match := range challengeParamRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	realm, exists := params["realm"]
+	if !exists {
+		return "", fmt.Errorf("bearer challenge '%s' contains no realm", challenge)
+	}
+	cacheKey := params["service"] + " " + params["scope"]
+	if token, exists := client.tokens[cacheKey]; exists {
+		return token, nil
+	}
+	query := url.Values{}
+	if service, exists := params["service"]; exists {
+		query.Set("service", service)
+	}
+	if scope, exists := params["scope"]; exists {
+		query.Set("scope", scope)
+	}
+	request, err := http.NewRequest(http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if client.credentials != nil {
+		request.SetBasicAuth(client.credentials.UserName, client.credentials.Password)
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", &HttpError{Method: request.Method, Url: realm, StatusCode: response.StatusCode, Body: string(body)}
+	}
+	tokenResponse := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return "", fmt.Errorf("cannot parse token response of '%s': %w", realm, err)
+	}
+	token := tokenResponse.Token
+	if token == "" {
+		token = tokenResponse.AccessToken
+	}
+	client.tokens[cacheKey] = token
+	return token, nil
+}
+
+// do executes the request and answers an authentication challenge of the registry once.
+func (client *Client) do(method, path string, header http.Header) (*http.Response, error) {
+	requestUrl := client.BaseUrl + path
+	var authorization string
+	for attempt := 0; attempt < 2; attempt++ {
+		request, err := http.NewRequest(method, requestUrl, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		response, err := client.httpClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return response, nil
+		}
+		response.Body.Close()
+		challenge := response.Header.Get("WWW-Authenticate")
+		switch {
+		case strings.HasPrefix(strings.ToLower(challenge), "bearer "):
+			token, err := client.fetchToken(challenge)
+			if err != nil {
+				return nil, err
+			}
+			authorization = "Bearer " + token
+		case client.credentials != nil:
+			request.SetBasicAuth(client.credentials.UserName, client.credentials.Password)
+			authorization = request.Header.Get("Authorization")
+		default:
+			return nil, &HttpError{Method: method, Url: requestUrl, StatusCode: http.StatusUnauthorized, Body: "no credentials configured"}
+		}
+	}
+	return nil, errors.New("unreachable")
+}
+
+func (client *Client) doExpecting(method, path string, header http.Header, expectedStatus int) (*http.Response, []byte, error) {
+	response, err := client.do(method, path, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if response.StatusCode != expectedStatus {
+		return nil, nil, &HttpError{Method: method, Url: client.BaseUrl + path, StatusCode: response.StatusCode, Body: string(body)}
+	}
+	return response, body, nil
+}
+
+// nextPath returns the path of the next page from the Link header, if any.
+func nextPath(response *http.Response) string {
+	match := nextLinkRegexp.FindStringSubmatch(response.Header.Get("Link"))
+	if match == nil {
+		return ""
+	}
+	if parsed, err := url.Parse(match[1]); err == nil && parsed.IsAbs() {
+		return parsed.RequestURI()
+	}
+	return match[1]
+}
+
+func (client *Client) ListTags(repository string) ([]string, error) {
+	tags := make([]string, 0)
+	path := fmt.Sprintf("/v2/%s/tags/list", repository)
+	for path != "" {
+		response, body, err := client.doExpecting(http.MethodGet, path, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		page := struct {
+			Tags []string `json:"tags"`
+		}{}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("cannot parse tag list of '%s': %w", repository, err)
+		}
+		tags = append(tags, page.Tags...)
+		path = nextPath(response)
+	}
+	return tags, nil
+}
+
+// ListRepositories uses the catalog api, which is not available on every registry.
+func (client *Client) ListRepositories() ([]string, error) {
+	repositories := make([]string, 0)
+	path := "/v2/_catalog"
+	for path != "" {
+		response, body, err := client.doExpecting(http.MethodGet, path, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		page := struct {
+			Repositories []string `json:"repositories"`
+		}{}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("cannot parse repository catalog: %w", err)
+		}
+		repositories = append(repositories, page.Repositories...)
+		path = nextPath(response)
+	}
+	return repositories, nil
+}
+
+type manifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+}
+
+func (client *Client) getManifest(repository, reference string) (*manifest, string, error) {
+	header := http.Header{"Accept": []string{strings.Join(manifestMediaTypes, ", ")}}
+	response, body, err := client.doExpecting(http.MethodGet, fmt.Sprintf("/v2/%s/manifests/%s", repository, reference), header, http.StatusOK)
+	if err != nil {
+		return nil, "", err
+	}
+	parsed := manifest{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, "", fmt.Errorf("cannot parse manifest '%s:%s': %w", repository, reference, err)
+	}
+	return &parsed, response.Header.Get("Docker-Content-Digest"), nil
+}
+
+type ManifestInfo struct {
+	Digest string
+	// Created is the creation time from the image config, zero if unknown
+	Created time.Time
+}
+
+// GetManifestInfo returns the digest and creation time of the image with the given tag. For
+// multi platform images, the creation time of the first image in the index is used.
+func (client *Client) GetManifestInfo(repository, tag string) (*ManifestInfo, error) {
+	imageManifest, digest, err := client.getManifest(repository, tag)
+	if err != nil {
+		return nil, err
+	}
+	if digest == "" {
+		return nil, fmt.Errorf("registry returned no digest for '%s:%s'", repository, tag)
+	}
+	if len(imageManifest.Manifests) > 0 {
+		imageManifest, _, err = client.getManifest(repository, imageManifest.Manifests[0].Digest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	info := ManifestInfo{Digest: digest}
+	if imageManifest.Config.Digest == "" {
+		return &info, nil
+	}
+	_, body, err := client.doExpecting(http.MethodGet, fmt.Sprintf("/v2/%s/blobs/%s", repository, imageManifest.Config.Digest), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	imageConfig := struct {
+		Created time.Time `json:"created"`
+	}{}
+	if err := json.Unmarshal(body, &imageConfig); err != nil {
+		return nil, fmt.Errorf("cannot parse image config of '%s:%s': %w", repository, tag, err)
+	}
+	// reproducible builds use the unix epoch, which says nothing about the age
+	if imageConfig.Created.Unix() > 0 {
+		info.Created = imageConfig.Created
+	}
+	return &info, nil
+}
+
+// DeleteManifest deletes the manifest and thereby all tags referencing it.
+func (client *Client) DeleteManifest(repository, digest string) error {
+	_, _, err := client.doExpecting(http.MethodDelete, fmt.Sprintf("/v2/%s/manifests/%s", repository, digest), nil, http.StatusAccepted)
+	return err
+}
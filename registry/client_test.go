@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devfbe/gipgee/docker"
+)
+
+// newFakeRegistry serves a registry with token auth containing the repository foo
+// with two tags (on two pages) pointing to the same manifest.
+func newFakeRegistry(t *testing.T, deleted *[]string) *httptest.Server {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "gipgee" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("scope") != "repository:foo:pull,delete" {
+			t.Errorf("unexpected token scope '%s'", r.URL.Query().Get("scope"))
+		}
+		_, _ = w.Write([]byte(`{"token": "t0ken"}`))
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="fake",scope="repository:foo:pull,delete"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/foo/tags/list" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/foo/tags/list?n=1&last=a>; rel="next"`)
+			_, _ = w.Write([]byte(`{"name": "foo", "tags": ["a"]}`))
+		case r.URL.Path == "/v2/foo/tags/list":
+			_, _ = w.Write([]byte(`{"name": "foo", "tags": ["b"]}`))
+		case r.URL.Path == "/v2/foo/manifests/a" && r.Method == http.MethodGet:
+			w.Header().Set("Docker-Content-Digest", "sha256:manifest")
+			_, _ = w.Write([]byte(`{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "config": {"digest": "sha256:config"}}`))
+		case r.URL.Path == "/v2/foo/blobs/sha256:config":
+			_, _ = w.Write([]byte(`{"created": "2026-10-01T12:00:00Z"}`))
+		case r.URL.Path == "/v2/foo/manifests/sha256:manifest" && r.Method == http.MethodDelete:
+			*deleted = append(*deleted, "sha256:manifest")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors": [{"code": "MANIFEST_UNKNOWN"}]}`))
+		}
+	})
+	server = httptest.NewServer(mux)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	deleted := make([]string, 0)
+	server := newFakeRegistry(t, &deleted)
+	defer server.Close()
+
+	client := NewClient("registry.example.com", &docker.UsernamePassword{UserName: "gipgee", Password: "secret"})
+	client.BaseUrl = server.URL
+
+	tags, err := client.ListTags("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0] != "a" || tags[1] != "b" {
+		t.Errorf("tags '%v' don't match expected [a b]", tags)
+	}
+
+	info, err := client.GetManifestInfo("foo", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Digest != "sha256:manifest" || !info.Created.Equal(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected manifest info %+v", info)
+	}
+
+	_, err = client.GetManifestInfo("foo", "doesnotexist")
+	if !IsNotFound(err) {
+		t.Errorf("expected not found error, got '%v'", err)
+	}
+
+	if err := client.DeleteManifest("foo", info.Digest); err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("expected manifest to be deleted, deleted: %v", deleted)
+	}
+}
+
+func TestNewClientDockerHub(t *testing.T) {
+	if client := NewClient("index.docker.io", nil); client.BaseUrl != "https://registry-1.docker.io" {
+		t.Errorf("unexpected docker hub api url '%s'", client.BaseUrl)
+	}
+}
@@ -0,0 +1,123 @@
+package retention
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/registry"
+)
+
+type ApplyCmd struct {
+	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
+	DryRun         bool   `help:"Only report which tags would be deleted"`
+}
+
+type RetentionCmd struct {
+	Apply ApplyCmd `cmd:""`
+}
+
+func (*ApplyCmd) Help() string {
+	return "Deletes the release tags which are expired according to the retention policies of the release locations. Runs as scheduled job in the update check pipeline or manually"
+}
+
+func (cmd *ApplyCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	if !config.HasRetention() {
+		log.Println("No release location defines a retention policy, nothing to do")
+		return nil
+	}
+
+	clients := registry.NewClientPool()
+	now := time.Now()
+	failed := 0
+	for _, imageId := range config.ImageIds() {
+		for idx, location := range config.Images[imageId].ReleaseLocations {
+			if location.Retention == nil {
+				continue
+			}
+			credentials, err := config.GetLocationCredentials(location)
+			if err != nil {
+				return err
+			}
+			client := clients.Get(*location.Registry, credentials)
+			decisions, err := evaluateLocation(client, config, location, now)
+			if err != nil {
+				return fmt.Errorf("cannot apply the retention of release location %d of image '%s': %w", idx, imageId, err)
+			}
+			writeReport(fmt.Sprintf("%s/%s (image '%s', release location %d)", *location.Registry, *location.Repository, imageId, idx), decisions, cmd.DryRun)
+			if !cmd.DryRun {
+				failed += deleteExpired(client, *location.Repository, decisions)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d manifests", failed)
+	}
+	return nil
+}
+
+func evaluateLocation(client *registry.Client, config *cfg.Config, location *cfg.ImageLocation, now time.Time) ([]*Decision, error) {
+	tagNames, err := client.ListTags(*location.Repository)
+	if err != nil {
+		if registry.IsNotFound(err) {
+			return []*Decision{}, nil // nothing released yet
+		}
+		return nil, err
+	}
+	tags := make([]*TagInfo, 0, len(tagNames))
+	for _, tagName := range tagNames {
+		info, err := client.GetManifestInfo(*location.Repository, tagName)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, &TagInfo{Tag: tagName, Digest: info.Digest, Created: info.Created})
+	}
+	return Evaluate(tags, location.Retention, getReferencedTags(config, location), now)
+}
+
+func writeReport(title string, decisions []*Decision, dryRun bool) {
+	deleteAction := "delete"
+	if dryRun {
+		deleteAction = "would delete"
+	}
+	fmt.Printf("\n%s\n", title)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TAG\tCREATED\tDIGEST\tACTION\tREASON")
+	for _, decision := range decisions {
+		created := "unknown"
+		if !decision.Tag.Created.IsZero() {
+			created = decision.Tag.Created.UTC().Format(time.RFC3339)
+		}
+		action := "keep"
+		if !decision.Keep {
+			action = deleteAction
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", decision.Tag.Tag, created, decision.Tag.Digest, action, decision.Reason)
+	}
+	writer.Flush()
+}
+
+// deleteExpired deletes the manifests of the expired tags and returns the number of failed deletions.
+func deleteExpired(client *registry.Client, repository string, decisions []*Decision) int {
+	deleted := make(map[string]bool)
+	failed := 0
+	for _, decision := range decisions {
+		if decision.Keep || deleted[decision.Tag.Digest] {
+			continue
+		}
+		deleted[decision.Tag.Digest] = true
+		log.Printf("Deleting manifest '%s' of tag '%s' in repository '%s'\n", decision.Tag.Digest, decision.Tag.Tag, repository)
+		if err := client.DeleteManifest(repository, decision.Tag.Digest); err != nil {
+			log.Printf("Failed to delete manifest '%s': %s\n", decision.Tag.Digest, err.Error())
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,110 @@
+package retention
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+type TagInfo struct {
+	Tag    string
+	Digest string
+	// Created is the creation time from the image config, zero if unknown
+	Created time.Time
+}
+
+type Decision struct {
+	Tag    *TagInfo
+	Keep   bool
+	Reason string
+}
+
+// Evaluate applies the retention policy to the tags of a release location. The decisions are
+// sorted newest first. Deleting a tag means deleting its manifest, so a tag is also kept if
+// another kept tag (e.g. latest or a tag not matching the pattern) references the same digest.
+func Evaluate(tags []*TagInfo, policy *cfg.Retention, referencedTags []string, now time.Time) ([]*Decision, error) {
+	pattern, err := regexp.Compile(*policy.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	var keepNewerThan time.Duration
+	if policy.KeepNewerThan != nil {
+		keepNewerThan, err = cfg.ParseAge(*policy.KeepNewerThan)
+		if err != nil {
+			return nil, err
+		}
+	}
+	referenced := make(map[string]bool, len(referencedTags))
+	for _, tag := range referencedTags {
+		referenced[tag] = true
+	}
+
+	sorted := make([]*TagInfo, len(tags))
+	copy(sorted, tags)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Created.Equal(sorted[j].Created) {
+			return sorted[i].Tag > sorted[j].Tag
+		}
+		return sorted[i].Created.After(sorted[j].Created) // newest first
+	})
+
+	decisions := make([]*Decision, 0, len(sorted))
+	matchingIdx := 0
+	for _, tag := range sorted {
+		decision := Decision{Tag: tag, Keep: true}
+		switch {
+		case !pattern.MatchString(tag.Tag):
+			decision.Reason = "doesn't match the pattern"
+		case referenced[tag.Tag]:
+			decision.Reason = "currently referenced"
+		case tag.Created.IsZero():
+			decision.Reason = "creation time unknown"
+		default:
+			if policy.KeepLast != nil && matchingIdx < *policy.KeepLast {
+				decision.Reason = fmt.Sprintf("within the last %d", *policy.KeepLast)
+			} else if policy.KeepNewerThan != nil && now.Sub(tag.Created) < keepNewerThan {
+				decision.Reason = fmt.Sprintf("newer than %s", *policy.KeepNewerThan)
+			} else {
+				decision.Keep = false
+				decision.Reason = "expired"
+			}
+			matchingIdx++
+		}
+		decisions = append(decisions, &decision)
+	}
+
+	keptDigests := make(map[string]string)
+	for _, decision := range decisions {
+		if _, exists := keptDigests[decision.Tag.Digest]; decision.Keep && !exists {
+			keptDigests[decision.Tag.Digest] = decision.Tag.Tag
+		}
+	}
+	for _, decision := range decisions {
+		if keptTag, exists := keptDigests[decision.Tag.Digest]; !decision.Keep && exists {
+			decision.Keep = true
+			decision.Reason = fmt.Sprintf("same digest as kept tag '%s'", keptTag)
+		}
+	}
+	return decisions, nil
+}
+
+// getReferencedTags returns the tags of the repository of the location which are referenced by the config,
+// i.e. the tags of all release locations and base images pointing to the same repository.
+func getReferencedTags(config *cfg.Config, location *cfg.ImageLocation) []string {
+	referenced := make([]string, 0)
+	for _, image := range config.Images {
+		for _, other := range append([]*cfg.ImageLocation{image.BaseImage}, image.ReleaseLocations...) {
+			if *other.Registry != *location.Registry || *other.Repository != *location.Repository {
+				continue
+			}
+			if other.Tag != nil {
+				referenced = append(referenced, *other.Tag)
+			}
+			referenced = append(referenced, other.ReleaseTags...)
+		}
+	}
+	return referenced
+}
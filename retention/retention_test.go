@@ -0,0 +1,54 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tags := []*TagInfo{
+		{Tag: "20220501-aaaaaaa", Digest: "sha256:a", Created: now.Add(-31 * day)},
+		{Tag: "20220510-bbbbbbb", Digest: "sha256:b", Created: now.Add(-22 * day)},
+		{Tag: "20220520-ccccccc", Digest: "sha256:c", Created: now.Add(-12 * day)},
+		{Tag: "20220530-ddddddd", Digest: "sha256:d", Created: now.Add(-2 * day)},
+		{Tag: "20220531-eeeeeee", Digest: "sha256:e", Created: now.Add(-1 * day)},
+		{Tag: "stable", Digest: "sha256:b", Created: now.Add(-22 * day)},
+		{Tag: "20220401-fffffff", Digest: "sha256:f", Created: now.Add(-61 * day)},
+		{Tag: "20220101-0000000", Digest: "sha256:0"},
+	}
+	pattern := `^\d{8}-[0-9a-f]{7}$`
+	keepLast := 1
+	keepNewerThan := "14d"
+	decisions, err := Evaluate(tags, &cfg.Retention{Pattern: &pattern, KeepLast: &keepLast, KeepNewerThan: &keepNewerThan}, []string{"20220401-fffffff"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Tag    string
+		Keep   bool
+		Reason string
+	}
+	results := make([]result, len(decisions))
+	for idx, decision := range decisions {
+		results[idx] = result{decision.Tag.Tag, decision.Keep, decision.Reason}
+	}
+	expected := []result{
+		{"20220531-eeeeeee", true, "within the last 1"},
+		{"20220530-ddddddd", true, "newer than 14d"},
+		{"20220520-ccccccc", true, "newer than 14d"},
+		{"stable", true, "doesn't match the pattern"},
+		{"20220510-bbbbbbb", true, "same digest as kept tag 'stable'"},
+		{"20220501-aaaaaaa", false, "expired"},
+		{"20220401-fffffff", true, "currently referenced"},
+		{"20220101-0000000", true, "creation time unknown"},
+	}
+	if diff := cmp.Diff(expected, results); diff != "" {
+		t.Errorf("retention decisions mismatch (-want +got):\n%s", diff)
+	}
+}
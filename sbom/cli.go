@@ -0,0 +1,105 @@
+package sbom
+
+import (
+	"fmt"
+	"log"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/docker"
+)
+
+type SbomCmd struct {
+	Generate GenerateCmd `cmd:""`
+	Attach   AttachCmd   `cmd:""`
+}
+
+type GenerateCmd struct {
+	ImageId        string `arg:""`
+	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	Digest         string `help:"Digest of the staging image" required:"" env:"GIPGEE_STAGING_IMAGE_DIGEST"`
+	OutputFile     string `help:"Write the SBOM to this file" required:""`
+}
+
+func (*GenerateCmd) Help() string {
+	return "Generate the SBOM of the staging image with syft. Used by the image build pipeline"
+}
+
+type AttachCmd struct {
+	ImageId        string `arg:""`
+	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	Digest         string `help:"Digest of the released image" required:"" env:"GIPGEE_STAGING_IMAGE_DIGEST"`
+	SbomFile       string `help:"The SBOM file to attach" required:""`
+}
+
+func (*AttachCmd) Help() string {
+	return "Attach the SBOM to the image in all release locations as OCI referrer. Used by the image build pipeline"
+}
+
+func getImageConfigWithSbom(config *cfg.Config, imageId string) (*cfg.Image, error) {
+	imageConfig, exists := config.Images[imageId]
+	if !exists {
+		return nil, fmt.Errorf("image with id '%s' does not exist in the configuration", imageId)
+	}
+	if !imageConfig.Sbom.IsEnabled() {
+		return nil, fmt.Errorf("sbom generation is not enabled for image '%s'", imageId)
+	}
+	return imageConfig, nil
+}
+
+func (cmd *GenerateCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	imageConfig, err := getImageConfigWithSbom(config, cmd.ImageId)
+	if err != nil {
+		return err
+	}
+	reference := imageConfig.StagingLocation.DigestReference(cmd.Digest)
+	args, err := syftArgs(reference, *imageConfig.Sbom.Format, cmd.OutputFile)
+	if err != nil {
+		return err
+	}
+	authMap, err := config.GetRegistryAuthMap(imageConfig.StagingLocation)
+	if err != nil {
+		return err
+	}
+	log.Printf("Generating %s SBOM of staging image '%s'\n", *imageConfig.Sbom.Format, reference)
+	_, err = docker.RunWithDockerConfig(authMap, nil, "syft", args...)
+	if err != nil {
+		return fmt.Errorf("sbom generation for '%s' failed: %w", reference, err)
+	}
+	log.Printf("Wrote SBOM to '%s'\n", cmd.OutputFile)
+	return nil
+}
+
+func (cmd *AttachCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	imageConfig, err := getImageConfigWithSbom(config, cmd.ImageId)
+	if err != nil {
+		return err
+	}
+	authMap, err := config.GetRegistryAuthMap(imageConfig.ReleaseLocations...)
+	if err != nil {
+		return err
+	}
+	for _, releaseLocation := range imageConfig.ReleaseLocations {
+		if len(releaseLocation.ReleaseTags) == 0 {
+			continue // not released in this pipeline
+		}
+		reference := releaseLocation.DigestReference(cmd.Digest)
+		args, err := orasAttachArgs(reference, *imageConfig.Sbom.Format, cmd.SbomFile)
+		if err != nil {
+			return err
+		}
+		log.Printf("Attaching SBOM '%s' to '%s'\n", cmd.SbomFile, reference)
+		_, err = docker.RunWithDockerConfig(authMap, nil, "oras", args...)
+		if err != nil {
+			return fmt.Errorf("attaching sbom to '%s' failed: %w", reference, err)
+		}
+	}
+	return nil
+}
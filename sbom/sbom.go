@@ -0,0 +1,60 @@
+package sbom
+
+import (
+	"fmt"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+// toolFormat describes how an SBOM format is generated by syft and attached by oras.
+type toolFormat struct {
+	syftOutput    string
+	artifactType  string
+	fileExtension string
+}
+
+var toolFormats = map[string]toolFormat{
+	cfg.SbomFormatCycloneDX: {
+		syftOutput:    "cyclonedx-json",
+		artifactType:  "application/vnd.cyclonedx+json",
+		fileExtension: "cdx.json",
+	},
+	cfg.SbomFormatSPDX: {
+		syftOutput:    "spdx-json",
+		artifactType:  "application/spdx+json",
+		fileExtension: "spdx.json",
+	},
+}
+
+func getToolFormat(format string) (toolFormat, error) {
+	tf, exists := toolFormats[format]
+	if !exists {
+		return toolFormat{}, fmt.Errorf("unsupported sbom format '%s'", format)
+	}
+	return tf, nil
+}
+
+// GetSbomFileName returns the name of the SBOM file (job artifact) for the given image and format.
+func GetSbomFileName(imageId string, format string) string {
+	tf, err := getToolFormat(format)
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("gipgee-sbom-%s.%s", imageId, tf.fileExtension)
+}
+
+func syftArgs(reference string, format string, outputFile string) ([]string, error) {
+	tf, err := getToolFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"registry:" + reference, "-o", tf.syftOutput + "=" + outputFile}, nil
+}
+
+func orasAttachArgs(reference string, format string, sbomFile string) ([]string, error) {
+	tf, err := getToolFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"attach", "--artifact-type", tf.artifactType, reference, sbomFile + ":" + tf.artifactType}, nil
+}
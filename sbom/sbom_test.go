@@ -0,0 +1,43 @@
+package sbom
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSyftArgs(t *testing.T) {
+	args, err := syftArgs("registry.example.com/foo@sha256:abc", "spdx", "sbom.spdx.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"registry:registry.example.com/foo@sha256:abc", "-o", "spdx-json=sbom.spdx.json"}
+	if !cmp.Equal(args, expected) {
+		t.Errorf("given syft args '%v' don't match expected args '%v'", args, expected)
+	}
+
+	_, err = syftArgs("registry.example.com/foo@sha256:abc", "unknown", "sbom.json")
+	if err == nil || err.Error() != "unsupported sbom format 'unknown'" {
+		t.Errorf("unexpected error '%v'", err)
+	}
+}
+
+func TestOrasAttachArgs(t *testing.T) {
+	args, err := orasAttachArgs("registry.example.com/foo@sha256:abc", "cyclonedx", "gipgee-sbom-foo.cdx.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"attach", "--artifact-type", "application/vnd.cyclonedx+json", "registry.example.com/foo@sha256:abc", "gipgee-sbom-foo.cdx.json:application/vnd.cyclonedx+json"}
+	if !cmp.Equal(args, expected) {
+		t.Errorf("given oras args '%v' don't match expected args '%v'", args, expected)
+	}
+}
+
+func TestGetSbomFileName(t *testing.T) {
+	if name := GetSbomFileName("foo", "cyclonedx"); name != "gipgee-sbom-foo.cdx.json" {
+		t.Errorf("unexpected sbom file name '%s'", name)
+	}
+	if name := GetSbomFileName("foo", "spdx"); name != "gipgee-sbom-foo.spdx.json" {
+		t.Errorf("unexpected sbom file name '%s'", name)
+	}
+}
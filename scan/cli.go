@@ -0,0 +1,123 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/docker"
+)
+
+type ScanCmd struct {
+	Image ImageCmd `cmd:""`
+}
+
+type ImageCmd struct {
+	ImageId        string `arg:""`
+	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	Digest         string `help:"Digest of the staging image" env:"GIPGEE_STAGING_IMAGE_DIGEST" optional:""`
+	ReportFile     string `help:"Write the gitlab container scanning report to this file" required:""`
+}
+
+func (*ImageCmd) Help() string {
+	return "Scan the staging image for vulnerabilities and fail if the findings exceed the configured thresholds. Used by the image build pipeline"
+}
+
+func getImageConfigWithScan(config *cfg.Config, imageId string) (*cfg.Image, error) {
+	imageConfig, exists := config.Images[imageId]
+	if !exists {
+		return nil, fmt.Errorf("image with id '%s' does not exist in the configuration", imageId)
+	}
+	if !imageConfig.VulnerabilityScan.IsEnabled() {
+		return nil, fmt.Errorf("vulnerability scan is not enabled for image '%s'", imageId)
+	}
+	return imageConfig, nil
+}
+
+// ScanImage scans the image with the given reference with the given tool (trivy or grype).
+// The location is only used to look up the registry credentials.
+func ScanImage(config *cfg.Config, tool string, reference string, location *cfg.ImageLocation) (*ScanResult, error) {
+	outputDir, err := os.MkdirTemp("", "gipgee-scan")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(outputDir)
+	}()
+	outputFile := filepath.Join(outputDir, tool+".json")
+
+	args, err := toolArgs(tool, reference, outputFile)
+	if err != nil {
+		return nil, err
+	}
+	authMap, err := config.GetRegistryAuthMap(location)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Scanning '%s' for vulnerabilities with %s\n", reference, tool)
+	_, err = docker.RunWithDockerConfig(authMap, nil, tool, args...)
+	if err != nil {
+		return nil, fmt.Errorf("vulnerability scan of '%s' failed: %w", reference, err)
+	}
+	output, err := os.ReadFile(outputFile) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	return parseToolOutput(tool, output)
+}
+
+func LogFindings(prefix string, findings []Finding) {
+	for _, finding := range findings {
+		fixedIn := "no fix available"
+		if finding.Fixable() {
+			fixedIn = "fixed in " + finding.FixedVersion
+		}
+		log.Printf("%s %s (%s) in %s %s, %s\n", prefix, finding.Id, finding.Severity, finding.PackageName, finding.InstalledVersion, fixedIn)
+	}
+}
+
+func (cmd *ImageCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	imageConfig, err := getImageConfigWithScan(config, cmd.ImageId)
+	if err != nil {
+		return err
+	}
+	if cmd.Digest == "" {
+		return fmt.Errorf("digest of the staging image of '%s' is not set", cmd.ImageId)
+	}
+	reference := imageConfig.StagingLocation.DigestReference(cmd.Digest)
+
+	startTime := time.Now()
+	result, err := ScanImage(config, *imageConfig.VulnerabilityScan.Tool, reference, imageConfig.StagingLocation)
+	if err != nil {
+		return err
+	}
+	report, err := json.MarshalIndent(createGitlabReport(result, reference, startTime, time.Now()), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(cmd.ReportFile, report, 0600)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote gitlab container scanning report to '%s'\n", cmd.ReportFile)
+
+	policy := imageConfig.VulnerabilityScan
+	evaluation := Evaluate(result, policy, time.Now())
+	LogFindings("Ignored:", evaluation.Ignored)
+	LogFindings("Accepted:", evaluation.Accepted)
+	LogFindings("❌ Blocking:", evaluation.Blocking)
+	log.Printf("%d findings: %d blocking, %d ignored, %d below the threshold (severity >= %s, fixable only: %t)\n",
+		len(result.Findings), len(evaluation.Blocking), len(evaluation.Ignored), len(evaluation.Accepted), *policy.Severity, policy.FixableOnly)
+	if len(evaluation.Blocking) > 0 {
+		return fmt.Errorf("staging image of '%s' has %d vulnerabilities exceeding the configured threshold, blocking the release", cmd.ImageId, len(evaluation.Blocking))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package scan
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+// Finding is a vulnerability found by one of the supported scanners, normalized
+// so that the policy evaluation and the gitlab report don't depend on the tool.
+type Finding struct {
+	Id               string
+	PackageName      string
+	InstalledVersion string
+	FixedVersion     string
+	Severity         string
+	Title            string
+	Description      string
+	Url              string
+}
+
+func (f *Finding) Fixable() bool {
+	return f.FixedVersion != ""
+}
+
+// ScanResult contains all findings of one scanned image.
+type ScanResult struct {
+	Tool            string
+	OperatingSystem string
+	Findings        []Finding
+}
+
+func severityRank(severity string) int {
+	for idx, s := range cfg.Severities {
+		if strings.EqualFold(s, severity) {
+			return idx
+		}
+	}
+	return 0 // unknown
+}
+
+// Evaluation is the result of applying the vulnerability scan policy of an image to a scan result.
+type Evaluation struct {
+	Blocking []Finding
+	Ignored  []Finding
+	Accepted []Finding
+}
+
+func isIgnored(finding Finding, policy *cfg.VulnerabilityScan, now time.Time) bool {
+	for _, ignored := range policy.Ignore {
+		if ignored.Id != finding.Id {
+			continue
+		}
+		if ignored.Expires != nil {
+			expires, err := time.Parse("2006-01-02", *ignored.Expires)
+			if err != nil {
+				panic(err) // validated while loading the configuration
+			}
+			// the ignore entry is valid until the end of the expiry day
+			if !now.Before(expires.AddDate(0, 0, 1)) {
+				log.Printf("Ignore entry for '%s' expired on %s, not ignoring it anymore\n", ignored.Id, *ignored.Expires)
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Evaluate sorts the findings into blocking, ignored and accepted findings, based on the given policy.
+func Evaluate(result *ScanResult, policy *cfg.VulnerabilityScan, now time.Time) Evaluation {
+	evaluation := Evaluation{}
+	threshold := severityRank(*policy.Severity)
+	for _, finding := range result.Findings {
+		if isIgnored(finding, policy, now) {
+			evaluation.Ignored = append(evaluation.Ignored, finding)
+		} else if severityRank(finding.Severity) >= threshold && (!policy.FixableOnly || finding.Fixable()) {
+			evaluation.Blocking = append(evaluation.Blocking, finding)
+		} else {
+			evaluation.Accepted = append(evaluation.Accepted, finding)
+		}
+	}
+	return evaluation
+}
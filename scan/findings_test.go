@@ -0,0 +1,85 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+func findingIds(findings []Finding) []string {
+	ids := make([]string, len(findings))
+	for idx, finding := range findings {
+		ids[idx] = finding.Id
+	}
+	return ids
+}
+
+func assertFindingIds(given []Finding, expected []string, t *testing.T) {
+	ids := findingIds(given)
+	if len(ids) != len(expected) {
+		t.Errorf("given findings '%v' don't match expected findings '%v'", ids, expected)
+		return
+	}
+	for idx := range ids {
+		if ids[idx] != expected[idx] {
+			t.Errorf("given findings '%v' don't match expected findings '%v'", ids, expected)
+			return
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	result := &ScanResult{
+		Findings: []Finding{
+			{Id: "CVE-1", Severity: "CRITICAL", FixedVersion: "1.1"},
+			{Id: "CVE-2", Severity: "CRITICAL"},
+			{Id: "CVE-3", Severity: "MEDIUM", FixedVersion: "1.1"},
+			{Id: "CVE-4", Severity: "HIGH", FixedVersion: "1.1"},
+			{Id: "CVE-5", Severity: "HIGH", FixedVersion: "1.1"},
+		},
+	}
+	policy := &cfg.VulnerabilityScan{
+		Severity:    &[]string{"HIGH"}[0],
+		FixableOnly: true,
+		Ignore: []cfg.IgnoredVulnerability{
+			{Id: "CVE-4", Expires: &[]string{"2026-10-19"}[0]},
+			{Id: "CVE-5", Expires: &[]string{"2026-10-18"}[0]},
+		},
+	}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	evaluation := Evaluate(result, policy, now)
+	assertFindingIds(evaluation.Blocking, []string{"CVE-1", "CVE-5"}, t)
+	assertFindingIds(evaluation.Ignored, []string{"CVE-4"}, t)
+	assertFindingIds(evaluation.Accepted, []string{"CVE-2", "CVE-3"}, t)
+
+	policy.FixableOnly = false
+	policy.Severity = &[]string{"MEDIUM"}[0]
+	evaluation = Evaluate(result, policy, now)
+	assertFindingIds(evaluation.Blocking, []string{"CVE-1", "CVE-2", "CVE-3", "CVE-5"}, t)
+}
+
+func TestCreateGitlabReport(t *testing.T) {
+	result, err := parseToolOutput("trivy", []byte(trivySampleOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	report := createGitlabReport(result, "registry.example.com/foo@sha256:abc", start, start.Add(time.Minute))
+	if report.Scan.Type != "container_scanning" || report.Scan.StartTime != "2026-10-19T12:00:00" || report.Scan.EndTime != "2026-10-19T12:01:00" {
+		t.Errorf("unexpected scan section %+v", report.Scan)
+	}
+	if len(report.Vulnerabilities) != 2 {
+		t.Fatalf("expected 2 vulnerabilities, got %d", len(report.Vulnerabilities))
+	}
+	vulnerability := report.Vulnerabilities[0]
+	if vulnerability.Severity != "High" || vulnerability.Identifiers[0].Type != "cve" || vulnerability.Solution != "Upgrade openssl from 3.1.3-r0 to 3.1.4-r0" {
+		t.Errorf("unexpected vulnerability %+v", vulnerability)
+	}
+	if vulnerability.Location.OperatingSystem != "alpine 3.18.4" || vulnerability.Location.Dependency.Package.Name != "openssl" {
+		t.Errorf("unexpected location %+v", vulnerability.Location)
+	}
+	if report.Vulnerabilities[0].Id == report.Vulnerabilities[1].Id {
+		t.Error("vulnerability ids must be unique")
+	}
+}
@@ -0,0 +1,154 @@
+package scan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// See https://gitlab.com/gitlab-org/security-products/security-report-schemas (container-scanning-report-format.json)
+const (
+	gitlabReportSchemaVersion = "15.0.7"
+	gitlabReportTimeFormat    = "2006-01-02T15:04:05"
+)
+
+type gitlabReport struct {
+	Version         string                `json:"version"`
+	Vulnerabilities []gitlabVulnerability `json:"vulnerabilities"`
+	Scan            gitlabScan            `json:"scan"`
+}
+
+type gitlabVulnerability struct {
+	Id          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Severity    string             `json:"severity"`
+	Solution    string             `json:"solution,omitempty"`
+	Identifiers []gitlabIdentifier `json:"identifiers"`
+	Links       []gitlabLink       `json:"links,omitempty"`
+	Location    gitlabLocation     `json:"location"`
+}
+
+type gitlabIdentifier struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Url   string `json:"url,omitempty"`
+}
+
+type gitlabLink struct {
+	Url string `json:"url"`
+}
+
+type gitlabLocation struct {
+	Dependency      gitlabDependency `json:"dependency"`
+	OperatingSystem string           `json:"operating_system"`
+	Image           string           `json:"image"`
+}
+
+type gitlabDependency struct {
+	Package struct {
+		Name string `json:"name"`
+	} `json:"package"`
+	Version string `json:"version"`
+}
+
+type gitlabScanTool struct {
+	Id      string `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Vendor  struct {
+		Name string `json:"name"`
+	} `json:"vendor"`
+}
+
+type gitlabScan struct {
+	Analyzer  gitlabScanTool `json:"analyzer"`
+	Scanner   gitlabScanTool `json:"scanner"`
+	Type      string         `json:"type"`
+	StartTime string         `json:"start_time"`
+	EndTime   string         `json:"end_time"`
+	Status    string         `json:"status"`
+}
+
+func newGitlabScanTool(id string, version string, vendor string) gitlabScanTool {
+	tool := gitlabScanTool{Id: id, Name: id, Version: version}
+	tool.Vendor.Name = vendor
+	return tool
+}
+
+// gitlabSeverity maps the normalized severity to the severities allowed in the gitlab report.
+func gitlabSeverity(severity string) string {
+	switch severity {
+	case "CRITICAL":
+		return "Critical"
+	case "HIGH":
+		return "High"
+	case "MEDIUM":
+		return "Medium"
+	case "LOW":
+		return "Low"
+	case "NEGLIGIBLE":
+		return "Info"
+	}
+	return "Unknown"
+}
+
+func identifierType(id string) string {
+	if strings.HasPrefix(id, "CVE-") {
+		return "cve"
+	}
+	if strings.HasPrefix(id, "GHSA-") {
+		return "ghsa"
+	}
+	return strings.ToLower(strings.SplitN(id, "-", 2)[0])
+}
+
+func createGitlabReport(result *ScanResult, image string, startTime time.Time, endTime time.Time) gitlabReport {
+	report := gitlabReport{
+		Version:         gitlabReportSchemaVersion,
+		Vulnerabilities: make([]gitlabVulnerability, 0, len(result.Findings)),
+		Scan: gitlabScan{
+			Analyzer:  newGitlabScanTool("gipgee", "1", "gipgee"),
+			Scanner:   newGitlabScanTool(result.Tool, "unknown", result.Tool),
+			Type:      "container_scanning",
+			StartTime: startTime.UTC().Format(gitlabReportTimeFormat),
+			EndTime:   endTime.UTC().Format(gitlabReportTimeFormat),
+			Status:    "success",
+		},
+	}
+	for _, finding := range result.Findings {
+		idHash := sha256.Sum256([]byte(image + "|" + finding.Id + "|" + finding.PackageName + "|" + finding.InstalledVersion))
+		vulnerability := gitlabVulnerability{
+			Id:          hex.EncodeToString(idHash[:]),
+			Name:        finding.Id,
+			Description: finding.Description,
+			Severity:    gitlabSeverity(finding.Severity),
+			Identifiers: []gitlabIdentifier{{
+				Type:  identifierType(finding.Id),
+				Name:  finding.Id,
+				Value: finding.Id,
+				Url:   finding.Url,
+			}},
+			Location: gitlabLocation{
+				OperatingSystem: result.OperatingSystem,
+				Image:           image,
+			},
+		}
+		if finding.Title != "" && finding.Title != finding.Id {
+			vulnerability.Name = fmt.Sprintf("%s: %s", finding.Id, finding.Title)
+		}
+		if finding.Fixable() {
+			vulnerability.Solution = fmt.Sprintf("Upgrade %s from %s to %s", finding.PackageName, finding.InstalledVersion, finding.FixedVersion)
+		}
+		if finding.Url != "" {
+			vulnerability.Links = []gitlabLink{{Url: finding.Url}}
+		}
+		vulnerability.Location.Dependency.Package.Name = finding.PackageName
+		vulnerability.Location.Dependency.Version = finding.InstalledVersion
+		report.Vulnerabilities = append(report.Vulnerabilities, vulnerability)
+	}
+	return report
+}
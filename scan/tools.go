@@ -0,0 +1,144 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	cfg "github.com/devfbe/gipgee/config"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+)
+
+func toolArgs(tool string, reference string, outputFile string) ([]string, error) {
+	switch tool {
+	case cfg.ScanToolTrivy:
+		return []string{"image", "--format", "json", "--output", outputFile, reference}, nil
+	case cfg.ScanToolGrype:
+		return []string{"registry:" + reference, "-o", "json", "--file", outputFile}, nil
+	}
+	return nil, fmt.Errorf("unsupported vulnerability scan tool '%s'", tool)
+}
+
+func parseToolOutput(tool string, output []byte) (*ScanResult, error) {
+	switch tool {
+	case cfg.ScanToolTrivy:
+		return parseTrivyOutput(output)
+	case cfg.ScanToolGrype:
+		return parseGrypeOutput(output)
+	}
+	return nil, fmt.Errorf("unsupported vulnerability scan tool '%s'", tool)
+}
+
+type trivyOutput struct {
+	Metadata struct {
+		OS struct {
+			Family string `json:"Family"`
+			Name   string `json:"Name"`
+		} `json:"OS"`
+	} `json:"Metadata"`
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+			Description      string `json:"Description"`
+			PrimaryURL       string `json:"PrimaryURL"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+func parseTrivyOutput(output []byte) (*ScanResult, error) {
+	parsed := trivyOutput{}
+	err := json.Unmarshal(output, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse trivy output: %w", err)
+	}
+	result := ScanResult{
+		Tool:            cfg.ScanToolTrivy,
+		OperatingSystem: strings.TrimSpace(parsed.Metadata.OS.Family + " " + parsed.Metadata.OS.Name),
+		Findings:        make([]Finding, 0),
+	}
+	for _, r := range parsed.Results {
+		for _, v := range r.Vulnerabilities {
+			result.Findings = append(result.Findings, Finding{
+				Id:               v.VulnerabilityID,
+				PackageName:      v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         strings.ToUpper(v.Severity),
+				Title:            v.Title,
+				Description:      v.Description,
+				Url:              v.PrimaryURL,
+			})
+		}
+	}
+	return &result, nil
+}
+
+type grypeOutput struct {
+	Distro struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"distro"`
+	Matches []struct {
+		Vulnerability struct {
+			Id          string   `json:"id"`
+			Severity    string   `json:"severity"`
+			Description string   `json:"description"`
+			DataSource  string   `json:"dataSource"`
+			Urls        []string `json:"urls"`
+			Fix         struct {
+				Versions []string `json:"versions"`
+				State    string   `json:"state"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+func parseGrypeOutput(output []byte) (*ScanResult, error) {
+	parsed := grypeOutput{}
+	err := json.Unmarshal(output, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse grype output: %w", err)
+	}
+	result := ScanResult{
+		Tool:            cfg.ScanToolGrype,
+		OperatingSystem: strings.TrimSpace(parsed.Distro.Name + " " + parsed.Distro.Version),
+		Findings:        make([]Finding, 0),
+	}
+	for _, m := range parsed.Matches {
+		finding := Finding{
+			Id:               m.Vulnerability.Id,
+			PackageName:      m.Artifact.Name,
+			InstalledVersion: m.Artifact.Version,
+			Severity:         strings.ToUpper(m.Vulnerability.Severity),
+			Title:            m.Vulnerability.Id,
+			Description:      m.Vulnerability.Description,
+			Url:              m.Vulnerability.DataSource,
+		}
+		if m.Vulnerability.Fix.State == "fixed" && len(m.Vulnerability.Fix.Versions) > 0 {
+			finding.FixedVersion = strings.Join(m.Vulnerability.Fix.Versions, ", ")
+		}
+		if finding.Url == "" && len(m.Vulnerability.Urls) > 0 {
+			finding.Url = m.Vulnerability.Urls[0]
+		}
+		result.Findings = append(result.Findings, finding)
+	}
+	return &result, nil
+}
+
+// GetToolImage returns the container image providing the given scan tool.
+func GetToolImage(tool string) *pm.ContainerImageCoordinates {
+	if tool == cfg.ScanToolGrype {
+		return &cfg.GrypeImage
+	}
+	return &cfg.TrivyImage
+}
@@ -0,0 +1,70 @@
+package scan
+
+import (
+	"testing"
+)
+
+const trivySampleOutput = `{
+  "SchemaVersion": 2,
+  "ArtifactName": "registry.example.com/foo@sha256:abc",
+  "Metadata": {"OS": {"Family": "alpine", "Name": "3.18.4"}},
+  "Results": [{
+    "Target": "registry.example.com/foo@sha256:abc (alpine 3.18.4)",
+    "Vulnerabilities": [
+      {"VulnerabilityID": "CVE-2023-0001", "PkgName": "openssl", "InstalledVersion": "3.1.3-r0", "FixedVersion": "3.1.4-r0", "Severity": "HIGH", "Title": "openssl: bad things", "PrimaryURL": "https://avd.aquasec.com/nvd/cve-2023-0001"},
+      {"VulnerabilityID": "CVE-2023-0002", "PkgName": "busybox", "InstalledVersion": "1.36.1-r2", "Severity": "CRITICAL"}
+    ]
+  }]
+}`
+
+const grypeSampleOutput = `{
+  "matches": [
+    {"vulnerability": {"id": "CVE-2023-0001", "severity": "High", "dataSource": "https://nvd.nist.gov/vuln/detail/CVE-2023-0001", "fix": {"versions": ["3.1.4-r0"], "state": "fixed"}}, "artifact": {"name": "openssl", "version": "3.1.3-r0"}},
+    {"vulnerability": {"id": "GHSA-xxxx-yyyy-zzzz", "severity": "Medium", "urls": ["https://github.com/advisories/GHSA-xxxx-yyyy-zzzz"], "fix": {"versions": [], "state": "not-fixed"}}, "artifact": {"name": "golang.org/x/net", "version": "v0.1.0"}}
+  ],
+  "distro": {"name": "alpine", "version": "3.18.4"}
+}`
+
+func TestParseTrivyOutput(t *testing.T) {
+	result, err := parseToolOutput("trivy", []byte(trivySampleOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OperatingSystem != "alpine 3.18.4" {
+		t.Errorf("unexpected operating system '%s'", result.OperatingSystem)
+	}
+	if len(result.Findings) != 2 {
+		t.Fatalf("expected 2 findings, got %d", len(result.Findings))
+	}
+	if !result.Findings[0].Fixable() || result.Findings[0].FixedVersion != "3.1.4-r0" {
+		t.Errorf("first finding should be fixable in 3.1.4-r0: %+v", result.Findings[0])
+	}
+	if result.Findings[1].Fixable() || result.Findings[1].Severity != "CRITICAL" {
+		t.Errorf("second finding should be a critical finding without fix: %+v", result.Findings[1])
+	}
+}
+
+func TestParseGrypeOutput(t *testing.T) {
+	result, err := parseToolOutput("grype", []byte(grypeSampleOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Findings) != 2 {
+		t.Fatalf("expected 2 findings, got %d", len(result.Findings))
+	}
+	first := result.Findings[0]
+	if first.Id != "CVE-2023-0001" || first.Severity != "HIGH" || first.FixedVersion != "3.1.4-r0" || first.PackageName != "openssl" {
+		t.Errorf("unexpected first finding %+v", first)
+	}
+	second := result.Findings[1]
+	if second.Fixable() || second.Url != "https://github.com/advisories/GHSA-xxxx-yyyy-zzzz" {
+		t.Errorf("unexpected second finding %+v", second)
+	}
+}
+
+func TestToolArgs(t *testing.T) {
+	_, err := toolArgs("clair", "foo", "bar")
+	if err == nil || err.Error() != "unsupported vulnerability scan tool 'clair'" {
+		t.Errorf("unexpected error '%v'", err)
+	}
+}
@@ -0,0 +1,155 @@
+package signing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+const (
+	// BaseImageDigestVarName is the dotenv variable containing the verified base image digest.
+	// The image build uses this digest instead of the base image tag, so that the image is built
+	// on exactly the base image that has been verified.
+	BaseImageDigestVarName = "GIPGEE_BASE_IMAGE_DIGEST"
+	// BaseImageVerifiedByVarName is the dotenv variable naming the signer that was accepted.
+	BaseImageVerifiedByVarName = "GIPGEE_BASE_IMAGE_VERIFIED_BY"
+)
+
+type VerifyBaseImageCmd struct {
+	ImageId        string `arg:""`
+	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	DotenvFile     string `help:"Write the verified base image digest as dotenv file to this path" required:""`
+}
+
+func (*VerifyBaseImageCmd) Help() string {
+	return "Only for gipgee internal use in the image build pipeline. Verifies the base image signature and fails if no trusted signature exists"
+}
+
+type cosignVerificationOutput struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// trustedSigner is one public key or certificate identity the base image may be signed with.
+type trustedSigner struct {
+	description string
+	args        []string
+	env         map[string]string
+}
+
+func cosignKeylessVerifyArgs(reference string, identity cfg.CertificateIdentity) []string {
+	args := []string{"verify"}
+	if identity.Identity != nil {
+		args = append(args, "--certificate-identity", *identity.Identity)
+	} else {
+		args = append(args, "--certificate-identity-regexp", *identity.IdentityRegexp)
+	}
+	if identity.Issuer != nil {
+		args = append(args, "--certificate-oidc-issuer", *identity.Issuer)
+	} else {
+		args = append(args, "--certificate-oidc-issuer-regexp", *identity.IssuerRegexp)
+	}
+	return append(args, reference)
+}
+
+func describeCertificateIdentity(identity cfg.CertificateIdentity) string {
+	var who, issuer string
+	if identity.Identity != nil {
+		who = *identity.Identity
+	} else {
+		who = "~" + *identity.IdentityRegexp
+	}
+	if identity.Issuer != nil {
+		issuer = *identity.Issuer
+	} else {
+		issuer = "~" + *identity.IssuerRegexp
+	}
+	return fmt.Sprintf("certificate:%s@%s", who, issuer)
+}
+
+func getTrustedSigners(config *cfg.Config, reference string, verify *cfg.SignatureVerification) ([]trustedSigner, error) {
+	signers := make([]trustedSigner, 0, len(verify.PublicKeys)+len(verify.CertificateIdentities))
+	for _, keyId := range verify.PublicKeys {
+		publicKey, err := config.GetSigningPublicKey(keyId)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, trustedSigner{
+			description: "key:" + keyId,
+			args:        cosignVerifyArgs(reference, verify.TransparencyLog),
+			env:         map[string]string{cosignPublicKeyVarName: publicKey},
+		})
+	}
+	for _, identity := range verify.CertificateIdentities {
+		signers = append(signers, trustedSigner{
+			description: describeCertificateIdentity(identity),
+			args:        cosignKeylessVerifyArgs(reference, identity),
+		})
+	}
+	return signers, nil
+}
+
+func parseVerifiedDigest(cosignOutput []byte) (string, error) {
+	verifications := make([]cosignVerificationOutput, 0)
+	err := json.Unmarshal(cosignOutput, &verifications)
+	if err != nil {
+		return "", fmt.Errorf("could not parse cosign verify output: %w", err)
+	}
+	if len(verifications) == 0 {
+		return "", errors.New("cosign verify output contains no verified signature")
+	}
+	digest := verifications[0].Critical.Image.DockerManifestDigest
+	if !strings.HasPrefix(digest, "sha256:") {
+		return "", fmt.Errorf("unexpected digest '%s' in cosign verify output", digest)
+	}
+	return digest, nil
+}
+
+func (cmd *VerifyBaseImageCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	imageConfig, exists := config.Images[cmd.ImageId]
+	if !exists {
+		return fmt.Errorf("image with id '%s' does not exist in the configuration", cmd.ImageId)
+	}
+	verify := imageConfig.BaseImage.Verify
+	if verify == nil {
+		return fmt.Errorf("base image verification is not configured for image '%s'", cmd.ImageId)
+	}
+	reference := imageConfig.BaseImage.String()
+	authMap, err := config.GetRegistryAuthMap(imageConfig.BaseImage)
+	if err != nil {
+		return err
+	}
+	signers, err := getTrustedSigners(config, reference, verify)
+	if err != nil {
+		return err
+	}
+
+	for _, signer := range signers {
+		log.Printf("Verifying base image '%s' of image '%s' with trusted signer '%s'\n", reference, cmd.ImageId, signer.description)
+		output, err := runCosign(signer.args, signer.env, authMap)
+		if err != nil {
+			log.Printf("No valid signature of trusted signer '%s' found (%v)\n", signer.description, err)
+			continue
+		}
+		digest, err := parseVerifiedDigest(output)
+		if err != nil {
+			return err
+		}
+		log.Printf("✅ Base image '%s' (digest '%s') has a valid signature of trusted signer '%s'\n", reference, digest, signer.description)
+		dotenv := fmt.Sprintf("%s=%s\n%s=%s\n", BaseImageDigestVarName, digest, BaseImageVerifiedByVarName, signer.description)
+		return os.WriteFile(cmd.DotenvFile, []byte(dotenv), 0600)
+	}
+	return fmt.Errorf("❌ base image '%s' of image '%s' has no valid signature of any trusted signer, refusing to build", reference, cmd.ImageId)
+}
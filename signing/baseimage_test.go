@@ -0,0 +1,41 @@
+package signing
+
+import (
+	"testing"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseVerifiedDigest(t *testing.T) {
+	output := `[{"critical":{"identity":{"docker-reference":"docker.io/library/alpine"},"image":{"docker-manifest-digest":"sha256:0123"},"type":"cosign container image signature"},"optional":null}]`
+	digest, err := parseVerifiedDigest([]byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "sha256:0123" {
+		t.Errorf("given digest '%s' doesn't match expected digest 'sha256:0123'", digest)
+	}
+
+	_, err = parseVerifiedDigest([]byte("[]"))
+	if err == nil || err.Error() != "cosign verify output contains no verified signature" {
+		t.Errorf("unexpected error '%v'", err)
+	}
+}
+
+func TestCosignKeylessVerifyArgs(t *testing.T) {
+	identity := "https://github.com/foo/bar/.github/workflows/release.yml@refs/heads/main"
+	issuerRegexp := "^https://token.actions.githubusercontent.com$"
+	certificateIdentity := cfg.CertificateIdentity{Identity: &identity, IssuerRegexp: &issuerRegexp}
+
+	expected := []string{"verify", "--certificate-identity", identity, "--certificate-oidc-issuer-regexp", issuerRegexp, "docker.io/foo/bar:latest"}
+	given := cosignKeylessVerifyArgs("docker.io/foo/bar:latest", certificateIdentity)
+	if !cmp.Equal(given, expected) {
+		t.Errorf("given args '%v' don't match expected args '%v'", given, expected)
+	}
+
+	expectedDescription := "certificate:" + identity + "@~" + issuerRegexp
+	if description := describeCertificateIdentity(certificateIdentity); description != expectedDescription {
+		t.Errorf("given description '%s' doesn't match expected description '%s'", description, expectedDescription)
+	}
+}
@@ -0,0 +1,132 @@
+package signing
+
+import (
+	"fmt"
+	"log"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+type SignCmd struct {
+	ImageId        string `arg:""`
+	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	Digest         string `help:"Digest of the image to sign" required:"" env:"GIPGEE_STAGING_IMAGE_DIGEST"`
+	Target         string `help:"Sign the image in the staging location or in all release locations" enum:"staging,release" default:"release"`
+}
+
+func (*SignCmd) Help() string {
+	return "Sign the image digest in the staging or release locations with cosign. Used by the image build pipeline"
+}
+
+type VerifyCmd struct {
+	ImageId        string `arg:""`
+	ConfigFileName string `help:"Set the name of the gipgee config file" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
+	Digest         string `help:"Digest of the image to verify. If not set, the tag of the location is verified" env:"GIPGEE_STAGING_IMAGE_DIGEST" optional:""`
+	Target         string `help:"Verify the image in the staging location or in all release locations" enum:"staging,release" default:"release"`
+}
+
+func (*VerifyCmd) Help() string {
+	return "Verify the cosign signature of the image in the staging or release locations"
+}
+
+func getTargetLocations(imageConfig *cfg.Image, target string) []*cfg.ImageLocation {
+	if target == "staging" {
+		return []*cfg.ImageLocation{imageConfig.StagingLocation}
+	}
+	// locations without release tags (semver tag strategy outside of tag pipelines) are not released
+	locations := make([]*cfg.ImageLocation, 0, len(imageConfig.ReleaseLocations))
+	for _, location := range imageConfig.ReleaseLocations {
+		if len(location.ReleaseTags) > 0 {
+			locations = append(locations, location)
+		}
+	}
+	return locations
+}
+
+func getImageConfigWithSigning(config *cfg.Config, imageId string) (*cfg.Image, error) {
+	imageConfig, exists := config.Images[imageId]
+	if !exists {
+		return nil, fmt.Errorf("image with id '%s' does not exist in the configuration", imageId)
+	}
+	if imageConfig.Signing == nil {
+		return nil, fmt.Errorf("signing is not configured for image '%s'", imageId)
+	}
+	return imageConfig, nil
+}
+
+func (cmd *SignCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	imageConfig, err := getImageConfigWithSigning(config, cmd.ImageId)
+	if err != nil {
+		return err
+	}
+	key, err := config.GetSigningPrivateKey(*imageConfig.Signing.Key)
+	if err != nil {
+		return err
+	}
+	locations := getTargetLocations(imageConfig, cmd.Target)
+	authMap, err := config.GetRegistryAuthMap(locations...)
+	if err != nil {
+		return err
+	}
+	env := map[string]string{
+		cosignPrivateKeyVarName: key.PrivateKey,
+		cosignPasswordVarName:   key.Password,
+	}
+	for _, location := range locations {
+		reference := location.DigestReference(cmd.Digest)
+		log.Printf("Signing '%s' with signing key '%s'\n", reference, *imageConfig.Signing.Key)
+		_, err := runCosign(cosignSignArgs(reference, imageConfig.Signing.TransparencyLog), env, authMap)
+		if err != nil {
+			return fmt.Errorf("signing '%s' failed: %w", reference, err)
+		}
+	}
+	return nil
+}
+
+func (cmd *VerifyCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	imageConfig, err := getImageConfigWithSigning(config, cmd.ImageId)
+	if err != nil {
+		return err
+	}
+	publicKey, err := config.GetSigningPublicKey(*imageConfig.Signing.Key)
+	if err != nil {
+		return err
+	}
+	locations := getTargetLocations(imageConfig, cmd.Target)
+	authMap, err := config.GetRegistryAuthMap(locations...)
+	if err != nil {
+		return err
+	}
+	env := map[string]string{
+		cosignPublicKeyVarName: publicKey,
+	}
+	for _, location := range locations {
+		reference := location.String()
+		if cmd.Digest != "" {
+			reference = location.DigestReference(cmd.Digest)
+		}
+		log.Printf("Verifying signature of '%s' with signing key '%s'\n", reference, *imageConfig.Signing.Key)
+		output, err := runCosign(cosignVerifyArgs(reference, imageConfig.Signing.TransparencyLog), env, authMap)
+		if err != nil {
+			return fmt.Errorf("signature verification of '%s' failed: %w", reference, err)
+		}
+		// the exit code alone is not trusted, the verified signature must cover the image that is released
+		digest, err := parseVerifiedDigest(output)
+		if err != nil {
+			return fmt.Errorf("signature verification of '%s' failed: %w", reference, err)
+		}
+		if cmd.Digest != "" && digest != cmd.Digest {
+			return fmt.Errorf("signature verification of '%s' failed: verified signature is for digest '%s'", reference, digest)
+		}
+		log.Printf("Signature of '%s' is valid\n", reference)
+	}
+	return nil
+}
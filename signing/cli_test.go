@@ -0,0 +1,285 @@
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCosignVarName makes the test binary act as cosign, see TestMain.
+const fakeCosignVarName = "GIPGEE_TEST_FAKE_COSIGN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeCosignVarName) == "1" {
+		if err := runFakeCosign(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeSignature is what the fake cosign stores in the registry instead of a real signature manifest.
+type fakeSignature struct {
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// runFakeCosign signs and verifies like cosign with a key pair, but stores the signature as a plain
+// manifest at the signature tag cosign uses. The registry is accessed with the auth from DOCKER_CONFIG.
+func runFakeCosign(args []string) error {
+	if len(args) < 4 || args[1] != "--key" || !strings.HasPrefix(args[2], "env://") {
+		return fmt.Errorf("unexpected cosign args %v", args)
+	}
+	key := os.Getenv(strings.TrimPrefix(args[2], "env://"))
+	reference := args[len(args)-1]
+	repositoryReference, digest, found := strings.Cut(reference, "@")
+	if !found {
+		return fmt.Errorf("reference '%s' has no digest", reference)
+	}
+	host, repository, _ := strings.Cut(repositoryReference, "/")
+	signatureUrl := fmt.Sprintf("http://%s/v2/%s/manifests/%s.sig", host, repository, strings.Replace(digest, ":", "-", 1))
+	auth, err := readFakeCosignAuth(host)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "sign":
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return errors.New("private key is not pem encoded")
+		}
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		payload := fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, repositoryReference, digest)
+		hash := sha256.Sum256([]byte(payload))
+		signature, err := ecdsa.SignASN1(rand.Reader, privateKey.(*ecdsa.PrivateKey), hash[:])
+		if err != nil {
+			return err
+		}
+		body, err := json.Marshal(fakeSignature{Payload: payload, Signature: base64.StdEncoding.EncodeToString(signature)})
+		if err != nil {
+			return err
+		}
+		_, err = fakeCosignRequest(http.MethodPut, signatureUrl, auth, body)
+		return err
+	case "verify":
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return errors.New("public key is not pem encoded")
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		body, err := fakeCosignRequest(http.MethodGet, signatureUrl, auth, nil)
+		if err != nil {
+			return err
+		}
+		stored := fakeSignature{}
+		if err := json.Unmarshal(body, &stored); err != nil {
+			return err
+		}
+		signature, err := base64.StdEncoding.DecodeString(stored.Signature)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256([]byte(stored.Payload))
+		if !ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), hash[:], signature) {
+			return errors.New("no matching signatures: invalid signature when validating ASN.1 encoded signature")
+		}
+		fmt.Printf("[%s]\n", stored.Payload)
+		return nil
+	}
+	return fmt.Errorf("unexpected cosign command '%s'", args[0])
+}
+
+func readFakeCosignAuth(host string) (string, error) {
+	configJson, err := os.ReadFile(filepath.Join(os.Getenv("DOCKER_CONFIG"), "config.json"))
+	if err != nil {
+		return "", err
+	}
+	config := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	if err := json.Unmarshal(configJson, &config); err != nil {
+		return "", err
+	}
+	return config.Auths[host].Auth, nil
+}
+
+func fakeCosignRequest(method string, url string, auth string, body []byte) ([]byte, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = strings.NewReader(string(body))
+	}
+	request, err := http.NewRequest(method, url, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Basic "+auth)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s returned %s", method, url, response.Status)
+	}
+	return responseBody, nil
+}
+
+// newFakeRegistry stores the manifests that are pushed and requires the given basic auth credentials.
+func newFakeRegistry(t *testing.T, username string, password string) *httptest.Server {
+	manifests := make(map[string][]byte)
+	lock := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != username || pass != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			manifests[r.URL.Path] = body
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			manifest, exists := manifests[r.URL.Path]
+			if !exists {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(manifest)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func generateKeyPair(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKey})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))
+}
+
+func TestSignAndVerifyStagingImage(t *testing.T) {
+	registryServer := newFakeRegistry(t, "gipgee", "secret")
+	registryHost := strings.TrimPrefix(registryServer.URL, "http://")
+	configFileName := filepath.Join(t.TempDir(), "gipgee.yml")
+	config := strings.ReplaceAll(`
+version: 1
+registryCredentials:
+  staging:
+    usernameVarName: GIPGEE_TEST_REGISTRY_USER
+    passwordVarName: GIPGEE_TEST_REGISTRY_PASSWORD
+signingKeys:
+  test:
+    privateKeyVarName: GIPGEE_TEST_COSIGN_PRIVATE_KEY
+    publicKeyVarName: GIPGEE_TEST_COSIGN_PUBLIC_KEY
+images:
+  foo:
+    containerFile: Containerfile
+    baseImage:
+      registry: docker.io
+      repository: alpine
+      tag: latest
+    stagingLocation:
+      registry: XXXREGISTRYXXX
+      repository: gipgee/foo
+      tag: staging
+      credentials: staging
+    releaseLocations:
+      - registry: docker.io
+        repository: devfbe/gipgee-test
+        tag: latest
+    updateCheckCommand: ["gipgee", "update-check"]
+    testCommand: ["./testImage.sh"]
+    assetsToWatch: []
+    signing:
+      key: test
+      verifyStagingImage: true
+`, "XXXREGISTRYXXX", registryHost)
+	if err := os.WriteFile(configFileName, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, publicKey := generateKeyPair(t)
+	_, wrongPublicKey := generateKeyPair(t)
+	cosignExecutable = os.Args[0]
+	t.Cleanup(func() { cosignExecutable = "cosign" })
+	t.Setenv(fakeCosignVarName, "1")
+	t.Setenv("GIPGEE_TEST_REGISTRY_USER", "gipgee")
+	t.Setenv("GIPGEE_TEST_REGISTRY_PASSWORD", "secret")
+	t.Setenv("GIPGEE_TEST_COSIGN_PRIVATE_KEY", privateKey)
+	t.Setenv("GIPGEE_TEST_COSIGN_PUBLIC_KEY", publicKey)
+
+	digest := "sha256:" + hex.EncodeToString(make([]byte, 32))
+	signCmd := SignCmd{ImageId: "foo", ConfigFileName: configFileName, Digest: digest, Target: "staging"}
+	if err := signCmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	verifyCmd := VerifyCmd{ImageId: "foo", ConfigFileName: configFileName, Digest: digest, Target: "staging"}
+	if err := verifyCmd.Run(); err != nil {
+		t.Fatalf("verification of the signed staging image failed: %v", err)
+	}
+
+	// an image signed with another key must not be released
+	t.Setenv("GIPGEE_TEST_COSIGN_PUBLIC_KEY", wrongPublicKey)
+	err := verifyCmd.Run()
+	expectedPrefix := fmt.Sprintf("signature verification of '%s/gipgee/foo@%s' failed", registryHost, digest)
+	if err == nil || !strings.HasPrefix(err.Error(), expectedPrefix) {
+		t.Errorf("error is '%v' but should start with '%s'", err, expectedPrefix)
+	}
+
+	// the signature of another digest doesn't verify the image that is released
+	t.Setenv("GIPGEE_TEST_COSIGN_PUBLIC_KEY", publicKey)
+	verifyCmd.Digest = "sha256:" + strings.Repeat("f", 64)
+	if err := verifyCmd.Run(); err == nil {
+		t.Error("verification of an unsigned digest must fail")
+	}
+}
@@ -0,0 +1,41 @@
+package signing
+
+import (
+	"fmt"
+
+	"github.com/devfbe/gipgee/docker"
+)
+
+const (
+	// The key material is passed to cosign via env vars of the cosign process so
+	// that it never shows up in the process list or on the disk.
+	cosignPrivateKeyVarName = "GIPGEE_COSIGN_PRIVATE_KEY" // #nosec G101
+	cosignPublicKeyVarName  = "GIPGEE_COSIGN_PUBLIC_KEY"  // #nosec G101
+	cosignPasswordVarName   = "COSIGN_PASSWORD"           // #nosec G101
+)
+
+// cosignExecutable is the cosign binary that is run, the tests replace it with a fake.
+var cosignExecutable = "cosign"
+
+func cosignSignArgs(reference string, transparencyLog bool) []string {
+	return []string{
+		"sign",
+		"--key", "env://" + cosignPrivateKeyVarName,
+		"--yes",
+		fmt.Sprintf("--tlog-upload=%t", transparencyLog),
+		reference,
+	}
+}
+
+func cosignVerifyArgs(reference string, transparencyLog bool) []string {
+	return []string{
+		"verify",
+		"--key", "env://" + cosignPublicKeyVarName,
+		fmt.Sprintf("--insecure-ignore-tlog=%t", !transparencyLog),
+		reference,
+	}
+}
+
+func runCosign(args []string, additionalEnv map[string]string, authMap map[string]docker.UsernamePassword) ([]byte, error) {
+	return docker.RunWithDockerConfig(authMap, additionalEnv, cosignExecutable, args...)
+}
@@ -0,0 +1,29 @@
+package signing
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCosignSignArgs(t *testing.T) {
+	expected := []string{"sign", "--key", "env://GIPGEE_COSIGN_PRIVATE_KEY", "--yes", "--tlog-upload=false", "registry.example.com/foo@sha256:abc"}
+	given := cosignSignArgs("registry.example.com/foo@sha256:abc", false)
+	if !cmp.Equal(given, expected) {
+		t.Errorf("given cosign sign args '%v' don't match expected args '%v'", given, expected)
+	}
+}
+
+func TestCosignVerifyArgs(t *testing.T) {
+	expected := []string{"verify", "--key", "env://GIPGEE_COSIGN_PUBLIC_KEY", "--insecure-ignore-tlog=true", "registry.example.com/foo@sha256:abc"}
+	given := cosignVerifyArgs("registry.example.com/foo@sha256:abc", false)
+	if !cmp.Equal(given, expected) {
+		t.Errorf("given cosign verify args '%v' don't match expected args '%v'", given, expected)
+	}
+
+	expected[3] = "--insecure-ignore-tlog=false"
+	given = cosignVerifyArgs("registry.example.com/foo@sha256:abc", true)
+	if !cmp.Equal(given, expected) {
+		t.Errorf("given cosign verify args '%v' don't match expected args '%v'", given, expected)
+	}
+}
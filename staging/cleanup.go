@@ -0,0 +1,221 @@
+package staging
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/registry"
+)
+
+// MinimumAge protects staging images of pipelines which are still running (build -> test -> release)
+// from being deleted, no matter what the policies say.
+const MinimumAge = time.Hour
+
+// StagingImage is a staging image in the registry which has been pushed by a gipgee image build pipeline.
+type StagingImage struct {
+	ImageId    string
+	Registry   string
+	Repository string
+	Tag        string
+	// Commit is the (short) git revision the image has been built from
+	Commit  string
+	Digest  string
+	Created time.Time
+}
+
+func (image *StagingImage) String() string {
+	return fmt.Sprintf("%s/%s:%s", image.Registry, image.Repository, image.Tag)
+}
+
+type Deletion struct {
+	Image  *StagingImage
+	Reason string
+}
+
+// SelectForDeletion applies the cleanup policies to the staging images. An image is deleted if any
+// policy matches. Images younger than MinimumAge or with an unknown creation time are always kept.
+// isMerged is only called if the deleteMerged policy is enabled. Deleting by digest removes every tag of the
+// manifest, so images sharing their digest with a kept image of the same repository are kept, too.
+func SelectForDeletion(images []*StagingImage, policy *cfg.StagingCleanup, now time.Time, isMerged func(commit string) bool) ([]*Deletion, error) {
+	var maxAge time.Duration
+	if policy.MaxAge != nil {
+		var err error
+		maxAge, err = cfg.ParseAge(*policy.MaxAge)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	imagesById := make(map[string][]*StagingImage)
+	for _, image := range images {
+		imagesById[image.ImageId] = append(imagesById[image.ImageId], image)
+	}
+	imageIds := make([]string, 0, len(imagesById))
+	for imageId := range imagesById {
+		imageIds = append(imageIds, imageId)
+	}
+	sort.Strings(imageIds)
+
+	deletions := make([]*Deletion, 0)
+	for _, imageId := range imageIds {
+		candidates := imagesById[imageId]
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Created.After(candidates[j].Created) // newest first
+		})
+		for idx, image := range candidates {
+			if image.Created.IsZero() {
+				log.Printf("Keeping staging image '%s' because its creation time is unknown\n", image.String())
+				continue
+			}
+			age := now.Sub(image.Created)
+			if age < MinimumAge {
+				continue
+			}
+			reasons := make([]string, 0)
+			if policy.MaxAge != nil && age > maxAge {
+				reasons = append(reasons, fmt.Sprintf("older than %s", *policy.MaxAge))
+			}
+			if policy.KeepLast != nil && idx >= *policy.KeepLast {
+				reasons = append(reasons, fmt.Sprintf("not within the last %d", *policy.KeepLast))
+			}
+			if policy.DeleteMerged && isMerged(image.Commit) {
+				reasons = append(reasons, "merged into the default branch")
+			}
+			if len(reasons) > 0 {
+				deletions = append(deletions, &Deletion{Image: image, Reason: strings.Join(reasons, ", ")})
+			}
+		}
+	}
+
+	deleted := make(map[*StagingImage]bool, len(deletions))
+	for _, deletion := range deletions {
+		deleted[deletion.Image] = true
+	}
+	keptDigests := make(map[string]*StagingImage)
+	for _, image := range images {
+		if !deleted[image] && image.Digest != "" {
+			keptDigests[digestKey(image)] = image
+		}
+	}
+	selected := make([]*Deletion, 0, len(deletions))
+	for _, deletion := range deletions {
+		if kept, exists := keptDigests[digestKey(deletion.Image)]; exists {
+			log.Printf("Keeping staging image '%s' because it has the same digest as kept staging image '%s'\n", deletion.Image.String(), kept.String())
+			continue
+		}
+		selected = append(selected, deletion)
+	}
+	return selected, nil
+}
+
+func digestKey(image *StagingImage) string {
+	return fmt.Sprintf("%s/%s@%s", image.Registry, image.Repository, image.Digest)
+}
+
+// NewMergedCommitMatcher returns a function which checks if the given (short) commit is
+// contained in the given set of full commit hashes.
+func NewMergedCommitMatcher(reachableCommits map[string]bool) func(commit string) bool {
+	shortCommits := make(map[string]bool, len(reachableCommits))
+	for commit := range reachableCommits {
+		shortCommits[commit[0:7]] = true
+	}
+	return func(commit string) bool {
+		if len(commit) < 7 {
+			return false
+		}
+		return shortCommits[commit[0:7]]
+	}
+}
+
+// staging images are located either in a per commit repository (default, repository is the git revision,
+// optionally below defaultStagingRepositoryPrefix, and the tag is the image id) or in a fixed repository with
+// the tag <image id>-<short git revision>. The staging location of the loaded config tells which one is used.
+func isCommitRepositoryLayout(config *cfg.Config, image *cfg.Image, gitRevision string) bool {
+	return *image.StagingLocation.Repository == config.DefaultStagingRepository(gitRevision)
+}
+
+func isCommitTagLayout(image *cfg.Image, gitRevision string) bool {
+	return *image.StagingLocation.Tag == fmt.Sprintf("%s-%s", image.Id, gitRevision[0:7])
+}
+
+// FindStagingImages lists the staging images of all images of the config in their staging registries.
+// Per commit repositories are only searched below defaultStagingRepositoryPrefix, a catalog wide search
+// would match the commit repositories of other projects sharing the registry.
+func FindStagingImages(config *cfg.Config, gitRevision string, clients *registry.ClientPool) ([]*StagingImage, map[*StagingImage]*registry.Client, error) {
+	images := make([]*StagingImage, 0)
+	imageClients := make(map[*StagingImage]*registry.Client)
+
+	// the catalog is only fetched once per registry, all images of a commit share the repository
+	catalogs := make(map[*registry.Client][]string)
+
+	for _, imageId := range config.ImageIds() {
+		image := config.Images[imageId]
+		location := image.StagingLocation
+		credentials, err := config.GetLocationCredentials(location)
+		if err != nil {
+			return nil, nil, err
+		}
+		client := clients.Get(*location.Registry, credentials)
+
+		var found []*StagingImage
+		if isCommitRepositoryLayout(config, image, gitRevision) {
+			prefix := strings.TrimSuffix(*location.Repository, gitRevision)
+			if prefix == "" {
+				log.Printf("Staging images of image '%s' are in per commit repositories without prefix, gipgee cannot tell them apart from the repositories of other projects, skipping (set defaults.defaultStagingRepositoryPrefix)\n", imageId)
+				continue
+			}
+			repositoryRegexp := regexp.MustCompile(fmt.Sprintf(`^%s([0-9a-f]{40})$`, regexp.QuoteMeta(prefix)))
+			repositories, fetched := catalogs[client]
+			if !fetched {
+				repositories, err = client.ListRepositories()
+				if err != nil {
+					log.Printf("Cannot list the repositories of registry '%s' (%s), skipping staging images of image '%s'\n", *location.Registry, err.Error(), imageId)
+					continue
+				}
+				catalogs[client] = repositories
+			}
+			for _, repository := range repositories {
+				if match := repositoryRegexp.FindStringSubmatch(repository); match != nil {
+					found = append(found, &StagingImage{ImageId: imageId, Registry: *location.Registry, Repository: repository, Tag: imageId, Commit: match[1]})
+				}
+			}
+		} else if isCommitTagLayout(image, gitRevision) {
+			tags, err := client.ListTags(*location.Repository)
+			if err != nil {
+				if registry.IsNotFound(err) {
+					continue
+				}
+				return nil, nil, err
+			}
+			tagRegexp := regexp.MustCompile(fmt.Sprintf(`^%s-([0-9a-f]{7})$`, regexp.QuoteMeta(imageId)))
+			for _, tag := range tags {
+				if match := tagRegexp.FindStringSubmatch(tag); match != nil {
+					found = append(found, &StagingImage{ImageId: imageId, Registry: *location.Registry, Repository: *location.Repository, Tag: tag, Commit: match[1]})
+				}
+			}
+		} else {
+			log.Printf("Staging location of image '%s' has a fixed tag, gipgee cannot tell its staging images apart, skipping\n", imageId)
+			continue
+		}
+
+		for _, stagingImage := range found {
+			info, err := client.GetManifestInfo(stagingImage.Repository, stagingImage.Tag)
+			if err != nil {
+				if registry.IsNotFound(err) {
+					continue // the repository of another commit which doesn't contain this image
+				}
+				return nil, nil, err
+			}
+			stagingImage.Digest = info.Digest
+			stagingImage.Created = info.Created
+			images = append(images, stagingImage)
+			imageClients[stagingImage] = client
+		}
+	}
+	return images, imageClients, nil
+}
@@ -0,0 +1,150 @@
+package staging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/registry"
+	"github.com/google/go-cmp/cmp"
+)
+
+func deletedTags(deletions []*Deletion) []string {
+	tags := make([]string, len(deletions))
+	for idx, deletion := range deletions {
+		tags[idx] = deletion.Image.Tag
+	}
+	return tags
+}
+
+func TestSelectForDeletion(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	images := []*StagingImage{
+		{ImageId: "app", Tag: "app-aaaaaaa", Commit: "aaaaaaa", Created: now.Add(-30 * time.Minute)},
+		{ImageId: "app", Tag: "app-bbbbbbb", Commit: "bbbbbbb", Created: now.Add(-2 * time.Hour)},
+		{ImageId: "app", Tag: "app-ccccccc", Commit: "ccccccc", Created: now.Add(-48 * time.Hour)},
+		{ImageId: "app", Tag: "app-ddddddd", Commit: "ddddddd", Created: now.Add(-20 * 24 * time.Hour)},
+		{ImageId: "app", Tag: "app-eeeeeee", Commit: "eeeeeee"},
+		{ImageId: "tool", Tag: "tool-fffffff", Commit: "fffffff", Created: now.Add(-20 * 24 * time.Hour)},
+	}
+	neverMerged := func(string) bool { return false }
+
+	maxAge := "14d"
+	deletions, err := SelectForDeletion(images, &cfg.StagingCleanup{MaxAge: &maxAge}, now, neverMerged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"app-ddddddd", "tool-fffffff"}, deletedTags(deletions)); diff != "" {
+		t.Errorf("maxAge deletions mismatch (-want +got):\n%s", diff)
+	}
+
+	// the image younger than the minimum age counts but is never deleted
+	keepLast := 1
+	deletions, err = SelectForDeletion(images, &cfg.StagingCleanup{KeepLast: &keepLast}, now, neverMerged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"app-bbbbbbb", "app-ccccccc", "app-ddddddd"}, deletedTags(deletions)); diff != "" {
+		t.Errorf("keepLast deletions mismatch (-want +got):\n%s", diff)
+	}
+
+	merged := NewMergedCommitMatcher(map[string]bool{
+		"aaaaaaa000000000000000000000000000000000": true,
+		"ccccccc000000000000000000000000000000000": true,
+	})
+	deletions, err = SelectForDeletion(images, &cfg.StagingCleanup{DeleteMerged: true}, now, merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"app-ccccccc"}, deletedTags(deletions)); diff != "" {
+		t.Errorf("deleteMerged deletions mismatch (-want +got):\n%s", diff)
+	}
+	if deletions[0].Reason != "merged into the default branch" {
+		t.Errorf("unexpected reason '%s'", deletions[0].Reason)
+	}
+}
+
+func TestSelectForDeletionKeepsSharedDigests(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	// an unchanged rebuild pushes the same manifest with a new tag, deleting the digest would delete both tags
+	images := []*StagingImage{
+		{ImageId: "app", Repository: "staging/app", Tag: "app-aaaaaaa", Digest: "sha256:1", Created: now.Add(-2 * time.Hour)},
+		{ImageId: "app", Repository: "staging/app", Tag: "app-bbbbbbb", Digest: "sha256:1", Created: now.Add(-48 * time.Hour)},
+		{ImageId: "app", Repository: "staging/app", Tag: "app-ccccccc", Digest: "sha256:2", Created: now.Add(-72 * time.Hour)},
+		{ImageId: "app", Repository: "staging/app", Tag: "app-ddddddd", Digest: "sha256:2", Created: now.Add(-96 * time.Hour)},
+	}
+	keepLast := 1
+	deletions, err := SelectForDeletion(images, &cfg.StagingCleanup{KeepLast: &keepLast}, now, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"app-ccccccc", "app-ddddddd"}, deletedTags(deletions)); diff != "" {
+		t.Errorf("deletions mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFindStagingImages(t *testing.T) {
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	other := "fedcba9876543210fedcba9876543210fedcba98"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/_catalog":
+			// the commit repositories of another project sharing the registry must not be matched
+			_, _ = w.Write([]byte(`{"repositories": ["gipgee/` + commit + `", "gipgee/` + other + `", "` + commit + `", "other-project/` + other + `", "staging/tool"]}`))
+		case "/v2/staging/tool/tags/list":
+			_, _ = w.Write([]byte(`{"name": "staging/tool", "tags": ["tool-0123456", "tool-latest", "app-0123456"]}`))
+		case "/v2/gipgee/" + commit + "/manifests/app", "/v2/staging/tool/manifests/tool-0123456":
+			w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Split(r.URL.Path, "/")[3])
+			_, _ = w.Write([]byte(`{"mediaType": "application/vnd.docker.distribution.manifest.v2+json"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors": [{"code": "MANIFEST_UNKNOWN"}]}`))
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	registryName := "registry.example.com"
+	prefix := "/gipgee/"
+	appRepository, toolRepository, toolTag := "gipgee/"+commit, "staging/tool", "tool-0123456"
+	config := &cfg.Config{
+		Defaults: cfg.Defaults{DefaultStagingRepositoryPrefix: &prefix},
+		Images: map[string]*cfg.Image{
+			"app":  {Id: "app", StagingLocation: &cfg.ImageLocation{Registry: &registryName, Repository: &appRepository, Tag: &[]string{"app"}[0]}},
+			"tool": {Id: "tool", StagingLocation: &cfg.ImageLocation{Registry: &registryName, Repository: &toolRepository, Tag: &toolTag}},
+		},
+	}
+	clients := registry.NewClientPool()
+	clients.Get(registryName, nil).BaseUrl = server.URL
+
+	images, imageClients, err := FindStagingImages(config, commit, clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make([]string, len(images))
+	for idx, image := range images {
+		found[idx] = image.String() + " " + image.Commit
+		if imageClients[image] == nil {
+			t.Errorf("no client for staging image '%s'", image.String())
+		}
+	}
+	expected := []string{"registry.example.com/gipgee/" + commit + ":app " + commit, "registry.example.com/staging/tool:tool-0123456 0123456"}
+	if diff := cmp.Diff(expected, found); diff != "" {
+		t.Errorf("staging images mismatch (-want +got):\n%s", diff)
+	}
+
+	// without prefix, the commit repositories can't be told apart from the ones of other projects
+	config.Defaults.DefaultStagingRepositoryPrefix = nil
+	config.Images["app"].StagingLocation.Repository = &commit
+	images, _, err = FindStagingImages(config, commit, clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].ImageId != "tool" {
+		t.Errorf("expected only the staging image of tool without prefix, got %v", images)
+	}
+}
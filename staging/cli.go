@@ -0,0 +1,77 @@
+package staging
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/git"
+	"github.com/devfbe/gipgee/registry"
+)
+
+type CleanupCmd struct {
+	ConfigFileName string `required:"" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
+	DefaultBranch  string `help:"Branch for the deleteMerged policy" env:"CI_DEFAULT_BRANCH" default:"main"`
+	DryRun         bool   `help:"Only report which staging images would be deleted"`
+}
+
+type StagingCmd struct {
+	Cleanup CleanupCmd `cmd:""`
+}
+
+func (*CleanupCmd) Help() string {
+	return "Deletes the staging images gipgee pushed according to the stagingCleanup policies of the config. Runs as scheduled job in the update check pipeline or manually"
+}
+
+func (cmd *CleanupCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	if config.StagingCleanup == nil {
+		log.Println("No stagingCleanup configured, nothing to do")
+		return nil
+	}
+
+	images, clients, err := FindStagingImages(config, git.GetCurrentGitRevisionHex(), registry.NewClientPool())
+	if err != nil {
+		return err
+	}
+	log.Printf("Found %d staging images\n", len(images))
+
+	isMerged := func(string) bool { return false }
+	if config.StagingCleanup.DeleteMerged {
+		isMerged = NewMergedCommitMatcher(git.GetCommitsReachableFromBranch(cmd.DefaultBranch))
+	}
+
+	deletions, err := SelectForDeletion(images, config.StagingCleanup, time.Now(), isMerged)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	deletedDigests := make(map[string]bool)
+	for _, deletion := range deletions {
+		// the staging images of a commit may share a manifest, it is deleted only once
+		if deletedDigests[digestKey(deletion.Image)] {
+			log.Printf("Staging image '%s' (%s) is deleted with a previous image of the same digest: %s\n", deletion.Image.String(), deletion.Image.Digest, deletion.Reason)
+			continue
+		}
+		deletedDigests[digestKey(deletion.Image)] = true
+		if cmd.DryRun {
+			log.Printf("[dry run] Would delete staging image '%s' (%s): %s\n", deletion.Image.String(), deletion.Image.Digest, deletion.Reason)
+			continue
+		}
+		log.Printf("Deleting staging image '%s' (%s): %s\n", deletion.Image.String(), deletion.Image.Digest, deletion.Reason)
+		if err := clients[deletion.Image].DeleteManifest(deletion.Image.Repository, deletion.Image.Digest); err != nil {
+			log.Printf("Failed to delete staging image '%s': %s\n", deletion.Image.String(), err.Error())
+			failed++
+		}
+	}
+	log.Printf("%d of %d staging images selected for deletion\n", len(deletions), len(images))
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d staging images", failed, len(deletions))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package structuretest
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	cfg "github.com/devfbe/gipgee/config"
+)
+
+type ExecStructureTestCmd struct {
+	ImageId         string `arg:""`
+	ConfigFileName  string `required:"" env:"GIPGEE_CONFIG_FILE_NAME"`
+	ImageConfigFile string `help:"Image config json as written by 'skopeo inspect --config', required for metadata tests beyond env and user" optional:""`
+	JunitReportFile string `help:"Write the test results as junit report to this path" optional:""`
+}
+
+func (*ExecStructureTestCmd) Help() string {
+	return "Only for gipgee internal use in the image build pipeline. Runs the structure tests of the image inside the staging image"
+}
+
+func loadImageConfig(path string) (*ImageConfig, error) {
+	bytes, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	imageConfig := ImageConfig{}
+	err = json.Unmarshal(bytes, &imageConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse image config '%s': %w", path, err)
+	}
+	return &imageConfig, nil
+}
+
+func (cmd *ExecStructureTestCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	image, exists := config.Images[cmd.ImageId]
+	if !exists {
+		return fmt.Errorf("image '%s' does not exist in config", cmd.ImageId)
+	}
+	if image.StructureTests == nil {
+		return fmt.Errorf("image '%s' has no structure tests configured", cmd.ImageId)
+	}
+	definitions, err := LoadTestDefinitions(*image.StructureTests)
+	if err != nil {
+		return err
+	}
+	var imageConfig *ImageConfig
+	if cmd.ImageConfigFile != "" {
+		imageConfig, err = loadImageConfig(cmd.ImageConfigFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	results := Run(definitions, imageConfig)
+	failed := 0
+	for _, result := range results {
+		if result.Passed() {
+			log.Printf("PASS %s '%s'\n", result.Kind, result.Name)
+			continue
+		}
+		failed++
+		log.Printf("FAIL %s '%s'\n", result.Kind, result.Name)
+		for _, e := range result.Errors {
+			log.Printf("     %s\n", e)
+		}
+	}
+
+	if cmd.JunitReportFile != "" {
+		err = WriteJunitReport(cmd.JunitReportFile, "gipgee structure tests "+cmd.ImageId, results)
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d structure tests failed for image '%s'", failed, len(results), cmd.ImageId)
+	}
+	log.Printf("All %d structure tests passed for image '%s'\n", len(results), cmd.ImageId)
+	return nil
+}
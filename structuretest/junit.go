@@ -0,0 +1,78 @@
+package structuretest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func seconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
+
+func createJunitReport(suiteName string, results []TestResult) ([]byte, error) {
+	suite := junitTestSuite{
+		Name:      suiteName,
+		Tests:     len(results),
+		TestCases: make([]junitTestCase, 0, len(results)),
+	}
+	var total time.Duration
+	for _, result := range results {
+		testCase := junitTestCase{
+			Name:      result.Name,
+			ClassName: suiteName + "." + result.Kind,
+			Time:      seconds(result.Duration),
+		}
+		if !result.Passed() {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: result.Errors[0],
+				Text:    strings.Join(result.Errors, "\n"),
+			}
+		}
+		total += result.Duration
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Time = seconds(total)
+	report, err := xml.MarshalIndent(junitTestSuites{TestSuites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), report...), nil
+}
+
+func WriteJunitReport(path, suiteName string, results []TestResult) error {
+	report, err := createJunitReport(suiteName, results)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Clean(path), report, 0600)
+}
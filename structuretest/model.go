@@ -0,0 +1,97 @@
+package structuretest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// The test definitions are compatible with the container-structure-test yaml format,
+// see https://github.com/GoogleContainerTools/container-structure-test
+
+type EnvVar struct {
+	Key     string `yaml:"key"`
+	Value   string `yaml:"value"`
+	IsRegex bool   `yaml:"isRegex"`
+}
+
+type FileExistenceTest struct {
+	Name           string  `yaml:"name"`
+	Path           string  `yaml:"path"`
+	ShouldExist    bool    `yaml:"shouldExist"`
+	Permissions    *string `yaml:"permissions"`
+	Uid            *int    `yaml:"uid"`
+	Gid            *int    `yaml:"gid"`
+	IsExecutableBy *string `yaml:"isExecutableBy"`
+}
+
+type FileContentTest struct {
+	Name             string   `yaml:"name"`
+	Path             string   `yaml:"path"`
+	ExpectedContents []string `yaml:"expectedContents"`
+	ExcludedContents []string `yaml:"excludedContents"`
+}
+
+type CommandTest struct {
+	Name           string     `yaml:"name"`
+	Setup          [][]string `yaml:"setup"`
+	Command        string     `yaml:"command"`
+	Args           []string   `yaml:"args"`
+	EnvVars        []EnvVar   `yaml:"envVars"`
+	ExpectedOutput []string   `yaml:"expectedOutput"`
+	ExcludedOutput []string   `yaml:"excludedOutput"`
+	ExpectedError  []string   `yaml:"expectedError"`
+	ExcludedError  []string   `yaml:"excludedError"`
+	ExitCode       int        `yaml:"exitCode"`
+}
+
+type MetadataTest struct {
+	EnvVars        []EnvVar  `yaml:"envVars"`
+	ExposedPorts   []string  `yaml:"exposedPorts"`
+	UnexposedPorts []string  `yaml:"unexposedPorts"`
+	Entrypoint     *[]string `yaml:"entrypoint"`
+	Cmd            *[]string `yaml:"cmd"`
+	Workdir        *string   `yaml:"workdir"`
+	User           *string   `yaml:"user"`
+	Labels         []EnvVar  `yaml:"labels"`
+}
+
+type TestDefinitions struct {
+	SchemaVersion      string              `yaml:"schemaVersion"`
+	FileExistenceTests []FileExistenceTest `yaml:"fileExistenceTests"`
+	FileContentTests   []FileContentTest   `yaml:"fileContentTests"`
+	CommandTests       []CommandTest       `yaml:"commandTests"`
+	MetadataTest       *MetadataTest       `yaml:"metadataTest"`
+}
+
+func LoadTestDefinitions(path string) (*TestDefinitions, error) {
+	bytes, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	definitions := TestDefinitions{}
+	err = yaml.Unmarshal(bytes, &definitions)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse structure test file '%s': %w", path, err)
+	}
+	if definitions.SchemaVersion != "" && definitions.SchemaVersion != "2.0.0" {
+		return nil, fmt.Errorf("structure test file '%s' has unsupported schemaVersion '%s' (supported: 2.0.0)", path, definitions.SchemaVersion)
+	}
+	return &definitions, nil
+}
+
+// ImageConfig is the relevant part of the image config json, as returned
+// by skopeo inspect --config.
+type ImageConfig struct {
+	Config struct {
+		User         string              `json:"User"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		Env          []string            `json:"Env"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Cmd          []string            `json:"Cmd"`
+		WorkingDir   string              `json:"WorkingDir"`
+		Labels       map[string]string   `json:"Labels"`
+	} `json:"config"`
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package structuretest
+
+import (
+	"os"
+	"syscall"
+)
+
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
@@ -0,0 +1,287 @@
+package structuretest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	kindFileExistence = "File Existence Test"
+	kindFileContent   = "File Content Test"
+	kindCommand       = "Command Test"
+	kindMetadata      = "Metadata Test"
+)
+
+type TestResult struct {
+	Name     string
+	Kind     string
+	Duration time.Duration
+	Errors   []string
+}
+
+func (result *TestResult) Passed() bool {
+	return len(result.Errors) == 0
+}
+
+func (result *TestResult) fail(format string, args ...interface{}) {
+	result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+}
+
+// Run executes all tests of the definitions in the current container. The image config
+// is optional, without it only the metadata that is visible at runtime (env and user) can be tested.
+func Run(definitions *TestDefinitions, imageConfig *ImageConfig) []TestResult {
+	results := make([]TestResult, 0)
+	for _, test := range definitions.FileExistenceTests {
+		results = append(results, timed(test.Name, kindFileExistence, func(result *TestResult) { runFileExistenceTest(test, result) }))
+	}
+	for _, test := range definitions.FileContentTests {
+		results = append(results, timed(test.Name, kindFileContent, func(result *TestResult) { runFileContentTest(test, result) }))
+	}
+	for _, test := range definitions.CommandTests {
+		results = append(results, timed(test.Name, kindCommand, func(result *TestResult) { runCommandTest(test, result) }))
+	}
+	if definitions.MetadataTest != nil {
+		results = append(results, timed("Metadata", kindMetadata, func(result *TestResult) { runMetadataTest(*definitions.MetadataTest, imageConfig, result) }))
+	}
+	return results
+}
+
+func timed(name, kind string, test func(*TestResult)) TestResult {
+	result := TestResult{Name: name, Kind: kind}
+	start := time.Now()
+	test(&result)
+	result.Duration = time.Since(start)
+	return result
+}
+
+func runFileExistenceTest(test FileExistenceTest, result *TestResult) {
+	info, err := os.Lstat(test.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			if test.ShouldExist {
+				result.fail("file '%s' should exist but does not", test.Path)
+			}
+			return
+		}
+		result.fail("cannot stat file '%s': %s", test.Path, err.Error())
+		return
+	}
+	if !test.ShouldExist {
+		result.fail("file '%s' should not exist but does", test.Path)
+		return
+	}
+	if test.Permissions != nil && info.Mode().String() != *test.Permissions {
+		result.fail("file '%s' has permissions '%s', expected '%s'", test.Path, info.Mode().String(), *test.Permissions)
+	}
+	if test.Uid != nil || test.Gid != nil {
+		uid, gid, ok := fileOwner(info)
+		if !ok {
+			result.fail("cannot determine the owner of file '%s' on this platform", test.Path)
+		} else {
+			if test.Uid != nil && uid != *test.Uid {
+				result.fail("file '%s' is owned by uid %d, expected %d", test.Path, uid, *test.Uid)
+			}
+			if test.Gid != nil && gid != *test.Gid {
+				result.fail("file '%s' is owned by gid %d, expected %d", test.Path, gid, *test.Gid)
+			}
+		}
+	}
+	if test.IsExecutableBy != nil {
+		var mask os.FileMode
+		switch *test.IsExecutableBy {
+		case "owner":
+			mask = 0100
+		case "group":
+			mask = 0010
+		case "other":
+			mask = 0001
+		case "any":
+			mask = 0111
+		default:
+			result.fail("invalid isExecutableBy value '%s' (valid: owner, group, other, any)", *test.IsExecutableBy)
+			return
+		}
+		if info.Mode().Perm()&mask == 0 {
+			result.fail("file '%s' is not executable by %s (permissions '%s')", test.Path, *test.IsExecutableBy, info.Mode().String())
+		}
+	}
+}
+
+func runFileContentTest(test FileContentTest, result *TestResult) {
+	content, err := os.ReadFile(test.Path)
+	if err != nil {
+		result.fail("cannot read file '%s': %s", test.Path, err.Error())
+		return
+	}
+	checkOutput(result, "contents of '"+test.Path+"'", string(content), test.ExpectedContents, test.ExcludedContents)
+}
+
+func runCommandTest(test CommandTest, result *TestResult) {
+	env := os.Environ()
+	for _, envVar := range test.EnvVars {
+		env = append(env, envVar.Key+"="+os.ExpandEnv(envVar.Value))
+	}
+	for _, setup := range test.Setup {
+		if len(setup) == 0 {
+			continue
+		}
+		cmd := exec.Command(setup[0], setup[1:]...) // #nosec G204
+		cmd.Env = env
+		if output, err := cmd.CombinedOutput(); err != nil {
+			result.fail("setup command '%s' failed: %s (output: %s)", strings.Join(setup, " "), err.Error(), string(output))
+			return
+		}
+	}
+
+	cmd := exec.Command(test.Command, test.Args...) // #nosec G204
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			result.fail("cannot execute command '%s': %s", test.Command, err.Error())
+			return
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	if exitCode != test.ExitCode {
+		result.fail("command '%s' exited with code %d, expected %d (stderr: %s)", test.Command, exitCode, test.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+	checkOutput(result, "stdout", stdout.String(), test.ExpectedOutput, test.ExcludedOutput)
+	checkOutput(result, "stderr", stderr.String(), test.ExpectedError, test.ExcludedError)
+}
+
+func checkOutput(result *TestResult, what, output string, expected, excluded []string) {
+	for _, pattern := range expected {
+		matched, err := regexp.MatchString(pattern, output)
+		if err != nil {
+			result.fail("invalid regular expression '%s': %s", pattern, err.Error())
+		} else if !matched {
+			result.fail("expected %s to match '%s', got: %s", what, pattern, output)
+		}
+	}
+	for _, pattern := range excluded {
+		matched, err := regexp.MatchString(pattern, output)
+		if err != nil {
+			result.fail("invalid regular expression '%s': %s", pattern, err.Error())
+		} else if matched {
+			result.fail("expected %s not to match '%s', got: %s", what, pattern, output)
+		}
+	}
+}
+
+func runMetadataTest(test MetadataTest, imageConfig *ImageConfig, result *TestResult) {
+	requireImageConfig := func(what string) bool {
+		if imageConfig == nil {
+			result.fail("testing the %s requires the image config (--image-config-file)", what)
+			return false
+		}
+		return true
+	}
+
+	var env []string
+	if imageConfig != nil {
+		env = imageConfig.Config.Env
+	} else {
+		env = os.Environ()
+	}
+	checkKeyValues(result, "env var", toMap(env), test.EnvVars)
+
+	if test.User != nil {
+		if imageConfig != nil {
+			if imageConfig.Config.User != *test.User {
+				result.fail("image user is '%s', expected '%s'", imageConfig.Config.User, *test.User)
+			}
+		} else if current, err := user.Current(); err != nil {
+			result.fail("cannot determine the current user: %s", err.Error())
+		} else if current.Username != *test.User && current.Uid != *test.User {
+			result.fail("container runs as user '%s' (uid %s), expected '%s'", current.Username, current.Uid, *test.User)
+		}
+	}
+
+	if (len(test.ExposedPorts) > 0 || len(test.UnexposedPorts) > 0) && requireImageConfig("exposed ports") {
+		for _, port := range test.ExposedPorts {
+			if !isPortExposed(imageConfig, port) {
+				result.fail("port '%s' is not exposed", port)
+			}
+		}
+		for _, port := range test.UnexposedPorts {
+			if isPortExposed(imageConfig, port) {
+				result.fail("port '%s' is exposed but should not be", port)
+			}
+		}
+	}
+	if test.Entrypoint != nil && requireImageConfig("entrypoint") && !equalStrings(imageConfig.Config.Entrypoint, *test.Entrypoint) {
+		result.fail("image entrypoint is %q, expected %q", imageConfig.Config.Entrypoint, *test.Entrypoint)
+	}
+	if test.Cmd != nil && requireImageConfig("cmd") && !equalStrings(imageConfig.Config.Cmd, *test.Cmd) {
+		result.fail("image cmd is %q, expected %q", imageConfig.Config.Cmd, *test.Cmd)
+	}
+	if test.Workdir != nil && requireImageConfig("workdir") && imageConfig.Config.WorkingDir != *test.Workdir {
+		result.fail("image workdir is '%s', expected '%s'", imageConfig.Config.WorkingDir, *test.Workdir)
+	}
+	if len(test.Labels) > 0 && requireImageConfig("labels") {
+		checkKeyValues(result, "label", imageConfig.Config.Labels, test.Labels)
+	}
+}
+
+func checkKeyValues(result *TestResult, what string, actual map[string]string, expected []EnvVar) {
+	for _, kv := range expected {
+		value, exists := actual[kv.Key]
+		if !exists {
+			result.fail("%s '%s' is not set", what, kv.Key)
+			continue
+		}
+		if kv.IsRegex {
+			matched, err := regexp.MatchString(kv.Value, value)
+			if err != nil {
+				result.fail("invalid regular expression '%s': %s", kv.Value, err.Error())
+			} else if !matched {
+				result.fail("%s '%s' has value '%s' which does not match '%s'", what, kv.Key, value, kv.Value)
+			}
+		} else if value != kv.Value {
+			result.fail("%s '%s' has value '%s', expected '%s'", what, kv.Key, value, kv.Value)
+		}
+	}
+}
+
+func toMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, e := range env {
+		key, value, _ := strings.Cut(e, "=")
+		m[key] = value
+	}
+	return m
+}
+
+// isPortExposed accepts ports with ("8080/udp") and without ("8080", means tcp) protocol.
+func isPortExposed(imageConfig *ImageConfig, port string) bool {
+	if _, err := strconv.Atoi(port); err == nil {
+		port += "/tcp"
+	}
+	_, exists := imageConfig.Config.ExposedPorts[port]
+	return exists
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package structuretest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+func runDefinitions(yamlDefinitions string, imageConfig *ImageConfig, t *testing.T) map[string]TestResult {
+	definitions := TestDefinitions{}
+	err := yaml.Unmarshal([]byte(yamlDefinitions), &definitions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[string]TestResult)
+	for _, result := range Run(&definitions, imageConfig) {
+		results[result.Name] = result
+	}
+	return results
+}
+
+func assertPassed(results map[string]TestResult, name string, expected bool, t *testing.T) {
+	result, exists := results[name]
+	if !exists {
+		t.Errorf("no result for test '%s'", name)
+		return
+	}
+	if result.Passed() != expected {
+		t.Errorf("test '%s' passed: %v, expected %v (errors: %v)", name, result.Passed(), expected, result.Errors)
+	}
+}
+
+func TestFileTests(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "hello.sh"), []byte("#!/bin/sh\necho hello world\n"), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "hello.sh"), 0750); err != nil { // umask independent
+		t.Fatal(err)
+	}
+
+	results := runDefinitions(strings.ReplaceAll(`
+schemaVersion: 2.0.0
+fileExistenceTests:
+  - name: exists
+    path: DIR/hello.sh
+    shouldExist: true
+    permissions: -rwxr-x---
+    isExecutableBy: group
+  - name: wrong permissions
+    path: DIR/hello.sh
+    shouldExist: true
+    permissions: -rw-r--r--
+  - name: not executable by other
+    path: DIR/hello.sh
+    shouldExist: true
+    isExecutableBy: other
+  - name: absent
+    path: DIR/missing
+    shouldExist: false
+  - name: missing
+    path: DIR/missing
+    shouldExist: true
+fileContentTests:
+  - name: content
+    path: DIR/hello.sh
+    expectedContents: ["echo hello"]
+    excludedContents: ["rm -rf"]
+  - name: excluded content
+    path: DIR/hello.sh
+    excludedContents: ["^#!/bin/sh"]
+`, "DIR", dir), nil, t)
+
+	assertPassed(results, "exists", true, t)
+	assertPassed(results, "wrong permissions", false, t)
+	assertPassed(results, "not executable by other", false, t)
+	assertPassed(results, "absent", true, t)
+	assertPassed(results, "missing", false, t)
+	assertPassed(results, "content", true, t)
+	assertPassed(results, "excluded content", false, t)
+}
+
+func TestCommandTests(t *testing.T) {
+	results := runDefinitions(`
+commandTests:
+  - name: echo
+    command: sh
+    args: ["-c", "echo $GREETING; echo oops >&2"]
+    envVars:
+      - key: GREETING
+        value: hello gipgee
+    expectedOutput: ["^hello gipgee$"]
+    expectedError: ["oops"]
+  - name: exit code
+    command: sh
+    args: ["-c", "exit 3"]
+    exitCode: 3
+  - name: unexpected exit code
+    command: sh
+    args: ["-c", "exit 1"]
+  - name: failing setup
+    setup: [["false"]]
+    command: "true"
+  - name: missing command
+    command: /does/not/exist
+`, nil, t)
+
+	assertPassed(results, "echo", false, t) // "^...$" doesn't match multiline output without (?m)
+	assertPassed(results, "exit code", true, t)
+	assertPassed(results, "unexpected exit code", false, t)
+	assertPassed(results, "failing setup", false, t)
+	assertPassed(results, "missing command", false, t)
+
+	results = runDefinitions(`
+commandTests:
+  - name: echo
+    command: sh
+    args: ["-c", "echo $GREETING"]
+    envVars:
+      - key: GREETING
+        value: hello gipgee
+    expectedOutput: ["(?m)^hello gipgee$"]
+    excludedOutput: ["goodbye"]
+`, nil, t)
+	assertPassed(results, "echo", true, t)
+}
+
+func TestMetadataTest(t *testing.T) {
+	imageConfig := &ImageConfig{}
+	imageConfig.Config.User = "nobody"
+	imageConfig.Config.Env = []string{"PATH=/usr/bin:/bin", "LANG=C.UTF-8"}
+	imageConfig.Config.ExposedPorts = map[string]struct{}{"8080/tcp": {}, "53/udp": {}}
+	imageConfig.Config.Entrypoint = []string{"/entrypoint.sh"}
+	imageConfig.Config.WorkingDir = "/app"
+	imageConfig.Config.Labels = map[string]string{"org.opencontainers.image.version": "1.2.3"}
+
+	definitions := `
+metadataTest:
+  envVars:
+    - key: LANG
+      value: C.UTF-8
+    - key: PATH
+      value: /usr/bin
+      isRegex: true
+  exposedPorts: ["8080", "53/udp"]
+  unexposedPorts: ["22"]
+  entrypoint: ["/entrypoint.sh"]
+  workdir: /app
+  user: nobody
+  labels:
+    - key: org.opencontainers.image.version
+      value: ^1\.
+      isRegex: true
+`
+	results := runDefinitions(definitions, imageConfig, t)
+	assertPassed(results, "Metadata", true, t)
+
+	imageConfig.Config.User = "root"
+	imageConfig.Config.ExposedPorts["22/tcp"] = struct{}{}
+	result := runDefinitions(definitions, imageConfig, t)["Metadata"]
+	if len(result.Errors) != 2 {
+		t.Errorf("expected user and port errors, got %v", result.Errors)
+	}
+
+	// without image config only env and user are testable
+	result = runDefinitions(`
+metadataTest:
+  entrypoint: ["/entrypoint.sh"]
+`, nil, t)["Metadata"]
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "--image-config-file") {
+		t.Errorf("expected missing image config error, got %v", result.Errors)
+	}
+}
+
+func TestCreateJunitReport(t *testing.T) {
+	report, err := createJunitReport("suite", []TestResult{
+		{Name: "ok", Kind: kindCommand},
+		{Name: "broken", Kind: kindFileExistence, Errors: []string{"file '/x' should exist but does not"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<testsuite name="suite" tests="2" failures="1"`,
+		`<testcase name="ok" classname="suite.Command Test" time="0.000"></testcase>`,
+		`<failure message="file &#39;/x&#39; should exist but does not">`,
+	} {
+		if !strings.Contains(string(report), expected) {
+			t.Errorf("junit report does not contain '%s':\n%s", expected, string(report))
+		}
+	}
+}
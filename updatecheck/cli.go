@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/imagebuild"
 )
 
 type AutoUpdateCheckCmd struct {
@@ -66,6 +67,10 @@ func CheckIfBaseImageLayersAreDiverged(imageId string, config *cfg.Config, rebui
 	baseImageLayers := runSkopeoInspect(imageId, imageConfig.BaseImage, config)
 	// release location iteration
 	for idx, releaseLocation := range imageConfig.ReleaseLocations {
+		if releaseLocation.Tag == nil {
+			log.Printf("Release location %d of image '%s' has no tag, skipping the layer check\n", idx, imageId)
+			continue
+		}
 		log.Printf("Getting layers of release location %d (%s)\n", idx, releaseLocation.String())
 		releaseLocationLayers := runSkopeoInspect(imageId, releaseLocation, config)
 		log.Printf("Comparing base image layers of base image '%s' and child image layers of '%s'\n", imageConfig.BaseImage.String(), releaseLocation.String())
@@ -127,21 +132,23 @@ func (cmd *PerformSkopeoUpdateCheckCmd) Run() error {
 }
 
 type UpdateCheckCmd struct {
-	GeneratePipeline         GeneratePipelineCmd         `cmd:""`
-	ExecUpdateCheck          ExecUpdateCheckCmd          `cmd:""`
-	AutoUpdateCheck          AutoUpdateCheckCmd          `cmd:""`
-	PerformSkopeoUpdateCheck PerformSkopeoUpdateCheckCmd `cmd:""`
-	GenerateImageRebuildFile GenerateImageRebuildFileCmd `cmd:""`
+	GeneratePipeline                GeneratePipelineCmd                `cmd:""`
+	ExecUpdateCheck                 ExecUpdateCheckCmd                 `cmd:""`
+	AutoUpdateCheck                 AutoUpdateCheckCmd                 `cmd:""`
+	PerformSkopeoUpdateCheck        PerformSkopeoUpdateCheckCmd        `cmd:""`
+	GenerateImageRebuildFile        GenerateImageRebuildFileCmd        `cmd:""`
+	PerformVulnerabilityUpdateCheck PerformVulnerabilityUpdateCheckCmd `cmd:""`
 }
 
 type GenerateImageRebuildFileCmd struct {
 	ConfigFileName   string `help:"Set the name of the gipgee config file" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
 	SkopeoResultPath string `help:"Set the path of the skopeo result" env:"GIPGEE_UPDATE_CHECK_SKOPEO_RESULT_PATH" required:""`
+	GithubOutput     string `help:"Also write the comma separated ids of the images to rebuild to this output of the github actions step" optional:""`
 }
 
 func (cmd *GenerateImageRebuildFileCmd) Run() error {
 
-	imagesToRebuild := make(map[string]bool, 0)
+	imagesToRebuild := make(imagebuild.ImageSelection)
 
 	log.Printf("Loading gipgee configuration file '%s'\n", cmd.ConfigFileName)
 	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
@@ -164,7 +171,7 @@ func (cmd *GenerateImageRebuildFileCmd) Run() error {
 	for key, value := range resultMap {
 		if value {
 			log.Printf("Skopeo check indicates rebuild needed for image '%s', adding to rebuild list.\n", key)
-			imagesToRebuild[key] = true
+			imagesToRebuild.Add(key, fmt.Sprintf("base image '%s' has changed (layers diverged)", config.Images[key].BaseImage.String()))
 		} else {
 			log.Printf("Skopeo check didn't indicate rebuild for image '%s'\n", key)
 		}
@@ -174,6 +181,9 @@ func (cmd *GenerateImageRebuildFileCmd) Run() error {
 	for _, imageConfig := range config.Images {
 		if len(*imageConfig.UpdateCheckCommand) > 0 {
 			for idx, location := range imageConfig.ReleaseLocations {
+				if location.Tag == nil {
+					continue // not checked, see pipeline generation
+				}
 				resultFileLocation := getImageUpdateCheckResultFileName(imageConfig.Id, idx)
 				log.Printf("Trying to load resultfile '%s' for image '%s', target location '%d' (%s)\n", resultFileLocation, imageConfig.Id, idx, location.String())
 				resultFile, err := os.ReadFile(resultFileLocation) // #nosec G304
@@ -183,7 +193,7 @@ func (cmd *GenerateImageRebuildFileCmd) Run() error {
 				result := strings.TrimSuffix(string(resultFile), "\n")
 				if result == "UPGRADE_NEEDED" {
 					log.Printf("Result file '%s' contains UPGRADE_NEEDED, adding '%s' to image rebuild list (if not already exists)\n", resultFileLocation, imageConfig.Id)
-					imagesToRebuild[imageConfig.Id] = true
+					imagesToRebuild.Add(imageConfig.Id, fmt.Sprintf("package updates available in release location '%s'", location.String()))
 				} else if result == "NO_UPGRADE_NEEDED" {
 					log.Printf("Result file '%s' contains NO_UPGRADE_NEEDED, not adding '%s' to image rebuild list\n", resultFileLocation, imageConfig.Id)
 				} else {
@@ -195,20 +205,59 @@ func (cmd *GenerateImageRebuildFileCmd) Run() error {
 		}
 	}
 
-	imagesToRebuildJson, err := json.Marshal(imagesToRebuild)
-	if err != nil {
-		panic(err)
+	log.Println("Checking vulnerability update check results")
+	for _, imageConfig := range config.Images {
+		if !imageConfig.VulnerabilityUpdateCheck.IsEnabled() {
+			continue
+		}
+		for idx, location := range imageConfig.ReleaseLocations {
+			if location.Tag == nil {
+				continue // not checked, see pipeline generation
+			}
+			resultFileLocation := getVulnerabilityUpdateCheckResultFileName(imageConfig.Id, idx)
+			log.Printf("Trying to load vulnerability result file '%s' for image '%s', target location '%d' (%s)\n", resultFileLocation, imageConfig.Id, idx, location.String())
+			result, err := loadVulnerabilityUpdateCheckResult(resultFileLocation)
+			if err != nil {
+				panic(err)
+			}
+			if result.RebuildNeeded {
+				log.Printf("Result file '%s' contains fixable vulnerabilities, adding '%s' to image rebuild list (if not already exists)\n", resultFileLocation, imageConfig.Id)
+				imagesToRebuild.Add(imageConfig.Id, fmt.Sprintf("fixable vulnerabilities in release location '%s': %s", location.String(), strings.Join(result.Findings, ", ")))
+			}
+		}
 	}
-	log.Printf("Images to rebuild (image selection file content: '%s')\n", imagesToRebuildJson)
+
 	rebuildFileName := "gipgee-image-rebuild-file.json" // TODO make as param
-	log.Printf("Writing json to file '%s'\n", rebuildFileName)
-	err = os.WriteFile(rebuildFileName, imagesToRebuildJson, 0600)
+	log.Printf("Writing image selection file '%s'\n", rebuildFileName)
+	for _, imageId := range imagesToRebuild.ImageIds() {
+		log.Printf("Image '%s' will be rebuilt, reasons: %s\n", imageId, strings.Join(imagesToRebuild[imageId].Reasons, "; "))
+	}
+	err = imagesToRebuild.WriteToFile(rebuildFileName)
 	if err != nil {
 		panic(err)
 	}
+	if cmd.GithubOutput != "" {
+		return writeGithubOutput(cmd.GithubOutput, strings.Join(imagesToRebuild.ImageIds(), ","))
+	}
 	return nil
 }
 
+// writeGithubOutput sets the output of the current github actions step.
+func writeGithubOutput(name string, value string) error {
+	outputFile, exists := os.LookupEnv("GITHUB_OUTPUT")
+	if !exists {
+		return fmt.Errorf("cannot write github output '%s', GITHUB_OUTPUT is not set (not running in github actions?)", name)
+	}
+	file, err := os.OpenFile(outputFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	log.Printf("Writing github output %s=%s\n", name, value)
+	_, err = fmt.Fprintf(file, "%s=%s\n", name, value)
+	return err
+}
+
 type GeneratePipelineCmd struct {
 	PipelineFileName string `help:"Set the name of the pipeline file" env:"GIPGEE_PIPELINE_FILENAME" default:".gipgee-gitlab-ci.yml"`
 	ConfigFileName   string `help:"Set the name of the gipgee config file" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
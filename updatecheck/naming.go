@@ -2,6 +2,21 @@ package updatecheck
 
 import "fmt"
 
+const (
+	// RebuildTriggerJobName is the name of the job starting the rebuild pipeline (or workflow)
+	RebuildTriggerJobName = "🛫 Trigger rebuild pipeline"
+	// RebuildSelectionJobName is the name of the job selecting the images to rebuild if the rebuilds run
+	// in a github actions workflow, its step output RebuildImagesOutputName contains the image ids.
+	RebuildSelectionJobName = "🛠️ Select images to rebuild"
+	RebuildImagesOutputName = "images"
+	// RebuildImagesVarName passes the comma separated ids of the images to rebuild to the rebuild workflow
+	RebuildImagesVarName = "GIPGEE_REBUILD_IMAGES"
+)
+
 func getImageUpdateCheckResultFileName(imageId string, locationIndex int) string {
 	return fmt.Sprintf("gipgee-update-check-result-%s-release-location-%d", imageId, locationIndex)
 }
+
+func getVulnerabilityUpdateCheckResultFileName(imageId string, locationIndex int) string {
+	return fmt.Sprintf("gipgee-vulnerability-update-check-result-%s-release-location-%d.json", imageId, locationIndex)
+}
@@ -7,7 +7,9 @@ import (
 
 	"github.com/devfbe/gipgee/config"
 	"github.com/devfbe/gipgee/docker"
+	"github.com/devfbe/gipgee/imagebuild"
 	pm "github.com/devfbe/gipgee/pipelinemodel"
+	"github.com/devfbe/gipgee/scan"
 )
 
 type PipelineParams struct {
@@ -15,6 +17,8 @@ type PipelineParams struct {
 	GipgeeImage    string
 	Config         *config.Config
 	ConfigFileName string
+	// RebuildWorkflow is the github actions workflow the rebuilds run in instead of a generated child pipeline
+	RebuildWorkflow string
 }
 
 func GeneratePipeline(params PipelineParams) *pm.Pipeline {
@@ -38,10 +42,10 @@ func GeneratePipeline(params PipelineParams) *pm.Pipeline {
 	// The copyGipgeeAsArtifact job copies the gipgee binary, which is statically linked, to the gitlab artifacts.
 	// This helps us e.g. in update check jobs (in the images the user has built) where we can then simply run our
 	// gipgee which contains additional code for the update checks / kaniko auth generation / ...
+	// Like all jobs without own image, it runs in the gipgee image (the default image of the pipeline).
 	copyGipgeeAsArtifact := pm.Job{
 		Name:  "Copy gipgee to artifacts",
 		Stage: &ai1Stage,
-		Image: gipgeeImage,
 		Script: []string{
 			"cp $(which gipgee) gipgee",
 		},
@@ -60,7 +64,6 @@ func GeneratePipeline(params PipelineParams) *pm.Pipeline {
 			"./gipgee update-check perform-skopeo-update-check",
 		},
 		Variables: &map[string]interface{}{
-			"GIPGEE_CONFIG_FILE_NAME":                params.ConfigFileName,
 			"GIPGEE_UPDATE_CHECK_SKOPEO_RESULT_PATH": skopeoResultLocation,
 		},
 		Needs: []pm.JobNeeds{
@@ -75,21 +78,35 @@ func GeneratePipeline(params PipelineParams) *pm.Pipeline {
 	}
 
 	pipelineJobs = append(pipelineJobs, &skopeoUpdateCheckJob)
+	updateCheckPhase := params.Config.GetPhaseExtension(config.PhaseUpdateCheck)
+	updateCheckPhase.ApplyTo(&skopeoUpdateCheckJob)
+	// the templates of the update check jobs are placed right after the skopeo update check
+	templateIndex := len(pipelineJobs)
+	updateCheckJobs := make([]*pm.Job, 0)
+	vulnerabilityUpdateCheckJobs := make([]*pm.Job, 0)
+	dockerAuthConfigs := generateDockerAuthConfigs(params.Config.ImageIds(), params.Config)
 
 	imageUpdateCheckResultFiles := map[string][]string{}
+	// update check jobs of each image, needed to collect the results of image groups
+	updateCheckJobsByImage := map[string][]*pm.Job{}
 
-	for imageId, imageConfig := range params.Config.Images {
+	for _, imageId := range params.Config.ImageIds() {
+		imageConfig := params.Config.Images[imageId]
 
 		var locations []*config.ImageLocation
 
 		locations = append(locations, imageConfig.ReleaseLocations...)
 
 		for idx, location := range locations {
+			if location.Tag == nil {
+				log.Printf("Release location %d of image '%s' has no tag (semver tag strategy without releaseLatest), skipping its update checks\n", idx, imageId)
+				continue
+			}
 			resultFileLocation := getImageUpdateCheckResultFileName(imageId, idx)
 			imageUpdateCheckResultFiles[imageId] = append(imageUpdateCheckResultFiles[imageId], resultFileLocation)
 
 			if len(*imageConfig.UpdateCheckCommand) > 0 {
-				pipelineJobs = append(pipelineJobs, &pm.Job{
+				updateCheckJob := pm.Job{
 					Name:   fmt.Sprintf("🛂 Update check %s/%d", imageId, idx),
 					Stage:  &ai1Stage,
 					Script: []string{fmt.Sprintf("./gipgee update-check exec-update-check %s", imageId)},
@@ -109,53 +126,187 @@ func GeneratePipeline(params PipelineParams) *pm.Pipeline {
 						},
 					},
 					Variables: &map[string]interface{}{
-						"GIPGEE_CONFIG_FILE_NAME":              params.ConfigFileName,
 						"GIPGEE_UPDATE_CHECK_RESULT_FILE_PATH": resultFileLocation,
-						"DOCKER_AUTH_CONFIG":                   generateDockerAuthConfig(imageId, params.Config),
+						"DOCKER_AUTH_CONFIG":                   dockerAuthConfigs[imageId],
 					},
 					Artifacts: &pm.JobArtifacts{
 						Paths: []string{resultFileLocation},
 					},
-				})
+				}
+				updateCheckPhase.ApplyTo(&updateCheckJob)
+				pipelineJobs = append(pipelineJobs, &updateCheckJob)
+				updateCheckJobs = append(updateCheckJobs, &updateCheckJob)
+				updateCheckJobsByImage[imageId] = append(updateCheckJobsByImage[imageId], &updateCheckJob)
 			} else {
 				log.Printf("Not generating update check job(s) for image '%s' because update check command is empty\n", imageId)
 			}
+
+			if imageConfig.VulnerabilityUpdateCheck.IsEnabled() {
+				vulnerabilityResultFile := getVulnerabilityUpdateCheckResultFileName(imageId, idx)
+				vulnerabilityUpdateCheckJob := pm.Job{
+					Name:   fmt.Sprintf("🩺 Vulnerability update check %s/%d", imageId, idx),
+					Stage:  &ai1Stage,
+					Image:  scan.GetToolImage(*imageConfig.VulnerabilityUpdateCheck.Tool),
+					Script: []string{fmt.Sprintf("./gipgee update-check perform-vulnerability-update-check %s --location-index %d --result-file-path %s", imageId, idx, vulnerabilityResultFile)},
+					Needs: []pm.JobNeeds{
+						{
+							Job:       &copyGipgeeAsArtifact,
+							Artifacts: true,
+						},
+					},
+					Artifacts: &pm.JobArtifacts{
+						Paths: []string{vulnerabilityResultFile},
+					},
+				}
+				updateCheckPhase.ApplyTo(&vulnerabilityUpdateCheckJob)
+				pipelineJobs = append(pipelineJobs, &vulnerabilityUpdateCheckJob)
+				vulnerabilityUpdateCheckJobs = append(vulnerabilityUpdateCheckJobs, &vulnerabilityUpdateCheckJob)
+				updateCheckJobsByImage[imageId] = append(updateCheckJobsByImage[imageId], &vulnerabilityUpdateCheckJob)
+			}
 		}
 	}
 
 	rebuildPipelineDependencies := make([]pm.JobNeeds, 0)
-	for _, j := range pipelineJobs {
-		rebuildPipelineDependencies = append(rebuildPipelineDependencies, pm.JobNeeds{
-			Job:       j,
-			Artifacts: true,
-		})
+	rebuildPipelineScript := []string{"./gipgee update-check generate-image-rebuild-file"}
+	rebuildPipelineFiles := make([]string, 0)
+	var imageGroups []*config.ImageGroup
+	rebuildPipelineJobName := "🛠️ Generate pipeline for rebuilds"
+	if params.RebuildWorkflow != "" {
+		if params.Config.Sharding != nil {
+			panic("sharding is not supported with a rebuild workflow")
+		}
+		// github actions can't run generated workflows, the selected images are passed to the rebuild workflow
+		for _, j := range pipelineJobs {
+			rebuildPipelineDependencies = append(rebuildPipelineDependencies, pm.JobNeeds{
+				Job:       j,
+				Artifacts: true,
+			})
+		}
+		rebuildPipelineJobName = RebuildSelectionJobName
+		rebuildPipelineScript[0] += " --github-output " + RebuildImagesOutputName
+		rebuildPipelineFiles = append(rebuildPipelineFiles, "gipgee-image-rebuild-file.json")
+	} else if params.Config.Sharding == nil {
+		for _, j := range pipelineJobs {
+			rebuildPipelineDependencies = append(rebuildPipelineDependencies, pm.JobNeeds{
+				Job:       j,
+				Artifacts: true,
+			})
+		}
+		rebuildPipelineScript = append(rebuildPipelineScript, "./gipgee image-build generate-pipeline --image-selection-file=gipgee-image-rebuild-file.json")
+		rebuildPipelineFiles = append(rebuildPipelineFiles, ".gipgee-gitlab-ci.yml")
+	} else {
+		// Gitlab limits the needs per job, so the results are collected per image group first. The rebuild pipelines
+		// of the groups are triggered directly, a parent pipeline of them would exceed gitlab's child pipeline depth.
+		imageGroups = params.Config.ImageGroups()
+		rebuildPipelineDependencies = append(rebuildPipelineDependencies,
+			pm.JobNeeds{Job: &copyGipgeeAsArtifact, Artifacts: true},
+			pm.JobNeeds{Job: &skopeoUpdateCheckJob, Artifacts: true},
+		)
+		// the rebuild pipeline generation needs the two jobs above and the collected results
+		collectedGroups := make([]collectedResults, 0)
+		for _, group := range imageGroups {
+			groupResults := make([]collectedResults, 0)
+			for _, imageId := range group.ImageIds {
+				for _, j := range updateCheckJobsByImage[imageId] {
+					groupResults = append(groupResults, collectedResults{job: j, files: j.Artifacts.Paths})
+				}
+			}
+			collectJobs, collected := collectResults("📦 Collect update check results of image group "+group.Name, groupResults, pm.MaxNeedsPerJob, &ai1Stage)
+			pipelineJobs = append(pipelineJobs, collectJobs...)
+			collectedGroups = append(collectedGroups, collected...)
+			groupPipelineFile := imagebuild.GetImageGroupPipelineFileName(group.Name)
+			rebuildPipelineScript = append(rebuildPipelineScript, fmt.Sprintf("./gipgee image-build generate-group-pipeline '%s' --image-selection-file=gipgee-image-rebuild-file.json --pipeline-file %s", group.Name, groupPipelineFile))
+			rebuildPipelineFiles = append(rebuildPipelineFiles, groupPipelineFile)
+		}
+		// with many groups, the results of the groups are collected again
+		for level := 1; len(collectedGroups) > pm.MaxNeedsPerJob-len(rebuildPipelineDependencies); level++ {
+			collectJobs, collected := collectResults(fmt.Sprintf("📦 Collect update check results of image groups (level %d)", level), collectedGroups, pm.MaxNeedsPerJob, &ai1Stage)
+			pipelineJobs = append(pipelineJobs, collectJobs...)
+			collectedGroups = collected
+		}
+		for _, collected := range collectedGroups {
+			rebuildPipelineDependencies = append(rebuildPipelineDependencies, pm.JobNeeds{Job: collected.job, Artifacts: true})
+		}
 	}
 	generateRebuildPipelineJob := pm.Job{
-		Name:  "🛠️ Generate pipeline for rebuilds",
-		Stage: &ai1Stage,
-		Script: []string{
-			"./gipgee update-check generate-image-rebuild-file",
-			"./gipgee image-build generate-pipeline --image-selection-file=gipgee-image-rebuild-file.json",
-		},
-		Needs: rebuildPipelineDependencies,
+		Name:   rebuildPipelineJobName,
+		Stage:  &ai1Stage,
+		Script: rebuildPipelineScript,
+		Needs:  rebuildPipelineDependencies,
 		Variables: &map[string]interface{}{
-			"GIPGEE_CONFIG_FILE_NAME":                params.ConfigFileName,
 			"GIPGEE_UPDATE_CHECK_SKOPEO_RESULT_PATH": skopeoResultLocation,
 		},
 		Artifacts: &pm.JobArtifacts{
-			Paths: []string{
-				".gipgee-gitlab-ci.yml",
-			},
+			Paths: rebuildPipelineFiles,
 		},
 	}
 
 	pipelineJobs = append(pipelineJobs, &generateRebuildPipelineJob)
 
+	for _, hook := range params.Config.GetHookJobs(config.HookPointPostUpdateCheck) {
+		hookJob := hook.NewJob("🪝 "+*hook.Name, &ai1Stage, nil)
+		// the generated rebuild pipeline tells the hook which images are rebuilt
+		hookJob.Needs = []pm.JobNeeds{{Job: &generateRebuildPipelineJob, Artifacts: true}}
+		pipelineJobs = append(pipelineJobs, hookJob)
+	}
+
+	// The cleanup jobs don't influence the rebuilds, so they are no dependency of the rebuild pipeline generation
+	if params.Config.StagingCleanup != nil {
+		pipelineJobs = append(pipelineJobs, &pm.Job{
+			Name:   "🧹 Clean up staging images",
+			Stage:  &ai1Stage,
+			Script: []string{"gipgee staging cleanup"},
+			Variables: &map[string]interface{}{
+				"GIT_DEPTH": "0", // the deleteMerged policy needs the default branch history
+			},
+		})
+	}
+
+	if params.Config.HasRetention() {
+		pipelineJobs = append(pipelineJobs, &pm.Job{
+			Name:   "🗑️ Apply release tag retention",
+			Stage:  &ai1Stage,
+			Script: []string{"gipgee retention apply"},
+		})
+	}
+
 	if params.SkipRebuild {
 		log.Println("Skip rebuild activated, not generating trigger job which starts the rebuild pipeline.")
+	} else if params.RebuildWorkflow != "" {
+		pipelineJobs = append(pipelineJobs, &pm.Job{
+			Name:  RebuildTriggerJobName,
+			Stage: &ai1Stage,
+			Trigger: &pm.JobTrigger{
+				Include: []pm.JobTriggerInclude{{Local: params.RebuildWorkflow}},
+			},
+			Needs: []pm.JobNeeds{{Job: &generateRebuildPipelineJob}},
+			Variables: &map[string]interface{}{
+				RebuildImagesVarName: fmt.Sprintf("${{ needs.%s.outputs.%s }}", pm.GithubActionsJobId(RebuildSelectionJobName), RebuildImagesOutputName),
+			},
+		})
+	} else if imageGroups != nil {
+		for _, group := range imageGroups {
+			pipelineJobs = append(pipelineJobs, &pm.Job{
+				Name:  "🛫 Trigger rebuild pipeline of image group " + group.Name,
+				Stage: &ai1Stage,
+				Trigger: &pm.JobTrigger{
+					Include: []pm.JobTriggerInclude{{
+						Artifact: imagebuild.GetImageGroupPipelineFileName(group.Name),
+						Job:      &generateRebuildPipelineJob,
+					}},
+					Strategy: "depend",
+				},
+				Needs: []pm.JobNeeds{
+					{
+						Job:       &generateRebuildPipelineJob,
+						Artifacts: true,
+					},
+				},
+			})
+		}
 	} else {
 		triggerJob := pm.Job{
-			Name:  "🛫 Trigger rebuild pipeline",
+			Name:  RebuildTriggerJobName,
 			Stage: &ai1Stage,
 			Trigger: &pm.JobTrigger{
 				Include: []pm.JobTriggerInclude{{
@@ -175,15 +326,80 @@ func GeneratePipeline(params PipelineParams) *pm.Pipeline {
 		pipelineJobs = append(pipelineJobs, &triggerJob)
 	}
 
+	// The templates are inserted last, the rebuild pipeline generation must not need them
+	templates := make([]*pm.Job, 0)
+	if template := pm.ExtractTemplate(".gipgee-update-check", updateCheckJobs); template != nil {
+		templates = append(templates, template)
+	}
+	if template := pm.ExtractTemplate(".gipgee-vulnerability-update-check", vulnerabilityUpdateCheckJobs); template != nil {
+		templates = append(templates, template)
+	}
+	pipelineJobs = append(pipelineJobs[:templateIndex], append(templates, pipelineJobs[templateIndex:]...)...)
+
 	pipeline := pm.Pipeline{
-		Stages:    []*pm.Stage{&ai1Stage},
-		Jobs:      pipelineJobs,
-		Variables: map[string]interface{}{},
+		Default: &pm.PipelineDefault{Image: gipgeeImage},
+		Stages:  []*pm.Stage{&ai1Stage},
+		Jobs:    pipelineJobs,
+		Variables: map[string]interface{}{
+			"GIPGEE_CONFIG_FILE_NAME": params.ConfigFileName,
+		},
 	}
 	return &pipeline
 }
 
-func generateDockerAuthConfig(imageId string, cfg *config.Config) string {
+// collectedResults is a job and the update check result files it passes on as artifacts.
+type collectedResults struct {
+	job   *pm.Job
+	files []string
+}
+
+// collectResults generates the jobs which collect the result files of the given jobs, each of them needs at most
+// maxNeeds jobs. The name is numbered if more than one job is needed.
+func collectResults(name string, results []collectedResults, maxNeeds int, stage *pm.Stage) ([]*pm.Job, []collectedResults) {
+	jobs := make([]*pm.Job, 0)
+	collected := make([]collectedResults, 0)
+	chunks := (len(results) + maxNeeds - 1) / maxNeeds
+	for chunk := 0; chunk < chunks; chunk++ {
+		end := (chunk + 1) * maxNeeds
+		if end > len(results) {
+			end = len(results)
+		}
+		needs := make([]pm.JobNeeds, 0)
+		files := make([]string, 0)
+		for _, result := range results[chunk*maxNeeds : end] {
+			needs = append(needs, pm.JobNeeds{Job: result.job, Artifacts: true})
+			files = append(files, result.files...)
+		}
+		jobName := name
+		if chunks > 1 {
+			jobName = fmt.Sprintf("%s %d/%d", name, chunk+1, chunks)
+		}
+		job := &pm.Job{
+			Name:   jobName,
+			Stage:  stage,
+			Script: []string{fmt.Sprintf(`echo "Collected %d update check results"`, len(files))},
+			Needs:  needs,
+			Artifacts: &pm.JobArtifacts{
+				Paths: files,
+			},
+		}
+		jobs = append(jobs, job)
+		collected = append(collected, collectedResults{job: job, files: files})
+	}
+	return jobs, collected
+}
+
+// generateDockerAuthConfigs returns the DOCKER_AUTH_CONFIG of the update check jobs of each image. Each image only
+// gets the credentials of its own release locations, the templates only share the configs all images have in common.
+func generateDockerAuthConfigs(imageIds []string, cfg *config.Config) map[string]string {
+	dockerAuthConfigs := make(map[string]string, len(imageIds))
+	for _, imageId := range imageIds {
+		dockerAuthConfigs[imageId] = generateDockerAuthConfig(imageId, cfg).ToJsonString()
+	}
+	return dockerAuthConfigs
+}
+
+func generateDockerAuthConfig(imageId string, cfg *config.Config) *docker.DockerAuths {
 	env, exists := os.LookupEnv("DOCKER_AUTH_CONFIG")
 	dockerAuthConfig := &docker.DockerAuths{Auths: make(map[string]docker.DockerAuth)}
 	if exists {
@@ -206,5 +422,5 @@ func generateDockerAuthConfig(imageId string, cfg *config.Config) string {
 			dockerAuthConfig.Auths[*releaseLocation.Registry] = up.ToDockerAuth()
 		}
 	}
-	return dockerAuthConfig.ToJsonString()
+	return dockerAuthConfig
 }
@@ -0,0 +1,190 @@
+package updatecheck
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/docker"
+	pm "github.com/devfbe/gipgee/pipelinemodel"
+	"github.com/google/go-cmp/cmp"
+)
+
+var updateGoldenFiles = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestUpdateCheckPipelineGolden(t *testing.T) {
+	if value, exists := os.LookupEnv("DOCKER_AUTH_CONFIG"); exists {
+		os.Unsetenv("DOCKER_AUTH_CONFIG")
+		t.Cleanup(func() { os.Setenv("DOCKER_AUTH_CONFIG", value) })
+	}
+	t.Setenv("FOO", "staging-user")
+	t.Setenv("BAR", "staging-password")
+	cfg, err := config.LoadConfiguration("../config/testconfig.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := PipelineParams{
+		GipgeeImage:    "registry.example.com/gipgee:1.0.0",
+		Config:         cfg,
+		ConfigFileName: "gipgee.yml",
+	}
+	rendered, err := GeneratePipeline(params).Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the images are a map in the config, a second generation must render exactly the same pipeline
+	if second, _ := GeneratePipeline(params).Render(); rendered != second {
+		t.Errorf("rendering is not deterministic:\n%s", cmp.Diff(rendered, second))
+	}
+
+	goldenPath := filepath.Join("testdata", "update-check-pipeline.yml")
+	if *updateGoldenFiles {
+		if err := os.WriteFile(goldenPath, []byte(rendered), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(expected), rendered); diff != "" {
+		t.Errorf("rendered pipeline doesn't match %s (run the tests with -update to accept the changes):\n%s", goldenPath, diff)
+	}
+	parsed, err := pm.ParsePipeline([]byte(rendered))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reRendered, _ := parsed.Render(); reRendered != rendered {
+		t.Errorf("parsed pipeline renders differently:\n%s", cmp.Diff(rendered, reRendered))
+	}
+}
+
+func TestShardedUpdateCheckPipeline(t *testing.T) {
+	t.Setenv("FOO", "staging-user")
+	t.Setenv("BAR", "staging-password")
+	cfg, err := config.LoadConfiguration("../config/testconfig.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Sharding = &config.Sharding{GroupSize: &[]int{2}[0], GroupBy: &[]string{config.GroupByNone}[0]}
+	pipeline := GeneratePipeline(PipelineParams{Config: cfg, ConfigFileName: "gipgee.yml"})
+	jobs := make(map[string]*pm.Job)
+	for _, job := range pipeline.Jobs {
+		jobs[job.Name] = job
+	}
+	generateJob := jobs["🛠️ Generate pipeline for rebuilds"]
+	expectedNeeds := []string{"Copy gipgee to artifacts", "🛃 Skopeo update check", "📦 Collect update check results of image group group+1", "📦 Collect update check results of image group group+2"}
+	needs := make([]string, 0)
+	for _, need := range generateJob.Needs {
+		needs = append(needs, need.Job.Name)
+	}
+	if diff := cmp.Diff(expectedNeeds, needs); diff != "" {
+		t.Errorf("the rebuild pipeline generation should only need the collect jobs:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{".gipgee-gitlab-ci-group+1.yml", ".gipgee-gitlab-ci-group+2.yml"}, generateJob.Artifacts.Paths); diff != "" {
+		t.Errorf("unexpected rebuild pipeline files:\n%s", diff)
+	}
+	for _, group := range []string{"group+1", "group+2"} {
+		if trigger := jobs["🛫 Trigger rebuild pipeline of image group "+group]; trigger == nil || trigger.Trigger.Include[0].Artifact != ".gipgee-gitlab-ci-"+group+".yml" {
+			t.Errorf("trigger job of image group %s is missing or includes the wrong pipeline", group)
+		}
+	}
+	if _, exists := jobs["🛫 Trigger rebuild pipeline"]; exists {
+		t.Error("sharded update check pipeline must not trigger a single rebuild pipeline")
+	}
+	if _, err := pipeline.Render(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShardedUpdateCheckPipelineWithManyJobs(t *testing.T) {
+	t.Setenv("FOO", "staging-user")
+	t.Setenv("BAR", "staging-password")
+	cfg, err := config.LoadConfiguration("../config/testconfig.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := cfg.Images[cfg.ImageIds()[0]]
+	cfg.Images = make(map[string]*config.Image)
+	for idx := 0; idx < 60; idx++ {
+		image := *template
+		image.Id = fmt.Sprintf("image-%02d", idx)
+		// two update check jobs per image
+		image.ReleaseLocations = []*config.ImageLocation{template.ReleaseLocations[0], template.ReleaseLocations[0]}
+		cfg.Images[image.Id] = &image
+	}
+
+	for _, groupSize := range []int{60, 1} {
+		cfg.Sharding = &config.Sharding{GroupSize: &groupSize, GroupBy: &[]string{config.GroupByNone}[0]}
+		pipeline := GeneratePipeline(PipelineParams{Config: cfg, ConfigFileName: "gipgee.yml"})
+		if _, err := pipeline.Render(); err != nil {
+			t.Fatalf("group size %d: %v", groupSize, err)
+		}
+		collectedFiles := 0
+		for _, job := range pipeline.Jobs {
+			if strings.HasPrefix(job.Name, "📦 Collect update check results of image group ") {
+				collectedFiles += len(job.Artifacts.Paths)
+			}
+		}
+		if collectedFiles != 120 {
+			t.Errorf("group size %d: collect jobs of the image groups pass on %d instead of 120 result files", groupSize, collectedFiles)
+		}
+	}
+}
+
+func TestUpdateCheckJobsOnlyGetTheCredentialsOfTheirImage(t *testing.T) {
+	if value, exists := os.LookupEnv("DOCKER_AUTH_CONFIG"); exists {
+		os.Unsetenv("DOCKER_AUTH_CONFIG")
+		t.Cleanup(func() { os.Setenv("DOCKER_AUTH_CONFIG", value) })
+	}
+	t.Setenv("FOO", "staging-user")
+	t.Setenv("BAR", "staging-password")
+	cfg, err := config.LoadConfiguration("../config/testconfig.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := GeneratePipeline(PipelineParams{Config: cfg, ConfigFileName: "gipgee.yml"})
+	jobs := make(map[string]*pm.Job)
+	for _, job := range pipeline.Jobs {
+		jobs[job.Name] = job
+	}
+	for _, imageId := range cfg.ImageIds() {
+		allowed := make([]string, 0)
+		for _, location := range cfg.Images[imageId].ReleaseLocations {
+			if location.Credentials != nil {
+				allowed = append(allowed, *location.Registry)
+			}
+		}
+		for idx := range cfg.Images[imageId].ReleaseLocations {
+			job := jobs[fmt.Sprintf("🛂 Update check %s/%d", imageId, idx)]
+			if job == nil {
+				continue
+			}
+			authConfig, exists := (*job.Variables)["DOCKER_AUTH_CONFIG"]
+			for _, extended := range job.Extends {
+				if template := jobs[extended]; !exists && template.Variables != nil {
+					authConfig, exists = (*template.Variables)["DOCKER_AUTH_CONFIG"]
+				}
+			}
+			auths := docker.DockerAuths{}
+			if err := json.Unmarshal([]byte(authConfig.(string)), &auths); err != nil {
+				t.Fatal(err)
+			}
+			registries := make([]string, 0)
+			for registry := range auths.Auths {
+				registries = append(registries, registry)
+			}
+			sort.Strings(registries)
+			sort.Strings(allowed)
+			if diff := cmp.Diff(allowed, registries); diff != "" {
+				t.Errorf("update check job '%s' gets the wrong credentials:\n%s", job.Name, diff)
+			}
+		}
+	}
+}
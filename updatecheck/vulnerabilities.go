@@ -0,0 +1,96 @@
+package updatecheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	cfg "github.com/devfbe/gipgee/config"
+	"github.com/devfbe/gipgee/scan"
+)
+
+type PerformVulnerabilityUpdateCheckCmd struct {
+	ImageId        string `arg:""`
+	LocationIndex  int    `help:"Index of the release location to scan" required:""`
+	ConfigFileName string `help:"Set the name of the gipgee config file" env:"GIPGEE_CONFIG_FILE_NAME" default:"gipgee.yml"`
+	ResultFilePath string `help:"Write the result to this file" required:""`
+}
+
+func (*PerformVulnerabilityUpdateCheckCmd) Help() string {
+	return "Scans a release image and checks if it contains fixable vulnerabilities that justify a rebuild"
+}
+
+// vulnerabilityUpdateCheckResult is written by the vulnerability update check job and
+// read by the rebuild file generation.
+type vulnerabilityUpdateCheckResult struct {
+	RebuildNeeded bool     `json:"rebuildNeeded"`
+	Findings      []string `json:"findings"`
+}
+
+func describeFinding(finding scan.Finding) string {
+	return fmt.Sprintf("%s (%s, %s %s -> %s)", finding.Id, finding.Severity, finding.PackageName, finding.InstalledVersion, finding.FixedVersion)
+}
+
+func (cmd *PerformVulnerabilityUpdateCheckCmd) Run() error {
+	config, err := cfg.LoadConfiguration(cmd.ConfigFileName)
+	if err != nil {
+		return err
+	}
+	imageConfig, exists := config.Images[cmd.ImageId]
+	if !exists {
+		return fmt.Errorf("image with id '%s' does not exist in the configuration", cmd.ImageId)
+	}
+	policy := imageConfig.VulnerabilityUpdateCheck
+	if !policy.IsEnabled() {
+		return fmt.Errorf("vulnerability update check is not enabled for image '%s'", cmd.ImageId)
+	}
+	if cmd.LocationIndex < 0 || cmd.LocationIndex >= len(imageConfig.ReleaseLocations) {
+		return fmt.Errorf("image '%s' has no release location with index %d", cmd.ImageId, cmd.LocationIndex)
+	}
+	location := imageConfig.ReleaseLocations[cmd.LocationIndex]
+	if location.Tag == nil {
+		return fmt.Errorf("release location %d of image '%s' has no tag that could be checked", cmd.LocationIndex, cmd.ImageId)
+	}
+
+	scanResult, err := scan.ScanImage(config, *policy.Tool, location.String(), location)
+	if err != nil {
+		return err
+	}
+	evaluation := scan.Evaluate(scanResult, policy, time.Now())
+	scan.LogFindings("Ignored:", evaluation.Ignored)
+	scan.LogFindings("Fixable:", evaluation.Blocking)
+
+	result := vulnerabilityUpdateCheckResult{
+		RebuildNeeded: len(evaluation.Blocking) > 0,
+		Findings:      make([]string, 0, len(evaluation.Blocking)),
+	}
+	for _, finding := range evaluation.Blocking {
+		result.Findings = append(result.Findings, describeFinding(finding))
+	}
+	if result.RebuildNeeded {
+		log.Printf("Release location '%s' contains %d fixable vulnerabilities with severity >= %s, rebuild needed\n", location.String(), len(evaluation.Blocking), *policy.Severity)
+	} else {
+		log.Printf("Release location '%s' contains no fixable vulnerabilities with severity >= %s\n", location.String(), *policy.Severity)
+	}
+
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cmd.ResultFilePath, resultJson, 0600)
+}
+
+func loadVulnerabilityUpdateCheckResult(path string) (*vulnerabilityUpdateCheckResult, error) {
+	bytes, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	result := vulnerabilityUpdateCheckResult{}
+	err = json.Unmarshal(bytes, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}